@@ -0,0 +1,181 @@
+package database
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/doug-martin/goqu/v9"
+
+	"stark/failure"
+)
+
+const (
+	TotalNone        = "none"
+	TotalExact       = "exact"
+	TotalApproximate = "approximate"
+)
+
+// Cursor is the keyset position of a row ordered by created_at and id, a
+// backward cursor reads the rows before it instead of after it.
+type Cursor struct {
+	CreatedAt time.Time `json:"c"`
+	ID        string    `json:"i"`
+	Backward  bool      `json:"b,omitempty"`
+}
+
+func NextCursor(createdAt time.Time, id string) string {
+	return Cursor{CreatedAt: createdAt, ID: id}.Encode()
+}
+
+func PrevCursor(createdAt time.Time, id string) string {
+	return Cursor{CreatedAt: createdAt, ID: id, Backward: true}.Encode()
+}
+
+// DecodeCursor returns nil for an empty value, that is the first page
+func DecodeCursor(value string) (*Cursor, error) {
+	if value == "" {
+		return nil, nil
+	}
+
+	data, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, errors.New("cursor is not base64")
+	}
+
+	var cursor Cursor
+	err = json.Unmarshal(data, &cursor)
+	if err != nil || cursor.ID == "" {
+		return nil, errors.New("cursor is malformed")
+	}
+
+	return &cursor, nil
+}
+
+func (c Cursor) Encode() string {
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// Paginate narrows the dataset down to limit rows after the cursor ordered by
+// created_at and id, a backward cursor returns the rows before it in
+// descending order. The id breaks ties between rows created at the same time.
+func (c *Cursor) Paginate(dataset *goqu.SelectDataset, limit int) *goqu.SelectDataset {
+	createdAt, id := goqu.C("created_at"), goqu.C("id")
+	dataset = dataset.Limit(uint(limit))
+	if c == nil {
+		return dataset.Order(createdAt.Asc(), id.Asc())
+	}
+
+	if c.Backward {
+		return dataset.Where(goqu.Or(
+			createdAt.Lt(c.CreatedAt),
+			goqu.And(createdAt.Eq(c.CreatedAt), id.Lt(c.ID)),
+		)).Order(createdAt.Desc(), id.Desc())
+	}
+
+	return dataset.Where(goqu.Or(
+		createdAt.Gt(c.CreatedAt),
+		goqu.And(createdAt.Eq(c.CreatedAt), id.Gt(c.ID)),
+	)).Order(createdAt.Asc(), id.Asc())
+}
+
+// HasNext reports whether rows follow the page read with the cursor, hasMore
+// tells that the read found more rows than the page holds.
+func (c *Cursor) HasNext(hasMore bool) bool {
+	if c != nil && c.Backward {
+		return true
+	}
+
+	return hasMore
+}
+
+// HasPrev reports whether rows precede the page read with the cursor
+func (c *Cursor) HasPrev(hasMore bool) bool {
+	if c == nil {
+		return false
+	}
+
+	if c.Backward {
+		return hasMore
+	}
+
+	return true
+}
+
+func (c *Cursor) IsBackward() bool {
+	return c != nil && c.Backward
+}
+
+// CursorPage is a page of rows read with ReadCursorPage
+type CursorPage[T any] struct {
+	Items      []T    `json:"items"`
+	NextCursor string `json:"next_cursor"`
+	PrevCursor string `json:"prev_cursor"`
+	Total      *int   `json:"total,omitempty"`
+}
+
+// ReadCursorPage reads up to limit rows after the cursor with read and links
+// the pages around them through the position key returns for a row. The total
+// is counted with count when it is exact and with approx when approximate.
+func ReadCursorPage[T any](
+	cursor string,
+	limit int,
+	total string,
+	read func(*Cursor, int) ([]T, error),
+	key func(T) (time.Time, string),
+	count, approx func() (int, error),
+) (CursorPage[T], error) {
+	current, err := DecodeCursor(cursor)
+	if err != nil {
+		return CursorPage[T]{}, failure.WithMessage(failure.CodeInvalidCursor, err.Error())
+	}
+
+	// One extra row tells whether another page follows
+	items, err := read(current, limit+1)
+	if err != nil {
+		return CursorPage[T]{}, err
+	}
+
+	hasMore := len(items) > limit
+	if hasMore {
+		items = items[:limit]
+	}
+
+	if current.IsBackward() {
+		for i, j := 0, len(items)-1; i < j; i, j = i+1, j-1 {
+			items[i], items[j] = items[j], items[i]
+		}
+	}
+
+	page := CursorPage[T]{Items: items}
+	if len(items) != 0 {
+		if current.HasNext(hasMore) {
+			page.NextCursor = NextCursor(key(items[len(items)-1]))
+		}
+
+		if current.HasPrev(hasMore) {
+			page.PrevCursor = PrevCursor(key(items[0]))
+		}
+	}
+
+	var counter func() (int, error)
+	switch total {
+	case TotalExact:
+		counter = count
+	case TotalApproximate:
+		counter = approx
+	}
+
+	if counter != nil {
+		count, err := counter()
+		if err != nil {
+			return CursorPage[T]{}, err
+		}
+
+		page.Total = &count
+	}
+
+	return page, nil
+}
@@ -0,0 +1,97 @@
+package database
+
+import (
+	"strings"
+	"time"
+
+	"github.com/doug-martin/goqu/v9"
+	"github.com/doug-martin/goqu/v9/exp"
+)
+
+const (
+	SortAsc  = "asc"
+	SortDesc = "desc"
+)
+
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// TimeRange matches a timestamp column from From (inclusive) until To
+// (exclusive), either end may be left open.
+type TimeRange struct {
+	From *time.Time `json:"from"`
+	To   *time.Time `json:"to"`
+}
+
+func (r *TimeRange) Expression(column string) exp.ExpressionList {
+	list := exp.NewExpressionList(exp.AndType)
+	if r == nil {
+		return list
+	}
+
+	if r.From != nil {
+		list = list.Append(goqu.C(column).Gte(*r.From))
+	}
+
+	if r.To != nil {
+		list = list.Append(goqu.C(column).Lt(*r.To))
+	}
+
+	return list
+}
+
+// TextMatch matches a text column by prefix and by substring ignoring case,
+// LIKE wildcards in the input are matched literally.
+type TextMatch struct {
+	Prefix   string `json:"prefix"`
+	Contains string `json:"contains"`
+}
+
+func (m *TextMatch) Expression(column string) exp.ExpressionList {
+	list := exp.NewExpressionList(exp.AndType)
+	if m == nil {
+		return list
+	}
+
+	if m.Prefix != "" {
+		list = list.Append(goqu.C(column).ILike(likeEscaper.Replace(m.Prefix) + "%"))
+	}
+
+	if m.Contains != "" {
+		list = list.Append(goqu.C(column).ILike("%" + likeEscaper.Replace(m.Contains) + "%"))
+	}
+
+	return list
+}
+
+// Combine joins the non-empty expressions with AND or OR, empty ones would
+// render as "()" in the WHERE clause.
+func Combine(kind exp.ExpressionListType, expressions ...exp.Expression) exp.ExpressionList {
+	list := exp.NewExpressionList(kind)
+	for _, expression := range expressions {
+		if item, ok := expression.(exp.ExpressionList); ok && item.IsEmpty() {
+			continue
+		}
+
+		list = list.Append(expression)
+	}
+
+	return list
+}
+
+// Not negates an expression list, an empty list stays empty
+func Not(list exp.ExpressionList) exp.ExpressionList {
+	if list.IsEmpty() {
+		return list
+	}
+
+	return exp.NewExpressionList(exp.AndType, goqu.L("NOT ?", list))
+}
+
+// Order sorts by the column, descending only when asked to
+func Order(column, direction string) exp.OrderedExpression {
+	if direction == SortDesc {
+		return goqu.C(column).Desc()
+	}
+
+	return goqu.C(column).Asc()
+}
@@ -16,8 +16,8 @@ import (
 	"github.com/palantir/stacktrace"
 )
 
-const INIT_STEP = 7
-const APP_SCHEMA_VERSION = 7
+const INIT_STEP = 34
+const APP_SCHEMA_VERSION = 34
 
 var seeds = []string{
 	"user",
@@ -0,0 +1 @@
+ALTER TABLE users ADD COLUMN deleted_at TIMESTAMP NULL DEFAULT NULL COMMENT 'Deleted At' AFTER email_verified_at;
\ No newline at end of file
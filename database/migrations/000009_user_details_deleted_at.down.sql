@@ -0,0 +1 @@
+ALTER TABLE user_details DROP COLUMN deleted_at;
\ No newline at end of file
@@ -0,0 +1 @@
+ALTER TABLE user_details ADD COLUMN deleted_at TIMESTAMP NULL DEFAULT NULL COMMENT 'Deleted At' AFTER id_card_path;
\ No newline at end of file
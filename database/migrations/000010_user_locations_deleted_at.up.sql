@@ -0,0 +1 @@
+ALTER TABLE user_locations ADD COLUMN deleted_at TIMESTAMP NULL DEFAULT NULL COMMENT 'Deleted At' AFTER village_id;
\ No newline at end of file
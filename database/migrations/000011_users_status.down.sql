@@ -0,0 +1,4 @@
+ALTER TABLE users
+    DROP COLUMN status,
+    DROP COLUMN status_reason,
+    DROP COLUMN status_until;
@@ -0,0 +1,4 @@
+ALTER TABLE users
+    ADD COLUMN status VARCHAR(25) DEFAULT 'active' NOT NULL COMMENT 'Status' AFTER password,
+    ADD COLUMN status_reason VARCHAR(255) DEFAULT '' NOT NULL COMMENT 'Status Reason' AFTER status,
+    ADD COLUMN status_until TIMESTAMP NULL DEFAULT NULL COMMENT 'Status Until' AFTER status_reason;
@@ -0,0 +1 @@
+ALTER TABLE users ADD COLUMN must_change_password TINYINT(1) DEFAULT 0 NOT NULL COMMENT 'Must Change Password' AFTER password;
\ No newline at end of file
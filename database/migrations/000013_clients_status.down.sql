@@ -0,0 +1,3 @@
+ALTER TABLE clients
+    DROP COLUMN status,
+    DROP COLUMN deleted_at;
\ No newline at end of file
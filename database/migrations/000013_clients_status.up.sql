@@ -0,0 +1,3 @@
+ALTER TABLE clients
+    ADD COLUMN status VARCHAR(25) DEFAULT 'enabled' NOT NULL COMMENT 'Status' AFTER bearer_key,
+    ADD COLUMN deleted_at TIMESTAMP NULL DEFAULT NULL COMMENT 'Deleted At' AFTER updated_at;
\ No newline at end of file
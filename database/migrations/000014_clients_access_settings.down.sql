@@ -0,0 +1,4 @@
+ALTER TABLE clients
+    DROP COLUMN allowed_origins,
+    DROP COLUMN redirect_uris,
+    DROP COLUMN allowed_cidrs;
\ No newline at end of file
@@ -0,0 +1,4 @@
+ALTER TABLE clients
+    ADD COLUMN allowed_origins TEXT NULL COMMENT 'Allowed Origins' AFTER status,
+    ADD COLUMN redirect_uris TEXT NULL COMMENT 'Redirect URIs' AFTER allowed_origins,
+    ADD COLUMN allowed_cidrs TEXT NULL COMMENT 'Allowed CIDRs' AFTER redirect_uris;
\ No newline at end of file
@@ -0,0 +1,3 @@
+ALTER TABLE clients
+    DROP COLUMN signing_secret,
+    DROP COLUMN require_signature;
\ No newline at end of file
@@ -0,0 +1,3 @@
+ALTER TABLE clients
+    ADD COLUMN signing_secret VARCHAR(255) DEFAULT '' NOT NULL COMMENT 'Signing Secret' AFTER bearer_key,
+    ADD COLUMN require_signature TINYINT(1) DEFAULT 0 NOT NULL COMMENT 'Require Signature' AFTER signing_secret;
\ No newline at end of file
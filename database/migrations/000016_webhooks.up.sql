@@ -0,0 +1,12 @@
+CREATE TABLE IF NOT EXISTS webhooks
+(
+    id CHAR(36) PRIMARY KEY COMMENT 'Identifier',
+    client_id CHAR(36) NOT NULL COMMENT 'Client ID',
+    url VARCHAR(255) NOT NULL COMMENT 'URL',
+    events TEXT NULL COMMENT 'Events',
+    secret VARCHAR(255) NOT NULL COMMENT 'Secret',
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP NOT NULL COMMENT 'Created At',
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP NOT NULL ON UPDATE CURRENT_TIMESTAMP COMMENT 'Updated At',
+    INDEX webhooks_client_id_index (client_id),
+    CONSTRAINT webhook_client_fk FOREIGN KEY (client_id) REFERENCES clients (id) ON DELETE CASCADE
+) COMMENT 'Webhooks' CHARSET=utf8;
@@ -0,0 +1,17 @@
+CREATE TABLE IF NOT EXISTS webhook_deliveries
+(
+    id CHAR(36) PRIMARY KEY COMMENT 'Identifier',
+    webhook_id CHAR(36) NOT NULL COMMENT 'Webhook ID',
+    client_id CHAR(36) NOT NULL COMMENT 'Client ID',
+    event VARCHAR(50) NOT NULL COMMENT 'Event',
+    payload MEDIUMTEXT NOT NULL COMMENT 'Payload',
+    status VARCHAR(25) DEFAULT 'pending' NOT NULL COMMENT 'Status',
+    attempts INT DEFAULT 0 NOT NULL COMMENT 'Attempts',
+    next_attempt_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP NOT NULL COMMENT 'Next Attempt At',
+    last_status_code INT DEFAULT 0 NOT NULL COMMENT 'Last Status Code',
+    last_error VARCHAR(255) DEFAULT '' NOT NULL COMMENT 'Last Error',
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP NOT NULL COMMENT 'Created At',
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP NOT NULL ON UPDATE CURRENT_TIMESTAMP COMMENT 'Updated At',
+    INDEX webhook_deliveries_status_index (status, next_attempt_at),
+    INDEX webhook_deliveries_client_id_index (client_id, created_at)
+) COMMENT 'Webhook Deliveries' CHARSET=utf8;
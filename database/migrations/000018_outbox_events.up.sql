@@ -0,0 +1,13 @@
+CREATE TABLE IF NOT EXISTS outbox_events
+(
+    id CHAR(36) PRIMARY KEY COMMENT 'Identifier',
+    aggregate_type VARCHAR(50) NOT NULL COMMENT 'Aggregate Type',
+    aggregate_id CHAR(36) NOT NULL COMMENT 'Aggregate ID',
+    type VARCHAR(50) NOT NULL COMMENT 'Type',
+    payload MEDIUMTEXT NOT NULL COMMENT 'Payload',
+    attempts INT DEFAULT 0 NOT NULL COMMENT 'Attempts',
+    last_error VARCHAR(255) DEFAULT '' NOT NULL COMMENT 'Last Error',
+    created_at TIMESTAMP(6) DEFAULT CURRENT_TIMESTAMP(6) NOT NULL COMMENT 'Created At',
+    published_at TIMESTAMP NULL DEFAULT NULL COMMENT 'Published At',
+    INDEX outbox_events_published_at_index (published_at, created_at)
+) COMMENT 'Outbox Events' CHARSET=utf8;
@@ -0,0 +1,2 @@
+ALTER TABLE users
+    ADD COLUMN version INT UNSIGNED DEFAULT 1 NOT NULL COMMENT 'Version' AFTER updated_at;
\ No newline at end of file
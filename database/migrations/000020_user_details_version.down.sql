@@ -0,0 +1,2 @@
+ALTER TABLE user_details
+    DROP COLUMN version;
\ No newline at end of file
@@ -0,0 +1,2 @@
+ALTER TABLE user_locations
+    DROP COLUMN version;
\ No newline at end of file
@@ -0,0 +1,2 @@
+ALTER TABLE clients
+    DROP COLUMN version;
\ No newline at end of file
@@ -0,0 +1 @@
+CREATE INDEX users_updated_at_index ON users (updated_at);
\ No newline at end of file
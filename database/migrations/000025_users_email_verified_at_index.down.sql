@@ -0,0 +1 @@
+DROP INDEX users_email_verified_at_index ON users;
\ No newline at end of file
@@ -0,0 +1 @@
+CREATE INDEX users_email_verified_at_index ON users (email_verified_at);
\ No newline at end of file
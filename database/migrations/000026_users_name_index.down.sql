@@ -0,0 +1 @@
+DROP INDEX users_name_index ON users;
\ No newline at end of file
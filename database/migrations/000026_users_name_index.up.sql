@@ -0,0 +1 @@
+CREATE INDEX users_name_index ON users (name);
\ No newline at end of file
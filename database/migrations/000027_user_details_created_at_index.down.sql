@@ -0,0 +1 @@
+DROP INDEX user_details_created_at_index ON user_details;
\ No newline at end of file
@@ -0,0 +1 @@
+CREATE INDEX user_details_created_at_index ON user_details (created_at);
\ No newline at end of file
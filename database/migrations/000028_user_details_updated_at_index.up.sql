@@ -0,0 +1 @@
+CREATE INDEX user_details_updated_at_index ON user_details (updated_at);
\ No newline at end of file
@@ -0,0 +1 @@
+DROP INDEX user_locations_created_at_index ON user_locations;
\ No newline at end of file
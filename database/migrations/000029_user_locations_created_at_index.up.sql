@@ -0,0 +1 @@
+CREATE INDEX user_locations_created_at_index ON user_locations (created_at);
\ No newline at end of file
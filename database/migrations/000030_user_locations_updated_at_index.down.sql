@@ -0,0 +1 @@
+DROP INDEX user_locations_updated_at_index ON user_locations;
\ No newline at end of file
@@ -0,0 +1 @@
+CREATE INDEX user_locations_updated_at_index ON user_locations (updated_at);
\ No newline at end of file
@@ -0,0 +1 @@
+DROP INDEX clients_created_at_index ON clients;
\ No newline at end of file
@@ -0,0 +1 @@
+CREATE INDEX clients_created_at_index ON clients (created_at);
\ No newline at end of file
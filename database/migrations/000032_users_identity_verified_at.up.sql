@@ -0,0 +1 @@
+ALTER TABLE users ADD COLUMN identity_verified_at TIMESTAMP NULL DEFAULT NULL COMMENT 'Identity Verified At' AFTER email_verified_at;
\ No newline at end of file
@@ -0,0 +1 @@
+DROP TABLE IF EXISTS identity_verifications;
\ No newline at end of file
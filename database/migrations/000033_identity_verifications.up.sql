@@ -0,0 +1,18 @@
+CREATE TABLE IF NOT EXISTS identity_verifications
+(
+    id CHAR(36) PRIMARY KEY COMMENT 'Identifier',
+    user_id CHAR(36) NOT NULL COMMENT 'User ID',
+    id_card_number VARCHAR(16) NOT NULL COMMENT 'ID Card Number',
+    id_card_path VARCHAR(255) NOT NULL COMMENT 'ID Card Path',
+    selfie_path VARCHAR(255) NOT NULL COMMENT 'Selfie Path',
+    status VARCHAR(25) DEFAULT 'submitted' NOT NULL COMMENT 'Status',
+    reviewer VARCHAR(100) DEFAULT '' NOT NULL COMMENT 'Reviewer',
+    reviewer_note VARCHAR(500) DEFAULT '' NOT NULL COMMENT 'Reviewer Note',
+    reviewed_at TIMESTAMP NULL DEFAULT NULL COMMENT 'Reviewed At',
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP NOT NULL COMMENT 'Created At',
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP NOT NULL ON UPDATE CURRENT_TIMESTAMP COMMENT 'Updated At',
+    version INT UNSIGNED DEFAULT 1 NOT NULL COMMENT 'Version',
+    INDEX identity_verifications_user_id_index (user_id, created_at),
+    INDEX identity_verifications_status_index (status, created_at),
+    CONSTRAINT identity_verification_user_fk FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+) COMMENT 'Identity Verifications' CHARSET=utf8;
\ No newline at end of file
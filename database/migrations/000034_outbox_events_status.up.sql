@@ -0,0 +1,2 @@
+ALTER TABLE outbox_events
+    ADD COLUMN status VARCHAR(25) DEFAULT 'pending' NOT NULL COMMENT 'Status' AFTER payload;
\ No newline at end of file
@@ -1,6 +1,7 @@
 package database
 
 import (
+	"errors"
 	"fmt"
 	"os"
 	"stark/utils/activity"
@@ -12,8 +13,14 @@ import (
 
 type Block func(tx *sqlx.Tx) (result interface{}, err error)
 
+// ErrVersionConflict is returned by an update guarded by the row version when
+// another write has bumped the version since the row was read.
+var ErrVersionConflict = errors.New("row version conflict")
+
 type MySQL struct {
 	db *sqlx.DB
+	// tx is set on a MySQL joined to a unit of work, see Join
+	tx *sqlx.Tx
 }
 
 func NewMySQL() (*MySQL, error) {
@@ -41,10 +48,21 @@ func NewMySQL() (*MySQL, error) {
 		return nil, stacktrace.Propagate(err, "can't ping mysql db")
 	}
 
-	return &MySQL{db}, nil
+	return &MySQL{db: db}, nil
+}
+
+// Join returns a MySQL that runs every query in tx. Its WithTransaction runs
+// the block in tx as well and leaves the commit or rollback to the owner of
+// tx, so repositories built on it write as one unit of work.
+func (m *MySQL) Join(tx *sqlx.Tx) *MySQL {
+	return &MySQL{db: m.db, tx: tx}
 }
 
 func (m *MySQL) WithTransaction(block Block) (interface{}, error) {
+	if m.tx != nil {
+		return block(m.tx)
+	}
+
 	tx, err := m.db.Beginx()
 	if err != nil {
 		return nil, stacktrace.Propagate(err, "can't start mysql DB transaction")
@@ -76,13 +94,45 @@ func (m *MySQL) In(query string, params map[string]interface{}) (string, []inter
 }
 
 func (m *MySQL) Get(dest interface{}, query string, args ...interface{}) error {
-	return m.db.Get(dest, query, args...)
+	return sqlx.Get(m.queryer(), dest, query, args...)
 }
 
 func (m *MySQL) Select(dest interface{}, query string, args ...interface{}) error {
-	return m.db.Select(dest, query, args...)
+	return sqlx.Select(m.queryer(), dest, query, args...)
+}
+
+// Queryx streams the rows of the query instead of loading them all, the
+// caller must close the rows.
+func (m *MySQL) Queryx(query string, args ...interface{}) (*sqlx.Rows, error) {
+	return m.queryer().Queryx(query, args...)
 }
 
 func (m *MySQL) Rebind(query string) string {
 	return m.db.Rebind(query)
 }
+
+// queryer reads through the joined transaction, if any, so a unit of work
+// sees its own writes
+func (m *MySQL) queryer() sqlx.Queryer {
+	if m.tx != nil {
+		return m.tx
+	}
+
+	return m.db
+}
+
+// ApproximateCount reads the row estimate InnoDB keeps for the table, it is
+// cheap but can be off by a large margin and includes soft-deleted rows.
+func (m *MySQL) ApproximateCount(table string) (int, error) {
+	var total int
+	err := m.db.Get(&total, `
+		SELECT COALESCE(TABLE_ROWS, 0) FROM information_schema.TABLES
+		WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = ?
+	`, table)
+
+	if err != nil {
+		return 0, stacktrace.Propagate(err, "can't read approximate count of %s", table)
+	}
+
+	return total, nil
+}
@@ -4,6 +4,7 @@ import (
 	"os"
 	"stark/utils/activity"
 	"stark/utils/log"
+	"strings"
 	"time"
 
 	"github.com/go-redis/redis"
@@ -63,3 +64,113 @@ func (r *Redis) Delete(key string) (int64, error) {
 
 	return deleted, nil
 }
+
+func (r *Redis) SAdd(key string, member string, sub time.Duration) error {
+	err := r.db.SAdd(key, member).Err()
+	if err != nil {
+		return stacktrace.Propagate(err, "can't add member to redis set")
+	}
+
+	err = r.db.Expire(key, sub).Err()
+	if err != nil {
+		return stacktrace.Propagate(err, "can't set expiration of redis set")
+	}
+
+	return nil
+}
+
+func (r *Redis) SMembers(key string) ([]string, error) {
+	members, err := r.db.SMembers(key).Result()
+	if err != nil {
+		return nil, stacktrace.Propagate(err, "can't get members of redis set")
+	}
+
+	return members, nil
+}
+
+func (r *Redis) SRem(key string, member string) error {
+	err := r.db.SRem(key, member).Err()
+	if err != nil {
+		return stacktrace.Propagate(err, "can't remove member from redis set")
+	}
+
+	return nil
+}
+
+func (r *Redis) TTL(key string) (time.Duration, error) {
+	ttl, err := r.db.TTL(key).Result()
+	if err != nil {
+		return 0, stacktrace.Propagate(err, "can't get ttl from redis DB")
+	}
+
+	return ttl, nil
+}
+
+func (r *Redis) SetNX(key string, value string, sub time.Duration) (bool, error) {
+	set, err := r.db.SetNX(key, value, sub).Result()
+	if err != nil {
+		return false, stacktrace.Propagate(err, "can't set if not exists to redis db")
+	}
+
+	return set, nil
+}
+
+func (r *Redis) XAdd(stream string, maxLen int64, values map[string]interface{}) (string, error) {
+	id, err := r.db.XAdd(&redis.XAddArgs{
+		Stream:       stream,
+		MaxLenApprox: maxLen,
+		Values:       values,
+	}).Result()
+
+	if err != nil {
+		return "", stacktrace.Propagate(err, "can't add to redis stream")
+	}
+
+	return id, nil
+}
+
+// XGroupCreate creates the consumer group and the stream if needed, an
+// existing group is not an error.
+func (r *Redis) XGroupCreate(stream, group string) error {
+	err := r.db.XGroupCreateMkStream(stream, group, "0").Err()
+	if err != nil && !strings.HasPrefix(err.Error(), "BUSYGROUP") {
+		return stacktrace.Propagate(err, "can't create redis stream group")
+	}
+
+	return nil
+}
+
+// XReadGroup returns no messages without error when the block timeout passes
+func (r *Redis) XReadGroup(stream, group, consumer, start string, count int64, block time.Duration) ([]redis.XMessage, error) {
+	streams, err := r.db.XReadGroup(&redis.XReadGroupArgs{
+		Group:    group,
+		Consumer: consumer,
+		Streams:  []string{stream, start},
+		Count:    count,
+		Block:    block,
+	}).Result()
+
+	if err == redis.Nil {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, stacktrace.Propagate(err, "can't read redis stream group")
+	}
+
+	messages := make([]redis.XMessage, 0)
+	for _, item := range streams {
+		messages = append(messages, item.Messages...)
+	}
+
+	return messages, nil
+}
+
+func (r *Redis) XAck(stream, group, id string) error {
+	err := r.db.XAck(stream, group, id).Err()
+	if err != nil {
+		return stacktrace.Propagate(err, "can't ack redis stream message")
+	}
+
+	return nil
+}
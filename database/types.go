@@ -0,0 +1,46 @@
+package database
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+)
+
+// StringList is a list of strings kept as a JSON array in a TEXT column, a
+// NULL column reads as an empty list.
+type StringList []string
+
+func (l StringList) Value() (driver.Value, error) {
+	if l == nil {
+		return "[]", nil
+	}
+
+	data, err := json.Marshal([]string(l))
+	if err != nil {
+		return nil, err
+	}
+
+	return string(data), nil
+}
+
+func (l *StringList) Scan(src interface{}) error {
+	var data []byte
+	switch value := src.(type) {
+	case nil:
+		*l = StringList{}
+		return nil
+	case []byte:
+		data = value
+	case string:
+		data = []byte(value)
+	default:
+		return errors.New("incompatible type for string list")
+	}
+
+	if len(data) == 0 {
+		*l = StringList{}
+		return nil
+	}
+
+	return json.Unmarshal(data, (*[]string)(l))
+}
@@ -34,4 +34,32 @@ const (
 	CodeUserNotMatch            = "UserNotMatch"
 	CodeIncorrectUserID         = "IncorrectUserID"
 	CodeTokenAlreadyExist       = "TokenAlreadyExist"
+	CodeExportNotFound          = "ExportNotFound"
+	CodeExportNotReady          = "ExportNotReady"
+
+	CodeAccountPendingVerification   = "AccountPendingVerification"
+	CodeAccountSuspended             = "AccountSuspended"
+	CodeAccountBanned                = "AccountBanned"
+	CodeAccountDeleted               = "AccountDeleted"
+	CodePasswordChangeRequired       = "PasswordChangeRequired"
+	CodeClientDisabled               = "ClientDisabled"
+	CodeOriginNotAllowed             = "OriginNotAllowed"
+	CodeIPNotAllowed                 = "IPNotAllowed"
+	CodeRedirectURINotAllowed        = "RedirectURINotAllowed"
+	CodeSignatureRequired            = "SignatureRequired"
+	CodeInvalidSignature             = "InvalidSignature"
+	CodeSignatureExpired             = "SignatureExpired"
+	CodeSignatureReplayed            = "SignatureReplayed"
+	CodeWebhookNotFound              = "WebhookNotFound"
+	CodeWebhookDeliveryNotFound      = "WebhookDeliveryNotFound"
+	CodeVersionRequired              = "VersionRequired"
+	CodeVersionConflict              = "VersionConflict"
+	CodeInvalidCursor                = "InvalidCursor"
+	CodeImportNotFound               = "ImportNotFound"
+	CodeInvalidImage                 = "InvalidImage"
+	CodeUploadTooLarge               = "UploadTooLarge"
+	CodeIdentityVerificationNotFound = "IdentityVerificationNotFound"
+	CodeIdentityVerificationPending  = "IdentityVerificationPending"
+	CodeIdentityAlreadyVerified      = "IdentityAlreadyVerified"
+	CodeInvalidStatusTransition      = "InvalidStatusTransition"
 )
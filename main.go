@@ -2,6 +2,8 @@ package main
 
 import (
 	"os"
+	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	_ "github.com/go-sql-driver/mysql"
@@ -12,17 +14,29 @@ import (
 
 	"stark/database"
 	"stark/services"
+	"stark/services/account"
 	"stark/services/auth"
 	"stark/services/client"
+	"stark/services/client_audit"
 	"stark/services/email_verification"
+	"stark/services/identity_verification"
+	"stark/services/notification"
+	"stark/services/outbox"
 	"stark/services/profile"
+	"stark/services/profile_trail"
+	"stark/services/session"
 	"stark/services/user"
 	"stark/services/user_detail"
+	"stark/services/user_export"
+	"stark/services/user_import"
 	"stark/services/user_location"
+	"stark/services/webhook"
 	"stark/utils"
 	"stark/utils/activity"
+	"stark/utils/broker"
 	"stark/utils/log"
 	"stark/utils/middleware"
+	"stark/utils/storage"
 )
 
 func main() {
@@ -44,31 +58,132 @@ func main() {
 		return
 	}
 
-	_, err = database.NewMongo()
+	mongoDB, err := database.NewMongo()
 	if err != nil {
 		log.WithContext(ctx).Error(stacktrace.Propagate(err, "mongo connection error"))
 		return
 	}
 
+	fileStorage, err := storage.New()
+	if err != nil {
+		log.WithContext(ctx).Error(stacktrace.Propagate(err, "storage init error"))
+		return
+	}
+
+	localStorage, _ := fileStorage.(*storage.LocalStorage)
+
 	// Define repository, service, handler
 	clientRepo := client.NewSQLRepository(mysqlDB)
-	clientService := client.NewService(clientRepo)
+	clientCache := client.NewCache(
+		redisDB,
+		utils.GetIntEnv("CLIENT_CACHE_SIZE", 1000),
+		utils.GetDurationEnv("CLIENT_CACHE_LOCAL_TTL", 30*time.Second),
+		utils.GetDurationEnv("CLIENT_CACHE_TTL", 5*time.Minute),
+	)
+	clientAuditRepo := client_audit.NewMongoRepository(mongoDB)
+	clientAuditService := client_audit.NewService(clientAuditRepo)
+	clientService := client.NewService(clientRepo, clientCache, clientAuditService)
 	clientHandler := client.NewHandler(clientService)
+	profileTrailRepo := profile_trail.NewMongoRepository(mongoDB)
+	profileTrailService := profile_trail.NewService(profileTrailRepo)
+	profileTrailHandler := profile_trail.NewHandler(profileTrailService)
 	userRepo := user.NewSQLRepository(mysqlDB)
-	userService := user.NewService(userRepo)
-	userHandler := user.NewHandler(userService)
+	webhookRepo := webhook.NewSQLRepository(mysqlDB)
+	webhookService := webhook.NewService(
+		webhookRepo,
+		webhook.NewHTTPClient(utils.GetDurationEnv("WEBHOOK_TIMEOUT", 10*time.Second)),
+		webhook.CheckURL,
+	)
+	webhookHandler := webhook.NewHandler(webhookService)
 	userDetailRepo := user_detail.NewSQLRepository(mysqlDB)
-	userDetailService := user_detail.NewService(userDetailRepo)
+	userDetailService := user_detail.NewService(userDetailRepo, profileTrailService, fileStorage)
 	userDetailHandler := user_detail.NewHandler(userDetailService)
 	userLocationRepo := user_location.NewSQLRepository(mysqlDB)
-	userLocationService := user_location.NewService(userLocationRepo)
+	userLocationService := user_location.NewService(userLocationRepo, profileTrailService)
 	userLocationHandler := user_location.NewHandler(userLocationService)
+	sessionService := session.NewService(redisDB)
+	notificationService := notification.NewService(redisDB, sessionService)
+	userService := user.NewService(
+		userRepo,
+		webhookService,
+		userDetailService,
+		userLocationService,
+		profileTrailService,
+		notificationService,
+	)
+	userHandler := user.NewHandler(userService)
 	emailVerificationRepo := email_verification.NewSQLRepository(mysqlDB)
 	emailVerificationService := email_verification.NewService(emailVerificationRepo)
-	authService := auth.NewService(redisDB, userService, emailVerificationService)
+	notificationHandler := notification.NewHandler(notificationService)
+	authService := auth.NewService(redisDB, userService, emailVerificationService, sessionService, notificationService)
 	authHandler := auth.NewHandler(authService)
-	profileService := profile.NewService(userService, userDetailService, userLocationService)
+	identityVerificationRepo := identity_verification.NewSQLRepository(mysqlDB)
+	identityVerificationService := identity_verification.NewService(
+		mysqlDB,
+		identityVerificationRepo,
+		userService,
+		userDetailService,
+		notificationService,
+		webhookService,
+		profileTrailService,
+		fileStorage,
+	)
+	identityVerificationHandler := identity_verification.NewHandler(identityVerificationService)
+	profileService := profile.NewService(
+		mysqlDB,
+		userService,
+		userDetailService,
+		userLocationService,
+		notificationService,
+		webhookService,
+		profileTrailService,
+		identityVerificationService,
+	)
 	profileHandler := profile.NewHandler(profileService)
+	accountService := account.NewService(
+		mysqlDB,
+		redisDB,
+		userService,
+		userDetailService,
+		userLocationService,
+		sessionService,
+		profileTrailService,
+		identityVerificationService,
+		utils.GetDurationEnv("ACCOUNT_DELETION_GRACE_PERIOD", 30*24*time.Hour),
+	)
+	accountHandler := account.NewHandler(accountService)
+	userImportService := user_import.NewService(
+		mysqlDB,
+		redisDB,
+		userService,
+		userDetailService,
+		userLocationService,
+		profileTrailService,
+		notificationService,
+	)
+	userImportHandler := user_import.NewHandler(userImportService)
+	userExportRepo := user_export.NewSQLRepository(mysqlDB)
+	userExportService := user_export.NewService(userExportRepo)
+	userExportHandler := user_export.NewHandler(userExportService)
+
+	// Domain events are relayed from the outbox to the broker, Redis Streams
+	// when BROKER=redis_stream, in-process otherwise
+	var eventBroker broker.Broker = broker.NewMemoryBroker()
+	if os.Getenv("BROKER") == "redis_stream" {
+		eventBroker = broker.NewRedisStreamBroker(redisDB)
+	}
+
+	outboxRepo := outbox.NewSQLRepository(mysqlDB)
+	outboxService := outbox.NewService(
+		outboxRepo,
+		eventBroker,
+		utils.GetDurationEnv("OUTBOX_RETENTION", 7*24*time.Hour),
+	)
+
+	// Background workers
+	go accountService.RunPurgeWorker(time.Hour)
+	go webhookService.RunDeliveryWorker(utils.GetDurationEnv("WEBHOOK_POLL_INTERVAL", 5*time.Second))
+	go outboxService.RunRelayWorker(utils.GetDurationEnv("OUTBOX_POLL_INTERVAL", time.Second))
 
 	// Set application mode
 	mode := os.Getenv("APP_MODE")
@@ -76,10 +191,24 @@ func main() {
 
 	// Define application
 	app := gin.Default()
+
+	// Only trust X-Forwarded-For from known proxies, client CIDR allowlists
+	// depend on the resolved client IP
+	var trustedProxies []string
+	if proxies := os.Getenv("TRUSTED_PROXIES"); proxies != "" {
+		trustedProxies = strings.Split(proxies, ",")
+	}
+
+	err = app.SetTrustedProxies(trustedProxies)
+	if err != nil {
+		log.WithContext(ctx).Error(stacktrace.Propagate(err, "set trusted proxies error"))
+		return
+	}
+
 	app.Use(
 		gin.Recovery(),
 		gin.Logger(),
-		middleware.CORSMiddleware(),
+		middleware.CORSMiddleware(clientService),
 		middleware.JSONMiddleware(),
 	)
 
@@ -89,12 +218,21 @@ func main() {
 		app,
 		redisDB,
 		clientService,
+		userService,
 		clientHandler,
 		userHandler,
 		userDetailHandler,
 		userLocationHandler,
 		authHandler,
 		profileHandler,
+		accountHandler,
+		notificationHandler,
+		webhookHandler,
+		userImportHandler,
+		userExportHandler,
+		profileTrailHandler,
+		identityVerificationHandler,
+		localStorage,
 	)
 
 	// Let's get started!
@@ -0,0 +1,66 @@
+package account
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"io"
+)
+
+func encodeExport(w io.Writer, export *Export, format string) error {
+	if format == ExportFormatJSON {
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(export)
+	}
+
+	archive := zip.NewWriter(w)
+	files := []struct {
+		name string
+		data interface{}
+	}{
+		{"user.json", export.User},
+		{"user_detail.json", export.Detail},
+		{"user_location.json", export.Location},
+		{"sessions.json", export.Sessions},
+		{"profile_trails.json", export.ProfileTrails},
+	}
+
+	for _, file := range files {
+		f, err := archive.Create(file.name)
+		if err != nil {
+			return err
+		}
+
+		encoder := json.NewEncoder(f)
+		encoder.SetIndent("", "  ")
+		err = encoder.Encode(file.data)
+		if err != nil {
+			return err
+		}
+	}
+
+	return archive.Close()
+}
+
+func EncodeExport(export *Export, format string) ([]byte, error) {
+	var buffer bytes.Buffer
+	err := encodeExport(&buffer, export, format)
+	if err != nil {
+		return nil, err
+	}
+
+	return buffer.Bytes(), nil
+}
+
+func ExportContentType(format string) string {
+	if format == ExportFormatZIP {
+		return "application/zip"
+	}
+
+	return "application/json"
+}
+
+func IsExportFormat(format string) bool {
+	return format == ExportFormatJSON || format == ExportFormatZIP
+}
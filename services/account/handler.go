@@ -0,0 +1,364 @@
+package account
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+	"github.com/google/uuid"
+	"github.com/palantir/stacktrace"
+
+	"stark/failure"
+	"stark/respond"
+	"stark/services/profile_trail"
+	"stark/utils"
+	"stark/utils/activity"
+	"stark/utils/log"
+)
+
+type Handler struct {
+	service *Service
+}
+
+func NewHandler(service *Service) *Handler {
+	return &Handler{service: service}
+}
+
+func (h *Handler) HandleDelete(c *gin.Context) {
+	ctx := activity.NewContext("account_delete")
+	ctx = activity.WithUserID(ctx, c.Value("user_id").(string))
+	trx, _ := activity.GetTransactionID(ctx)
+	userID, _ := activity.GetUserID(ctx)
+	var input InputDelete
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		var validationErrors validator.ValidationErrors
+		if errors.As(err, &validationErrors) {
+			out := make([]utils.ErrorMessage, 0)
+			for _, validationError := range validationErrors {
+				out = append(out, utils.ErrorMessage{
+					Field:   utils.ToSnakeCase(validationError.Field()),
+					Message: utils.GetErrorMessage(validationError),
+				})
+			}
+
+			respond.Invalid(c, trx, http.StatusBadRequest, out)
+		}
+		return
+	}
+
+	id, err := uuid.Parse(userID)
+	if err != nil {
+		respond.Error(c, trx, http.StatusBadRequest, respond.ErrBadRequest, "invalid user id")
+		return
+	}
+
+	deletion, err := h.service.DeleteSelf(id, input.Password)
+	if err != nil {
+		if f, ok := stacktrace.RootCause(err).(failure.Failure); ok {
+			switch f.Code {
+			case failure.CodeUserNotFound:
+				respond.Error(c, trx, http.StatusBadRequest, f.Code, f.Desc)
+				return
+			case failure.CodeIncorrectPassword:
+				respond.Error(c, trx, http.StatusBadRequest, f.Code, f.Desc)
+				return
+			}
+		}
+
+		log.WithContext(ctx).Error(stacktrace.Propagate(err, "delete account error"))
+		respond.Error(c, trx, http.StatusInternalServerError, respond.ErrInternal, "unknown error")
+		return
+	}
+
+	respond.Success(c, trx, http.StatusOK, deletion)
+}
+
+func (h *Handler) HandleClientDelete(c *gin.Context) {
+	ctx := activity.NewContext("account_client_delete")
+	ctx = activity.WithClientID(ctx, c.Value("client_id").(string))
+	trx, _ := activity.GetTransactionID(ctx)
+	userID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		respond.Error(c, trx, http.StatusBadRequest, respond.ErrBadRequest, "invalid user id")
+		return
+	}
+
+	deletion, err := h.service.Delete(userID)
+	if err != nil {
+		if f, ok := stacktrace.RootCause(err).(failure.Failure); ok {
+			switch f.Code {
+			case failure.CodeUserNotFound:
+				respond.Error(c, trx, http.StatusBadRequest, f.Code, f.Desc)
+				return
+			}
+		}
+
+		log.WithContext(ctx).Error(stacktrace.Propagate(err, "client delete account error"))
+		respond.Error(c, trx, http.StatusInternalServerError, respond.ErrInternal, "unknown error")
+		return
+	}
+
+	respond.Success(c, trx, http.StatusOK, deletion)
+}
+
+// HandleDetail reads the user with its ETag for an If-Match on the status
+func (h *Handler) HandleDetail(c *gin.Context) {
+	ctx := activity.NewContext("account_detail")
+	ctx = activity.WithInternalID(ctx, c.Value("internal_id").(string))
+	trx, _ := activity.GetTransactionID(ctx)
+	userID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		respond.Error(c, trx, http.StatusBadRequest, respond.ErrBadRequest, "invalid user id")
+		return
+	}
+
+	user, err := h.service.FindByID(userID)
+	if err != nil {
+		if f, ok := stacktrace.RootCause(err).(failure.Failure); ok {
+			switch f.Code {
+			case failure.CodeUserNotFound:
+				respond.Error(c, trx, http.StatusNotFound, f.Code, f.Desc)
+				return
+			}
+		}
+
+		log.WithContext(ctx).Error(stacktrace.Propagate(err, "get account error"))
+		respond.Error(c, trx, http.StatusInternalServerError, respond.ErrInternal, "unknown error")
+		return
+	}
+
+	c.Header("ETag", utils.FormatETag(user.Version))
+	respond.Success(c, trx, http.StatusOK, user.InternalView())
+}
+
+func (h *Handler) HandleChangeStatus(c *gin.Context) {
+	ctx := activity.NewContext("account_change_status")
+	trx, _ := activity.GetTransactionID(ctx)
+	userID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		respond.Error(c, trx, http.StatusBadRequest, respond.ErrBadRequest, "invalid user id")
+		return
+	}
+
+	var input InputChangeStatus
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		var validationErrors validator.ValidationErrors
+		if errors.As(err, &validationErrors) {
+			out := make([]utils.ErrorMessage, 0)
+			for _, validationError := range validationErrors {
+				out = append(out, utils.ErrorMessage{
+					Field:   utils.ToSnakeCase(validationError.Field()),
+					Message: utils.GetErrorMessage(validationError),
+				})
+			}
+
+			respond.Invalid(c, trx, http.StatusBadRequest, out)
+		}
+		return
+	}
+
+	user, err := h.service.ChangeStatus(userID, c.GetInt("version"), input.Status, input.Reason, input.Until)
+	if err != nil {
+		if f, ok := stacktrace.RootCause(err).(failure.Failure); ok {
+			switch f.Code {
+			case failure.CodeUserNotFound:
+				respond.Error(c, trx, http.StatusBadRequest, f.Code, f.Desc)
+				return
+			case failure.CodeVersionConflict:
+				respond.Error(c, trx, http.StatusPreconditionFailed, f.Code, f.Desc)
+				return
+			}
+		}
+
+		log.WithContext(ctx).Error(stacktrace.Propagate(err, "change account status error"))
+		respond.Error(c, trx, http.StatusInternalServerError, respond.ErrInternal, "unknown error")
+		return
+	}
+
+	c.Header("ETag", utils.FormatETag(user.Version))
+	respond.Success(c, trx, http.StatusCreated, user.InternalView())
+}
+
+func (h *Handler) HandleForcePasswordReset(c *gin.Context) {
+	ctx := activity.NewContext("account_force_password_reset")
+	ctx = activity.WithInternalID(ctx, c.Value("internal_id").(string))
+	trx, _ := activity.GetTransactionID(ctx)
+	userID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		respond.Error(c, trx, http.StatusBadRequest, respond.ErrBadRequest, "invalid user id")
+		return
+	}
+
+	var input InputForcePasswordReset
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		var validationErrors validator.ValidationErrors
+		if errors.As(err, &validationErrors) {
+			out := make([]utils.ErrorMessage, 0)
+			for _, validationError := range validationErrors {
+				out = append(out, utils.ErrorMessage{
+					Field:   utils.ToSnakeCase(validationError.Field()),
+					Message: utils.GetErrorMessage(validationError),
+				})
+			}
+
+			respond.Invalid(c, trx, http.StatusBadRequest, out)
+		}
+		return
+	}
+
+	origin := profile_trail.NewOrigin(ctx, c.ClientIP(), c.Request.UserAgent())
+	reset, err := h.service.ForcePasswordReset(origin, userID, input.TemporaryPassword)
+	if err != nil {
+		if f, ok := stacktrace.RootCause(err).(failure.Failure); ok {
+			switch f.Code {
+			case failure.CodeUserNotFound:
+				respond.Error(c, trx, http.StatusBadRequest, f.Code, f.Desc)
+				return
+			case failure.CodeVersionConflict:
+				respond.Error(c, trx, http.StatusPreconditionFailed, f.Code, f.Desc)
+				return
+			}
+		}
+
+		log.WithContext(ctx).Error(stacktrace.Propagate(err, "force password reset error"))
+		respond.Error(c, trx, http.StatusInternalServerError, respond.ErrInternal, "unknown error")
+		return
+	}
+
+	respond.Success(c, trx, http.StatusCreated, reset)
+}
+
+func (h *Handler) HandleExport(c *gin.Context) {
+	ctx := activity.NewContext("account_export")
+	ctx = activity.WithUserID(ctx, c.Value("user_id").(string))
+	trx, _ := activity.GetTransactionID(ctx)
+	userID, _ := activity.GetUserID(ctx)
+	format := c.DefaultQuery("format", ExportFormatJSON)
+	if !IsExportFormat(format) {
+		respond.Error(c, trx, http.StatusBadRequest, respond.ErrBadRequest, "invalid format, use json or zip")
+		return
+	}
+
+	id, err := uuid.Parse(userID)
+	if err != nil {
+		respond.Error(c, trx, http.StatusBadRequest, respond.ErrBadRequest, "invalid user id")
+		return
+	}
+
+	async := c.Query("async") == "true"
+	if !async {
+		async, err = h.service.IsLargeExport(id)
+		if err != nil {
+			log.WithContext(ctx).Error(stacktrace.Propagate(err, "check export size error"))
+			respond.Error(c, trx, http.StatusInternalServerError, respond.ErrInternal, "unknown error")
+			return
+		}
+	}
+
+	if async {
+		job, err := h.service.CreateExportJob(id, format)
+		if err != nil {
+			if f, ok := stacktrace.RootCause(err).(failure.Failure); ok {
+				switch f.Code {
+				case failure.CodeUserNotFound:
+					respond.Error(c, trx, http.StatusBadRequest, f.Code, f.Desc)
+					return
+				}
+			}
+
+			log.WithContext(ctx).Error(stacktrace.Propagate(err, "create export job error"))
+			respond.Error(c, trx, http.StatusInternalServerError, respond.ErrInternal, "unknown error")
+			return
+		}
+
+		respond.Success(c, trx, http.StatusAccepted, job.Public())
+		return
+	}
+
+	export, err := h.service.Export(id)
+	if err != nil {
+		if f, ok := stacktrace.RootCause(err).(failure.Failure); ok {
+			switch f.Code {
+			case failure.CodeUserNotFound:
+				respond.Error(c, trx, http.StatusBadRequest, f.Code, f.Desc)
+				return
+			}
+		}
+
+		log.WithContext(ctx).Error(stacktrace.Propagate(err, "export account error"))
+		respond.Error(c, trx, http.StatusInternalServerError, respond.ErrInternal, "unknown error")
+		return
+	}
+
+	data, err := EncodeExport(export, format)
+	if err != nil {
+		log.WithContext(ctx).Error(stacktrace.Propagate(err, "encode export error"))
+		respond.Error(c, trx, http.StatusInternalServerError, respond.ErrInternal, "unknown error")
+		return
+	}
+
+	c.Header("Content-Type", ExportContentType(format))
+	c.Header("Content-Disposition", `attachment; filename="stark-export-`+userID+`.`+format+`"`)
+	c.Data(http.StatusOK, ExportContentType(format), data)
+}
+
+func (h *Handler) HandleExportStatus(c *gin.Context) {
+	ctx := activity.NewContext("account_export_status")
+	ctx = activity.WithUserID(ctx, c.Value("user_id").(string))
+	trx, _ := activity.GetTransactionID(ctx)
+	userID, _ := activity.GetUserID(ctx)
+	id, err := uuid.Parse(userID)
+	if err != nil {
+		respond.Error(c, trx, http.StatusBadRequest, respond.ErrBadRequest, "invalid user id")
+		return
+	}
+
+	job, err := h.service.FindExportJob(id, c.Param("id"))
+	if err != nil {
+		if f, ok := stacktrace.RootCause(err).(failure.Failure); ok {
+			switch f.Code {
+			case failure.CodeExportNotFound:
+				respond.Error(c, trx, http.StatusNotFound, f.Code, f.Desc)
+				return
+			}
+		}
+
+		log.WithContext(ctx).Error(stacktrace.Propagate(err, "get export status error"))
+		respond.Error(c, trx, http.StatusInternalServerError, respond.ErrInternal, "unknown error")
+		return
+	}
+
+	respond.Success(c, trx, http.StatusOK, job.Public())
+}
+
+func (h *Handler) HandleExportDownload(c *gin.Context) {
+	ctx := activity.NewContext("account_export_download")
+	trx, _ := activity.GetTransactionID(ctx)
+	job, path, err := h.service.FindExportFile(c.Param("id"), c.Query("token"))
+	if err != nil {
+		if f, ok := stacktrace.RootCause(err).(failure.Failure); ok {
+			switch f.Code {
+			case failure.CodeExportNotFound:
+				respond.Error(c, trx, http.StatusNotFound, f.Code, f.Desc)
+				return
+			case failure.CodeIncorrectToken:
+				respond.Error(c, trx, http.StatusForbidden, f.Code, f.Desc)
+				return
+			case failure.CodeExportNotReady:
+				respond.Error(c, trx, http.StatusConflict, f.Code, f.Desc)
+				return
+			}
+		}
+
+		log.WithContext(ctx).Error(stacktrace.Propagate(err, "download export error"))
+		respond.Error(c, trx, http.StatusInternalServerError, respond.ErrInternal, "unknown error")
+		return
+	}
+
+	c.Header("Content-Type", ExportContentType(job.Format))
+	c.FileAttachment(path, "stark-export-"+job.UserID+"."+job.Format)
+}
@@ -0,0 +1,17 @@
+package account
+
+import "time"
+
+type InputDelete struct {
+	Password string `json:"password" binding:"required"`
+}
+
+type InputChangeStatus struct {
+	Status string     `json:"status" binding:"required,oneof=active suspended banned"`
+	Reason string     `json:"reason" binding:"max=255"`
+	Until  *time.Time `json:"until"`
+}
+
+type InputForcePasswordReset struct {
+	TemporaryPassword bool `json:"temporary_password"`
+}
@@ -0,0 +1,92 @@
+package account
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+
+	"stark/services/profile_trail"
+	"stark/services/session"
+	"stark/services/user"
+	"stark/services/user_detail"
+	"stark/services/user_location"
+	"stark/utils"
+)
+
+const (
+	ExportFormatJSON = "json"
+	ExportFormatZIP  = "zip"
+
+	ExportStatusPending   = "pending"
+	ExportStatusCompleted = "completed"
+	ExportStatusFailed    = "failed"
+)
+
+type Deletion struct {
+	UserID    uuid.UUID `json:"user_id"`
+	DeletedAt time.Time `json:"deleted_at"`
+	PurgeAt   time.Time `json:"purge_at"`
+}
+
+type PasswordReset struct {
+	UserID             uuid.UUID `json:"user_id"`
+	MustChangePassword bool      `json:"must_change_password"`
+	TemporaryPassword  string    `json:"temporary_password,omitempty"`
+}
+
+type Export struct {
+	User          user.SelfView                 `json:"user"`
+	Detail        *user_detail.UserDetail       `json:"detail"`
+	Location      *user_location.UserLocation   `json:"location"`
+	Sessions      []*session.Session            `json:"sessions"`
+	ProfileTrails []*profile_trail.ProfileTrail `json:"profile_trails"`
+	ExportedAt    time.Time                     `json:"exported_at"`
+}
+
+type ExportJob struct {
+	ID          string     `json:"id"`
+	UserID      string     `json:"user_id"`
+	Format      string     `json:"format"`
+	Status      string     `json:"status"`
+	Token       string     `json:"token,omitempty"`
+	DownloadURL string     `json:"download_url,omitempty"`
+	Error       string     `json:"error,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+	CompletedAt *time.Time `json:"completed_at"`
+	ExpiresAt   time.Time  `json:"expires_at"`
+}
+
+func NewExportJob(userID uuid.UUID, format string, ttl time.Duration) *ExportJob {
+	now := time.Now()
+
+	return &ExportJob{
+		ID:        uuid.New().String(),
+		UserID:    userID.String(),
+		Format:    format,
+		Status:    ExportStatusPending,
+		Token:     utils.GenerateSecureToken(25),
+		CreatedAt: now,
+		ExpiresAt: now.Add(ttl),
+	}
+}
+
+func (e *ExportJob) Complete(ttl time.Duration) {
+	now := time.Now()
+	e.Status = ExportStatusCompleted
+	e.DownloadURL = "/api/account/export/" + e.ID + "/download?token=" + e.Token
+	e.CompletedAt = &now
+	e.ExpiresAt = now.Add(ttl)
+}
+
+func (e *ExportJob) Fail(err error) {
+	now := time.Now()
+	e.Status = ExportStatusFailed
+	e.Error = err.Error()
+	e.CompletedAt = &now
+}
+
+// Public hides the download token, which is only handed out inside DownloadURL.
+func (e ExportJob) Public() ExportJob {
+	e.Token = ""
+	return e
+}
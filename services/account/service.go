@@ -0,0 +1,465 @@
+package account
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis"
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/palantir/stacktrace"
+
+	"stark/database"
+	"stark/failure"
+	"stark/services/identity_verification"
+	"stark/services/profile_trail"
+	"stark/services/session"
+	"stark/services/user"
+	"stark/services/user_detail"
+	"stark/services/user_location"
+	"stark/utils"
+	"stark/utils/activity"
+	"stark/utils/log"
+)
+
+const (
+	exportJobPrefix = "account_export:"
+
+	// Exports with more profile trails than this are generated in the background
+	exportAsyncThreshold = 1000
+)
+
+type Service struct {
+	mysqlDB                     *database.MySQL
+	redisDB                     *database.Redis
+	userService                 *user.Service
+	userDetailService           *user_detail.Service
+	userLocationService         *user_location.Service
+	sessionService              *session.Service
+	profileTrailService         *profile_trail.Service
+	identityVerificationService *identity_verification.Service
+	gracePeriod                 time.Duration
+}
+
+func NewService(
+	mysqlDB *database.MySQL,
+	redisDB *database.Redis,
+	userService *user.Service,
+	userDetailService *user_detail.Service,
+	userLocationService *user_location.Service,
+	sessionService *session.Service,
+	profileTrailService *profile_trail.Service,
+	identityVerificationService *identity_verification.Service,
+	gracePeriod time.Duration,
+) *Service {
+	return &Service{
+		mysqlDB:                     mysqlDB,
+		redisDB:                     redisDB,
+		userService:                 userService,
+		userDetailService:           userDetailService,
+		userLocationService:         userLocationService,
+		sessionService:              sessionService,
+		profileTrailService:         profileTrailService,
+		identityVerificationService: identityVerificationService,
+		gracePeriod:                 gracePeriod,
+	}
+}
+
+func (s *Service) DeleteSelf(id uuid.UUID, password string) (*Deletion, error) {
+	item, err := s.userService.FindByID(id)
+	if err != nil {
+		return nil, err
+	}
+
+	if !utils.CheckPasswordHash(password, item.Password) {
+		return nil, failure.WithMessage(
+			failure.CodeIncorrectPassword,
+			"incorrect password, try again",
+		)
+	}
+
+	return s.Delete(id)
+}
+
+func (s *Service) Delete(id uuid.UUID) (*Deletion, error) {
+	_, err := s.userService.FindByID(id)
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.sessionService.RevokeAll(id.String())
+	if err != nil {
+		return nil, err
+	}
+
+	// The user, detail and location are soft-deleted in one transaction, a
+	// failed write rolls back the ones before it together with the queued
+	// user.deleted webhook
+	result, err := s.mysqlDB.WithTransaction(func(tx *sqlx.Tx) (interface{}, error) {
+		item, err := s.userService.WithTx(tx).Delete(id)
+		if err != nil {
+			return nil, err
+		}
+
+		_, err = s.userDetailService.WithTx(tx).Delete(id)
+		if err != nil && !isNotFound(err) {
+			return nil, err
+		}
+
+		_, err = s.userLocationService.WithTx(tx).Delete(id)
+		if err != nil && !isNotFound(err) {
+			return nil, err
+		}
+
+		return item, nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	item := result.(*user.User)
+	return &Deletion{
+		UserID:    item.ID,
+		DeletedAt: *item.DeletedAt,
+		PurgeAt:   item.DeletedAt.Add(s.gracePeriod),
+	}, nil
+}
+
+// FindByID reads the user for operators, its version is the ETag status
+// changes are made against
+func (s *Service) FindByID(id uuid.UUID) (*user.User, error) {
+	return s.userService.FindByID(id)
+}
+
+func (s *Service) ChangeStatus(id uuid.UUID, version int, status, reason string, until *time.Time) (*user.User, error) {
+	if status != user.StatusSuspended {
+		until = nil
+	}
+
+	item, err := s.userService.ChangeStatus(id, version, status, reason, until)
+	if err != nil {
+		return nil, err
+	}
+
+	if status == user.StatusSuspended || status == user.StatusBanned {
+		err = s.sessionService.RevokeAll(id.String())
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return item, nil
+}
+
+func (s *Service) ForcePasswordReset(origin profile_trail.Origin, id uuid.UUID, temporary bool) (*PasswordReset, error) {
+	temporaryPassword, err := s.userService.ForcePasswordReset(origin, id, temporary)
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.sessionService.RevokeAll(id.String())
+	if err != nil {
+		return nil, err
+	}
+
+	return &PasswordReset{
+		UserID:             id,
+		MustChangePassword: true,
+		TemporaryPassword:  temporaryPassword,
+	}, nil
+}
+
+func (s *Service) Export(id uuid.UUID) (*Export, error) {
+	item, err := s.userService.FindByID(id)
+	if err != nil {
+		return nil, err
+	}
+
+	detail, err := s.userDetailService.FindByID(id)
+	if err != nil && !isNotFound(err) {
+		return nil, err
+	}
+
+	location, err := s.userLocationService.FindByID(id)
+	if err != nil && !isNotFound(err) {
+		return nil, err
+	}
+
+	sessions, err := s.sessionService.FindByUserID(id.String())
+	if err != nil {
+		return nil, err
+	}
+
+	profileTrails, err := s.profileTrailService.FindByUserID(id.String())
+	if err != nil {
+		return nil, err
+	}
+
+	return &Export{
+		// The password hash is not personal data the user can make any use of
+		User:          item.SelfView(),
+		Detail:        detail,
+		Location:      location,
+		Sessions:      sessions,
+		ProfileTrails: profileTrails,
+		ExportedAt:    time.Now(),
+	}, nil
+}
+
+func (s *Service) IsLargeExport(id uuid.UUID) (bool, error) {
+	total, err := s.profileTrailService.FindTotalByUserID(id.String())
+	if err != nil {
+		return false, err
+	}
+
+	return total > exportAsyncThreshold, nil
+}
+
+func (s *Service) CreateExportJob(id uuid.UUID, format string) (*ExportJob, error) {
+	_, err := s.userService.FindByID(id)
+	if err != nil {
+		return nil, err
+	}
+
+	job := NewExportJob(id, format, exportLinkTTL())
+	err = s.storeExportJob(job)
+	if err != nil {
+		return nil, err
+	}
+
+	go s.processExportJob(job)
+
+	return job, nil
+}
+
+func (s *Service) FindExportJob(id uuid.UUID, jobID string) (*ExportJob, error) {
+	job, err := s.findExportJob(jobID)
+	if err != nil {
+		return nil, err
+	}
+
+	if job.UserID != id.String() {
+		return nil, failure.WithMessage(
+			failure.CodeExportNotFound,
+			"export not found, id isn't in storage",
+		)
+	}
+
+	return job, nil
+}
+
+func (s *Service) FindExportFile(jobID, token string) (*ExportJob, string, error) {
+	job, err := s.findExportJob(jobID)
+	if err != nil {
+		return nil, "", err
+	}
+
+	if subtle.ConstantTimeCompare([]byte(job.Token), []byte(token)) != 1 {
+		return nil, "", failure.WithMessage(
+			failure.CodeIncorrectToken,
+			"incorrect token, try again",
+		)
+	}
+
+	if job.Status != ExportStatusCompleted {
+		return nil, "", failure.WithMessage(
+			failure.CodeExportNotReady,
+			"export isn't ready, check the export status",
+		)
+	}
+
+	return job, exportPath(job), nil
+}
+
+func (s *Service) processExportJob(job *ExportJob) {
+	ctx := activity.NewContext("account_export")
+	ctx = activity.WithUserID(ctx, job.UserID)
+
+	err := s.writeExportFile(job)
+	if err != nil {
+		log.WithContext(ctx).Error(stacktrace.Propagate(err, "generate export %s error", job.ID))
+		job.Fail(err)
+	} else {
+		job.Complete(exportLinkTTL())
+	}
+
+	err = s.storeExportJob(job)
+	if err != nil {
+		log.WithContext(ctx).Error(stacktrace.Propagate(err, "store export %s error", job.ID))
+	}
+}
+
+func (s *Service) writeExportFile(job *ExportJob) error {
+	id, err := uuid.Parse(job.UserID)
+	if err != nil {
+		return err
+	}
+
+	export, err := s.Export(id)
+	if err != nil {
+		return err
+	}
+
+	err = os.MkdirAll(exportDir(), 0700)
+	if err != nil {
+		return err
+	}
+
+	file, err := os.OpenFile(exportPath(job), os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	return encodeExport(file, export, job.Format)
+}
+
+func (s *Service) storeExportJob(job *ExportJob) error {
+	data, err := json.Marshal(job)
+	if err != nil {
+		return err
+	}
+
+	return s.redisDB.Set(exportJobPrefix+job.ID, string(data), time.Until(job.ExpiresAt))
+}
+
+func (s *Service) findExportJob(jobID string) (*ExportJob, error) {
+	data, err := s.redisDB.Get(exportJobPrefix + jobID)
+	if err != nil {
+		if stacktrace.RootCause(err) == redis.Nil {
+			return nil, failure.WithMessage(
+				failure.CodeExportNotFound,
+				"export not found, id isn't in storage",
+			)
+		}
+
+		return nil, err
+	}
+
+	var job ExportJob
+	err = json.Unmarshal([]byte(data), &job)
+	if err != nil {
+		return nil, err
+	}
+
+	return &job, nil
+}
+
+func (s *Service) removeExpiredExports(now time.Time) error {
+	entries, err := os.ReadDir(exportDir())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+
+		return err
+	}
+
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+
+		if now.Sub(info.ModTime()) > exportLinkTTL() {
+			err := os.Remove(filepath.Join(exportDir(), entry.Name()))
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func (s *Service) Purge(now time.Time) (int, error) {
+	ctx := activity.NewContext("account_purge")
+	ctx = activity.WithClientID(ctx, "stark_system")
+	items, err := s.userService.FindDeletedBefore(now.Add(-s.gracePeriod))
+	if err != nil {
+		return 0, err
+	}
+
+	purged := 0
+	for _, item := range items {
+		err := s.profileTrailService.AnonymizeByUserID(item.ID.String())
+		if err != nil {
+			log.WithContext(ctx).Error(stacktrace.Propagate(err, "anonymize profile trails of %s error", item.ID))
+			continue
+		}
+
+		// Stored files are removed while the rows still point to them, a
+		// failure keeps the user for the next run so nothing is orphaned
+		err = s.userDetailService.RemoveUploads(item.ID)
+		if err != nil {
+			log.WithContext(ctx).Error(stacktrace.Propagate(err, "remove uploads of %s error", item.ID))
+			continue
+		}
+
+		err = s.identityVerificationService.RemoveDocumentsByUserID(item.ID)
+		if err != nil {
+			log.WithContext(ctx).Error(stacktrace.Propagate(err, "remove identity documents of %s error", item.ID))
+			continue
+		}
+
+		err = s.userService.Purge(item.ID)
+		if err != nil {
+			log.WithContext(ctx).Error(stacktrace.Propagate(err, "purge user %s error", item.ID))
+			continue
+		}
+
+		purged++
+	}
+
+	return purged, nil
+}
+
+func (s *Service) RunPurgeWorker(interval time.Duration) {
+	ctx := activity.NewContext("account_purge_worker")
+	ctx = activity.WithClientID(ctx, "stark_system")
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		purged, err := s.Purge(time.Now())
+		if err != nil {
+			log.WithContext(ctx).Error(stacktrace.Propagate(err, "purge deleted accounts error"))
+		} else if purged > 0 {
+			log.WithContext(ctx).Infof("purged %d deleted accounts", purged)
+		}
+
+		err = s.removeExpiredExports(time.Now())
+		if err != nil {
+			log.WithContext(ctx).Error(stacktrace.Propagate(err, "remove expired exports error"))
+		}
+
+		<-ticker.C
+	}
+}
+
+func exportDir() string {
+	dir := os.Getenv("EXPORT_DIR")
+	if dir == "" {
+		dir = filepath.Join(os.TempDir(), "stark-exports")
+	}
+
+	return dir
+}
+
+func exportPath(job *ExportJob) string {
+	return filepath.Join(exportDir(), job.ID+"."+strings.ToLower(job.Format))
+}
+
+func exportLinkTTL() time.Duration {
+	return utils.GetDurationEnv("EXPORT_LINK_TTL", 24*time.Hour)
+}
+
+func isNotFound(err error) bool {
+	f, ok := stacktrace.RootCause(err).(failure.Failure)
+	return ok && f.Code == failure.CodeUserNotFound
+}
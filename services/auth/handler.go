@@ -44,7 +44,7 @@ func (h *Handler) HandleLogin(c *gin.Context) {
 		return
 	}
 
-	token, err := h.service.Login(input.Email, input.Username, input.Password)
+	token, err := h.service.Login(input.Email, input.Username, input.Password, c.ClientIP(), c.Request.UserAgent())
 	if err != nil {
 		if f, ok := stacktrace.RootCause(err).(failure.Failure); ok {
 			switch f.Code {
@@ -54,6 +54,12 @@ func (h *Handler) HandleLogin(c *gin.Context) {
 			case failure.CodeIncorrectPassword:
 				respond.Error(c, trx, http.StatusBadRequest, f.Code, f.Desc)
 				return
+			case failure.CodeAccountPendingVerification,
+				failure.CodeAccountSuspended,
+				failure.CodeAccountBanned,
+				failure.CodeAccountDeleted:
+				respond.Error(c, trx, http.StatusForbidden, f.Code, f.Desc)
+				return
 			}
 		}
 
@@ -99,6 +105,15 @@ func (h *Handler) HandleRefreshToken(c *gin.Context) {
 			case failure.CodeUserNotMatch:
 				respond.Error(c, trx, http.StatusBadRequest, f.Code, f.Desc)
 				return
+			case failure.CodeUserNotFound:
+				respond.Error(c, trx, http.StatusBadRequest, f.Code, f.Desc)
+				return
+			case failure.CodeAccountPendingVerification,
+				failure.CodeAccountSuspended,
+				failure.CodeAccountBanned,
+				failure.CodeAccountDeleted:
+				respond.Error(c, trx, http.StatusForbidden, f.Code, f.Desc)
+				return
 			}
 		}
 
@@ -165,3 +180,48 @@ func (h *Handler) HandleRegister(c *gin.Context) {
 
 	respond.Success(c, trx, http.StatusCreated, nil)
 }
+
+func (h *Handler) HandleVerifyEmail(c *gin.Context) {
+	ctx := activity.NewContext("auth_verify_email")
+	trx, _ := activity.GetTransactionID(ctx)
+	var input InputVerifyEmail
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		var validationErrors validator.ValidationErrors
+		if errors.As(err, &validationErrors) {
+			out := make([]utils.ErrorMessage, 0)
+			for _, validationError := range validationErrors {
+				out = append(out, utils.ErrorMessage{
+					Field:   utils.ToSnakeCase(validationError.Field()),
+					Message: utils.GetErrorMessage(validationError),
+				})
+			}
+
+			respond.Invalid(c, trx, http.StatusBadRequest, out)
+		}
+		return
+	}
+
+	err := h.service.VerifyEmail(input.Email, input.Token)
+	if err != nil {
+		if f, ok := stacktrace.RootCause(err).(failure.Failure); ok {
+			switch f.Code {
+			case failure.CodeUserNotFound:
+				respond.Error(c, trx, http.StatusBadRequest, f.Code, f.Desc)
+				return
+			case failure.CodeIncorrectToken:
+				respond.Error(c, trx, http.StatusBadRequest, f.Code, f.Desc)
+				return
+			case failure.CodeTokenExpired:
+				respond.Error(c, trx, http.StatusBadRequest, f.Code, f.Desc)
+				return
+			}
+		}
+
+		log.WithContext(ctx).Error(stacktrace.Propagate(err, "auth verify email error"))
+		respond.Error(c, trx, http.StatusInternalServerError, respond.ErrInternal, "unknown error")
+		return
+	}
+
+	respond.Success(c, trx, http.StatusCreated, nil)
+}
@@ -36,3 +36,8 @@ type InputRegister struct {
 	Contact  string `json:"contact" binding:"required"`
 	Password string `json:"password" binding:"required"`
 }
+
+type InputVerifyEmail struct {
+	Email string `json:"email" binding:"required,email"`
+	Token string `json:"token" binding:"required"`
+}
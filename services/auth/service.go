@@ -5,11 +5,13 @@ import (
 	"stark/database"
 	"stark/failure"
 	"stark/services/email_verification"
+	"stark/services/notification"
+	"stark/services/session"
 	"stark/services/user"
 	"stark/utils"
 	"strings"
-	"time"
 
+	"github.com/google/uuid"
 	"github.com/palantir/stacktrace"
 )
 
@@ -22,21 +24,27 @@ type Service struct {
 	redisDB                  *database.Redis
 	userService              *user.Service
 	emailVerificationService *email_verification.Service
+	sessionService           *session.Service
+	notificationService      *notification.Service
 }
 
 func NewService(
 	redisDB *database.Redis,
 	userService *user.Service,
 	emailVerificationService *email_verification.Service,
+	sessionService *session.Service,
+	notificationService *notification.Service,
 ) *Service {
 	return &Service{
 		redisDB:                  redisDB,
 		userService:              userService,
 		emailVerificationService: emailVerificationService,
+		sessionService:           sessionService,
+		notificationService:      notificationService,
 	}
 }
 
-func (s *Service) Login(email, username, password string) (*Login, error) {
+func (s *Service) Login(email, username, password, ip, userAgent string) (*Login, error) {
 	filter := user.Filter{}
 	if email != "" {
 		filter.Emails = []string{email}
@@ -58,6 +66,13 @@ func (s *Service) Login(email, username, password string) (*Login, error) {
 		return nil, err
 	}
 
+	if len(user) == 0 {
+		return nil, failure.WithMessage(
+			failure.CodeUserNotFound,
+			"user not found, email or username isn't in database",
+		)
+	}
+
 	if !utils.CheckPasswordHash(password, user[0].Password) {
 		return nil, failure.WithMessage(
 			failure.CodeIncorrectPassword,
@@ -65,45 +80,41 @@ func (s *Service) Login(email, username, password string) (*Login, error) {
 		)
 	}
 
-	token, err := utils.CreateToken(user[0].ID.String())
+	err = s.userService.CheckStatus(user[0])
 	if err != nil {
 		return nil, err
 	}
 
-	accessExpires := time.Unix(token.AccessExpires, 0)
-	refreshExpires := time.Unix(token.RefreshExpires, 0)
-	now := time.Now()
+	token, err := utils.CreateToken(user[0].ID.String(), user[0].MustChangePassword)
+	if err != nil {
+		return nil, err
+	}
 
-	err = s.redisDB.Set(token.AccessUuid, user[0].ID.String(), accessExpires.Sub(now))
+	err = s.sessionService.Create(user[0].ID.String(), token)
 	if err != nil {
 		return nil, err
 	}
 
-	err = s.redisDB.Set(token.RefreshUuid, user[0].ID.String(), refreshExpires.Sub(now))
+	isNewDevice, err := s.sessionService.RememberDevice(user[0].ID.String(), ip, userAgent)
 	if err != nil {
 		return nil, err
 	}
 
+	if isNewDevice {
+		s.notificationService.NotifyNewLogin(user[0], ip, userAgent)
+	}
+
 	login := &Login{
-		AccessToken:  token.AccessToken,
-		RefreshToken: token.RefreshToken,
+		AccessToken:        token.AccessToken,
+		RefreshToken:       token.RefreshToken,
+		MustChangePassword: user[0].MustChangePassword,
 	}
 
 	return login, nil
 }
 
 func (s *Service) Logout(accessUuid string, userID string) (int64, error) {
-	deleted, err := s.redisDB.Delete(accessUuid)
-	if err != nil {
-		return 0, err
-	}
-
-	deleted, err = s.redisDB.Delete(accessUuid + "++" + userID)
-	if err != nil {
-		return 0, err
-	}
-
-	return deleted, nil
+	return s.sessionService.Delete(accessUuid, userID)
 }
 
 func (s *Service) RefreshToken(refreshToken string) (*Login, error) {
@@ -134,50 +145,52 @@ func (s *Service) RefreshToken(refreshToken string) (*Login, error) {
 		return nil, err
 	}
 
-	splitRefreshUuid := strings.Split(metadata.RefreshUuid, "++")
-	if len(splitRefreshUuid) != 2 {
-		return nil, errors.New("invalid refresh uuid")
+	id, err := uuid.Parse(userID)
+	if err != nil {
+		return nil, err
 	}
 
-	_, err = s.redisDB.Delete(metadata.RefreshUuid)
+	item, err := s.userService.FindByID(id)
 	if err != nil {
 		return nil, err
 	}
 
-	_, err = s.redisDB.Delete(splitRefreshUuid[0])
+	err = s.userService.CheckStatus(item)
 	if err != nil {
 		return nil, err
 	}
 
-	token, err := utils.CreateToken(userID)
+	splitRefreshUuid := strings.Split(metadata.RefreshUuid, "++")
+	if len(splitRefreshUuid) != 2 {
+		return nil, errors.New("invalid refresh uuid")
+	}
+
+	_, err = s.sessionService.Delete(splitRefreshUuid[0], userID)
 	if err != nil {
 		return nil, err
 	}
 
-	accessExpires := time.Unix(token.AccessExpires, 0)
-	refreshExpires := time.Unix(token.RefreshExpires, 0)
-	now := time.Now()
-
-	err = s.redisDB.Set(token.AccessUuid, userID, accessExpires.Sub(now))
+	token, err := utils.CreateToken(userID, item.MustChangePassword)
 	if err != nil {
 		return nil, err
 	}
 
-	err = s.redisDB.Set(token.RefreshUuid, userID, refreshExpires.Sub(now))
+	err = s.sessionService.Create(userID, token)
 	if err != nil {
 		return nil, err
 	}
 
 	login := &Login{
-		AccessToken:  token.AccessToken,
-		RefreshToken: token.RefreshToken,
+		AccessToken:        token.AccessToken,
+		RefreshToken:       token.RefreshToken,
+		MustChangePassword: item.MustChangePassword,
 	}
 
 	return login, nil
 }
 
 func (s *Service) Register(name, email, username, contact, password string) error {
-	_, err := s.userService.Create(name, email, username, contact, password)
+	_, err := s.userService.Create(name, email, username, contact, password, user.StatusPendingVerification)
 	if err != nil {
 		return err
 	}
@@ -197,3 +210,36 @@ func (s *Service) Register(name, email, username, contact, password string) erro
 
 	return nil
 }
+
+func (s *Service) VerifyEmail(email, token string) error {
+	emailVerification, err := s.emailVerificationService.FindByToken(token)
+	if err != nil {
+		return err
+	}
+
+	if emailVerification.Email != email {
+		return failure.WithMessage(
+			failure.CodeIncorrectToken,
+			"incorrect token, email doesn't match",
+		)
+	}
+
+	users, err := s.userService.FindAllByFilter(user.Filter{Emails: []string{email}})
+	if err != nil {
+		return err
+	}
+
+	if len(users) == 0 {
+		return failure.WithMessage(
+			failure.CodeUserNotFound,
+			"user not found, email isn't in database",
+		)
+	}
+
+	_, err = s.userService.Verify(users[0].ID)
+	if err != nil {
+		return err
+	}
+
+	return s.emailVerificationService.DeleteByEmail(email)
+}
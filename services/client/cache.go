@@ -0,0 +1,282 @@
+package client
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-redis/redis"
+	"github.com/google/uuid"
+	"github.com/palantir/stacktrace"
+
+	"stark/database"
+)
+
+const bearerKeyCachePrefix = "client_bearer_key:"
+
+type CacheStats struct {
+	LocalHits int64 `json:"local_hits"`
+	RedisHits int64 `json:"redis_hits"`
+	Misses    int64 `json:"misses"`
+	LocalSize int   `json:"local_size"`
+}
+
+// Cache is a two level read-through cache of clients keyed by bearer key, an
+// in-process LRU in front of Redis. The local TTL should stay short since
+// invalidation only reaches the LRU of the instance that made the change.
+// Redis never holds the client secrets, so clients requiring signatures are
+// only cached in the LRU.
+type Cache struct {
+	redisDB   *database.Redis
+	local     *lruCache
+	localTTL  time.Duration
+	redisTTL  time.Duration
+	localHits atomic.Int64
+	redisHits atomic.Int64
+	misses    atomic.Int64
+
+	originsMu        sync.Mutex
+	origins          map[string]bool
+	originsExpiresAt time.Time
+}
+
+func NewCache(redisDB *database.Redis, size int, localTTL, redisTTL time.Duration) *Cache {
+	return &Cache{
+		redisDB:  redisDB,
+		local:    newLRUCache(size),
+		localTTL: localTTL,
+		redisTTL: redisTTL,
+	}
+}
+
+func (c *Cache) GetByBearerKey(bearerKey string, load func() (*Client, error)) (*Client, error) {
+	key := bearerKeyCacheKey(bearerKey)
+	if item, ok := c.local.get(key); ok {
+		c.localHits.Add(1)
+		return item, nil
+	}
+
+	value, err := c.redisDB.Get(key)
+	if err == nil {
+		var cached cachedClient
+		err = json.Unmarshal([]byte(value), &cached)
+		// An entry stored before the client required signatures has no
+		// secret to check them with, it's loaded again
+		if err == nil && !cached.RequireSignature {
+			item := cached.client(bearerKey)
+			c.redisHits.Add(1)
+			c.local.set(key, item, c.localTTL)
+			return item, nil
+		}
+	} else if stacktrace.RootCause(err) != redis.Nil {
+		return nil, err
+	}
+
+	c.misses.Add(1)
+	item, err := load()
+	if err != nil || item == nil {
+		return item, err
+	}
+
+	if !item.RequireSignature {
+		data, err := json.Marshal(newCachedClient(item))
+		if err != nil {
+			return nil, stacktrace.Propagate(err, "marshal client error")
+		}
+
+		err = c.redisDB.Set(key, string(data), c.redisTTL)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	c.local.set(key, item, c.localTTL)
+	return item, nil
+}
+
+func (c *Cache) Invalidate(bearerKey string) error {
+	key := bearerKeyCacheKey(bearerKey)
+	c.local.remove(key)
+	_, err := c.redisDB.Delete(key)
+	return err
+}
+
+// IsAllowedOrigin checks an origin against the allowed origins of every
+// enabled client, preflight requests carry no bearer key to narrow it down.
+func (c *Cache) IsAllowedOrigin(origin string, load func() ([]string, error)) (bool, error) {
+	c.originsMu.Lock()
+	defer c.originsMu.Unlock()
+
+	if c.origins == nil || time.Now().After(c.originsExpiresAt) {
+		origins, err := load()
+		if err != nil {
+			return false, err
+		}
+
+		c.origins = make(map[string]bool)
+		for _, allowed := range origins {
+			c.origins[allowed] = true
+		}
+
+		c.originsExpiresAt = time.Now().Add(c.localTTL)
+	}
+
+	return c.origins[origin], nil
+}
+
+func (c *Cache) InvalidateOrigins() {
+	c.originsMu.Lock()
+	defer c.originsMu.Unlock()
+
+	c.origins = nil
+}
+
+func (c *Cache) Stats() CacheStats {
+	return CacheStats{
+		LocalHits: c.localHits.Load(),
+		RedisHits: c.redisHits.Load(),
+		Misses:    c.misses.Load(),
+		LocalSize: c.local.len(),
+	}
+}
+
+// Bearer keys are hashed so the raw credential never shows up in Redis keys,
+// the values are cachedClient which leaves both secrets out
+func bearerKeyCacheKey(bearerKey string) string {
+	hash := sha256.Sum256([]byte(bearerKey))
+	return bearerKeyCachePrefix + hex.EncodeToString(hash[:])
+}
+
+// cachedClient is the Client stored in Redis, without the bearer key and
+// signing secret. A hit on the hashed key proves the caller holds the bearer
+// key, so it's put back from the request.
+type cachedClient struct {
+	ID               uuid.UUID           `json:"id"`
+	Name             string              `json:"name"`
+	RequireSignature bool                `json:"require_signature"`
+	Status           string              `json:"status"`
+	AllowedOrigins   database.StringList `json:"allowed_origins"`
+	RedirectURIs     database.StringList `json:"redirect_uris"`
+	AllowedCIDRs     database.StringList `json:"allowed_cidrs"`
+	CreatedAt        time.Time           `json:"created_at"`
+	UpdatedAt        time.Time           `json:"updated_at"`
+	Version          int                 `json:"version"`
+	DeletedAt        *time.Time          `json:"deleted_at"`
+}
+
+func newCachedClient(item *Client) cachedClient {
+	return cachedClient{
+		ID:               item.ID,
+		Name:             item.Name,
+		RequireSignature: item.RequireSignature,
+		Status:           item.Status,
+		AllowedOrigins:   item.AllowedOrigins,
+		RedirectURIs:     item.RedirectURIs,
+		AllowedCIDRs:     item.AllowedCIDRs,
+		CreatedAt:        item.CreatedAt,
+		UpdatedAt:        item.UpdatedAt,
+		Version:          item.Version,
+		DeletedAt:        item.DeletedAt,
+	}
+}
+
+func (c cachedClient) client(bearerKey string) *Client {
+	return &Client{
+		ID:               c.ID,
+		Name:             c.Name,
+		BearerKey:        bearerKey,
+		RequireSignature: c.RequireSignature,
+		Status:           c.Status,
+		AllowedOrigins:   c.AllowedOrigins,
+		RedirectURIs:     c.RedirectURIs,
+		AllowedCIDRs:     c.AllowedCIDRs,
+		CreatedAt:        c.CreatedAt,
+		UpdatedAt:        c.UpdatedAt,
+		Version:          c.Version,
+		DeletedAt:        c.DeletedAt,
+	}
+}
+
+type lruEntry struct {
+	key       string
+	item      *Client
+	expiresAt time.Time
+}
+
+type lruCache struct {
+	mu      sync.Mutex
+	size    int
+	order   *list.List
+	entries map[string]*list.Element
+}
+
+func newLRUCache(size int) *lruCache {
+	return &lruCache{
+		size:    size,
+		order:   list.New(),
+		entries: make(map[string]*list.Element),
+	}
+}
+
+func (l *lruCache) get(key string) (*Client, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	element, ok := l.entries[key]
+	if !ok {
+		return nil, false
+	}
+
+	entry := element.Value.(*lruEntry)
+	if time.Now().After(entry.expiresAt) {
+		l.order.Remove(element)
+		delete(l.entries, key)
+		return nil, false
+	}
+
+	l.order.MoveToFront(element)
+	return entry.item, true
+}
+
+func (l *lruCache) set(key string, item *Client, ttl time.Duration) {
+	if l.size <= 0 {
+		return
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if element, ok := l.entries[key]; ok {
+		element.Value = &lruEntry{key: key, item: item, expiresAt: time.Now().Add(ttl)}
+		l.order.MoveToFront(element)
+		return
+	}
+
+	l.entries[key] = l.order.PushFront(&lruEntry{key: key, item: item, expiresAt: time.Now().Add(ttl)})
+	for l.order.Len() > l.size {
+		oldest := l.order.Back()
+		l.order.Remove(oldest)
+		delete(l.entries, oldest.Value.(*lruEntry).key)
+	}
+}
+
+func (l *lruCache) remove(key string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if element, ok := l.entries[key]; ok {
+		l.order.Remove(element)
+		delete(l.entries, key)
+	}
+}
+
+func (l *lruCache) len() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.order.Len()
+}
@@ -0,0 +1,40 @@
+package client
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestCachedClientLeavesSecretsOut(t *testing.T) {
+	item := New("Stark Industries")
+	item.AllowedOrigins = append(item.AllowedOrigins, "https://stark.com")
+
+	data, err := json.Marshal(newCachedClient(item))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, field := range credentialFields {
+		if strings.Contains(string(data), field) {
+			t.Errorf("%s leaked in %s", field, data)
+		}
+	}
+
+	var cached cachedClient
+	err = json.Unmarshal(data, &cached)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Only the signing secret is lost, the bearer key comes from the request.
+	// The times lose their monotonic reading in JSON, so they aren't compared.
+	expected := *item
+	expected.SigningSecret = ""
+	actual := cached.client(item.BearerKey)
+	actual.CreatedAt, actual.UpdatedAt = expected.CreatedAt, expected.UpdatedAt
+	if !reflect.DeepEqual(*actual, expected) {
+		t.Errorf("expected %+v, got %+v", expected, *actual)
+	}
+}
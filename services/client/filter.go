@@ -3,6 +3,8 @@ package client
 type Filter struct {
 	Names      []string `json:"names"`
 	BearerKeys []string `json:"bearer_keys"`
+	// WithDeleted includes soft-deleted clients, e.g. for bearer key collisions.
+	WithDeleted bool `json:"-"`
 }
 
 func (f Filter) IsEmpty() bool {
@@ -10,6 +10,7 @@ import (
 	"github.com/google/uuid"
 	"github.com/palantir/stacktrace"
 
+	"stark/database"
 	"stark/failure"
 	"stark/respond"
 	"stark/utils"
@@ -27,7 +28,9 @@ func NewHandler(service *Service) *Handler {
 
 func (h *Handler) HandleCreate(c *gin.Context) {
 	ctx := activity.NewContext("client_create")
+	ctx = activity.WithInternalID(ctx, c.Value("internal_id").(string))
 	trx, _ := activity.GetTransactionID(ctx)
+	actor, _ := activity.GetInternalID(ctx)
 	var input Input
 
 	if err := c.ShouldBindJSON(&input); err != nil {
@@ -46,7 +49,7 @@ func (h *Handler) HandleCreate(c *gin.Context) {
 		return
 	}
 
-	user, err := h.service.Create(input.Name)
+	user, err := h.service.Create(actor, input.Name)
 	if err != nil {
 		if f, ok := stacktrace.RootCause(err).(failure.Failure); ok {
 			switch f.Code {
@@ -61,7 +64,7 @@ func (h *Handler) HandleCreate(c *gin.Context) {
 		return
 	}
 
-	respond.Success(c, trx, http.StatusCreated, user)
+	respond.Success(c, trx, http.StatusCreated, user.CredentialsView())
 }
 
 func (h *Handler) HandleDetail(c *gin.Context) {
@@ -88,12 +91,15 @@ func (h *Handler) HandleDetail(c *gin.Context) {
 		return
 	}
 
-	respond.Success(c, trx, http.StatusOK, user)
+	c.Header("ETag", utils.FormatETag(user.Version))
+	respond.Success(c, trx, http.StatusOK, user.InternalView())
 }
 
 func (h *Handler) HandleUpdate(c *gin.Context) {
 	ctx := activity.NewContext("client_update")
+	ctx = activity.WithInternalID(ctx, c.Value("internal_id").(string))
 	trx, _ := activity.GetTransactionID(ctx)
+	actor, _ := activity.GetInternalID(ctx)
 	userID, err := uuid.Parse(c.Param("id"))
 	if err != nil {
 		respond.Error(c, trx, http.StatusBadRequest, respond.ErrBadRequest, "invalid user id")
@@ -118,13 +124,16 @@ func (h *Handler) HandleUpdate(c *gin.Context) {
 		return
 	}
 
-	user, err := h.service.Update(userID, input.Name)
+	user, err := h.service.Update(actor, userID, c.GetInt("version"), input.Name)
 	if err != nil {
 		if f, ok := stacktrace.RootCause(err).(failure.Failure); ok {
 			switch f.Code {
 			case failure.CodeUserNotFound:
 				respond.Error(c, trx, http.StatusBadRequest, f.Code, f.Desc)
 				return
+			case failure.CodeVersionConflict:
+				respond.Error(c, trx, http.StatusPreconditionFailed, f.Code, f.Desc)
+				return
 			}
 		}
 
@@ -133,7 +142,214 @@ func (h *Handler) HandleUpdate(c *gin.Context) {
 		return
 	}
 
-	respond.Success(c, trx, http.StatusCreated, user)
+	c.Header("ETag", utils.FormatETag(user.Version))
+	respond.Success(c, trx, http.StatusCreated, user.InternalView())
+}
+
+func (h *Handler) HandleRotateKey(c *gin.Context) {
+	ctx := activity.NewContext("client_rotate_key")
+	ctx = activity.WithInternalID(ctx, c.Value("internal_id").(string))
+	trx, _ := activity.GetTransactionID(ctx)
+	actor, _ := activity.GetInternalID(ctx)
+	clientID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		respond.Error(c, trx, http.StatusBadRequest, respond.ErrBadRequest, "invalid client id")
+		return
+	}
+
+	client, err := h.service.RotateKey(actor, clientID)
+	if err != nil {
+		if f, ok := stacktrace.RootCause(err).(failure.Failure); ok {
+			switch f.Code {
+			case failure.CodeClientNotFound:
+				respond.Error(c, trx, http.StatusBadRequest, f.Code, f.Desc)
+				return
+			}
+		}
+
+		log.WithContext(ctx).Error(stacktrace.Propagate(err, "rotate client key error"))
+		respond.Error(c, trx, http.StatusInternalServerError, respond.ErrInternal, "unknown error")
+		return
+	}
+
+	c.Header("ETag", utils.FormatETag(client.Version))
+	respond.Success(c, trx, http.StatusCreated, client.CredentialsView())
+}
+
+func (h *Handler) HandleChangeStatus(c *gin.Context) {
+	ctx := activity.NewContext("client_change_status")
+	ctx = activity.WithInternalID(ctx, c.Value("internal_id").(string))
+	trx, _ := activity.GetTransactionID(ctx)
+	actor, _ := activity.GetInternalID(ctx)
+	clientID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		respond.Error(c, trx, http.StatusBadRequest, respond.ErrBadRequest, "invalid client id")
+		return
+	}
+
+	var input InputChangeStatus
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		var validationErrors validator.ValidationErrors
+		if errors.As(err, &validationErrors) {
+			out := make([]utils.ErrorMessage, 0)
+			for _, validationError := range validationErrors {
+				out = append(out, utils.ErrorMessage{
+					Field:   utils.ToSnakeCase(validationError.Field()),
+					Message: utils.GetErrorMessage(validationError),
+				})
+			}
+
+			respond.Invalid(c, trx, http.StatusBadRequest, out)
+		}
+		return
+	}
+
+	client, err := h.service.ChangeStatus(actor, clientID, c.GetInt("version"), input.Status)
+	if err != nil {
+		if f, ok := stacktrace.RootCause(err).(failure.Failure); ok {
+			switch f.Code {
+			case failure.CodeClientNotFound:
+				respond.Error(c, trx, http.StatusBadRequest, f.Code, f.Desc)
+				return
+			case failure.CodeVersionConflict:
+				respond.Error(c, trx, http.StatusPreconditionFailed, f.Code, f.Desc)
+				return
+			}
+		}
+
+		log.WithContext(ctx).Error(stacktrace.Propagate(err, "change client status error"))
+		respond.Error(c, trx, http.StatusInternalServerError, respond.ErrInternal, "unknown error")
+		return
+	}
+
+	c.Header("ETag", utils.FormatETag(client.Version))
+	respond.Success(c, trx, http.StatusCreated, client.InternalView())
+}
+
+func (h *Handler) HandleUpdateSettings(c *gin.Context) {
+	ctx := activity.NewContext("client_update_settings")
+	ctx = activity.WithInternalID(ctx, c.Value("internal_id").(string))
+	trx, _ := activity.GetTransactionID(ctx)
+	actor, _ := activity.GetInternalID(ctx)
+	clientID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		respond.Error(c, trx, http.StatusBadRequest, respond.ErrBadRequest, "invalid client id")
+		return
+	}
+
+	var input InputSettings
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		var validationErrors validator.ValidationErrors
+		if errors.As(err, &validationErrors) {
+			out := make([]utils.ErrorMessage, 0)
+			for _, validationError := range validationErrors {
+				out = append(out, utils.ErrorMessage{
+					Field:   utils.ToSnakeCase(validationError.Field()),
+					Message: utils.GetErrorMessage(validationError),
+				})
+			}
+
+			respond.Invalid(c, trx, http.StatusBadRequest, out)
+		}
+		return
+	}
+
+	client, err := h.service.UpdateSettings(actor, clientID, c.GetInt("version"), input.AllowedOrigins, input.RedirectURIs, input.AllowedCIDRs, input.RequireSignature)
+	if err != nil {
+		if f, ok := stacktrace.RootCause(err).(failure.Failure); ok {
+			switch f.Code {
+			case failure.CodeClientNotFound:
+				respond.Error(c, trx, http.StatusBadRequest, f.Code, f.Desc)
+				return
+			case failure.CodeVersionConflict:
+				respond.Error(c, trx, http.StatusPreconditionFailed, f.Code, f.Desc)
+				return
+			}
+		}
+
+		log.WithContext(ctx).Error(stacktrace.Propagate(err, "update client settings error"))
+		respond.Error(c, trx, http.StatusInternalServerError, respond.ErrInternal, "unknown error")
+		return
+	}
+
+	c.Header("ETag", utils.FormatETag(client.Version))
+	respond.Success(c, trx, http.StatusCreated, client.InternalView())
+}
+
+func (h *Handler) HandleDelete(c *gin.Context) {
+	ctx := activity.NewContext("client_delete")
+	ctx = activity.WithInternalID(ctx, c.Value("internal_id").(string))
+	trx, _ := activity.GetTransactionID(ctx)
+	actor, _ := activity.GetInternalID(ctx)
+	clientID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		respond.Error(c, trx, http.StatusBadRequest, respond.ErrBadRequest, "invalid client id")
+		return
+	}
+
+	client, err := h.service.Delete(actor, clientID)
+	if err != nil {
+		if f, ok := stacktrace.RootCause(err).(failure.Failure); ok {
+			switch f.Code {
+			case failure.CodeClientNotFound:
+				respond.Error(c, trx, http.StatusBadRequest, f.Code, f.Desc)
+				return
+			}
+		}
+
+		log.WithContext(ctx).Error(stacktrace.Propagate(err, "delete client error"))
+		respond.Error(c, trx, http.StatusInternalServerError, respond.ErrInternal, "unknown error")
+		return
+	}
+
+	respond.Success(c, trx, http.StatusOK, client.InternalView())
+}
+
+func (h *Handler) HandleAuditPage(c *gin.Context) {
+	ctx := activity.NewContext("client_audit_page")
+	trx, _ := activity.GetTransactionID(ctx)
+	clientID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		respond.Error(c, trx, http.StatusBadRequest, respond.ErrBadRequest, "invalid client id")
+		return
+	}
+
+	pageString := c.Query("page")
+	limitString := c.Query("limit")
+	page := 1
+	limit := 25
+	if pageString != "" {
+		page, err = strconv.Atoi(pageString)
+		if err != nil {
+			respond.Error(c, trx, http.StatusBadRequest, respond.ErrBadRequest, "invalid page")
+			return
+		}
+	}
+
+	if limitString != "" {
+		limit, err = strconv.Atoi(limitString)
+		if err != nil {
+			respond.Error(c, trx, http.StatusBadRequest, respond.ErrBadRequest, "invalid limit")
+			return
+		}
+	}
+
+	auditPage, err := h.service.FindAuditPage(clientID, page, limit)
+	if err != nil {
+		log.WithContext(ctx).Error(stacktrace.Propagate(err, "get client audit page error"))
+		respond.Error(c, trx, http.StatusInternalServerError, respond.ErrInternal, "unknown error")
+		return
+	}
+
+	respond.Success(c, trx, http.StatusOK, auditPage)
+}
+
+func (h *Handler) HandleCacheStats(c *gin.Context) {
+	ctx := activity.NewContext("client_cache_stats")
+	trx, _ := activity.GetTransactionID(ctx)
+	respond.Success(c, trx, http.StatusOK, h.service.CacheStats())
 }
 
 func (h *Handler) HandleAllByFilter(c *gin.Context) {
@@ -163,7 +379,7 @@ func (h *Handler) HandleAllByFilter(c *gin.Context) {
 		return
 	}
 
-	respond.Success(c, trx, http.StatusCreated, tenant)
+	respond.Success(c, trx, http.StatusCreated, InternalViews(tenant))
 }
 
 func (h *Handler) HandlePage(c *gin.Context) {
@@ -190,11 +406,43 @@ func (h *Handler) HandlePage(c *gin.Context) {
 		}
 	}
 
+	// A cursor query, empty for the first page, switches to keyset pagination
+	if cursor, ok := c.GetQuery("cursor"); ok {
+		total := c.DefaultQuery("total", database.TotalNone)
+		if !utils.IsInList([]string{database.TotalNone, database.TotalExact, database.TotalApproximate}, total) {
+			respond.Error(c, trx, http.StatusBadRequest, respond.ErrBadRequest, "invalid total, should be one of none exact approximate")
+			return
+		}
+
+		if limit <= 0 {
+			respond.Error(c, trx, http.StatusBadRequest, respond.ErrBadRequest, "invalid limit")
+			return
+		}
+
+		cursorPage, err := h.service.FindCursorPage(cursor, limit, total)
+		if err != nil {
+			if f, ok := stacktrace.RootCause(err).(failure.Failure); ok {
+				switch f.Code {
+				case failure.CodeInvalidCursor:
+					respond.Error(c, trx, http.StatusBadRequest, f.Code, f.Desc)
+					return
+				}
+			}
+
+			log.WithContext(ctx).Error(stacktrace.Propagate(err, "get client cursor page error"))
+			respond.Error(c, trx, http.StatusInternalServerError, respond.ErrInternal, "unknown error")
+			return
+		}
+
+		respond.Success(c, trx, http.StatusOK, cursorPage.InternalView())
+		return
+	}
+
 	tenantPage, err := h.service.FindPage(page, limit)
 	if err != nil {
 		respond.Error(c, trx, http.StatusBadRequest, respond.ErrInternal, err.Error())
 		return
 	}
 
-	respond.Success(c, trx, http.StatusOK, tenantPage)
+	respond.Success(c, trx, http.StatusOK, tenantPage.InternalView())
 }
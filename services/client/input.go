@@ -3,3 +3,14 @@ package client
 type Input struct {
 	Name string `json:"name" binding:"required"`
 }
+
+type InputChangeStatus struct {
+	Status string `json:"status" binding:"required,oneof=enabled disabled"`
+}
+
+type InputSettings struct {
+	AllowedOrigins   []string `json:"allowed_origins" binding:"dive,url"`
+	RedirectURIs     []string `json:"redirect_uris" binding:"dive,url"`
+	AllowedCIDRs     []string `json:"allowed_cidrs" binding:"dive,cidr"`
+	RequireSignature bool     `json:"require_signature"`
+}
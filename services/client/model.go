@@ -1,19 +1,39 @@
 package client
 
 import (
+	"net"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
 
+	"stark/database"
 	"stark/utils"
 )
 
+const (
+	StatusEnabled  = "enabled"
+	StatusDisabled = "disabled"
+)
+
 type Client struct {
 	ID        uuid.UUID `json:"id" db:"id"`
 	Name      string    `json:"name" db:"name"`
 	BearerKey string    `json:"bearer_key" db:"bearer_key"`
-	CreatedAt time.Time `json:"created_at" db:"created_at"`
-	UpdatedAt time.Time `json:"updated_at" db:"updated_at"`
+	// SigningSecret is the HMAC key for signed requests, RequireSignature
+	// rejects unsigned requests of this client.
+	SigningSecret    string `json:"signing_secret" db:"signing_secret"`
+	RequireSignature bool   `json:"require_signature" db:"require_signature"`
+	Status           string `json:"status" db:"status"`
+	// AllowedOrigins and RedirectURIs are matched exactly, an empty
+	// AllowedCIDRs list allows requests from any network.
+	AllowedOrigins database.StringList `json:"allowed_origins" db:"allowed_origins"`
+	RedirectURIs   database.StringList `json:"redirect_uris" db:"redirect_uris"`
+	AllowedCIDRs   database.StringList `json:"allowed_cidrs" db:"allowed_cidrs"`
+	CreatedAt      time.Time           `json:"created_at" db:"created_at"`
+	UpdatedAt      time.Time           `json:"updated_at" db:"updated_at"`
+	Version        int                 `json:"version" db:"version"`
+	DeletedAt      *time.Time          `json:"deleted_at" db:"deleted_at"`
 }
 
 func New(name string) *Client {
@@ -21,20 +41,115 @@ func New(name string) *Client {
 	bearer_key := utils.GenerateSecureToken(25)
 
 	return &Client{
-		ID:        id,
-		Name:      name,
-		BearerKey: bearer_key,
-		CreatedAt: time.Now(),
-		UpdatedAt: time.Now(),
+		ID:             id,
+		Name:           name,
+		BearerKey:      bearer_key,
+		SigningSecret:  utils.GenerateSecureToken(32),
+		Status:         StatusEnabled,
+		AllowedOrigins: database.StringList{},
+		RedirectURIs:   database.StringList{},
+		AllowedCIDRs:   database.StringList{},
+		CreatedAt:      time.Now(),
+		UpdatedAt:      time.Now(),
+		Version:        1,
 	}
 }
 
+// MatchVersion reports whether the client is still at the version the caller
+// read, 0 matches any version.
+func (u *Client) MatchVersion(version int) bool {
+	return version == 0 || u.Version == version
+}
+
 func (u *Client) Update(name string) {
 	u.Name = name
 	u.UpdatedAt = time.Now()
 }
 
+// RotateKey replaces both credentials, a leaked bearer key usually means the
+// signing secret stored next to it leaked as well.
+func (u *Client) RotateKey() {
+	u.BearerKey = utils.GenerateSecureToken(25)
+	u.SigningSecret = utils.GenerateSecureToken(32)
+	u.UpdatedAt = time.Now()
+}
+
+func (u *Client) ChangeStatus(status string) {
+	u.Status = status
+	u.UpdatedAt = time.Now()
+}
+
+func (u *Client) Delete() {
+	now := time.Now()
+	u.Status = StatusDisabled
+	u.UpdatedAt = now
+	u.DeletedAt = &now
+}
+
+func (u *Client) UpdateSettings(allowedOrigins, redirectURIs, allowedCIDRs []string, requireSignature bool) {
+	origins := make(database.StringList, 0, len(allowedOrigins))
+	for _, origin := range allowedOrigins {
+		origins = append(origins, NormalizeOrigin(origin))
+	}
+
+	u.AllowedOrigins = origins
+	u.RedirectURIs = append(database.StringList{}, redirectURIs...)
+	u.AllowedCIDRs = append(database.StringList{}, allowedCIDRs...)
+	u.RequireSignature = requireSignature
+	if u.SigningSecret == "" {
+		u.SigningSecret = utils.GenerateSecureToken(32)
+	}
+
+	u.UpdatedAt = time.Now()
+}
+
+func (u *Client) AllowsOrigin(origin string) bool {
+	return utils.IsInList(u.AllowedOrigins, NormalizeOrigin(origin))
+}
+
+func (u *Client) AllowsRedirectURI(uri string) bool {
+	return utils.IsInList(u.RedirectURIs, uri)
+}
+
+func (u *Client) AllowsIP(ip string) bool {
+	if len(u.AllowedCIDRs) == 0 {
+		return true
+	}
+
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return false
+	}
+
+	for _, cidr := range u.AllowedCIDRs {
+		_, network, err := net.ParseCIDR(cidr)
+		if err == nil && network.Contains(parsed) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (u *Client) IsEnabled() bool {
+	return u.Status == StatusEnabled && u.DeletedAt == nil
+}
+
+// NormalizeOrigin lowercases an origin and drops a trailing slash so it can be
+// compared with the Origin header sent by browsers.
+func NormalizeOrigin(origin string) string {
+	return strings.ToLower(strings.TrimSuffix(strings.TrimSpace(origin), "/"))
+}
+
 type Page struct {
 	Items []*Client `json:"items"`
 	Total int       `json:"total"`
 }
+
+// CursorPage is a keyset page, Total is only set when it was asked for
+type CursorPage struct {
+	Items      []*Client `json:"items"`
+	NextCursor string    `json:"next_cursor"`
+	PrevCursor string    `json:"prev_cursor"`
+	Total      *int      `json:"total,omitempty"`
+}
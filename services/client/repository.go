@@ -1,11 +1,18 @@
 package client
 
-import "github.com/google/uuid"
+import (
+	"github.com/google/uuid"
+
+	"stark/database"
+)
 
 type Repository interface {
 	Store(item *Client) error
 	FindByID(id uuid.UUID) (*Client, error)
 	FindByFilter(filter Filter) ([]*Client, error)
 	FindPage(offset, limit int) ([]*Client, error)
+	FindCursorPage(cursor *database.Cursor, limit int) ([]*Client, error)
 	FindTotalByFilter(filter Filter) (int, error)
+	FindApproximateTotal() (int, error)
+	FindAllowedOrigins() ([]string, error)
 }
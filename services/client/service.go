@@ -2,25 +2,39 @@ package client
 
 import (
 	"database/sql"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/palantir/stacktrace"
 
+	"stark/database"
 	"stark/failure"
+	"stark/services/client_audit"
+)
+
+var errVersionConflict = failure.WithMessage(
+	failure.CodeVersionConflict,
+	"client was changed by another request, fetch it again and retry with the new ETag",
 )
 
 type Service struct {
-	repo Repository
+	repo         Repository
+	cache        *Cache
+	auditService *client_audit.Service
 }
 
-func NewService(repo Repository) *Service {
-	return &Service{repo: repo}
+func NewService(repo Repository, cache *Cache, auditService *client_audit.Service) *Service {
+	return &Service{
+		repo:         repo,
+		cache:        cache,
+		auditService: auditService,
+	}
 }
 
-func (s *Service) Create(name string) (*Client, error) {
+func (s *Service) Create(actor, name string) (*Client, error) {
 	item := New(name)
 	for {
-		total, err := s.repo.FindTotalByFilter(Filter{BearerKeys: []string{item.BearerKey}})
+		total, err := s.repo.FindTotalByFilter(Filter{BearerKeys: []string{item.BearerKey}, WithDeleted: true})
 		if err != nil {
 			return nil, err
 		}
@@ -38,31 +52,125 @@ func (s *Service) Create(name string) (*Client, error) {
 		return nil, err
 	}
 
+	err = s.audit(client_audit.ActionCreate, actor, nil, item)
+	if err != nil {
+		return nil, err
+	}
+
 	return s.FindByID(item.ID)
 }
 
-func (s *Service) Update(id uuid.UUID, name string) (*Client, error) {
-	item, err := s.repo.FindByID(id)
+func (s *Service) Update(actor string, id uuid.UUID, version int, name string) (*Client, error) {
+	item, err := s.FindByID(id)
 	if err != nil {
-		if stacktrace.RootCause(err) == sql.ErrNoRows {
-			return nil, failure.WithMessage(
-				failure.CodeClientNotFound,
-				"client not found, id isn't in database",
-			)
+		return nil, err
+	}
+
+	if !item.MatchVersion(version) {
+		return nil, errVersionConflict
+	}
+
+	before := *item
+	item.Update(name)
+	err = s.store(client_audit.ActionUpdate, actor, &before, item)
+	if err != nil {
+		return nil, conflict(err)
+	}
+
+	return s.repo.FindByID(id)
+}
+
+func (s *Service) RotateKey(actor string, id uuid.UUID) (*Client, error) {
+	item, err := s.FindByID(id)
+	if err != nil {
+		return nil, err
+	}
+
+	before := *item
+	for {
+		item.RotateKey()
+		total, err := s.repo.FindTotalByFilter(Filter{BearerKeys: []string{item.BearerKey}, WithDeleted: true})
+		if err != nil {
+			return nil, err
 		}
 
+		if total == 0 {
+			break
+		}
+	}
+
+	err = s.store(client_audit.ActionRotateKey, actor, &before, item)
+	if err != nil {
 		return nil, err
 	}
 
-	item.Update(name)
-	err = s.repo.Store(item)
+	return s.repo.FindByID(id)
+}
+
+func (s *Service) ChangeStatus(actor string, id uuid.UUID, version int, status string) (*Client, error) {
+	item, err := s.FindByID(id)
 	if err != nil {
 		return nil, err
 	}
 
+	if !item.MatchVersion(version) {
+		return nil, errVersionConflict
+	}
+
+	before := *item
+	item.ChangeStatus(status)
+	err = s.store(client_audit.ActionChangeStatus, actor, &before, item)
+	if err != nil {
+		return nil, conflict(err)
+	}
+
 	return s.repo.FindByID(id)
 }
 
+func (s *Service) UpdateSettings(actor string, id uuid.UUID, version int, allowedOrigins, redirectURIs, allowedCIDRs []string, requireSignature bool) (*Client, error) {
+	item, err := s.FindByID(id)
+	if err != nil {
+		return nil, err
+	}
+
+	if !item.MatchVersion(version) {
+		return nil, errVersionConflict
+	}
+
+	before := *item
+	item.UpdateSettings(allowedOrigins, redirectURIs, allowedCIDRs, requireSignature)
+	err = s.store(client_audit.ActionUpdateSettings, actor, &before, item)
+	if err != nil {
+		return nil, conflict(err)
+	}
+
+	return s.repo.FindByID(id)
+}
+
+func (s *Service) IsAllowedOrigin(origin string) (bool, error) {
+	return s.cache.IsAllowedOrigin(NormalizeOrigin(origin), s.repo.FindAllowedOrigins)
+}
+
+func (s *Service) Delete(actor string, id uuid.UUID) (*Client, error) {
+	item, err := s.FindByID(id)
+	if err != nil {
+		return nil, err
+	}
+
+	before := *item
+	item.Delete()
+	err = s.store(client_audit.ActionDelete, actor, &before, item)
+	if err != nil {
+		return nil, err
+	}
+
+	return item, nil
+}
+
+func (s *Service) FindAuditPage(id uuid.UUID, page, limit int) (client_audit.Page, error) {
+	return s.auditService.FindPageByClientID(id.String(), page, limit)
+}
+
 func (s *Service) FindByID(id uuid.UUID) (*Client, error) {
 	item, err := s.repo.FindByID(id)
 	if err != nil {
@@ -79,6 +187,22 @@ func (s *Service) FindByID(id uuid.UUID) (*Client, error) {
 	return item, nil
 }
 
+// FindByBearerKey returns nil without error when no client owns the key
+func (s *Service) FindByBearerKey(bearerKey string) (*Client, error) {
+	return s.cache.GetByBearerKey(bearerKey, func() (*Client, error) {
+		items, err := s.repo.FindByFilter(Filter{BearerKeys: []string{bearerKey}})
+		if err != nil || len(items) == 0 {
+			return nil, err
+		}
+
+		return items[0], nil
+	})
+}
+
+func (s *Service) CacheStats() CacheStats {
+	return s.cache.Stats()
+}
+
 func (s *Service) FindAllByFilter(filter Filter) ([]*Client, error) {
 	return s.repo.FindByFilter(filter)
 }
@@ -100,3 +224,58 @@ func (s *Service) FindPage(page, limit int) (Page, error) {
 		Total: total,
 	}, nil
 }
+
+// FindCursorPage reads a keyset page, total is one of the database total
+// modes and the table is only counted when asked to.
+func (s *Service) FindCursorPage(cursor string, limit int, total string) (CursorPage, error) {
+	page, err := database.ReadCursorPage(
+		cursor,
+		limit,
+		total,
+		s.repo.FindCursorPage,
+		func(item *Client) (time.Time, string) {
+			return item.CreatedAt, item.ID.String()
+		},
+		func() (int, error) {
+			return s.repo.FindTotalByFilter(Filter{})
+		},
+		s.repo.FindApproximateTotal,
+	)
+
+	if err != nil {
+		return CursorPage{}, err
+	}
+
+	return CursorPage(page), nil
+}
+
+// store persists a changed client, drops the cached entry of the previous
+// bearer key and records the change in the audit trail.
+func (s *Service) store(action, actor string, before, after *Client) error {
+	err := s.repo.Store(after)
+	if err != nil {
+		return err
+	}
+
+	err = s.cache.Invalidate(before.BearerKey)
+	if err != nil {
+		return err
+	}
+
+	s.cache.InvalidateOrigins()
+	return s.audit(action, actor, before, after)
+}
+
+func (s *Service) audit(action, actor string, before, after *Client) error {
+	return s.auditService.Record(after.ID.String(), action, actor, before, after, "bearer_key", "signing_secret")
+}
+
+// conflict turns a write that lost the race on the row version into the same
+// failure as a stale If-Match.
+func conflict(err error) error {
+	if stacktrace.RootCause(err) == database.ErrVersionConflict {
+		return errVersionConflict
+	}
+
+	return err
+}
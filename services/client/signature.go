@@ -0,0 +1,41 @@
+package client
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+)
+
+// Sign returns the hex HMAC-SHA256 of a request, the signed string is the
+// method, request URI, hex SHA-256 of the body, unix timestamp and nonce
+// joined by newlines.
+func Sign(secret, method, requestURI string, body []byte, timestamp, nonce string) string {
+	bodyHash := sha256.Sum256(body)
+	return signHash(secret, method, requestURI, bodyHash[:], timestamp, nonce)
+}
+
+// VerifySignature takes the SHA-256 of the body rather than the body, so a
+// large one can be hashed as it streams in.
+func (u *Client) VerifySignature(method, requestURI string, bodyHash []byte, timestamp, nonce, signature string) bool {
+	if u.SigningSecret == "" {
+		return false
+	}
+
+	expected := signHash(u.SigningSecret, method, requestURI, bodyHash, timestamp, nonce)
+	return hmac.Equal([]byte(expected), []byte(strings.ToLower(signature)))
+}
+
+func signHash(secret, method, requestURI string, bodyHash []byte, timestamp, nonce string) string {
+	payload := strings.Join([]string{
+		strings.ToUpper(method),
+		requestURI,
+		hex.EncodeToString(bodyHash),
+		timestamp,
+		nonce,
+	}, "\n")
+
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(payload))
+	return hex.EncodeToString(mac.Sum(nil))
+}
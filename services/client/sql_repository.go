@@ -19,15 +19,23 @@ type sqlRepository struct {
 const (
 	selectCountQuery = "SELECT COUNT(*) FROM clients"
 	insertQuery      = `
-		INSERT INTO clients (id, name, bearer_key, created_at, updated_at) 
-		VALUES (?, ?, ?, ?, ?)
+		INSERT INTO clients (id, name, bearer_key, signing_secret, require_signature, status, allowed_origins, redirect_uris, allowed_cidrs, created_at, updated_at) 
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
 	`
 	updateQuery = `
 		UPDATE clients SET
 			name = ?,
 			bearer_key = ?,
-			updated_at = ?
-		WHERE id = ?
+			signing_secret = ?,
+			require_signature = ?,
+			status = ?,
+			allowed_origins = ?,
+			redirect_uris = ?,
+			allowed_cidrs = ?,
+			updated_at = ?,
+			deleted_at = ?,
+			version = version + 1
+		WHERE id = ? AND version = ?
 	`
 )
 
@@ -53,7 +61,8 @@ func (repo *sqlRepository) FindByID(id uuid.UUID) (result *Client, err error) {
 	dialect := goqu.Dialect("mysql")
 	dataset := dialect.From("clients")
 	dataset = dataset.Where(goqu.Ex{
-		"id": id.String(),
+		"id":         id.String(),
+		"deleted_at": nil,
 	})
 
 	sql, _, err := dataset.ToSQL()
@@ -76,6 +85,12 @@ func (repo *sqlRepository) FindByFilter(filter Filter) (result []*Client, err er
 
 	dialect := goqu.Dialect("mysql")
 	dataset := dialect.From("clients")
+	if !filter.WithDeleted {
+		dataset = dataset.Where(goqu.Ex{
+			"deleted_at": nil,
+		})
+	}
+
 	if len(filter.Names) != 0 {
 		dataset = dataset.Where(goqu.Ex{
 			"name": filter.Names,
@@ -104,6 +119,11 @@ func (repo *sqlRepository) FindByFilter(filter Filter) (result []*Client, err er
 func (repo *sqlRepository) FindPage(offset int, limit int) (result []*Client, err error) {
 	dialect := goqu.Dialect("mysql")
 	dataset := dialect.From("clients")
+	dataset = dataset.Where(goqu.Ex{
+		"deleted_at": nil,
+	})
+	dataset = dataset.Order(goqu.C("created_at").Asc(), goqu.C("id").Asc())
+
 	sql, _, err := dataset.ToSQL()
 	if err != nil {
 		return nil, stacktrace.Propagate(err, "sql error")
@@ -117,10 +137,39 @@ func (repo *sqlRepository) FindPage(offset int, limit int) (result []*Client, er
 	return
 }
 
+// FindCursorPage reads up to limit rows from the cursor, a backward cursor
+// returns them newest first
+func (repo *sqlRepository) FindCursorPage(cursor *database.Cursor, limit int) (result []*Client, err error) {
+	dialect := goqu.Dialect("mysql")
+	dataset := dialect.From("clients")
+	dataset = dataset.Where(goqu.Ex{
+		"deleted_at": nil,
+	})
+	dataset = cursor.Paginate(dataset, limit)
+
+	sql, _, err := dataset.ToSQL()
+	if err != nil {
+		return nil, stacktrace.Propagate(err, "sql error")
+	}
+
+	err = repo.mysqlDB.Select(&result, sql)
+	if err != nil {
+		return nil, stacktrace.Propagate(err, "select rows fails")
+	}
+
+	return result, nil
+}
+
 func (repo *sqlRepository) FindTotalByFilter(filter Filter) (total int, err error) {
 	dialect := goqu.Dialect("mysql")
 	dataset := dialect.From("clients")
 	dataset = dataset.Select(goqu.COUNT("*"))
+	if !filter.WithDeleted {
+		dataset = dataset.Where(goqu.Ex{
+			"deleted_at": nil,
+		})
+	}
+
 	if len(filter.Names) != 0 {
 		dataset = dataset.Where(goqu.ExOr{
 			"name": filter.Names,
@@ -146,6 +195,38 @@ func (repo *sqlRepository) FindTotalByFilter(filter Filter) (total int, err erro
 	return total, nil
 }
 
+func (repo *sqlRepository) FindApproximateTotal() (int, error) {
+	return repo.mysqlDB.ApproximateCount("clients")
+}
+
+func (repo *sqlRepository) FindAllowedOrigins() (result []string, err error) {
+	dialect := goqu.Dialect("mysql")
+	dataset := dialect.From("clients")
+	dataset = dataset.Select("allowed_origins")
+	dataset = dataset.Where(goqu.Ex{
+		"status":     StatusEnabled,
+		"deleted_at": nil,
+	})
+
+	sql, _, err := dataset.ToSQL()
+	if err != nil {
+		return nil, stacktrace.Propagate(err, "sql error")
+	}
+
+	var lists []database.StringList
+	err = repo.mysqlDB.Select(&lists, sql)
+	if err != nil {
+		return nil, stacktrace.Propagate(err, "select rows fails")
+	}
+
+	result = make([]string, 0)
+	for _, list := range lists {
+		result = append(result, list...)
+	}
+
+	return result, nil
+}
+
 func (repo *sqlRepository) existByID(id uuid.UUID) (bool, error) {
 	var total int
 	err := repo.mysqlDB.Get(&total, selectCountQuery+" WHERE id = ?", id)
@@ -162,6 +243,12 @@ func (repo *sqlRepository) insert(data *Client) error {
 			data.ID,
 			data.Name,
 			data.BearerKey,
+			data.SigningSecret,
+			data.RequireSignature,
+			data.Status,
+			data.AllowedOrigins,
+			data.RedirectURIs,
+			data.AllowedCIDRs,
 			data.CreatedAt,
 			data.UpdatedAt,
 		)
@@ -190,8 +277,16 @@ func (repo *sqlRepository) update(data *Client) error {
 		res, err := tx.Exec(updateQuery,
 			data.Name,
 			data.BearerKey,
+			data.SigningSecret,
+			data.RequireSignature,
+			data.Status,
+			data.AllowedOrigins,
+			data.RedirectURIs,
+			data.AllowedCIDRs,
 			data.UpdatedAt,
+			data.DeletedAt,
 			data.ID,
+			data.Version,
 		)
 
 		if err != nil {
@@ -204,9 +299,11 @@ func (repo *sqlRepository) update(data *Client) error {
 		}
 
 		if rowsAffected <= 0 {
-			return nil, errors.New("update client fails")
+			return nil, stacktrace.Propagate(database.ErrVersionConflict, "update client fails")
 		}
 
+		data.Version++
+
 		return nil, nil
 	})
 
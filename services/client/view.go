@@ -0,0 +1,94 @@
+package client
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+
+	"stark/database"
+)
+
+// InternalView is a client as seen by operators, without its credentials.
+// Those are only shown once, when they are issued.
+type InternalView struct {
+	ID               uuid.UUID           `json:"id"`
+	Name             string              `json:"name"`
+	RequireSignature bool                `json:"require_signature"`
+	Status           string              `json:"status"`
+	AllowedOrigins   database.StringList `json:"allowed_origins"`
+	RedirectURIs     database.StringList `json:"redirect_uris"`
+	AllowedCIDRs     database.StringList `json:"allowed_cidrs"`
+	CreatedAt        time.Time           `json:"created_at"`
+	UpdatedAt        time.Time           `json:"updated_at"`
+	Version          int                 `json:"version"`
+	DeletedAt        *time.Time          `json:"deleted_at"`
+}
+
+// CredentialsView is a client with the bearer key and signing secret, for the
+// responses that issue them
+type CredentialsView struct {
+	InternalView
+	BearerKey     string `json:"bearer_key"`
+	SigningSecret string `json:"signing_secret"`
+}
+
+type InternalPage struct {
+	Items []InternalView `json:"items"`
+	Total int            `json:"total"`
+}
+
+type InternalCursorPage struct {
+	Items      []InternalView `json:"items"`
+	NextCursor string         `json:"next_cursor"`
+	PrevCursor string         `json:"prev_cursor"`
+	Total      *int           `json:"total,omitempty"`
+}
+
+func (u *Client) InternalView() InternalView {
+	return InternalView{
+		ID:               u.ID,
+		Name:             u.Name,
+		RequireSignature: u.RequireSignature,
+		Status:           u.Status,
+		AllowedOrigins:   u.AllowedOrigins,
+		RedirectURIs:     u.RedirectURIs,
+		AllowedCIDRs:     u.AllowedCIDRs,
+		CreatedAt:        u.CreatedAt,
+		UpdatedAt:        u.UpdatedAt,
+		Version:          u.Version,
+		DeletedAt:        u.DeletedAt,
+	}
+}
+
+func (u *Client) CredentialsView() CredentialsView {
+	return CredentialsView{
+		InternalView:  u.InternalView(),
+		BearerKey:     u.BearerKey,
+		SigningSecret: u.SigningSecret,
+	}
+}
+
+func InternalViews(items []*Client) []InternalView {
+	views := make([]InternalView, 0, len(items))
+	for _, item := range items {
+		views = append(views, item.InternalView())
+	}
+
+	return views
+}
+
+func (p Page) InternalView() InternalPage {
+	return InternalPage{
+		Items: InternalViews(p.Items),
+		Total: p.Total,
+	}
+}
+
+func (p CursorPage) InternalView() InternalCursorPage {
+	return InternalCursorPage{
+		Items:      InternalViews(p.Items),
+		NextCursor: p.NextCursor,
+		PrevCursor: p.PrevCursor,
+		Total:      p.Total,
+	}
+}
@@ -0,0 +1,46 @@
+package client
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+// credentialFields are only shown by CredentialsView, when they are issued
+var credentialFields = []string{`"bearer_key"`, `"signing_secret"`}
+
+func TestOnlyCredentialsViewCarriesSecrets(t *testing.T) {
+	item := New("Stark Industries")
+	total := 1
+
+	tests := []struct {
+		name        string
+		view        interface{}
+		withSecrets bool
+	}{
+		{"InternalView", item.InternalView(), false},
+		{"InternalViews", InternalViews([]*Client{item}), false},
+		{"InternalPage", Page{Items: []*Client{item}, Total: 1}.InternalView(), false},
+		{"InternalCursorPage", CursorPage{Items: []*Client{item}, Total: &total}.InternalView(), false},
+		{"CredentialsView", item.CredentialsView(), true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			data, err := json.Marshal(test.view)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if strings.Contains(string(data), `"password"`) {
+				t.Errorf(`"password" leaked in %s`, data)
+			}
+
+			for _, field := range credentialFields {
+				if strings.Contains(string(data), field) != test.withSecrets {
+					t.Errorf("%s presence should be %v in %s", field, test.withSecrets, data)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,113 @@
+package client_audit
+
+import (
+	"encoding/json"
+	"reflect"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"stark/utils"
+)
+
+const (
+	ActionCreate         = "create"
+	ActionUpdate         = "update"
+	ActionRotateKey      = "rotate_key"
+	ActionChangeStatus   = "change_status"
+	ActionUpdateSettings = "update_settings"
+	ActionDelete         = "delete"
+
+	redactedValue = "[redacted]"
+)
+
+type Change struct {
+	Old interface{} `json:"old" bson:"old"`
+	New interface{} `json:"new" bson:"new"`
+}
+
+type ClientAudit struct {
+	ID        primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	ClientID  string             `json:"client_id" bson:"client_id"`
+	Action    string             `json:"action" bson:"action"`
+	Actor     string             `json:"actor" bson:"actor"`
+	Changes   map[string]Change  `json:"changes" bson:"changes"`
+	CreatedAt time.Time          `json:"created_at" bson:"created_at"`
+}
+
+func New(clientID, action, actor string, changes map[string]Change) *ClientAudit {
+	return &ClientAudit{
+		ClientID:  clientID,
+		Action:    action,
+		Actor:     actor,
+		Changes:   changes,
+		CreatedAt: time.Now(),
+	}
+}
+
+type Page struct {
+	Items []*ClientAudit `json:"items"`
+	Total int            `json:"total"`
+}
+
+// Diff compares the JSON representation of two snapshots and returns the
+// fields that differ, either side may be nil. Values of the redacted fields
+// are masked so secrets only show up as changed.
+func Diff(before, after interface{}, redacted ...string) (map[string]Change, error) {
+	oldFields, err := toMap(before)
+	if err != nil {
+		return nil, err
+	}
+
+	newFields, err := toMap(after)
+	if err != nil {
+		return nil, err
+	}
+
+	changes := make(map[string]Change)
+	for field := range oldFields {
+		if _, ok := newFields[field]; !ok {
+			newFields[field] = nil
+		}
+	}
+
+	for field, value := range newFields {
+		if reflect.DeepEqual(oldFields[field], value) {
+			continue
+		}
+
+		change := Change{Old: oldFields[field], New: value}
+		if utils.IsInList(redacted, field) {
+			if change.Old != nil {
+				change.Old = redactedValue
+			}
+
+			if change.New != nil {
+				change.New = redactedValue
+			}
+		}
+
+		changes[field] = change
+	}
+
+	return changes, nil
+}
+
+func toMap(item interface{}) (map[string]interface{}, error) {
+	result := make(map[string]interface{})
+	if item == nil || reflect.ValueOf(item).IsNil() {
+		return result, nil
+	}
+
+	data, err := json.Marshal(item)
+	if err != nil {
+		return nil, err
+	}
+
+	err = json.Unmarshal(data, &result)
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
@@ -0,0 +1,64 @@
+package client_audit
+
+import (
+	"os"
+
+	"github.com/palantir/stacktrace"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"stark/utils/activity"
+)
+
+const collectionName = "client_audits"
+
+type mongoRepository struct {
+	collection *mongo.Collection
+}
+
+func NewMongoRepository(mongoDB *mongo.Client) Repository {
+	collection := mongoDB.Database(os.Getenv("MONGO_DATABASE")).Collection(collectionName)
+	return &mongoRepository{collection}
+}
+
+func (repo *mongoRepository) Store(item *ClientAudit) error {
+	ctx := activity.NewContext("client_audit_store")
+	_, err := repo.collection.InsertOne(ctx, item)
+	if err != nil {
+		return stacktrace.Propagate(err, "can't insert client audit")
+	}
+
+	return nil
+}
+
+func (repo *mongoRepository) FindPageByClientID(clientID string, offset, limit int) (result []*ClientAudit, err error) {
+	ctx := activity.NewContext("client_audit_find_page_by_client_id")
+	opts := options.Find().
+		SetSort(bson.D{{Key: "created_at", Value: -1}}).
+		SetSkip(int64(offset)).
+		SetLimit(int64(limit))
+
+	cursor, err := repo.collection.Find(ctx, bson.M{"client_id": clientID}, opts)
+	if err != nil {
+		return nil, stacktrace.Propagate(err, "can't find client audits by client id")
+	}
+
+	result = make([]*ClientAudit, 0)
+	err = cursor.All(ctx, &result)
+	if err != nil {
+		return nil, stacktrace.Propagate(err, "can't decode client audits")
+	}
+
+	return result, nil
+}
+
+func (repo *mongoRepository) FindTotalByClientID(clientID string) (int, error) {
+	ctx := activity.NewContext("client_audit_total_by_client_id")
+	total, err := repo.collection.CountDocuments(ctx, bson.M{"client_id": clientID})
+	if err != nil {
+		return 0, stacktrace.Propagate(err, "can't count client audits by client id")
+	}
+
+	return int(total), nil
+}
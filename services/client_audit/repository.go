@@ -0,0 +1,7 @@
+package client_audit
+
+type Repository interface {
+	Store(item *ClientAudit) error
+	FindPageByClientID(clientID string, offset, limit int) ([]*ClientAudit, error)
+	FindTotalByClientID(clientID string) (int, error)
+}
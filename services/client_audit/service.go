@@ -0,0 +1,38 @@
+package client_audit
+
+import "github.com/palantir/stacktrace"
+
+type Service struct {
+	repo Repository
+}
+
+func NewService(repo Repository) *Service {
+	return &Service{repo: repo}
+}
+
+func (s *Service) Record(clientID, action, actor string, before, after interface{}, redacted ...string) error {
+	changes, err := Diff(before, after, redacted...)
+	if err != nil {
+		return stacktrace.Propagate(err, "diff client audit error")
+	}
+
+	return s.repo.Store(New(clientID, action, actor, changes))
+}
+
+func (s *Service) FindPageByClientID(clientID string, page, limit int) (Page, error) {
+	offset := (page - 1) * limit
+	items, err := s.repo.FindPageByClientID(clientID, offset, limit)
+	if err != nil {
+		return Page{}, err
+	}
+
+	total, err := s.repo.FindTotalByClientID(clientID)
+	if err != nil {
+		return Page{}, err
+	}
+
+	return Page{
+		Items: items,
+		Total: total,
+	}, nil
+}
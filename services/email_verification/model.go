@@ -21,3 +21,8 @@ func New(email string) *EmailVerification {
 		CreatedAt: time.Now(),
 	}
 }
+
+// IsExpired reports whether the token is older than ttl
+func (e *EmailVerification) IsExpired(ttl time.Duration) bool {
+	return time.Since(e.CreatedAt) > ttl
+}
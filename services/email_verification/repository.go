@@ -4,4 +4,5 @@ type Repository interface {
 	Store(data *EmailVerification) error
 	FindByToken(token string) (*EmailVerification, error)
 	FindTotalByFilter(filter Filter) (int, error)
+	DeleteByEmail(email string) error
 }
@@ -2,18 +2,24 @@ package email_verification
 
 import (
 	"database/sql"
+	"time"
 
 	"github.com/palantir/stacktrace"
 
 	"stark/failure"
+	"stark/utils"
 )
 
 type Service struct {
 	repo Repository
+	ttl  time.Duration
 }
 
 func NewService(repo Repository) *Service {
-	return &Service{repo: repo}
+	return &Service{
+		repo: repo,
+		ttl:  utils.GetDurationEnv("EMAIL_VERIFICATION_TTL", 24*time.Hour),
+	}
 }
 
 func (s *Service) Create(email string) (*EmailVerification, error) {
@@ -53,5 +59,18 @@ func (s *Service) FindByToken(token string) (*EmailVerification, error) {
 		return nil, err
 	}
 
+	if item.IsExpired(s.ttl) {
+		return nil, failure.WithMessage(
+			failure.CodeTokenExpired,
+			"email verification expired, request a new verification email",
+		)
+	}
+
 	return item, nil
 }
+
+// DeleteByEmail removes every token sent to email, once it's verified none
+// of them may be used again
+func (s *Service) DeleteByEmail(email string) error {
+	return s.repo.DeleteByEmail(email)
+}
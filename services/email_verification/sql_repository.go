@@ -21,6 +21,7 @@ const (
 		INSERT INTO email_verifications (email, token, created_at) 
 		VALUES (?, ?, ?)
 	`
+	deleteEmailVerificationQuery = "DELETE FROM email_verifications WHERE email = ?"
 )
 
 func NewSQLRepository(mysqlDB *database.MySQL) Repository {
@@ -75,6 +76,15 @@ func (repo *sqlRepository) FindTotalByFilter(filter Filter) (total int, err erro
 	return total, nil
 }
 
+func (repo *sqlRepository) DeleteByEmail(email string) error {
+	_, err := repo.mysqlDB.WithTransaction(func(tx *sqlx.Tx) (interface{}, error) {
+		_, err := tx.Exec(deleteEmailVerificationQuery, email)
+		return nil, err
+	})
+
+	return err
+}
+
 func (repo *sqlRepository) insert(data *EmailVerification) error {
 	_, err := repo.mysqlDB.WithTransaction(func(tx *sqlx.Tx) (interface{}, error) {
 		res, err := tx.Exec(insertEmailVerificationQuery,
@@ -0,0 +1,6 @@
+package identity_verification
+
+type Filter struct {
+	UserID   string
+	Statuses []string
+}
@@ -0,0 +1,257 @@
+package identity_verification
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+	"github.com/google/uuid"
+	"github.com/palantir/stacktrace"
+
+	"stark/failure"
+	"stark/respond"
+	"stark/services/profile_trail"
+	"stark/services/user_detail"
+	"stark/utils"
+	"stark/utils/activity"
+	"stark/utils/log"
+)
+
+type Handler struct {
+	service *Service
+}
+
+func NewHandler(service *Service) *Handler {
+	return &Handler{service: service}
+}
+
+// HandleSubmit takes the ID card number as a field and the id_card and selfie
+// images as files of a multipart form
+func (h *Handler) HandleSubmit(c *gin.Context) {
+	ctx := activity.NewContext("identity_verification_submit")
+	ctx = activity.WithUserID(ctx, c.Value("user_id").(string))
+	trx, _ := activity.GetTransactionID(ctx)
+	userID, _ := activity.GetUserID(ctx)
+	id, err := uuid.Parse(userID)
+	if err != nil {
+		respond.Error(c, trx, http.StatusBadRequest, respond.ErrBadRequest, "invalid user id")
+		return
+	}
+
+	// The files are read first, binding the form field would parse the whole
+	// body without the upload limit
+	files, err := user_detail.ReadUploads(c, "id_card", "selfie")
+	if err != nil {
+		if f, ok := stacktrace.RootCause(err).(failure.Failure); ok {
+			switch f.Code {
+			case failure.CodeInvalidImage:
+				respond.Error(c, trx, http.StatusBadRequest, f.Code, f.Desc)
+				return
+			case failure.CodeUploadTooLarge:
+				respond.Error(c, trx, http.StatusRequestEntityTooLarge, f.Code, f.Desc)
+				return
+			}
+		}
+
+		log.WithContext(ctx).Error(stacktrace.Propagate(err, "read identity verification documents error"))
+		respond.Error(c, trx, http.StatusInternalServerError, respond.ErrInternal, "unknown error")
+		return
+	}
+
+	var input Input
+
+	if err := c.ShouldBind(&input); err != nil {
+		var validationErrors validator.ValidationErrors
+		if errors.As(err, &validationErrors) {
+			out := make([]utils.ErrorMessage, 0)
+			for _, validationError := range validationErrors {
+				out = append(out, utils.ErrorMessage{
+					Field:   utils.ToSnakeCase(validationError.Field()),
+					Message: utils.GetErrorMessage(validationError),
+				})
+			}
+
+			respond.Invalid(c, trx, http.StatusBadRequest, out)
+		}
+		return
+	}
+
+	item, err := h.service.Submit(id, input.IDCardNumber, files[0], files[1])
+	if err != nil {
+		if f, ok := stacktrace.RootCause(err).(failure.Failure); ok {
+			switch f.Code {
+			case failure.CodeUserNotFound, failure.CodeInvalidImage:
+				respond.Error(c, trx, http.StatusBadRequest, f.Code, f.Desc)
+				return
+			case failure.CodeIdentityVerificationPending, failure.CodeIdentityAlreadyVerified:
+				respond.Error(c, trx, http.StatusConflict, f.Code, f.Desc)
+				return
+			}
+		}
+
+		log.WithContext(ctx).Error(stacktrace.Propagate(err, "submit identity verification error"))
+		respond.Error(c, trx, http.StatusInternalServerError, respond.ErrInternal, "unknown error")
+		return
+	}
+
+	respond.Success(c, trx, http.StatusCreated, item.SelfView())
+}
+
+// HandleSelf reads the latest request of the user
+func (h *Handler) HandleSelf(c *gin.Context) {
+	ctx := activity.NewContext("identity_verification_self")
+	ctx = activity.WithUserID(ctx, c.Value("user_id").(string))
+	trx, _ := activity.GetTransactionID(ctx)
+	userID, _ := activity.GetUserID(ctx)
+	id, err := uuid.Parse(userID)
+	if err != nil {
+		respond.Error(c, trx, http.StatusBadRequest, respond.ErrBadRequest, "invalid user id")
+		return
+	}
+
+	item, err := h.service.FindLatestByUserID(id)
+	if err != nil {
+		if f, ok := stacktrace.RootCause(err).(failure.Failure); ok {
+			switch f.Code {
+			case failure.CodeIdentityVerificationNotFound:
+				respond.Error(c, trx, http.StatusNotFound, f.Code, f.Desc)
+				return
+			}
+		}
+
+		log.WithContext(ctx).Error(stacktrace.Propagate(err, "get own identity verification error"))
+		respond.Error(c, trx, http.StatusInternalServerError, respond.ErrInternal, "unknown error")
+		return
+	}
+
+	respond.Success(c, trx, http.StatusOK, item.SelfView())
+}
+
+// HandlePage lists the requests for reviewers, oldest first and optionally
+// narrowed by status and user_id
+func (h *Handler) HandlePage(c *gin.Context) {
+	ctx := activity.NewContext("identity_verification_page")
+	ctx = activity.WithInternalID(ctx, c.Value("internal_id").(string))
+	trx, _ := activity.GetTransactionID(ctx)
+	filter := Filter{UserID: c.Query("user_id")}
+	if status := c.Query("status"); status != "" {
+		filter.Statuses = []string{status}
+	}
+
+	var err error
+	pageString := c.Query("page")
+	limitString := c.Query("limit")
+	page := 1
+	limit := 25
+	if pageString != "" {
+		page, err = strconv.Atoi(pageString)
+		if err != nil || page < 1 {
+			respond.Error(c, trx, http.StatusBadRequest, respond.ErrBadRequest, "invalid page")
+			return
+		}
+	}
+
+	if limitString != "" {
+		limit, err = strconv.Atoi(limitString)
+		if err != nil || limit < 1 {
+			respond.Error(c, trx, http.StatusBadRequest, respond.ErrBadRequest, "invalid limit")
+			return
+		}
+	}
+
+	verificationPage, err := h.service.FindPage(filter, page, limit)
+	if err != nil {
+		log.WithContext(ctx).Error(stacktrace.Propagate(err, "get identity verification page error"))
+		respond.Error(c, trx, http.StatusInternalServerError, respond.ErrInternal, "unknown error")
+		return
+	}
+
+	respond.Success(c, trx, http.StatusOK, verificationPage.InternalView())
+}
+
+func (h *Handler) HandleDetail(c *gin.Context) {
+	ctx := activity.NewContext("identity_verification_detail")
+	ctx = activity.WithInternalID(ctx, c.Value("internal_id").(string))
+	trx, _ := activity.GetTransactionID(ctx)
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		respond.Error(c, trx, http.StatusBadRequest, respond.ErrBadRequest, "invalid identity verification id")
+		return
+	}
+
+	item, err := h.service.FindByID(id)
+	if err != nil {
+		if f, ok := stacktrace.RootCause(err).(failure.Failure); ok {
+			switch f.Code {
+			case failure.CodeIdentityVerificationNotFound:
+				respond.Error(c, trx, http.StatusNotFound, f.Code, f.Desc)
+				return
+			}
+		}
+
+		log.WithContext(ctx).Error(stacktrace.Propagate(err, "get identity verification error"))
+		respond.Error(c, trx, http.StatusInternalServerError, respond.ErrInternal, "unknown error")
+		return
+	}
+
+	c.Header("ETag", utils.FormatETag(item.Version))
+	respond.Success(c, trx, http.StatusOK, item.InternalView())
+}
+
+// HandleReview moves a request to in_review, approved or rejected on behalf
+// of the internal caller
+func (h *Handler) HandleReview(c *gin.Context) {
+	ctx := activity.NewContext("identity_verification_review")
+	ctx = activity.WithInternalID(ctx, c.Value("internal_id").(string))
+	trx, _ := activity.GetTransactionID(ctx)
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		respond.Error(c, trx, http.StatusBadRequest, respond.ErrBadRequest, "invalid identity verification id")
+		return
+	}
+
+	var input InputReview
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		var validationErrors validator.ValidationErrors
+		if errors.As(err, &validationErrors) {
+			out := make([]utils.ErrorMessage, 0)
+			for _, validationError := range validationErrors {
+				out = append(out, utils.ErrorMessage{
+					Field:   utils.ToSnakeCase(validationError.Field()),
+					Message: utils.GetErrorMessage(validationError),
+				})
+			}
+
+			respond.Invalid(c, trx, http.StatusBadRequest, out)
+		}
+		return
+	}
+
+	origin := profile_trail.NewOrigin(ctx, c.ClientIP(), c.Request.UserAgent())
+	item, err := h.service.Review(origin, id, c.GetInt("version"), input.Status, input.Note)
+	if err != nil {
+		if f, ok := stacktrace.RootCause(err).(failure.Failure); ok {
+			switch f.Code {
+			case failure.CodeIdentityVerificationNotFound:
+				respond.Error(c, trx, http.StatusNotFound, f.Code, f.Desc)
+				return
+			case failure.CodeInvalidStatusTransition:
+				respond.Error(c, trx, http.StatusConflict, f.Code, f.Desc)
+				return
+			case failure.CodeVersionConflict:
+				respond.Error(c, trx, http.StatusPreconditionFailed, f.Code, f.Desc)
+				return
+			}
+		}
+
+		log.WithContext(ctx).Error(stacktrace.Propagate(err, "review identity verification error"))
+		respond.Error(c, trx, http.StatusInternalServerError, respond.ErrInternal, "unknown error")
+		return
+	}
+
+	c.Header("ETag", utils.FormatETag(item.Version))
+	respond.Success(c, trx, http.StatusOK, item.InternalView())
+}
@@ -0,0 +1,13 @@
+package identity_verification
+
+// Input is the form part of a submission, the ID card and selfie images are
+// the id_card and selfie files of the same multipart form
+type Input struct {
+	IDCardNumber string `form:"id_card_number" binding:"required,numeric,len=16"`
+}
+
+// InputReview moves a request along, a rejection has to tell the user why
+type InputReview struct {
+	Status string `json:"status" binding:"required,oneof=in_review approved rejected"`
+	Note   string `json:"note" binding:"required_if=Status rejected,max=500"`
+}
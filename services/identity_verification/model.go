@@ -0,0 +1,96 @@
+package identity_verification
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	StatusSubmitted = "submitted"
+	StatusInReview  = "in_review"
+	StatusApproved  = "approved"
+	StatusRejected  = "rejected"
+)
+
+// transitions are the statuses a request can move to from each status, an
+// approved or rejected request is final
+var transitions = map[string][]string{
+	StatusSubmitted: {StatusInReview, StatusApproved, StatusRejected},
+	StatusInReview:  {StatusApproved, StatusRejected},
+}
+
+// IdentityVerification is a request of a user to have their identity checked
+// against their ID card (KTP). The document images are private files, the
+// urls are signed on read.
+type IdentityVerification struct {
+	ID           uuid.UUID  `json:"id" db:"id"`
+	UserID       uuid.UUID  `json:"user_id" db:"user_id"`
+	IDCardNumber string     `json:"id_card_number" db:"id_card_number"`
+	IDCardPath   string     `json:"id_card_path" db:"id_card_path"`
+	IDCardUrl    string     `json:"id_card_url" db:"-"`
+	SelfiePath   string     `json:"selfie_path" db:"selfie_path"`
+	SelfieUrl    string     `json:"selfie_url" db:"-"`
+	Status       string     `json:"status" db:"status"`
+	Reviewer     string     `json:"reviewer" db:"reviewer"`
+	ReviewerNote string     `json:"reviewer_note" db:"reviewer_note"`
+	ReviewedAt   *time.Time `json:"reviewed_at" db:"reviewed_at"`
+	CreatedAt    time.Time  `json:"created_at" db:"created_at"`
+	UpdatedAt    time.Time  `json:"updated_at" db:"updated_at"`
+	Version      int        `json:"version" db:"version"`
+}
+
+func New(id, userID uuid.UUID, idCardNumber, idCardPath, selfiePath string) *IdentityVerification {
+	return &IdentityVerification{
+		ID:           id,
+		UserID:       userID,
+		IDCardNumber: idCardNumber,
+		IDCardPath:   idCardPath,
+		SelfiePath:   selfiePath,
+		Status:       StatusSubmitted,
+		CreatedAt:    time.Now(),
+		UpdatedAt:    time.Now(),
+		Version:      1,
+	}
+}
+
+// MatchVersion reports whether the request is still at the version the
+// caller read, 0 matches any version.
+func (v *IdentityVerification) MatchVersion(version int) bool {
+	return version == 0 || v.Version == version
+}
+
+// IsOpen reports whether the request still waits for a decision
+func (v *IdentityVerification) IsOpen() bool {
+	return v.Status == StatusSubmitted || v.Status == StatusInReview
+}
+
+// CanMoveTo reports whether the request can go from its status to status
+func (v *IdentityVerification) CanMoveTo(status string) bool {
+	for _, next := range transitions[v.Status] {
+		if next == status {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Review moves the request to status on behalf of reviewer, a decision is
+// timestamped with ReviewedAt.
+func (v *IdentityVerification) Review(status, reviewer, note string) {
+	now := time.Now()
+	v.Status = status
+	v.Reviewer = reviewer
+	v.ReviewerNote = note
+	if status == StatusApproved || status == StatusRejected {
+		v.ReviewedAt = &now
+	}
+
+	v.UpdatedAt = now
+}
+
+type Page struct {
+	Items []*IdentityVerification `json:"items"`
+	Total int                     `json:"total"`
+}
@@ -0,0 +1,19 @@
+package identity_verification
+
+import (
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+)
+
+type Repository interface {
+	// WithTx returns the repository writing and reading in tx, the owner of
+	// tx commits or rolls back
+	WithTx(tx *sqlx.Tx) Repository
+	Store(item *IdentityVerification) error
+	StoreStatus(item *IdentityVerification) error
+	FindByID(id uuid.UUID) (*IdentityVerification, error)
+	FindLatestByUserID(userID uuid.UUID) (*IdentityVerification, error)
+	FindByUserID(userID uuid.UUID) ([]*IdentityVerification, error)
+	FindPage(filter Filter, offset, limit int) ([]*IdentityVerification, error)
+	FindTotal(filter Filter) (int, error)
+}
@@ -0,0 +1,346 @@
+package identity_verification
+
+import (
+	"database/sql"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/palantir/stacktrace"
+
+	"stark/database"
+	"stark/failure"
+	"stark/services/notification"
+	"stark/services/profile_trail"
+	"stark/services/user"
+	"stark/services/user_detail"
+	"stark/services/webhook"
+	"stark/utils/activity"
+	"stark/utils/log"
+	"stark/utils/storage"
+)
+
+// documentPrefix holds the document images, under a folder per user and
+// request
+const documentPrefix = "identity-verifications/"
+
+var errVersionConflict = failure.WithMessage(
+	failure.CodeVersionConflict,
+	"identity verification was changed by another request, fetch it again and retry with the new ETag",
+)
+
+type Service struct {
+	mysqlDB             *database.MySQL
+	repo                Repository
+	userService         *user.Service
+	userDetailService   *user_detail.Service
+	notificationService *notification.Service
+	webhookService      *webhook.Service
+	profileTrailService *profile_trail.Service
+	fileStorage         storage.Storage
+}
+
+func NewService(
+	mysqlDB *database.MySQL,
+	repo Repository,
+	userService *user.Service,
+	userDetailService *user_detail.Service,
+	notificationService *notification.Service,
+	webhookService *webhook.Service,
+	profileTrailService *profile_trail.Service,
+	fileStorage storage.Storage,
+) *Service {
+	return &Service{
+		mysqlDB:             mysqlDB,
+		repo:                repo,
+		userService:         userService,
+		userDetailService:   userDetailService,
+		notificationService: notificationService,
+		webhookService:      webhookService,
+		profileTrailService: profileTrailService,
+		fileStorage:         fileStorage,
+	}
+}
+
+// Submit stores the document images and queues a request for review. A user
+// has at most one open request and none once their identity is verified. The
+// row of the user is locked while that is checked and the request stored, so
+// concurrent submits of one user can't both pass the check.
+func (s *Service) Submit(userID uuid.UUID, idCardNumber string, idCard, selfie []byte) (*IdentityVerification, error) {
+	item, err := s.userService.FindByID(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Checked before the images are stored to fail fast, and again under the
+	// lock where it counts
+	err = checkSubmittable(s.repo, item)
+	if err != nil {
+		return nil, err
+	}
+
+	id := uuid.New()
+	prefix := documentPrefix + userID.String() + "/" + id.String() + "/"
+	idCardPath, err := s.userDetailService.StorePrivateImage(prefix+"id_card", idCard)
+	if err != nil {
+		return nil, err
+	}
+
+	selfiePath, err := s.userDetailService.StorePrivateImage(prefix+"selfie", selfie)
+	if err != nil {
+		s.removeDocuments(idCardPath)
+		return nil, err
+	}
+
+	verification := New(id, userID, idCardNumber, idCardPath, selfiePath)
+	_, err = s.mysqlDB.WithTransaction(func(tx *sqlx.Tx) (interface{}, error) {
+		item, err := s.userService.WithTx(tx).FindByIDForUpdate(userID)
+		if err != nil {
+			return nil, err
+		}
+
+		repo := s.repo.WithTx(tx)
+		err = checkSubmittable(repo, item)
+		if err != nil {
+			return nil, err
+		}
+
+		return nil, repo.Store(verification)
+	})
+
+	if err != nil {
+		s.removeDocuments(idCardPath, selfiePath)
+		return nil, err
+	}
+
+	return s.FindByID(id)
+}
+
+// Review moves the request to status. Approving it verifies the identity of
+// the user in the same transaction, the user is emailed on a decision.
+func (s *Service) Review(origin profile_trail.Origin, id uuid.UUID, version int, status, note string) (*IdentityVerification, error) {
+	item, err := s.find(id)
+	if err != nil {
+		return nil, err
+	}
+
+	if !item.MatchVersion(version) {
+		return nil, errVersionConflict
+	}
+
+	if !item.CanMoveTo(status) {
+		return nil, failure.WithMessage(
+			failure.CodeInvalidStatusTransition,
+			"identity verification can't move from "+item.Status+" to "+status,
+		)
+	}
+
+	item.Review(status, origin.Actor, note)
+	trails := s.profileTrailService.NewBatch()
+	payload, err := s.mysqlDB.WithTransaction(func(tx *sqlx.Tx) (interface{}, error) {
+		err := s.repo.WithTx(tx).StoreStatus(item)
+		if err != nil {
+			return nil, conflict(err)
+		}
+
+		if status != StatusApproved {
+			return nil, nil
+		}
+
+		return s.userService.WithTx(tx).WithTrail(trails).VerifyIdentity(origin, item.UserID)
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	ctx := activity.NewContext("identity_verification_review")
+	ctx = activity.WithUserID(ctx, item.UserID.String())
+	err = trails.Flush()
+	if err != nil {
+		log.WithContext(ctx).Error(stacktrace.Propagate(err, "record profile trails error"))
+	}
+
+	if verified, ok := payload.(*user.User); ok {
+		view := verified.ClientView()
+		err = s.webhookService.Dispatch(webhook.EventUserIdentityVerified, &view)
+		if err != nil {
+			log.WithContext(ctx).Error(stacktrace.Propagate(err, "dispatch identity verified webhook error"))
+		}
+	}
+
+	if status == StatusApproved || status == StatusRejected {
+		s.notify(item)
+	}
+
+	return s.FindByID(id)
+}
+
+func (s *Service) FindByID(id uuid.UUID) (*IdentityVerification, error) {
+	item, err := s.find(id)
+	if err != nil {
+		return nil, err
+	}
+
+	return item, s.sign(item)
+}
+
+func (s *Service) FindLatestByUserID(userID uuid.UUID) (*IdentityVerification, error) {
+	item, err := s.repo.FindLatestByUserID(userID)
+	if err != nil {
+		if stacktrace.RootCause(err) == sql.ErrNoRows {
+			return nil, failure.WithMessage(
+				failure.CodeIdentityVerificationNotFound,
+				"identity verification not found, user hasn't submitted one",
+			)
+		}
+
+		return nil, err
+	}
+
+	return item, nil
+}
+
+func (s *Service) FindPage(filter Filter, page, limit int) (Page, error) {
+	offset := (page - 1) * limit
+	items, err := s.repo.FindPage(filter, offset, limit)
+	if err != nil {
+		return Page{}, err
+	}
+
+	total, err := s.repo.FindTotal(filter)
+	if err != nil {
+		return Page{}, err
+	}
+
+	err = s.sign(items...)
+	if err != nil {
+		return Page{}, err
+	}
+
+	return Page{
+		Items: items,
+		Total: total,
+	}, nil
+}
+
+func (s *Service) find(id uuid.UUID) (*IdentityVerification, error) {
+	item, err := s.repo.FindByID(id)
+	if err != nil {
+		if stacktrace.RootCause(err) == sql.ErrNoRows {
+			return nil, failure.WithMessage(
+				failure.CodeIdentityVerificationNotFound,
+				"identity verification not found, id isn't in database",
+			)
+		}
+
+		return nil, err
+	}
+
+	return item, nil
+}
+
+// sign fills in signed urls of the document images for the reviewers
+func (s *Service) sign(items ...*IdentityVerification) error {
+	for _, item := range items {
+		idCardUrl, err := s.fileStorage.SignedURL(item.IDCardPath, user_detail.SignedURLTTL())
+		if err != nil {
+			return err
+		}
+
+		selfieUrl, err := s.fileStorage.SignedURL(item.SelfiePath, user_detail.SignedURLTTL())
+		if err != nil {
+			return err
+		}
+
+		item.IDCardUrl = idCardUrl
+		item.SelfieUrl = selfieUrl
+	}
+
+	return nil
+}
+
+// notify emails the decision, the request is already decided so a missing
+// user is only logged
+func (s *Service) notify(item *IdentityVerification) {
+	recipient, err := s.userService.FindByID(item.UserID)
+	if err != nil {
+		ctx := activity.NewContext("identity_verification_notify")
+		ctx = activity.WithUserID(ctx, item.UserID.String())
+		log.WithContext(ctx).Error(stacktrace.Propagate(err, "read user to notify error"))
+		return
+	}
+
+	s.notificationService.NotifyIdentityReviewed(recipient, item.Status == StatusApproved, item.ReviewerNote)
+}
+
+// RemoveDocumentsByUserID deletes the images of every request of the user.
+// It runs before the user is purged, the rows go with the user and nothing
+// would point to the images afterwards.
+func (s *Service) RemoveDocumentsByUserID(userID uuid.UUID) error {
+	items, err := s.repo.FindByUserID(userID)
+	if err != nil {
+		return err
+	}
+
+	for _, item := range items {
+		for _, key := range []string{item.IDCardPath, item.SelfiePath} {
+			err := s.fileStorage.Delete(key)
+			if err != nil {
+				return stacktrace.Propagate(err, "remove document %s error", key)
+			}
+		}
+	}
+
+	return nil
+}
+
+// removeDocuments deletes the images of a request that wasn't stored, a
+// failure only leaves an orphan behind so it is logged.
+func (s *Service) removeDocuments(keys ...string) {
+	for _, key := range keys {
+		err := s.fileStorage.Delete(key)
+		if err != nil {
+			ctx := activity.NewContext("identity_verification_remove_document")
+			log.WithContext(ctx).Error(stacktrace.Propagate(err, "remove document %s error", key))
+		}
+	}
+}
+
+// checkSubmittable fails when the identity of the user is already verified
+// or a request of theirs is still open
+func checkSubmittable(repo Repository, item *user.User) error {
+	if item.IdentityVerifiedAt != nil {
+		return failure.WithMessage(
+			failure.CodeIdentityAlreadyVerified,
+			"identity is already verified",
+		)
+	}
+
+	latest, err := repo.FindLatestByUserID(item.ID)
+	if err != nil {
+		if stacktrace.RootCause(err) == sql.ErrNoRows {
+			return nil
+		}
+
+		return err
+	}
+
+	if latest.IsOpen() {
+		return failure.WithMessage(
+			failure.CodeIdentityVerificationPending,
+			"identity verification is already waiting for review",
+		)
+	}
+
+	return nil
+}
+
+// conflict turns a write that lost the race on the row version into the same
+// failure as a stale If-Match.
+func conflict(err error) error {
+	if stacktrace.RootCause(err) == database.ErrVersionConflict {
+		return errVersionConflict
+	}
+
+	return err
+}
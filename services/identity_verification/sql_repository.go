@@ -0,0 +1,218 @@
+package identity_verification
+
+import (
+	"errors"
+
+	"github.com/doug-martin/goqu/v9"
+	_ "github.com/doug-martin/goqu/v9/dialect/mysql"
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/palantir/stacktrace"
+
+	"stark/database"
+)
+
+type sqlRepository struct {
+	mysqlDB *database.MySQL
+}
+
+const (
+	insertIdentityVerificationQuery = `
+		INSERT INTO identity_verifications (id, user_id, id_card_number, id_card_path, selfie_path, status, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+	`
+	updateStatusQuery = `
+		UPDATE identity_verifications SET
+			status = ?,
+			reviewer = ?,
+			reviewer_note = ?,
+			reviewed_at = ?,
+			updated_at = ?,
+			version = version + 1
+		WHERE id = ? AND version = ?
+	`
+)
+
+func NewSQLRepository(mysqlDB *database.MySQL) Repository {
+	return &sqlRepository{mysqlDB}
+}
+
+func (repo *sqlRepository) WithTx(tx *sqlx.Tx) Repository {
+	return &sqlRepository{mysqlDB: repo.mysqlDB.Join(tx)}
+}
+
+func (repo *sqlRepository) Store(data *IdentityVerification) error {
+	_, err := repo.mysqlDB.WithTransaction(func(tx *sqlx.Tx) (interface{}, error) {
+		res, err := tx.Exec(insertIdentityVerificationQuery,
+			data.ID,
+			data.UserID,
+			data.IDCardNumber,
+			data.IDCardPath,
+			data.SelfiePath,
+			data.Status,
+			data.CreatedAt,
+			data.UpdatedAt,
+		)
+
+		if err != nil {
+			return nil, err
+		}
+
+		rowsAffected, err := res.RowsAffected()
+		if err != nil {
+			return nil, err
+		}
+
+		if rowsAffected <= 0 {
+			return nil, errors.New("insert identity verification fails")
+		}
+
+		return nil, nil
+	})
+
+	return err
+}
+
+func (repo *sqlRepository) StoreStatus(data *IdentityVerification) error {
+	_, err := repo.mysqlDB.WithTransaction(func(tx *sqlx.Tx) (interface{}, error) {
+		res, err := tx.Exec(updateStatusQuery,
+			data.Status,
+			data.Reviewer,
+			data.ReviewerNote,
+			data.ReviewedAt,
+			data.UpdatedAt,
+			data.ID,
+			data.Version,
+		)
+
+		if err != nil {
+			return nil, err
+		}
+
+		rowsAffected, err := res.RowsAffected()
+		if err != nil {
+			return nil, err
+		}
+
+		if rowsAffected <= 0 {
+			return nil, stacktrace.Propagate(database.ErrVersionConflict, "update identity verification status fails")
+		}
+
+		data.Version++
+		return nil, nil
+	})
+
+	return err
+}
+
+func (repo *sqlRepository) FindByID(id uuid.UUID) (result *IdentityVerification, err error) {
+	var data IdentityVerification
+	dialect := goqu.Dialect("mysql")
+	dataset := dialect.From("identity_verifications")
+	dataset = dataset.Where(goqu.Ex{
+		"id": id.String(),
+	})
+
+	sql, _, err := dataset.ToSQL()
+	if err != nil {
+		return nil, stacktrace.Propagate(err, "sql error")
+	}
+
+	err = repo.mysqlDB.Get(&data, sql)
+	if err != nil {
+		return nil, stacktrace.Propagate(err, "can't read identity verification by id")
+	}
+
+	return &data, nil
+}
+
+func (repo *sqlRepository) FindLatestByUserID(userID uuid.UUID) (result *IdentityVerification, err error) {
+	var data IdentityVerification
+	dialect := goqu.Dialect("mysql")
+	dataset := dialect.From("identity_verifications")
+	dataset = dataset.Where(goqu.Ex{
+		"user_id": userID.String(),
+	})
+
+	dataset = dataset.Order(goqu.C("created_at").Desc()).Limit(1)
+	sql, _, err := dataset.ToSQL()
+	if err != nil {
+		return nil, stacktrace.Propagate(err, "sql error")
+	}
+
+	err = repo.mysqlDB.Get(&data, sql)
+	if err != nil {
+		return nil, stacktrace.Propagate(err, "can't read identity verification by user id")
+	}
+
+	return &data, nil
+}
+
+func (repo *sqlRepository) FindByUserID(userID uuid.UUID) (result []*IdentityVerification, err error) {
+	dataset := filterDataset(Filter{UserID: userID.String()})
+	sql, _, err := dataset.ToSQL()
+	if err != nil {
+		return nil, stacktrace.Propagate(err, "sql error")
+	}
+
+	result = make([]*IdentityVerification, 0)
+	err = repo.mysqlDB.Select(&result, sql)
+	if err != nil {
+		return nil, stacktrace.Propagate(err, "select rows fails")
+	}
+
+	return result, nil
+}
+
+// FindPage reads the oldest requests first, reviewers work through the queue
+// in the order it was submitted
+func (repo *sqlRepository) FindPage(filter Filter, offset, limit int) (result []*IdentityVerification, err error) {
+	dataset := filterDataset(filter)
+	dataset = dataset.Order(goqu.C("created_at").Asc())
+	sql, _, err := dataset.ToSQL()
+	if err != nil {
+		return nil, stacktrace.Propagate(err, "sql error")
+	}
+
+	result = make([]*IdentityVerification, 0)
+	err = repo.mysqlDB.Select(&result, sql+" LIMIT ? OFFSET ?", limit, offset)
+	if err != nil {
+		return nil, stacktrace.Propagate(err, "select rows fails")
+	}
+
+	return result, nil
+}
+
+func (repo *sqlRepository) FindTotal(filter Filter) (total int, err error) {
+	dataset := filterDataset(filter)
+	dataset = dataset.Select(goqu.COUNT("*"))
+	sql, _, err := dataset.ToSQL()
+	if err != nil {
+		return 0, stacktrace.Propagate(err, "sql error")
+	}
+
+	err = repo.mysqlDB.Get(&total, sql)
+	if err != nil {
+		return 0, stacktrace.Propagate(err, "select row fails")
+	}
+
+	return total, nil
+}
+
+func filterDataset(filter Filter) *goqu.SelectDataset {
+	dialect := goqu.Dialect("mysql")
+	dataset := dialect.From("identity_verifications")
+	if filter.UserID != "" {
+		dataset = dataset.Where(goqu.Ex{
+			"user_id": filter.UserID,
+		})
+	}
+
+	if len(filter.Statuses) != 0 {
+		dataset = dataset.Where(goqu.Ex{
+			"status": filter.Statuses,
+		})
+	}
+
+	return dataset
+}
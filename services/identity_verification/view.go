@@ -0,0 +1,110 @@
+package identity_verification
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// The views are what each audience gets to see of a request. The documents
+// are only handed out to reviewers as signed urls, never as storage paths,
+// and who reviewed a request stays internal.
+
+// InternalView is a request as seen by the reviewers
+type InternalView struct {
+	ID           uuid.UUID  `json:"id"`
+	UserID       uuid.UUID  `json:"user_id"`
+	IDCardNumber string     `json:"id_card_number"`
+	IDCardUrl    string     `json:"id_card_url"`
+	SelfieUrl    string     `json:"selfie_url"`
+	Status       string     `json:"status"`
+	Reviewer     string     `json:"reviewer"`
+	ReviewerNote string     `json:"reviewer_note"`
+	ReviewedAt   *time.Time `json:"reviewed_at"`
+	CreatedAt    time.Time  `json:"created_at"`
+	UpdatedAt    time.Time  `json:"updated_at"`
+	Version      int        `json:"version"`
+}
+
+// ClientView is a request as seen by client apps, only where it stands
+type ClientView struct {
+	ID         uuid.UUID  `json:"id"`
+	UserID     uuid.UUID  `json:"user_id"`
+	Status     string     `json:"status"`
+	ReviewedAt *time.Time `json:"reviewed_at"`
+	CreatedAt  time.Time  `json:"created_at"`
+	UpdatedAt  time.Time  `json:"updated_at"`
+}
+
+// SelfView is a request as seen by the user who submitted it, the documents
+// and who reviewed it are for the reviewers only
+type SelfView struct {
+	ID           uuid.UUID  `json:"id"`
+	IDCardNumber string     `json:"id_card_number"`
+	Status       string     `json:"status"`
+	ReviewerNote string     `json:"reviewer_note"`
+	ReviewedAt   *time.Time `json:"reviewed_at"`
+	CreatedAt    time.Time  `json:"created_at"`
+	UpdatedAt    time.Time  `json:"updated_at"`
+}
+
+type InternalPage struct {
+	Items []InternalView `json:"items"`
+	Total int            `json:"total"`
+}
+
+func (v *IdentityVerification) InternalView() InternalView {
+	return InternalView{
+		ID:           v.ID,
+		UserID:       v.UserID,
+		IDCardNumber: v.IDCardNumber,
+		IDCardUrl:    v.IDCardUrl,
+		SelfieUrl:    v.SelfieUrl,
+		Status:       v.Status,
+		Reviewer:     v.Reviewer,
+		ReviewerNote: v.ReviewerNote,
+		ReviewedAt:   v.ReviewedAt,
+		CreatedAt:    v.CreatedAt,
+		UpdatedAt:    v.UpdatedAt,
+		Version:      v.Version,
+	}
+}
+
+func (v *IdentityVerification) ClientView() ClientView {
+	return ClientView{
+		ID:         v.ID,
+		UserID:     v.UserID,
+		Status:     v.Status,
+		ReviewedAt: v.ReviewedAt,
+		CreatedAt:  v.CreatedAt,
+		UpdatedAt:  v.UpdatedAt,
+	}
+}
+
+func (v *IdentityVerification) SelfView() SelfView {
+	return SelfView{
+		ID:           v.ID,
+		IDCardNumber: v.IDCardNumber,
+		Status:       v.Status,
+		ReviewerNote: v.ReviewerNote,
+		ReviewedAt:   v.ReviewedAt,
+		CreatedAt:    v.CreatedAt,
+		UpdatedAt:    v.UpdatedAt,
+	}
+}
+
+func InternalViews(items []*IdentityVerification) []InternalView {
+	views := make([]InternalView, 0, len(items))
+	for _, item := range items {
+		views = append(views, item.InternalView())
+	}
+
+	return views
+}
+
+func (p Page) InternalView() InternalPage {
+	return InternalPage{
+		Items: InternalViews(p.Items),
+		Total: p.Total,
+	}
+}
@@ -0,0 +1,53 @@
+package identity_verification
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+// pathFields are storage paths of the documents, reviewers get signed urls
+var pathFields = []string{`"id_card_path"`, `"selfie_path"`}
+
+func TestViewsHideDocumentPaths(t *testing.T) {
+	id, userID := uuid.New(), uuid.New()
+	prefix := documentPrefix + userID.String() + "/" + id.String() + "/"
+	item := New(id, userID, "3171010101010001", prefix+"id_card.png", prefix+"selfie.png")
+	item.IDCardUrl = "https://cdn.example.com/id_card.png?signature=x"
+	item.SelfieUrl = "https://cdn.example.com/selfie.png?signature=x"
+	item.Review(StatusRejected, "reviewer@stark.com", "blurry selfie")
+
+	tests := []struct {
+		name     string
+		view     interface{}
+		internal bool
+	}{
+		{"InternalView", item.InternalView(), true},
+		{"InternalPage", Page{Items: []*IdentityVerification{item}, Total: 1}.InternalView(), true},
+		{"ClientView", item.ClientView(), false},
+		{"SelfView", item.SelfView(), false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			data, err := json.Marshal(test.view)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			for _, field := range pathFields {
+				if strings.Contains(string(data), field) {
+					t.Errorf("%s leaked in %s", field, data)
+				}
+			}
+
+			for _, field := range []string{`"reviewer"`, `"id_card_url"`, `"selfie_url"`} {
+				if strings.Contains(string(data), field) != test.internal {
+					t.Errorf("%s presence should be %v in %s", field, test.internal, data)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,24 @@
+package notification
+
+import "stark/services/user"
+
+// Batch holds the notifications of a unit of work, they are sent by Flush
+// once it commits so nobody is told of a rolled back change.
+type Batch struct {
+	service *Service
+	pending []func()
+}
+
+func (b *Batch) NotifyEmailChanged(item *user.User, oldEmail string) {
+	b.pending = append(b.pending, func() {
+		b.service.NotifyEmailChanged(item, oldEmail)
+	})
+}
+
+func (b *Batch) Flush() {
+	for _, notify := range b.pending {
+		notify()
+	}
+
+	b.pending = nil
+}
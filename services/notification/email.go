@@ -0,0 +1,86 @@
+package notification
+
+import "html"
+
+func securityNoticeContent(revokeToken string) string {
+	return `
+	<p style="text-align: justify">Bukan Kamu? Segera amankan akun Kamu dengan keluar dari semua perangkat melalui tombol di bawah, lalu ganti password Kamu.</p>
+	<table role="presentation" border="0" cellpadding="0" cellspacing="0" class="btn btn-primary">
+	  <tbody>
+		<tr>
+		  <td align="center">
+			<table role="presentation" border="0" cellpadding="0" cellspacing="0">
+			  <tbody>
+				<tr>
+				  <td> <a href="https://gimsak.com/auth/revoke-sessions?token=` + revokeToken + `" target="_blank">Ini Bukan Saya</a> </td>
+				</tr>
+			  </tbody>
+			</table>
+		  </td>
+		</tr>
+	  </tbody>
+	</table>
+	<p style="text-align: justify">Segala bentuk informasi seperti nomor kontak, alamat e-mail, atau password Anda bersifat rahasia. Jangan menginformasikan data-data tersebut kepada siapapun, termasuk kepada pihak yang mengatasnamakan Gimsak.</p>
+	`
+}
+
+func newLoginContent(name, ip, userAgent, loginAt, revokeToken string) string {
+	return `
+	<p>Halo ` + html.EscapeString(name) + `,</p>
+	<p style="text-align: justify">Kami mendeteksi <b>login baru</b> ke akun Gimsak Kamu dari perangkat atau alamat IP yang belum pernah digunakan sebelumnya.</p>
+	<ul>
+	  <li>Waktu: ` + loginAt + `</li>
+	  <li>Alamat IP: ` + html.EscapeString(ip) + `</li>
+	  <li>Perangkat: ` + html.EscapeString(userAgent) + `</li>
+	</ul>
+	` + securityNoticeContent(revokeToken)
+}
+
+func passwordChangedContent(name, changedAt, revokeToken string) string {
+	return `
+	<p>Halo ` + html.EscapeString(name) + `,</p>
+	<p style="text-align: justify"><b>Password</b> akun Gimsak Kamu telah diubah pada ` + changedAt + `.</p>
+	` + securityNoticeContent(revokeToken)
+}
+
+func emailChangedContent(name, oldEmail, newEmail, changedAt, revokeToken string) string {
+	return `
+	<p>Halo ` + html.EscapeString(name) + `,</p>
+	<p style="text-align: justify"><b>Alamat e-mail</b> akun Gimsak Kamu telah diubah dari ` + html.EscapeString(oldEmail) + ` menjadi ` + html.EscapeString(newEmail) + ` pada ` + changedAt + `.</p>
+	` + securityNoticeContent(revokeToken)
+}
+
+func mfaToggledContent(name string, enabled bool, changedAt, revokeToken string) string {
+	state := "dinonaktifkan"
+	if enabled {
+		state = "diaktifkan"
+	}
+
+	return `
+	<p>Halo ` + html.EscapeString(name) + `,</p>
+	<p style="text-align: justify"><b>Verifikasi dua langkah</b> akun Gimsak Kamu telah ` + state + ` pada ` + changedAt + `.</p>
+	` + securityNoticeContent(revokeToken)
+}
+
+func lockoutContent(name, lockedUntil, revokeToken string) string {
+	return `
+	<p>Halo ` + html.EscapeString(name) + `,</p>
+	<p style="text-align: justify">Akun Gimsak Kamu <b>dikunci sementara</b> hingga ` + lockedUntil + ` karena terlalu banyak percobaan login yang gagal.</p>
+	` + securityNoticeContent(revokeToken)
+}
+
+func identityApprovedContent(name, decidedAt string) string {
+	return `
+	<p>Halo ` + html.EscapeString(name) + `,</p>
+	<p style="text-align: justify">Pengajuan <b>verifikasi identitas</b> akun Gimsak Kamu telah <b>disetujui</b> pada ` + decidedAt + `. Identitas Kamu kini sudah terverifikasi.</p>
+	`
+}
+
+func identityRejectedContent(name, note, decidedAt string) string {
+	return `
+	<p>Halo ` + html.EscapeString(name) + `,</p>
+	<p style="text-align: justify">Pengajuan <b>verifikasi identitas</b> akun Gimsak Kamu <b>ditolak</b> pada ` + decidedAt + ` dengan catatan berikut:</p>
+	<p style="text-align: justify"><i>` + html.EscapeString(note) + `</i></p>
+	<p style="text-align: justify">Silakan perbaiki data atau foto dokumen Kamu, lalu ajukan verifikasi kembali.</p>
+	`
+}
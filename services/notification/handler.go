@@ -0,0 +1,63 @@
+package notification
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+	"github.com/palantir/stacktrace"
+
+	"stark/failure"
+	"stark/respond"
+	"stark/utils"
+	"stark/utils/activity"
+	"stark/utils/log"
+)
+
+type Handler struct {
+	service *Service
+}
+
+func NewHandler(service *Service) *Handler {
+	return &Handler{service: service}
+}
+
+func (h *Handler) HandleRevokeSessions(c *gin.Context) {
+	ctx := activity.NewContext("notification_revoke_sessions")
+	trx, _ := activity.GetTransactionID(ctx)
+	var input InputRevokeSessions
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		var validationErrors validator.ValidationErrors
+		if errors.As(err, &validationErrors) {
+			out := make([]utils.ErrorMessage, 0)
+			for _, validationError := range validationErrors {
+				out = append(out, utils.ErrorMessage{
+					Field:   utils.ToSnakeCase(validationError.Field()),
+					Message: utils.GetErrorMessage(validationError),
+				})
+			}
+
+			respond.Invalid(c, trx, http.StatusBadRequest, out)
+		}
+		return
+	}
+
+	err := h.service.RevokeSessions(input.Token)
+	if err != nil {
+		if f, ok := stacktrace.RootCause(err).(failure.Failure); ok {
+			switch f.Code {
+			case failure.CodeIncorrectToken:
+				respond.Error(c, trx, http.StatusBadRequest, f.Code, f.Desc)
+				return
+			}
+		}
+
+		log.WithContext(ctx).Error(stacktrace.Propagate(err, "revoke sessions error"))
+		respond.Error(c, trx, http.StatusInternalServerError, respond.ErrInternal, "unknown error")
+		return
+	}
+
+	respond.Success(c, trx, http.StatusCreated, nil)
+}
@@ -0,0 +1,5 @@
+package notification
+
+type InputRevokeSessions struct {
+	Token string `json:"token" binding:"required"`
+}
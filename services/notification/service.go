@@ -0,0 +1,157 @@
+package notification
+
+import (
+	"time"
+
+	"github.com/go-redis/redis"
+	"github.com/palantir/stacktrace"
+
+	"stark/database"
+	"stark/failure"
+	"stark/services/session"
+	"stark/services/user"
+	"stark/utils"
+	"stark/utils/activity"
+	"stark/utils/log"
+)
+
+const (
+	revokeTokenPrefix = "revoke_sessions:"
+	revokeTokenTTL    = 7 * 24 * time.Hour
+	timeLayout        = "02 Jan 2006 15:04 MST"
+
+	newLoginSubject         = "Login Baru Terdeteksi"
+	newLoginPreview         = "Ada login baru ke akun Gimsak kamu!"
+	passwordChangedSubject  = "Password Telah Diubah"
+	passwordChangedPreview  = "Password akun Gimsak kamu telah diubah!"
+	emailChangedSubject     = "E-mail Telah Diubah"
+	emailChangedPreview     = "Alamat e-mail akun Gimsak kamu telah diubah!"
+	mfaToggledSubject       = "Verifikasi Dua Langkah Diubah"
+	mfaToggledPreview       = "Pengaturan verifikasi dua langkah akun Gimsak kamu telah diubah!"
+	lockoutSubject          = "Akun Dikunci Sementara"
+	lockoutPreview          = "Akun Gimsak kamu dikunci sementara!"
+	identitySubject         = "Hasil Verifikasi Identitas"
+	identityApprovedPreview = "Identitas akun Gimsak kamu telah terverifikasi!"
+	identityRejectedPreview = "Verifikasi identitas akun Gimsak kamu ditolak!"
+)
+
+type Service struct {
+	redisDB        *database.Redis
+	sessionService *session.Service
+}
+
+func NewService(redisDB *database.Redis, sessionService *session.Service) *Service {
+	return &Service{
+		redisDB:        redisDB,
+		sessionService: sessionService,
+	}
+}
+
+func (s *Service) NewBatch() *Batch {
+	return &Batch{service: s}
+}
+
+func (s *Service) NotifyNewLogin(item *user.User, ip, userAgent string) {
+	s.send(item, newLoginSubject, newLoginPreview, func(revokeToken string) string {
+		return newLoginContent(item.Name, ip, userAgent, time.Now().Format(timeLayout), revokeToken)
+	})
+}
+
+func (s *Service) NotifyPasswordChanged(item *user.User) {
+	s.send(item, passwordChangedSubject, passwordChangedPreview, func(revokeToken string) string {
+		return passwordChangedContent(item.Name, time.Now().Format(timeLayout), revokeToken)
+	})
+}
+
+// NotifyEmailChanged is sent to the previous address, the new one is already
+// confirmed by the user who changed it.
+func (s *Service) NotifyEmailChanged(item *user.User, oldEmail string) {
+	previous := *item
+	previous.Email = oldEmail
+	s.send(&previous, emailChangedSubject, emailChangedPreview, func(revokeToken string) string {
+		return emailChangedContent(item.Name, oldEmail, item.Email, time.Now().Format(timeLayout), revokeToken)
+	})
+}
+
+func (s *Service) NotifyMFAToggled(item *user.User, enabled bool) {
+	s.send(item, mfaToggledSubject, mfaToggledPreview, func(revokeToken string) string {
+		return mfaToggledContent(item.Name, enabled, time.Now().Format(timeLayout), revokeToken)
+	})
+}
+
+func (s *Service) NotifyLockout(item *user.User, lockedUntil time.Time) {
+	s.send(item, lockoutSubject, lockoutPreview, func(revokeToken string) string {
+		return lockoutContent(item.Name, lockedUntil.Format(timeLayout), revokeToken)
+	})
+}
+
+// NotifyIdentityReviewed tells the user the decision on their identity
+// verification request, a rejection comes with the note of the reviewer.
+func (s *Service) NotifyIdentityReviewed(item *user.User, approved bool, note string) {
+	decidedAt := time.Now().Format(timeLayout)
+	if approved {
+		s.mail(item, identitySubject, identityApprovedPreview, identityApprovedContent(item.Name, decidedAt))
+		return
+	}
+
+	s.mail(item, identitySubject, identityRejectedPreview, identityRejectedContent(item.Name, note, decidedAt))
+}
+
+func (s *Service) RevokeSessions(revokeToken string) error {
+	userID, err := s.redisDB.Get(revokeTokenPrefix + revokeToken)
+	if err != nil {
+		if stacktrace.RootCause(err) == redis.Nil {
+			return failure.WithMessage(
+				failure.CodeIncorrectToken,
+				"incorrect token, link is invalid or expired",
+			)
+		}
+
+		return err
+	}
+
+	err = s.sessionService.RevokeAll(userID)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.redisDB.Delete(revokeTokenPrefix + revokeToken)
+	return err
+}
+
+// send delivers the notification in the background so the triggering request
+// isn't held up by SMTP, failures are only logged.
+func (s *Service) send(item *user.User, subject, preview string, content func(revokeToken string) string) {
+	go func() {
+		ctx := activity.NewContext("notification_send")
+		ctx = activity.WithUserID(ctx, item.ID.String())
+
+		revokeToken := utils.GenerateSecureToken(25)
+		err := s.redisDB.Set(revokeTokenPrefix+revokeToken, item.ID.String(), revokeTokenTTL)
+		if err != nil {
+			log.WithContext(ctx).Error(stacktrace.Propagate(err, "store revoke token error"))
+			return
+		}
+
+		message := utils.EmailLayout(preview, content(revokeToken))
+		err = utils.SendMail([]string{item.Email}, nil, subject, message)
+		if err != nil {
+			log.WithContext(ctx).Error(stacktrace.Propagate(err, "send %s notification error", subject))
+		}
+	}()
+}
+
+// mail delivers a notification that isn't about the security of the account,
+// in the background like send but without a revoke link.
+func (s *Service) mail(item *user.User, subject, preview, content string) {
+	go func() {
+		ctx := activity.NewContext("notification_mail")
+		ctx = activity.WithUserID(ctx, item.ID.String())
+
+		message := utils.EmailLayout(preview, content)
+		err := utils.SendMail([]string{item.Email}, nil, subject, message)
+		if err != nil {
+			log.WithContext(ctx).Error(stacktrace.Propagate(err, "send %s notification error", subject))
+		}
+	}()
+}
@@ -0,0 +1,62 @@
+package outbox
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	StatusPending = "pending"
+	StatusDead    = "dead"
+)
+
+type Event struct {
+	ID            uuid.UUID       `json:"id" db:"id"`
+	AggregateType string          `json:"aggregate_type" db:"aggregate_type"`
+	AggregateID   string          `json:"aggregate_id" db:"aggregate_id"`
+	Type          string          `json:"type" db:"type"`
+	Payload       json.RawMessage `json:"payload" db:"payload"`
+	Status        string          `json:"status" db:"status"`
+	Attempts      int             `json:"attempts" db:"attempts"`
+	LastError     string          `json:"last_error" db:"last_error"`
+	CreatedAt     time.Time       `json:"created_at" db:"created_at"`
+	PublishedAt   *time.Time      `json:"published_at" db:"published_at"`
+}
+
+func New(aggregateType, aggregateID, eventType string, data interface{}) (*Event, error) {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Event{
+		ID:            uuid.New(),
+		AggregateType: aggregateType,
+		AggregateID:   aggregateID,
+		Type:          eventType,
+		Payload:       payload,
+		Status:        StatusPending,
+		CreatedAt:     time.Now(),
+	}, nil
+}
+
+func (e *Event) Publish() {
+	now := time.Now()
+	e.PublishedAt = &now
+}
+
+// Fail records a failed publish and gives up on the event once maxAttempts
+// is reached, the relay skips dead events.
+func (e *Event) Fail(reason string, maxAttempts int) {
+	e.Attempts++
+	e.LastError = reason
+	if len(e.LastError) > 255 {
+		e.LastError = e.LastError[:255]
+	}
+
+	if e.Attempts >= maxAttempts {
+		e.Status = StatusDead
+	}
+}
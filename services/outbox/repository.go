@@ -0,0 +1,11 @@
+package outbox
+
+import "time"
+
+type Repository interface {
+	// Relay hands unpublished events to publish in creation order and stores
+	// the outcome, stopping at the first failure to keep the order intact.
+	// An event failing its maxAttempts-th publish is dead and skipped.
+	Relay(limit, maxAttempts int, publish func(item *Event) error) (int, error)
+	DeletePublishedBefore(publishedAt time.Time) error
+}
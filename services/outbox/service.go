@@ -0,0 +1,81 @@
+package outbox
+
+import (
+	"time"
+
+	"github.com/palantir/stacktrace"
+
+	"stark/utils"
+	"stark/utils/activity"
+	"stark/utils/broker"
+	"stark/utils/log"
+)
+
+const relayBatchSize = 100
+
+type Service struct {
+	repo        Repository
+	broker      broker.Broker
+	retention   time.Duration
+	maxAttempts int
+}
+
+func NewService(repo Repository, broker broker.Broker, retention time.Duration) *Service {
+	return &Service{
+		repo:        repo,
+		broker:      broker,
+		retention:   retention,
+		maxAttempts: utils.GetIntEnv("OUTBOX_MAX_ATTEMPTS", 10),
+	}
+}
+
+// Relay publishes pending events until the outbox is drained or a publish
+// fails, events are published to a topic named after their aggregate. An
+// event that keeps failing is left dead after maxAttempts, so it doesn't
+// hold back the events behind it forever.
+func (s *Service) Relay() error {
+	for {
+		published, err := s.repo.Relay(relayBatchSize, s.maxAttempts, func(item *Event) error {
+			return s.broker.Publish(broker.Message{
+				ID:        item.ID.String(),
+				Topic:     item.AggregateType,
+				Type:      item.Type,
+				Key:       item.AggregateID,
+				Payload:   item.Payload,
+				CreatedAt: item.CreatedAt,
+			})
+		})
+
+		if err != nil {
+			return err
+		}
+
+		if published < relayBatchSize {
+			return nil
+		}
+	}
+}
+
+func (s *Service) RunRelayWorker(interval time.Duration) {
+	ctx := activity.NewContext("outbox_relay_worker")
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	lastCleanup := time.Now()
+	for range ticker.C {
+		err := s.Relay()
+		if err != nil {
+			log.WithContext(ctx).Error(stacktrace.Propagate(err, "relay outbox events error"))
+		}
+
+		if time.Since(lastCleanup) < time.Hour {
+			continue
+		}
+
+		lastCleanup = time.Now()
+		err = s.repo.DeletePublishedBefore(lastCleanup.Add(-s.retention))
+		if err != nil {
+			log.WithContext(ctx).Error(stacktrace.Propagate(err, "delete published outbox events error"))
+		}
+	}
+}
@@ -0,0 +1,114 @@
+package outbox
+
+import (
+	"time"
+
+	"github.com/doug-martin/goqu/v9"
+	_ "github.com/doug-martin/goqu/v9/dialect/mysql"
+	"github.com/doug-martin/goqu/v9/exp"
+	"github.com/jmoiron/sqlx"
+	"github.com/palantir/stacktrace"
+
+	"stark/database"
+)
+
+type sqlRepository struct {
+	mysqlDB *database.MySQL
+}
+
+const (
+	publishEventQuery = `
+		UPDATE outbox_events SET
+			published_at = ?
+		WHERE id = ?
+	`
+	failEventQuery = `
+		UPDATE outbox_events SET
+			status = ?,
+			attempts = ?,
+			last_error = ?
+		WHERE id = ?
+	`
+	deletePublishedEventQuery = "DELETE FROM outbox_events WHERE published_at IS NOT NULL AND published_at < ?"
+)
+
+func NewSQLRepository(mysqlDB *database.MySQL) Repository {
+	return &sqlRepository{mysqlDB}
+}
+
+// Relay locks the batch with SKIP LOCKED, so relays running on several
+// instances never publish the same event concurrently.
+func (repo *sqlRepository) Relay(limit, maxAttempts int, publish func(item *Event) error) (int, error) {
+	var publishErr error
+	result, err := repo.mysqlDB.WithTransaction(func(tx *sqlx.Tx) (interface{}, error) {
+		dialect := goqu.Dialect("mysql")
+		dataset := dialect.From("outbox_events")
+		dataset = dataset.Where(goqu.Ex{
+			"published_at": nil,
+			"status":       StatusPending,
+		})
+
+		dataset = dataset.Order(goqu.C("created_at").Asc(), goqu.C("id").Asc())
+		dataset = dataset.Limit(uint(limit)).ForUpdate(exp.SkipLocked)
+		sql, _, err := dataset.ToSQL()
+		if err != nil {
+			return nil, stacktrace.Propagate(err, "sql error")
+		}
+
+		var items []*Event
+		err = tx.Select(&items, sql)
+		if err != nil {
+			return nil, stacktrace.Propagate(err, "select rows fails")
+		}
+
+		published := 0
+		for _, item := range items {
+			err := publish(item)
+			if err != nil {
+				publishErr = err
+				item.Fail(err.Error(), maxAttempts)
+				_, err = tx.Exec(failEventQuery, item.Status, item.Attempts, item.LastError, item.ID)
+				if err != nil {
+					return nil, stacktrace.Propagate(err, "update outbox event fails")
+				}
+
+				// A dead event is given up on, the ones after it go on
+				if item.Status == StatusDead {
+					continue
+				}
+
+				break
+			}
+
+			item.Publish()
+			_, err = tx.Exec(publishEventQuery, item.PublishedAt, item.ID)
+			if err != nil {
+				return nil, stacktrace.Propagate(err, "update outbox event fails")
+			}
+
+			published++
+		}
+
+		return published, nil
+	})
+
+	if err != nil {
+		return 0, err
+	}
+
+	// The failed attempt is committed above, report it afterwards
+	if publishErr != nil {
+		return result.(int), stacktrace.Propagate(publishErr, "publish outbox event fails")
+	}
+
+	return result.(int), nil
+}
+
+func (repo *sqlRepository) DeletePublishedBefore(publishedAt time.Time) error {
+	_, err := repo.mysqlDB.WithTransaction(func(tx *sqlx.Tx) (interface{}, error) {
+		_, err := tx.Exec(deletePublishedEventQuery, publishedAt)
+		return nil, err
+	})
+
+	return err
+}
@@ -0,0 +1,49 @@
+package outbox
+
+import (
+	"errors"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/palantir/stacktrace"
+)
+
+const insertEventQuery = `
+	INSERT INTO outbox_events (id, aggregate_type, aggregate_id, type, payload, status, attempts, last_error, created_at) 
+	VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+`
+
+// Write records an event inside the caller's transaction, so the event is
+// stored if and only if the state change it describes is committed.
+func Write(tx *sqlx.Tx, aggregateType, aggregateID, eventType string, data interface{}) error {
+	item, err := New(aggregateType, aggregateID, eventType, data)
+	if err != nil {
+		return stacktrace.Propagate(err, "build outbox event error")
+	}
+
+	res, err := tx.Exec(insertEventQuery,
+		item.ID,
+		item.AggregateType,
+		item.AggregateID,
+		item.Type,
+		string(item.Payload),
+		item.Status,
+		item.Attempts,
+		item.LastError,
+		item.CreatedAt,
+	)
+
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected <= 0 {
+		return errors.New("insert outbox event fails")
+	}
+
+	return nil
+}
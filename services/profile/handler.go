@@ -1,8 +1,10 @@
 package profile
 
 import (
+	"context"
 	"errors"
 	"net/http"
+	"strconv"
 
 	"github.com/gin-gonic/gin"
 	"github.com/go-playground/validator/v10"
@@ -11,6 +13,8 @@ import (
 
 	"stark/failure"
 	"stark/respond"
+	"stark/services/profile_trail"
+	"stark/services/user_detail"
 	"stark/utils"
 	"stark/utils/activity"
 	"stark/utils/log"
@@ -24,6 +28,76 @@ func NewHandler(service *Service) *Handler {
 	return &Handler{service: service}
 }
 
+func (h *Handler) HandleDetail(c *gin.Context) {
+	ctx := activity.NewContext("profile_detail")
+	ctx = activity.WithUserID(ctx, c.Value("user_id").(string))
+	trx, _ := activity.GetTransactionID(ctx)
+	userID, _ := activity.GetUserID(ctx)
+	id, err := uuid.Parse(userID)
+	if err != nil {
+		respond.Error(c, trx, http.StatusBadRequest, respond.ErrBadRequest, "invalid user id")
+		return
+	}
+
+	profile, err := h.service.FindProfile(id)
+	if err != nil {
+		if f, ok := stacktrace.RootCause(err).(failure.Failure); ok {
+			switch f.Code {
+			case failure.CodeUserNotFound:
+				respond.Error(c, trx, http.StatusBadRequest, f.Code, f.Desc)
+				return
+			}
+		}
+
+		log.WithContext(ctx).Error(stacktrace.Propagate(err, "get profile error"))
+		respond.Error(c, trx, http.StatusInternalServerError, respond.ErrInternal, "unknown error")
+		return
+	}
+
+	respond.Success(c, trx, http.StatusOK, profile)
+}
+
+func (h *Handler) HandleHistory(c *gin.Context) {
+	ctx := activity.NewContext("profile_history")
+	ctx = activity.WithUserID(ctx, c.Value("user_id").(string))
+	trx, _ := activity.GetTransactionID(ctx)
+	userID, _ := activity.GetUserID(ctx)
+	id, err := uuid.Parse(userID)
+	if err != nil {
+		respond.Error(c, trx, http.StatusBadRequest, respond.ErrBadRequest, "invalid user id")
+		return
+	}
+
+	pageString := c.Query("page")
+	limitString := c.Query("limit")
+	page := 1
+	limit := 25
+	if pageString != "" {
+		page, err = strconv.Atoi(pageString)
+		if err != nil || page < 1 {
+			respond.Error(c, trx, http.StatusBadRequest, respond.ErrBadRequest, "invalid page")
+			return
+		}
+	}
+
+	if limitString != "" {
+		limit, err = strconv.Atoi(limitString)
+		if err != nil || limit < 1 {
+			respond.Error(c, trx, http.StatusBadRequest, respond.ErrBadRequest, "invalid limit")
+			return
+		}
+	}
+
+	history, err := h.service.FindHistory(id, page, limit)
+	if err != nil {
+		log.WithContext(ctx).Error(stacktrace.Propagate(err, "get profile history error"))
+		respond.Error(c, trx, http.StatusInternalServerError, respond.ErrInternal, "unknown error")
+		return
+	}
+
+	respond.Success(c, trx, http.StatusOK, history)
+}
+
 func (h *Handler) HandleUpdateProfile(c *gin.Context) {
 	ctx := activity.NewContext("update_profile")
 	ctx = activity.WithUserID(ctx, c.Value("user_id").(string))
@@ -53,19 +127,17 @@ func (h *Handler) HandleUpdateProfile(c *gin.Context) {
 		return
 	}
 
+	origin := profile_trail.NewOrigin(ctx, c.ClientIP(), c.Request.UserAgent())
 	err = h.service.UpdateProfile(
+		origin,
 		id,
 		input.Name,
 		input.Username,
 		input.Contact,
 		input.DeviceToken,
 		input.DeviceOS,
-		input.AvatarUrl,
-		input.AvatarPath,
 		input.Source,
 		input.OAuthId,
-		input.IDCardUrl,
-		input.IDCardPath,
 		input.ProvinceID,
 		input.RegencyID,
 		input.DistrictID,
@@ -78,6 +150,9 @@ func (h *Handler) HandleUpdateProfile(c *gin.Context) {
 			case failure.CodeIncorrectUserID:
 				respond.Error(c, trx, http.StatusBadRequest, f.Code, f.Desc)
 				return
+			case failure.CodeVersionConflict:
+				respond.Error(c, trx, http.StatusPreconditionFailed, f.Code, f.Desc)
+				return
 			}
 		}
 
@@ -89,6 +164,62 @@ func (h *Handler) HandleUpdateProfile(c *gin.Context) {
 	respond.Success(c, trx, http.StatusCreated, input)
 }
 
+// HandleUploadAvatar takes the avatar as the file field of a multipart form
+func (h *Handler) HandleUploadAvatar(c *gin.Context) {
+	h.handleUpload(c, "profile_upload_avatar", h.service.UploadAvatar)
+}
+
+// HandleUploadIDCard takes the ID card as the file field of a multipart form
+func (h *Handler) HandleUploadIDCard(c *gin.Context) {
+	h.handleUpload(c, "profile_upload_id_card", h.service.UploadIDCard)
+}
+
+func (h *Handler) handleUpload(c *gin.Context, action string, upload func(profile_trail.Origin, uuid.UUID, []byte) (*user_detail.Upload, error)) {
+	ctx := activity.NewContext(action)
+	ctx = activity.WithUserID(ctx, c.Value("user_id").(string))
+	trx, _ := activity.GetTransactionID(ctx)
+	userID, _ := activity.GetUserID(ctx)
+	id, err := uuid.Parse(userID)
+	if err != nil {
+		respond.Error(c, trx, http.StatusBadRequest, respond.ErrBadRequest, "invalid user id")
+		return
+	}
+
+	data, err := user_detail.ReadUpload(c)
+	if err != nil {
+		respondUploadError(c, ctx, trx, err)
+		return
+	}
+
+	origin := profile_trail.NewOrigin(ctx, c.ClientIP(), c.Request.UserAgent())
+	item, err := upload(origin, id, data)
+	if err != nil {
+		respondUploadError(c, ctx, trx, err)
+		return
+	}
+
+	respond.Success(c, trx, http.StatusCreated, item.SelfView())
+}
+
+func respondUploadError(c *gin.Context, ctx context.Context, trx string, err error) {
+	if f, ok := stacktrace.RootCause(err).(failure.Failure); ok {
+		switch f.Code {
+		case failure.CodeInvalidImage:
+			respond.Error(c, trx, http.StatusBadRequest, f.Code, f.Desc)
+			return
+		case failure.CodeUserNotFound:
+			respond.Error(c, trx, http.StatusBadRequest, f.Code, "profile has no user detail, update the profile first")
+			return
+		case failure.CodeUploadTooLarge:
+			respond.Error(c, trx, http.StatusRequestEntityTooLarge, f.Code, f.Desc)
+			return
+		}
+	}
+
+	log.WithContext(ctx).Error(stacktrace.Propagate(err, "upload profile image error"))
+	respond.Error(c, trx, http.StatusInternalServerError, respond.ErrInternal, "unknown error")
+}
+
 func (h *Handler) HandleChangePassword(c *gin.Context) {
 	ctx := activity.NewContext("profile_change_password")
 	ctx = activity.WithUserID(ctx, c.Value("user_id").(string))
@@ -123,7 +254,9 @@ func (h *Handler) HandleChangePassword(c *gin.Context) {
 		return
 	}
 
+	origin := profile_trail.NewOrigin(ctx, c.ClientIP(), c.Request.UserAgent())
 	err = h.service.ChangePassword(
+		origin,
 		id,
 		input.OldPassword,
 		input.NewPassword,
@@ -139,6 +272,9 @@ func (h *Handler) HandleChangePassword(c *gin.Context) {
 			case failure.CodeIncorrectPassword:
 				respond.Error(c, trx, http.StatusBadRequest, f.Code, f.Desc)
 				return
+			case failure.CodeVersionConflict:
+				respond.Error(c, trx, http.StatusPreconditionFailed, f.Code, f.Desc)
+				return
 			}
 		}
 
@@ -16,12 +16,8 @@ type InputUpdateProfile struct {
 	Contact     string `json:"contact"`
 	DeviceToken string `json:"device_token"`
 	DeviceOS    string `json:"device_os"`
-	AvatarUrl   string `json:"avatar_url"`
-	AvatarPath  string `json:"avatar_path"`
 	Source      string `json:"source"`
 	OAuthId     string `json:"oauth_id"`
-	IDCardUrl   string `json:"id_card_url"`
-	IDCardPath  string `json:"id_card_path"`
 	ProvinceID  string `json:"province_id"`
 	RegencyID   string `json:"regency_id"`
 	DistrictID  string `json:"district_id"`
@@ -1,6 +1,129 @@
 package profile
 
+import (
+	"time"
+
+	"stark/services/identity_verification"
+	"stark/services/user"
+	"stark/services/user_detail"
+	"stark/services/user_location"
+)
+
 type Login struct {
 	AccessToken  string `json:"access_token"`
 	RefreshToken string `json:"refresh_token"`
 }
+
+// Profile is everything the user can see about themselves in one response
+type Profile struct {
+	User         user.SelfView           `json:"user"`
+	Detail       *user_detail.SelfView   `json:"detail"`
+	Location     *user_location.SelfView `json:"location"`
+	Verification Verification            `json:"verification"`
+	Completeness Completeness            `json:"completeness"`
+}
+
+type Verification struct {
+	Email VerificationState `json:"email"`
+	// There is no phone verification flow yet, the contact stays unverified
+	Phone    VerificationState         `json:"phone"`
+	Identity IdentityVerificationState `json:"identity"`
+}
+
+type VerificationState struct {
+	Verified   bool       `json:"verified"`
+	VerifiedAt *time.Time `json:"verified_at"`
+}
+
+// IdentityVerificationState adds the status of the latest identity
+// verification request, empty when the user never submitted one
+type IdentityVerificationState struct {
+	VerificationState
+	Status string `json:"status"`
+}
+
+// Completeness scores the profile from 0 to 100 by the share of filled
+// fields, Missing lists the ones left to fill.
+type Completeness struct {
+	Score   int      `json:"score"`
+	Missing []string `json:"missing"`
+}
+
+func NewProfile(
+	item *user.User,
+	detail *user_detail.UserDetail,
+	location *user_location.UserLocation,
+	identityVerification *identity_verification.IdentityVerification,
+) *Profile {
+	identity := IdentityVerificationState{
+		VerificationState: VerificationState{
+			Verified:   item.IdentityVerifiedAt != nil,
+			VerifiedAt: item.IdentityVerifiedAt,
+		},
+	}
+
+	if identityVerification != nil {
+		identity.Status = identityVerification.Status
+	}
+
+	profile := &Profile{
+		User: item.SelfView(),
+		Verification: Verification{
+			Email: VerificationState{
+				Verified:   item.EmailVerifiedAt != nil,
+				VerifiedAt: item.EmailVerifiedAt,
+			},
+			Identity: identity,
+		},
+		Completeness: completeness(item, detail, location),
+	}
+
+	if detail != nil {
+		view := detail.SelfView()
+		profile.Detail = &view
+	}
+
+	if location != nil {
+		view := location.SelfView()
+		profile.Location = &view
+	}
+
+	return profile
+}
+
+func completeness(item *user.User, detail *user_detail.UserDetail, location *user_location.UserLocation) Completeness {
+	if detail == nil {
+		detail = &user_detail.UserDetail{}
+	}
+
+	if location == nil {
+		location = &user_location.UserLocation{}
+	}
+
+	fields := []struct {
+		name   string
+		filled bool
+	}{
+		{"name", item.Name != ""},
+		{"contact", item.Contact != ""},
+		{"email_verified", item.EmailVerifiedAt != nil},
+		{"avatar", detail.AvatarUrl != ""},
+		{"id_card", detail.IDCardUrl != ""},
+		{"province", location.ProvinceID != ""},
+		{"regency", location.RegencyID != ""},
+		{"district", location.DistrictID != ""},
+		{"village", location.VillageID != ""},
+	}
+
+	missing := make([]string, 0)
+	for _, field := range fields {
+		if !field.filled {
+			missing = append(missing, field.name)
+		}
+	}
+
+	return Completeness{
+		Score:   (len(fields) - len(missing)) * 100 / len(fields),
+		Missing: missing,
+	}
+}
@@ -0,0 +1,33 @@
+package profile
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"stark/services/user"
+	"stark/services/user_detail"
+	"stark/services/user_location"
+)
+
+func TestProfileHidesSecrets(t *testing.T) {
+	item := user.NewWithPasswordHash("Tony", "tony@stark.com", "tony", "0800", "$2a$14$secret-hash", user.StatusActive)
+	detail := user_detail.New(item.ID, "device-token", "ios", "web", "google-oauth-id")
+	detail.SetIDCard("https://cdn.example.com/id-card.png?signature=x", "id-cards/"+item.ID.String()+"/id-card.png")
+	location := user_location.New(item.ID, "31", "3171", "317101", "3171011001")
+
+	data, err := json.Marshal(NewProfile(item, detail, location, nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, field := range []string{`"password"`, `"device_token"`, `"oauth_id"`, `"avatar_path"`, `"id_card_path"`} {
+		if strings.Contains(string(data), field) {
+			t.Errorf("%s leaked in %s", field, data)
+		}
+	}
+
+	if !strings.Contains(string(data), `"id_card_url"`) {
+		t.Errorf(`"id_card_url" is missing from %s`, data)
+	}
+}
@@ -2,92 +2,185 @@ package profile
 
 import (
 	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/palantir/stacktrace"
 
+	"stark/database"
 	"stark/failure"
+	"stark/services/identity_verification"
+	"stark/services/notification"
+	"stark/services/profile_trail"
 	"stark/services/user"
 	"stark/services/user_detail"
 	"stark/services/user_location"
+	"stark/services/webhook"
 	"stark/utils"
+	"stark/utils/activity"
+	"stark/utils/log"
 )
 
 type Service struct {
-	userService         *user.Service
-	userDetailService   *user_detail.Service
-	userLocationService *user_location.Service
+	mysqlDB                     *database.MySQL
+	userService                 *user.Service
+	userDetailService           *user_detail.Service
+	userLocationService         *user_location.Service
+	notificationService         *notification.Service
+	webhookService              *webhook.Service
+	profileTrailService         *profile_trail.Service
+	identityVerificationService *identity_verification.Service
 }
 
 func NewService(
+	mysqlDB *database.MySQL,
 	userService *user.Service,
 	userDetailService *user_detail.Service,
 	userLocationService *user_location.Service,
+	notificationService *notification.Service,
+	webhookService *webhook.Service,
+	profileTrailService *profile_trail.Service,
+	identityVerificationService *identity_verification.Service,
 ) *Service {
 	return &Service{
-		userService:         userService,
-		userDetailService:   userDetailService,
-		userLocationService: userLocationService,
+		mysqlDB:                     mysqlDB,
+		userService:                 userService,
+		userDetailService:           userDetailService,
+		userLocationService:         userLocationService,
+		notificationService:         notificationService,
+		webhookService:              webhookService,
+		profileTrailService:         profileTrailService,
+		identityVerificationService: identityVerificationService,
 	}
 }
 
+func (s *Service) FindProfile(id uuid.UUID) (*Profile, error) {
+	item, err := s.userService.FindByID(id)
+	if err != nil {
+		return nil, err
+	}
+
+	detail, err := s.userDetailService.FindByID(id)
+	if err != nil && !isNotFound(err) {
+		return nil, err
+	}
+
+	location, err := s.userLocationService.FindByID(id)
+	if err != nil && !isNotFound(err) {
+		return nil, err
+	}
+
+	identityVerification, err := s.identityVerificationService.FindLatestByUserID(id)
+	if err != nil && !isNotFound(err) {
+		return nil, err
+	}
+
+	return NewProfile(item, detail, location, identityVerification), nil
+}
+
+// FindHistory reads a page of the profile trail of the user, newest first
+func (s *Service) FindHistory(id uuid.UUID, page, limit int) (profile_trail.Page, error) {
+	return s.profileTrailService.FindPageByFilter(profile_trail.Filter{UserID: id.String()}, page, limit)
+}
+
 func (s *Service) UpdateProfile(
+	origin profile_trail.Origin,
 	id uuid.UUID,
 	name,
 	username,
 	contact,
 	device_token,
 	device_os,
-	avatar_url,
-	avatar_path,
 	source,
 	oauth_id,
-	id_card_url,
-	id_card_path,
 	province_id,
 	regency_id,
 	district_id,
 	village_id string) error {
-	_, err := s.userService.UpdateProfile(
-		id,
-		name,
-		username,
-		contact,
-	)
+	// The user, detail and location are written in one transaction, a failed
+	// write rolls back the ones before it. Their trails are held in a batch
+	// until the commit.
+	trails := s.profileTrailService.NewBatch()
+	payload, err := s.mysqlDB.WithTransaction(func(tx *sqlx.Tx) (interface{}, error) {
+		user, err := s.userService.WithTx(tx).WithTrail(trails).UpdateProfile(
+			origin,
+			id,
+			name,
+			username,
+			contact,
+		)
 
-	if err != nil {
-		return err
-	}
+		if err != nil {
+			return nil, err
+		}
 
-	_, err = s.userDetailService.Update(
-		id,
-		device_token,
-		device_os,
-		avatar_url,
-		avatar_path,
-		source,
-		oauth_id,
-		id_card_url,
-		id_card_path,
-	)
+		// The profile form carries no ETag, version 0 writes over whatever is
+		// stored just like before
+		detail, err := s.userDetailService.WithTx(tx).WithTrail(trails).Update(
+			origin,
+			id,
+			0,
+			device_token,
+			device_os,
+			source,
+			oauth_id,
+		)
+
+		if err != nil {
+			return nil, err
+		}
+
+		location, err := s.userLocationService.WithTx(tx).WithTrail(trails).Update(
+			origin,
+			id,
+			0,
+			province_id,
+			regency_id,
+			district_id,
+			village_id,
+		)
+
+		if err != nil {
+			return nil, err
+		}
+
+		return map[string]interface{}{
+			"user":     user.ClientView(),
+			"detail":   detail.ClientView(),
+			"location": location.ClientView(),
+		}, nil
+	})
 
 	if err != nil {
 		return err
 	}
 
-	_, err = s.userLocationService.Update(
-		id,
-		province_id,
-		regency_id,
-		district_id,
-		village_id,
-	)
+	err = trails.Flush()
+	if err != nil {
+		ctx := activity.NewContext("profile_trail")
+		ctx = activity.WithUserID(ctx, id.String())
+		log.WithContext(ctx).Error(stacktrace.Propagate(err, "record profile trails error"))
+	}
 
+	// Dispatched after the commit so receivers never hear of a rolled back
+	// update
+	err = s.webhookService.Dispatch(webhook.EventProfileUpdated, payload)
 	if err != nil {
-		return err
+		ctx := activity.NewContext("profile_webhook_dispatch")
+		ctx = activity.WithUserID(ctx, id.String())
+		log.WithContext(ctx).Error(stacktrace.Propagate(err, "dispatch profile webhook error"))
 	}
 
 	return nil
 }
 
-func (s *Service) ChangePassword(id uuid.UUID, old_password, new_password, new_password_confirmation string) error {
+func (s *Service) UploadAvatar(origin profile_trail.Origin, id uuid.UUID, data []byte) (*user_detail.Upload, error) {
+	return s.userDetailService.UploadAvatar(origin, id, data)
+}
+
+func (s *Service) UploadIDCard(origin profile_trail.Origin, id uuid.UUID, data []byte) (*user_detail.Upload, error) {
+	return s.userDetailService.UploadIDCard(origin, id, data)
+}
+
+func (s *Service) ChangePassword(origin profile_trail.Origin, id uuid.UUID, old_password, new_password, new_password_confirmation string) error {
 	user, err := s.userService.FindByID(id)
 	if err != nil {
 		return err
@@ -100,10 +193,17 @@ func (s *Service) ChangePassword(id uuid.UUID, old_password, new_password, new_p
 		)
 	}
 
-	_, err = s.userService.Update(user.ID, user.Name, user.Email, user.Username, user.Contact, new_password)
+	_, err = s.userService.ChangePassword(origin, user.ID, new_password)
 	if err != nil {
 		return err
 	}
 
+	s.notificationService.NotifyPasswordChanged(user)
+
 	return nil
 }
+
+func isNotFound(err error) bool {
+	f, ok := stacktrace.RootCause(err).(failure.Failure)
+	return ok && (f.Code == failure.CodeUserNotFound || f.Code == failure.CodeIdentityVerificationNotFound)
+}
@@ -0,0 +1,37 @@
+package profile_trail
+
+import "github.com/palantir/stacktrace"
+
+// Batch holds the trails of a unit of work, they are stored by Flush once it
+// commits so a rolled back change leaves no trail.
+type Batch struct {
+	service *Service
+	items   []*ProfileTrail
+}
+
+func (b *Batch) Record(origin Origin, userID, section string, before, after interface{}, redacted ...string) error {
+	item, err := New(origin, userID, section, before, after, redacted...)
+	if err != nil {
+		return stacktrace.Propagate(err, "diff profile trail error")
+	}
+
+	if item != nil {
+		b.items = append(b.items, item)
+	}
+
+	return nil
+}
+
+func (b *Batch) Flush() error {
+	if len(b.items) == 0 {
+		return nil
+	}
+
+	err := b.service.repo.StoreMany(b.items)
+	if err != nil {
+		return err
+	}
+
+	b.items = nil
+	return nil
+}
@@ -0,0 +1,34 @@
+package profile_trail
+
+import "go.mongodb.org/mongo-driver/bson"
+
+type Filter struct {
+	UserID        string
+	TransactionID string
+	Section       string
+	Actor         string
+	ClientID      string
+}
+
+// IsIndexed reports whether the filter narrows on an indexed field, the other
+// criteria alone would scan the whole collection.
+func (f Filter) IsIndexed() bool {
+	return f.UserID != "" || f.TransactionID != ""
+}
+
+func (f Filter) document() bson.M {
+	document := bson.M{}
+	for field, value := range map[string]string{
+		"user_id":        f.UserID,
+		"transaction_id": f.TransactionID,
+		"section":        f.Section,
+		"actor":          f.Actor,
+		"client_id":      f.ClientID,
+	} {
+		if value != "" {
+			document[field] = value
+		}
+	}
+
+	return document
+}
@@ -0,0 +1,71 @@
+package profile_trail
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/palantir/stacktrace"
+
+	"stark/respond"
+	"stark/utils/activity"
+	"stark/utils/log"
+)
+
+type Handler struct {
+	service *Service
+}
+
+func NewHandler(service *Service) *Handler {
+	return &Handler{service: service}
+}
+
+// HandlePage queries the trails of every user for operators, by user_id or
+// transaction_id and optionally narrowed by section, actor and client_id.
+func (h *Handler) HandlePage(c *gin.Context) {
+	ctx := activity.NewContext("profile_trail_page")
+	ctx = activity.WithInternalID(ctx, c.Value("internal_id").(string))
+	trx, _ := activity.GetTransactionID(ctx)
+	filter := Filter{
+		UserID:        c.Query("user_id"),
+		TransactionID: c.Query("transaction_id"),
+		Section:       c.Query("section"),
+		Actor:         c.Query("actor"),
+		ClientID:      c.Query("client_id"),
+	}
+
+	if !filter.IsIndexed() {
+		respond.Error(c, trx, http.StatusBadRequest, respond.ErrBadRequest, "user_id or transaction_id is required")
+		return
+	}
+
+	var err error
+	pageString := c.Query("page")
+	limitString := c.Query("limit")
+	page := 1
+	limit := 25
+	if pageString != "" {
+		page, err = strconv.Atoi(pageString)
+		if err != nil || page < 1 {
+			respond.Error(c, trx, http.StatusBadRequest, respond.ErrBadRequest, "invalid page")
+			return
+		}
+	}
+
+	if limitString != "" {
+		limit, err = strconv.Atoi(limitString)
+		if err != nil || limit < 1 {
+			respond.Error(c, trx, http.StatusBadRequest, respond.ErrBadRequest, "invalid limit")
+			return
+		}
+	}
+
+	trailPage, err := h.service.FindPageByFilter(filter, page, limit)
+	if err != nil {
+		log.WithContext(ctx).Error(stacktrace.Propagate(err, "get profile trail page error"))
+		respond.Error(c, trx, http.StatusInternalServerError, respond.ErrInternal, "unknown error")
+		return
+	}
+
+	respond.Success(c, trx, http.StatusOK, trailPage)
+}
@@ -0,0 +1,108 @@
+package profile_trail
+
+import (
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"stark/services/client_audit"
+	"stark/utils/activity"
+)
+
+const (
+	anonymizedUserID = "anonymized"
+
+	SectionProfile  = "profile"
+	SectionDetail   = "detail"
+	SectionLocation = "location"
+
+	ActorUser     = "user"
+	ActorClient   = "client"
+	ActorInternal = "internal"
+)
+
+// bookkeepingFields change on every write, they are left out of the changes
+var bookkeepingFields = []string{"created_at", "updated_at", "version"}
+
+type ProfileTrail struct {
+	ID            primitive.ObjectID             `json:"id" bson:"_id,omitempty"`
+	TransactionID string                         `json:"transaction_id" bson:"transaction_id"`
+	UserID        string                         `json:"user_id" bson:"user_id"`
+	Section       string                         `json:"section" bson:"section"`
+	Actor         string                         `json:"actor" bson:"actor"`
+	ActorType     string                         `json:"actor_type" bson:"actor_type"`
+	ClientID      string                         `json:"client_id" bson:"client_id"`
+	Changes       map[string]client_audit.Change `json:"changes" bson:"changes"`
+	IP            string                         `json:"ip" bson:"ip"`
+	UserAgent     string                         `json:"user_agent" bson:"user_agent"`
+	CreatedAt     time.Time                      `json:"created_at" bson:"created_at"`
+}
+
+// Origin is who made a change and where the request came from
+type Origin struct {
+	TransactionID string
+	Actor         string
+	ActorType     string
+	ClientID      string
+	IP            string
+	UserAgent     string
+}
+
+// NewOrigin reads the actor of a request from its activity context, the
+// user themselves, an internal operator or else the client app.
+func NewOrigin(ctx context.Context, ip, userAgent string) Origin {
+	trx, _ := activity.GetTransactionID(ctx)
+	clientID, _ := activity.GetClientID(ctx)
+	origin := Origin{
+		TransactionID: trx,
+		ClientID:      clientID,
+		IP:            ip,
+		UserAgent:     userAgent,
+	}
+
+	if userID, ok := activity.GetUserID(ctx); ok {
+		origin.Actor, origin.ActorType = userID, ActorUser
+	} else if internalID, ok := activity.GetInternalID(ctx); ok {
+		origin.Actor, origin.ActorType = internalID, ActorInternal
+	} else {
+		origin.Actor, origin.ActorType = clientID, ActorClient
+	}
+
+	return origin
+}
+
+// New returns the trail of a change to a section of the user, nil when
+// nothing but the bookkeeping fields changed
+func New(origin Origin, userID, section string, before, after interface{}, redacted ...string) (*ProfileTrail, error) {
+	changes, err := client_audit.Diff(before, after, redacted...)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, field := range bookkeepingFields {
+		delete(changes, field)
+	}
+
+	if len(changes) == 0 {
+		return nil, nil
+	}
+
+	return &ProfileTrail{
+		TransactionID: origin.TransactionID,
+		UserID:        userID,
+		Section:       section,
+		Actor:         origin.Actor,
+		ActorType:     origin.ActorType,
+		ClientID:      origin.ClientID,
+		Changes:       changes,
+		IP:            origin.IP,
+		UserAgent:     origin.UserAgent,
+		CreatedAt:     time.Now(),
+	}, nil
+}
+
+type Page struct {
+	Items []*ProfileTrail `json:"items"`
+	Total int             `json:"total"`
+}
@@ -0,0 +1,136 @@
+package profile_trail
+
+import (
+	"os"
+
+	"github.com/palantir/stacktrace"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"stark/utils/activity"
+)
+
+const collectionName = "profile_trails"
+
+type mongoRepository struct {
+	collection *mongo.Collection
+}
+
+func NewMongoRepository(mongoDB *mongo.Client) Repository {
+	collection := mongoDB.Database(os.Getenv("MONGO_DATABASE")).Collection(collectionName)
+	return &mongoRepository{collection}
+}
+
+func (repo *mongoRepository) Store(item *ProfileTrail) error {
+	ctx := activity.NewContext("profile_trail_store")
+	_, err := repo.collection.InsertOne(ctx, item)
+	if err != nil {
+		return stacktrace.Propagate(err, "can't insert profile trail")
+	}
+
+	return nil
+}
+
+func (repo *mongoRepository) StoreMany(items []*ProfileTrail) error {
+	ctx := activity.NewContext("profile_trail_store_many")
+	documents := make([]interface{}, 0, len(items))
+	for _, item := range items {
+		documents = append(documents, item)
+	}
+
+	_, err := repo.collection.InsertMany(ctx, documents)
+	if err != nil {
+		return stacktrace.Propagate(err, "can't insert profile trails")
+	}
+
+	return nil
+}
+
+func (repo *mongoRepository) FindByUserID(userID string) (result []*ProfileTrail, err error) {
+	ctx := activity.NewContext("profile_trail_find_by_user_id")
+	opts := options.Find().SetSort(bson.D{{Key: "created_at", Value: 1}})
+	cursor, err := repo.collection.Find(ctx, bson.M{"user_id": userID}, opts)
+	if err != nil {
+		return nil, stacktrace.Propagate(err, "can't find profile trails by user id")
+	}
+
+	result = make([]*ProfileTrail, 0)
+	err = cursor.All(ctx, &result)
+	if err != nil {
+		return nil, stacktrace.Propagate(err, "can't decode profile trails")
+	}
+
+	return result, nil
+}
+
+func (repo *mongoRepository) FindPageByFilter(filter Filter, offset, limit int) (result []*ProfileTrail, err error) {
+	ctx := activity.NewContext("profile_trail_find_page_by_filter")
+	opts := options.Find().
+		SetSort(bson.D{{Key: "created_at", Value: -1}}).
+		SetSkip(int64(offset)).
+		SetLimit(int64(limit))
+
+	cursor, err := repo.collection.Find(ctx, filter.document(), opts)
+	if err != nil {
+		return nil, stacktrace.Propagate(err, "can't find profile trails by filter")
+	}
+
+	result = make([]*ProfileTrail, 0)
+	err = cursor.All(ctx, &result)
+	if err != nil {
+		return nil, stacktrace.Propagate(err, "can't decode profile trails")
+	}
+
+	return result, nil
+}
+
+func (repo *mongoRepository) FindTotalByUserID(userID string) (int, error) {
+	ctx := activity.NewContext("profile_trail_total_by_user_id")
+	total, err := repo.collection.CountDocuments(ctx, bson.M{"user_id": userID})
+	if err != nil {
+		return 0, stacktrace.Propagate(err, "can't count profile trails by user id")
+	}
+
+	return int(total), nil
+}
+
+func (repo *mongoRepository) FindTotalByFilter(filter Filter) (int, error) {
+	ctx := activity.NewContext("profile_trail_total_by_filter")
+	total, err := repo.collection.CountDocuments(ctx, filter.document())
+	if err != nil {
+		return 0, stacktrace.Propagate(err, "can't count profile trails by filter")
+	}
+
+	return int(total), nil
+}
+
+// AnonymizeByUserID detaches the trails of a user from them, the changed
+// values are personal data as well and are dropped.
+func (repo *mongoRepository) AnonymizeByUserID(userID string) error {
+	ctx := activity.NewContext("profile_trail_anonymize")
+	_, err := repo.collection.UpdateMany(
+		ctx,
+		bson.M{"actor": userID},
+		bson.M{"$set": bson.M{"actor": anonymizedUserID}},
+	)
+
+	if err != nil {
+		return stacktrace.Propagate(err, "can't anonymize profile trail actors")
+	}
+
+	_, err = repo.collection.UpdateMany(
+		ctx,
+		bson.M{"user_id": userID},
+		bson.M{
+			"$set":   bson.M{"user_id": anonymizedUserID},
+			"$unset": bson.M{"ip": "", "user_agent": "", "changes": ""},
+		},
+	)
+
+	if err != nil {
+		return stacktrace.Propagate(err, "can't anonymize profile trails")
+	}
+
+	return nil
+}
@@ -0,0 +1,11 @@
+package profile_trail
+
+type Repository interface {
+	Store(item *ProfileTrail) error
+	StoreMany(items []*ProfileTrail) error
+	FindByUserID(userID string) ([]*ProfileTrail, error)
+	FindPageByFilter(filter Filter, offset, limit int) ([]*ProfileTrail, error)
+	FindTotalByUserID(userID string) (int, error)
+	FindTotalByFilter(filter Filter) (int, error)
+	AnonymizeByUserID(userID string) error
+}
@@ -0,0 +1,67 @@
+package profile_trail
+
+import "github.com/palantir/stacktrace"
+
+// Recorder records the trail of a change, Service stores it right away and
+// Batch holds it until the unit of work of the change commits.
+type Recorder interface {
+	Record(origin Origin, userID, section string, before, after interface{}, redacted ...string) error
+}
+
+type Service struct {
+	repo Repository
+}
+
+func NewService(repo Repository) *Service {
+	return &Service{repo: repo}
+}
+
+// Record stores the fields that differ between the two snapshots, either side
+// may be nil. Values of the redacted fields are masked.
+func (s *Service) Record(origin Origin, userID, section string, before, after interface{}, redacted ...string) error {
+	item, err := New(origin, userID, section, before, after, redacted...)
+	if err != nil {
+		return stacktrace.Propagate(err, "diff profile trail error")
+	}
+
+	if item == nil {
+		return nil
+	}
+
+	return s.repo.Store(item)
+}
+
+func (s *Service) NewBatch() *Batch {
+	return &Batch{service: s}
+}
+
+func (s *Service) FindByUserID(userID string) ([]*ProfileTrail, error) {
+	return s.repo.FindByUserID(userID)
+}
+
+func (s *Service) FindTotalByUserID(userID string) (int, error) {
+	return s.repo.FindTotalByUserID(userID)
+}
+
+// FindPageByFilter reads a page of trails, newest first
+func (s *Service) FindPageByFilter(filter Filter, page, limit int) (Page, error) {
+	offset := (page - 1) * limit
+	items, err := s.repo.FindPageByFilter(filter, offset, limit)
+	if err != nil {
+		return Page{}, err
+	}
+
+	total, err := s.repo.FindTotalByFilter(filter)
+	if err != nil {
+		return Page{}, err
+	}
+
+	return Page{
+		Items: items,
+		Total: total,
+	}, nil
+}
+
+func (s *Service) AnonymizeByUserID(userID string) error {
+	return s.repo.AnonymizeByUserID(userID)
+}
@@ -6,14 +6,22 @@ import (
 	"github.com/gin-gonic/gin"
 
 	"stark/database"
+	"stark/services/account"
 	"stark/services/auth"
 	"stark/services/client"
+	"stark/services/identity_verification"
+	"stark/services/notification"
 	"stark/services/profile"
+	"stark/services/profile_trail"
 	"stark/services/user"
 	"stark/services/user_detail"
+	"stark/services/user_export"
+	"stark/services/user_import"
 	"stark/services/user_location"
+	"stark/services/webhook"
 	"stark/utils/log"
 	"stark/utils/middleware"
+	"stark/utils/storage"
 )
 
 func InitRoute(
@@ -21,12 +29,21 @@ func InitRoute(
 	router *gin.Engine,
 	redisDB *database.Redis,
 	clientService *client.Service,
+	userService *user.Service,
 	clientHandler *client.Handler,
 	userHandler *user.Handler,
 	userDetailHandler *user_detail.Handler,
 	userLocationHandler *user_location.Handler,
 	authHandler *auth.Handler,
 	profileHandler *profile.Handler,
+	accountHandler *account.Handler,
+	notificationHandler *notification.Handler,
+	webhookHandler *webhook.Handler,
+	userImportHandler *user_import.Handler,
+	userExportHandler *user_export.Handler,
+	profileTrailHandler *profile_trail.Handler,
+	identityVerificationHandler *identity_verification.Handler,
+	localStorage *storage.LocalStorage,
 ) {
 	// Internal group
 	internal := router.Group("/internal")
@@ -35,48 +52,108 @@ func InitRoute(
 	// Client service
 	internal.POST("/client", clientHandler.HandleCreate)
 	internal.GET("/client/:id", clientHandler.HandleDetail)
-	internal.PUT("/client/:id", clientHandler.HandleUpdate)
+	internal.PUT("/client/:id", middleware.IfMatchMiddleware(), clientHandler.HandleUpdate)
+	internal.DELETE("/client/:id", clientHandler.HandleDelete)
+	internal.PUT("/client/:id/status", middleware.IfMatchMiddleware(), clientHandler.HandleChangeStatus)
+	internal.PUT("/client/:id/settings", middleware.IfMatchMiddleware(), clientHandler.HandleUpdateSettings)
+	internal.POST("/client/:id/rotate-key", clientHandler.HandleRotateKey)
+	internal.GET("/client/:id/audit", clientHandler.HandleAuditPage)
+	internal.GET("/client/cache-stats", clientHandler.HandleCacheStats)
 	internal.POST("/client/filter", clientHandler.HandleAllByFilter)
 	internal.GET("/client", clientHandler.HandlePage)
 
+	// Account service
+	internal.GET("/user/:id", accountHandler.HandleDetail)
+	internal.PUT("/user/:id/status", middleware.IfMatchMiddleware(), accountHandler.HandleChangeStatus)
+	internal.POST("/user/:id/force-password-reset", accountHandler.HandleForcePasswordReset)
+
+	// User export service
+	internal.POST("/user/export", userExportHandler.HandleExport)
+
+	// Profile trail service
+	internal.GET("/profile-trail", profileTrailHandler.HandlePage)
+
+	// Identity verification service
+	internal.GET("/identity-verification", identityVerificationHandler.HandlePage)
+	internal.GET("/identity-verification/:id", identityVerificationHandler.HandleDetail)
+	internal.PUT("/identity-verification/:id/status", middleware.IfMatchMiddleware(), identityVerificationHandler.HandleReview)
+
 	// Client group
 	client := router.Group("/client")
 	client.Use(middleware.ClientMiddleware(clientService))
+	client.Use(middleware.SignatureMiddleware(redisDB))
 
 	// User service
 	client.POST("/user", userHandler.HandleCreate)
 	client.GET("/user/:id", userHandler.HandleDetail)
-	client.PUT("/user/:id", userHandler.HandleUpdate)
+	client.PUT("/user/:id", middleware.IfMatchMiddleware(), userHandler.HandleUpdate)
+	client.PATCH("/user/:id", middleware.IfMatchMiddleware(), userHandler.HandlePatch)
+	client.DELETE("/user/:id", accountHandler.HandleClientDelete)
 	client.POST("/user/filter", userHandler.HandleAllByFilter)
+	client.POST("/user/batch", userHandler.HandleBatch)
 	client.GET("/user", userHandler.HandlePage)
 
+	// User import service
+	client.POST("/user/import", userImportHandler.HandleCreate)
+	client.GET("/user/import/:id", userImportHandler.HandleDetail)
+
 	// User detail service
 	client.POST("/user-detail", userDetailHandler.HandleCreate)
 	client.GET("/user-detail/:id", userDetailHandler.HandleDetail)
-	client.PUT("/user-detail/:id", userDetailHandler.HandleUpdate)
+	client.PUT("/user-detail/:id", middleware.IfMatchMiddleware(), userDetailHandler.HandleUpdate)
+	client.PATCH("/user-detail/:id", middleware.IfMatchMiddleware(), userDetailHandler.HandlePatch)
+	client.POST("/user-detail/:id/avatar", userDetailHandler.HandleUploadAvatar)
+	client.POST("/user-detail/:id/id-card", userDetailHandler.HandleUploadIDCard)
 	client.POST("/user-detail/filter", userDetailHandler.HandleAllByFilter)
 	client.GET("/user-detail", userDetailHandler.HandlePage)
 
 	// User location service
 	client.POST("/user-location", userLocationHandler.HandleCreate)
 	client.GET("/user-location/:id", userLocationHandler.HandleDetail)
-	client.PUT("/user-location/:id", userLocationHandler.HandleUpdate)
+	client.PUT("/user-location/:id", middleware.IfMatchMiddleware(), userLocationHandler.HandleUpdate)
+	client.PATCH("/user-location/:id", middleware.IfMatchMiddleware(), userLocationHandler.HandlePatch)
 	client.POST("/user-location/filter", userLocationHandler.HandleAllByFilter)
 	client.GET("/user-location", userLocationHandler.HandlePage)
 
+	// Webhook service
+	client.POST("/webhook", webhookHandler.HandleCreate)
+	client.GET("/webhook", webhookHandler.HandleList)
+	client.DELETE("/webhook/:id", webhookHandler.HandleDelete)
+	client.GET("/webhook/delivery", webhookHandler.HandleDeliveryPage)
+	client.POST("/webhook/delivery/:id/retry", webhookHandler.HandleRetryDelivery)
+
 	// API group
 	api := router.Group("/api")
 
 	// Auth service
 	api.POST("/login", authHandler.HandleLogin)
 	api.POST("/register", authHandler.HandleRegister)
+	api.POST("/verify-email", authHandler.HandleVerifyEmail)
+	api.POST("/revoke-sessions", notificationHandler.HandleRevokeSessions)
 	api.POST("/refresh-token", authHandler.HandleRegister)
-	api.Use(middleware.AuthMiddleware(redisDB))
+	api.GET("/account/export/:id/download", accountHandler.HandleExportDownload)
+	api.Use(middleware.AuthMiddleware(redisDB, userService))
 	api.GET("/logout", authHandler.HandleLogout)
 
 	// Profile service
+	api.GET("/profile", profileHandler.HandleDetail)
+	api.GET("/profile/history", profileHandler.HandleHistory)
 	api.POST("/update-profile", profileHandler.HandleUpdateProfile)
 	api.POST("/change-password", profileHandler.HandleChangePassword)
+	api.POST("/profile/avatar", profileHandler.HandleUploadAvatar)
+	api.POST("/profile/id-card", profileHandler.HandleUploadIDCard)
+	api.POST("/profile/identity-verification", identityVerificationHandler.HandleSubmit)
+	api.GET("/profile/identity-verification", identityVerificationHandler.HandleSelf)
+
+	// Account service
+	api.DELETE("/account", accountHandler.HandleDelete)
+	api.GET("/account/export", accountHandler.HandleExport)
+	api.GET("/account/export/:id", accountHandler.HandleExportStatus)
+
+	// Files of the local storage, an S3 backend serves its own
+	if localStorage != nil {
+		router.GET("/storage/:visibility/*key", localStorage.HandleGet)
+	}
 
 	router.GET("/ping", func(c *gin.Context) {
 		log.WithContext(ctx).Info("when you ping, then you get pong!")
@@ -0,0 +1,133 @@
+package session
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"time"
+
+	"stark/database"
+	"stark/utils"
+)
+
+const (
+	userSessionsPrefix = "user_sessions:"
+	knownDevicesPrefix = "known_devices:"
+	knownDevicesTTL    = 365 * 24 * time.Hour
+)
+
+type Service struct {
+	redisDB *database.Redis
+}
+
+func NewService(redisDB *database.Redis) *Service {
+	return &Service{redisDB: redisDB}
+}
+
+func (s *Service) Create(userID string, token *utils.TokenDetail) error {
+	accessExpires := time.Unix(token.AccessExpires, 0)
+	refreshExpires := time.Unix(token.RefreshExpires, 0)
+	now := time.Now()
+
+	err := s.redisDB.Set(token.AccessUuid, userID, accessExpires.Sub(now))
+	if err != nil {
+		return err
+	}
+
+	err = s.redisDB.Set(token.RefreshUuid, userID, refreshExpires.Sub(now))
+	if err != nil {
+		return err
+	}
+
+	return s.redisDB.SAdd(userSessionsPrefix+userID, token.AccessUuid, refreshExpires.Sub(now))
+}
+
+func (s *Service) Delete(accessUuid, userID string) (int64, error) {
+	deleted, err := s.redisDB.Delete(accessUuid)
+	if err != nil {
+		return 0, err
+	}
+
+	deleted, err = s.redisDB.Delete(accessUuid + "++" + userID)
+	if err != nil {
+		return 0, err
+	}
+
+	err = s.redisDB.SRem(userSessionsPrefix+userID, accessUuid)
+	if err != nil {
+		return 0, err
+	}
+
+	return deleted, nil
+}
+
+func (s *Service) FindByUserID(userID string) ([]*Session, error) {
+	accessUuids, err := s.redisDB.SMembers(userSessionsPrefix + userID)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	sessions := make([]*Session, 0)
+	for _, accessUuid := range accessUuids {
+		ttl, err := s.redisDB.TTL(accessUuid)
+		if err != nil {
+			return nil, err
+		}
+
+		// A negative TTL means the access token has already expired
+		if ttl < 0 {
+			continue
+		}
+
+		sessions = append(sessions, &Session{
+			ID:        accessUuid,
+			UserID:    userID,
+			ExpiresAt: now.Add(ttl),
+		})
+	}
+
+	return sessions, nil
+}
+
+func (s *Service) RevokeAll(userID string) error {
+	accessUuids, err := s.redisDB.SMembers(userSessionsPrefix + userID)
+	if err != nil {
+		return err
+	}
+
+	for _, accessUuid := range accessUuids {
+		_, err := s.Delete(accessUuid, userID)
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err = s.redisDB.Delete(userSessionsPrefix + userID)
+	return err
+}
+
+// RememberDevice records the IP and user agent of a login and reports whether
+// either of them is new for a user who has logged in before.
+func (s *Service) RememberDevice(userID, ip, userAgent string) (bool, error) {
+	known, err := s.redisDB.SMembers(knownDevicesPrefix + userID)
+	if err != nil {
+		return false, err
+	}
+
+	hash := sha256.Sum256([]byte(userAgent))
+	members := []string{"ip:" + ip, "ua:" + hex.EncodeToString(hash[:])}
+	isNew := false
+	for _, member := range members {
+		if utils.IsInList(known, member) {
+			continue
+		}
+
+		isNew = true
+		err = s.redisDB.SAdd(knownDevicesPrefix+userID, member, knownDevicesTTL)
+		if err != nil {
+			return false, err
+		}
+	}
+
+	return isNew && len(known) > 0, nil
+}
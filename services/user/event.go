@@ -0,0 +1,18 @@
+package user
+
+const (
+	aggregateType = "user"
+
+	EventCreated         = "user.created"
+	EventUpdated         = "user.updated"
+	EventStatusChanged   = "user.status_changed"
+	EventPasswordChanged = "user.password_changed"
+	EventDeleted         = "user.deleted"
+	EventPurged          = "user.purged"
+)
+
+// eventPayload is the user as published to the outbox, never with the
+// password hash.
+func (u *User) eventPayload() InternalView {
+	return u.InternalView()
+}
@@ -1,10 +1,61 @@
 package user
 
+import (
+	"github.com/doug-martin/goqu/v9/exp"
+
+	"stark/database"
+)
+
 type Filter struct {
 	Emails    []string `json:"emails"`
 	Usernames []string `json:"usernames"`
+	Statuses  []string `json:"statuses"`
+
+	Name            *database.TextMatch `json:"name"`
+	Email           *database.TextMatch `json:"email"`
+	Username        *database.TextMatch `json:"username"`
+	CreatedAt       *database.TimeRange `json:"created_at"`
+	UpdatedAt       *database.TimeRange `json:"updated_at"`
+	EmailVerifiedAt *database.TimeRange `json:"email_verified_at"`
+	// Verified matches users with (true) or without (false) a verified email
+	Verified *bool `json:"verified"`
+
+	// And, Or and Not combine nested filters with the criteria above
+	And []Filter `json:"and" binding:"omitempty,dive"`
+	Or  []Filter `json:"or" binding:"omitempty,dive"`
+	Not *Filter  `json:"not"`
+
+	Sort []Sort `json:"sort" binding:"omitempty,max=5,dive"`
+
+	// WithDeleted includes soft-deleted users, e.g. for uniqueness checks.
+	WithDeleted bool `json:"-"`
+}
+
+type Sort struct {
+	Field     string `json:"field" binding:"required,oneof=name email username status created_at updated_at email_verified_at"`
+	Direction string `json:"direction" binding:"omitempty,oneof=asc desc"`
 }
 
+// IsEmpty reports whether the filter has no criteria, sorting alone does not
+// count.
 func (f Filter) IsEmpty() bool {
-	return len(f.Emails) == 0 && len(f.Usernames) == 0
+	return len(f.Emails) == 0 &&
+		len(f.Usernames) == 0 &&
+		len(f.Statuses) == 0 &&
+		f.Name == nil &&
+		f.Email == nil &&
+		f.Username == nil &&
+		f.CreatedAt == nil &&
+		f.UpdatedAt == nil &&
+		f.EmailVerifiedAt == nil &&
+		f.Verified == nil &&
+		len(f.And) == 0 &&
+		len(f.Or) == 0 &&
+		f.Not == nil
+}
+
+// Expression is the WHERE expression of the criteria on the users table, for
+// queries outside this package
+func (f Filter) Expression() exp.ExpressionList {
+	return filterExpression(f)
 }
@@ -1,17 +1,21 @@
 package user
 
 import (
+	"encoding/json"
 	"errors"
 	"net/http"
 	"strconv"
 
 	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
 	"github.com/go-playground/validator/v10"
 	"github.com/google/uuid"
 	"github.com/palantir/stacktrace"
 
+	"stark/database"
 	"stark/failure"
 	"stark/respond"
+	"stark/services/profile_trail"
 	"stark/utils"
 	"stark/utils/activity"
 	"stark/utils/log"
@@ -47,7 +51,7 @@ func (h *Handler) HandleCreate(c *gin.Context) {
 		return
 	}
 
-	user, err := h.service.Create(input.Name, input.Email, input.Username, input.Contact, input.Password)
+	user, err := h.service.Create(input.Name, input.Email, input.Username, input.Contact, input.Password, StatusActive)
 	if err != nil {
 		if f, ok := stacktrace.RootCause(err).(failure.Failure); ok {
 			switch f.Code {
@@ -62,7 +66,7 @@ func (h *Handler) HandleCreate(c *gin.Context) {
 		return
 	}
 
-	respond.Success(c, trx, http.StatusCreated, user)
+	respond.Success(c, trx, http.StatusCreated, user.ClientView())
 }
 
 func (h *Handler) HandleDetail(c *gin.Context) {
@@ -75,6 +79,12 @@ func (h *Handler) HandleDetail(c *gin.Context) {
 		return
 	}
 
+	options, err := ParseViewOptions(c.Query("fields"), c.Query("include"))
+	if err != nil {
+		respond.Error(c, trx, http.StatusBadRequest, respond.ErrBadRequest, err.Error())
+		return
+	}
+
 	user, err := h.service.FindByID(userID)
 	if err != nil {
 		if f, ok := stacktrace.RootCause(err).(failure.Failure); ok {
@@ -90,7 +100,15 @@ func (h *Handler) HandleDetail(c *gin.Context) {
 		return
 	}
 
-	respond.Success(c, trx, http.StatusOK, user)
+	views, err := h.service.Represent([]*User{user}, options)
+	if err != nil {
+		log.WithContext(ctx).Error(stacktrace.Propagate(err, "represent user error"))
+		respond.Error(c, trx, http.StatusInternalServerError, respond.ErrInternal, "unknown error")
+		return
+	}
+
+	c.Header("ETag", utils.FormatETag(user.Version))
+	respond.Success(c, trx, http.StatusOK, views[0])
 }
 
 func (h *Handler) HandleUpdate(c *gin.Context) {
@@ -121,13 +139,17 @@ func (h *Handler) HandleUpdate(c *gin.Context) {
 		return
 	}
 
-	user, err := h.service.Update(userID, input.Name, input.Email, input.Username, input.Contact, input.Password)
+	origin := profile_trail.NewOrigin(ctx, c.ClientIP(), c.Request.UserAgent())
+	user, err := h.service.Update(origin, userID, c.GetInt("version"), input.Name, input.Email, input.Username, input.Contact, input.Password)
 	if err != nil {
 		if f, ok := stacktrace.RootCause(err).(failure.Failure); ok {
 			switch f.Code {
 			case failure.CodeUserNotFound:
 				respond.Error(c, trx, http.StatusBadRequest, f.Code, f.Desc)
 				return
+			case failure.CodeVersionConflict:
+				respond.Error(c, trx, http.StatusPreconditionFailed, f.Code, f.Desc)
+				return
 			}
 		}
 
@@ -136,13 +158,90 @@ func (h *Handler) HandleUpdate(c *gin.Context) {
 		return
 	}
 
-	respond.Success(c, trx, http.StatusCreated, user)
+	c.Header("ETag", utils.FormatETag(user.Version))
+	respond.Success(c, trx, http.StatusCreated, user.ClientView())
+}
+
+// HandlePatch applies a JSON Merge Patch (RFC 7396), only the fields present
+// in the body are validated and written.
+func (h *Handler) HandlePatch(c *gin.Context) {
+	ctx := activity.NewContext("user_patch")
+	ctx = activity.WithClientID(ctx, c.Value("client_id").(string))
+	trx, _ := activity.GetTransactionID(ctx)
+	userID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		respond.Error(c, trx, http.StatusBadRequest, respond.ErrBadRequest, "invalid user id")
+		return
+	}
+
+	var input InputPatch
+
+	if err := c.ShouldBindBodyWith(&input, binding.JSON); err != nil {
+		var validationErrors validator.ValidationErrors
+		if errors.As(err, &validationErrors) {
+			out := make([]utils.ErrorMessage, 0)
+			for _, validationError := range validationErrors {
+				out = append(out, utils.ErrorMessage{
+					Field:   utils.ToSnakeCase(validationError.Field()),
+					Message: utils.GetErrorMessage(validationError),
+				})
+			}
+
+			respond.Invalid(c, trx, http.StatusBadRequest, out)
+			return
+		}
+
+		respond.Error(c, trx, http.StatusBadRequest, respond.ErrBadRequest, "invalid merge patch document")
+		return
+	}
+
+	var fields map[string]json.RawMessage
+	if err := c.ShouldBindBodyWith(&fields, binding.JSON); err != nil {
+		respond.Error(c, trx, http.StatusBadRequest, respond.ErrBadRequest, "invalid merge patch document")
+		return
+	}
+
+	if out := input.ApplyNulls(utils.NullFields(fields)); len(out) != 0 {
+		respond.Invalid(c, trx, http.StatusBadRequest, out)
+		return
+	}
+
+	origin := profile_trail.NewOrigin(ctx, c.ClientIP(), c.Request.UserAgent())
+	item, err := h.service.Patch(origin, userID, c.GetInt("version"), input)
+	if err != nil {
+		if f, ok := stacktrace.RootCause(err).(failure.Failure); ok {
+			switch f.Code {
+			case failure.CodeUserNotFound:
+				respond.Error(c, trx, http.StatusBadRequest, f.Code, f.Desc)
+				return
+			case failure.CodeUserAlreadyExist:
+				respond.Error(c, trx, http.StatusBadRequest, f.Code, f.Desc)
+				return
+			case failure.CodeVersionConflict:
+				respond.Error(c, trx, http.StatusPreconditionFailed, f.Code, f.Desc)
+				return
+			}
+		}
+
+		log.WithContext(ctx).Error(stacktrace.Propagate(err, "patch user error"))
+		respond.Error(c, trx, http.StatusInternalServerError, respond.ErrInternal, "unknown error")
+		return
+	}
+
+	c.Header("ETag", utils.FormatETag(item.Version))
+	respond.Success(c, trx, http.StatusOK, item.ClientView())
 }
 
 func (h *Handler) HandleAllByFilter(c *gin.Context) {
 	ctx := activity.NewContext("user_all_by_filter")
 	ctx = activity.WithClientID(ctx, c.Value("client_id").(string))
 	trx, _ := activity.GetTransactionID(ctx)
+	options, err := ParseViewOptions(c.Query("fields"), c.Query("include"))
+	if err != nil {
+		respond.Error(c, trx, http.StatusBadRequest, respond.ErrBadRequest, err.Error())
+		return
+	}
+
 	var input Filter
 
 	if err := c.ShouldBindJSON(&input); err != nil {
@@ -167,7 +266,76 @@ func (h *Handler) HandleAllByFilter(c *gin.Context) {
 		return
 	}
 
-	respond.Success(c, trx, http.StatusCreated, tenant)
+	views, err := h.service.Represent(tenant, options)
+	if err != nil {
+		log.WithContext(ctx).Error(stacktrace.Propagate(err, "represent users error"))
+		respond.Error(c, trx, http.StatusInternalServerError, respond.ErrInternal, "unknown error")
+		return
+	}
+
+	respond.Success(c, trx, http.StatusCreated, views)
+}
+
+// HandleBatch reads many users in one request, found users are keyed by ID
+// and the IDs without a user are listed as missing.
+func (h *Handler) HandleBatch(c *gin.Context) {
+	ctx := activity.NewContext("user_batch")
+	ctx = activity.WithClientID(ctx, c.Value("client_id").(string))
+	trx, _ := activity.GetTransactionID(ctx)
+	options, err := ParseViewOptions(c.Query("fields"), c.Query("include"))
+	if err != nil {
+		respond.Error(c, trx, http.StatusBadRequest, respond.ErrBadRequest, err.Error())
+		return
+	}
+
+	var input InputBatch
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		var validationErrors validator.ValidationErrors
+		if errors.As(err, &validationErrors) {
+			out := make([]utils.ErrorMessage, 0)
+			for _, validationError := range validationErrors {
+				out = append(out, utils.ErrorMessage{
+					Field:   utils.ToSnakeCase(validationError.Field()),
+					Message: utils.GetErrorMessage(validationError),
+				})
+			}
+
+			respond.Invalid(c, trx, http.StatusBadRequest, out)
+		}
+		return
+	}
+
+	// IDs are compared in their canonical lower case form
+	ids := make([]string, 0, len(input.Ids))
+	for _, id := range input.Ids {
+		ids = append(ids, uuid.MustParse(id).String())
+	}
+
+	items, missing, err := h.service.FindByIDs(ids)
+	if err != nil {
+		log.WithContext(ctx).Error(stacktrace.Propagate(err, "get user batch error"))
+		respond.Error(c, trx, http.StatusInternalServerError, respond.ErrInternal, "unknown error")
+		return
+	}
+
+	views, err := h.service.Represent(items, options)
+	if err != nil {
+		log.WithContext(ctx).Error(stacktrace.Propagate(err, "represent users error"))
+		respond.Error(c, trx, http.StatusInternalServerError, respond.ErrInternal, "unknown error")
+		return
+	}
+
+	batch := Batch{
+		Items:   make(map[string]ClientView, len(views)),
+		Missing: missing,
+	}
+
+	for _, view := range views {
+		batch.Items[view.ID.String()] = view
+	}
+
+	respond.Success(c, trx, http.StatusOK, batch)
 }
 
 func (h *Handler) HandlePage(c *gin.Context) {
@@ -178,7 +346,12 @@ func (h *Handler) HandlePage(c *gin.Context) {
 	limitString := c.Query("limit")
 	page := 1
 	limit := 25
-	var err error
+	options, err := ParseViewOptions(c.Query("fields"), c.Query("include"))
+	if err != nil {
+		respond.Error(c, trx, http.StatusBadRequest, respond.ErrBadRequest, err.Error())
+		return
+	}
+
 	if pageString != "" {
 		page, err = strconv.Atoi(pageString)
 		if err != nil {
@@ -195,11 +368,62 @@ func (h *Handler) HandlePage(c *gin.Context) {
 		}
 	}
 
+	// A cursor query, empty for the first page, switches to keyset pagination
+	if cursor, ok := c.GetQuery("cursor"); ok {
+		total := c.DefaultQuery("total", database.TotalNone)
+		if !utils.IsInList([]string{database.TotalNone, database.TotalExact, database.TotalApproximate}, total) {
+			respond.Error(c, trx, http.StatusBadRequest, respond.ErrBadRequest, "invalid total, should be one of none exact approximate")
+			return
+		}
+
+		if limit <= 0 {
+			respond.Error(c, trx, http.StatusBadRequest, respond.ErrBadRequest, "invalid limit")
+			return
+		}
+
+		cursorPage, err := h.service.FindCursorPage(cursor, limit, total)
+		if err != nil {
+			if f, ok := stacktrace.RootCause(err).(failure.Failure); ok {
+				switch f.Code {
+				case failure.CodeInvalidCursor:
+					respond.Error(c, trx, http.StatusBadRequest, f.Code, f.Desc)
+					return
+				}
+			}
+
+			log.WithContext(ctx).Error(stacktrace.Propagate(err, "get user cursor page error"))
+			respond.Error(c, trx, http.StatusInternalServerError, respond.ErrInternal, "unknown error")
+			return
+		}
+
+		views, err := h.service.Represent(cursorPage.Items, options)
+		if err != nil {
+			log.WithContext(ctx).Error(stacktrace.Propagate(err, "represent users error"))
+			respond.Error(c, trx, http.StatusInternalServerError, respond.ErrInternal, "unknown error")
+			return
+		}
+
+		respond.Success(c, trx, http.StatusOK, ClientCursorPage{
+			Items:      views,
+			NextCursor: cursorPage.NextCursor,
+			PrevCursor: cursorPage.PrevCursor,
+			Total:      cursorPage.Total,
+		})
+		return
+	}
+
 	tenantPage, err := h.service.FindPage(page, limit)
 	if err != nil {
 		respond.Error(c, trx, http.StatusBadRequest, respond.ErrInternal, err.Error())
 		return
 	}
 
-	respond.Success(c, trx, http.StatusOK, tenantPage)
+	views, err := h.service.Represent(tenantPage.Items, options)
+	if err != nil {
+		log.WithContext(ctx).Error(stacktrace.Propagate(err, "represent users error"))
+		respond.Error(c, trx, http.StatusInternalServerError, respond.ErrInternal, "unknown error")
+		return
+	}
+
+	respond.Success(c, trx, http.StatusOK, ClientPage{Items: views, Total: tenantPage.Total})
 }
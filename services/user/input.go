@@ -1,5 +1,7 @@
 package user
 
+import "stark/utils"
+
 type Input struct {
 	Name     string `json:"name" binding:"required"`
 	Email    string `json:"email" binding:"required,email"`
@@ -7,3 +9,30 @@ type Input struct {
 	Contact  string `json:"contact" binding:"required"`
 	Password string `json:"password" binding:"required"`
 }
+
+// InputBatch lists up to 100 users to read at once
+type InputBatch struct {
+	Ids []string `json:"ids" binding:"required,min=1,max=100,dive,uuid"`
+}
+
+// InputPatch is a JSON Merge Patch, nil fields are left untouched
+type InputPatch struct {
+	Name     *string `json:"name" binding:"omitempty,min=1"`
+	Email    *string `json:"email" binding:"omitempty,email"`
+	Username *string `json:"username" binding:"omitempty,min=1"`
+	Contact  *string `json:"contact" binding:"omitempty,min=1"`
+	Password *string `json:"password" binding:"omitempty,min=1"`
+}
+
+// ApplyNulls rejects removal of fields, every user field is mandatory
+func (p *InputPatch) ApplyNulls(nulls []string) []utils.ErrorMessage {
+	out := make([]utils.ErrorMessage, 0)
+	for _, field := range nulls {
+		out = append(out, utils.ErrorMessage{
+			Field:   field,
+			Message: "this field cannot be null",
+		})
+	}
+
+	return out
+}
@@ -8,37 +8,67 @@ import (
 	"stark/utils"
 )
 
+const (
+	StatusPendingVerification = "pending_verification"
+	StatusActive              = "active"
+	StatusSuspended           = "suspended"
+	StatusBanned              = "banned"
+	StatusDeleted             = "deleted"
+)
+
 type User struct {
-	ID              uuid.UUID `json:"id" db:"id"`
-	Name            string    `json:"name" db:"name"`
-	Email           string    `json:"email" db:"email"`
-	Username        string    `json:"username" db:"username"`
-	Contact         string    `json:"contact" db:"contact"`
-	Password        string    `json:"password" db:"password"`
-	EmailVerifiedAt time.Time `json:"email_verified_at" db:"email_verified_at"`
-	CreatedAt       time.Time `json:"created_at" db:"created_at"`
-	UpdatedAt       time.Time `json:"updated_at" db:"updated_at"`
-}
-
-func New(name, email, username, contact, password string) *User {
-	id := uuid.New()
+	ID                 uuid.UUID  `json:"id" db:"id"`
+	Name               string     `json:"name" db:"name"`
+	Email              string     `json:"email" db:"email"`
+	Username           string     `json:"username" db:"username"`
+	Contact            string     `json:"contact" db:"contact"`
+	Password           string     `json:"password" db:"password"`
+	MustChangePassword bool       `json:"must_change_password" db:"must_change_password"`
+	Status             string     `json:"status" db:"status"`
+	StatusReason       string     `json:"status_reason" db:"status_reason"`
+	StatusUntil        *time.Time `json:"status_until" db:"status_until"`
+	EmailVerifiedAt    *time.Time `json:"email_verified_at" db:"email_verified_at"`
+	IdentityVerifiedAt *time.Time `json:"identity_verified_at" db:"identity_verified_at"`
+	DeletedAt          *time.Time `json:"deleted_at" db:"deleted_at"`
+	CreatedAt          time.Time  `json:"created_at" db:"created_at"`
+	UpdatedAt          time.Time  `json:"updated_at" db:"updated_at"`
+	Version            int        `json:"version" db:"version"`
+}
+
+func New(name, email, username, contact, password, status string) *User {
 	hashPassword, err := utils.HashPassword(password)
 	if err != nil {
 		hashPassword = "-"
 	}
 
+	return NewWithPasswordHash(name, email, username, contact, hashPassword, status)
+}
+
+// NewWithPasswordHash takes a bcrypt hash as is, e.g. one imported from
+// another system.
+func NewWithPasswordHash(name, email, username, contact, passwordHash, status string) *User {
+	id := uuid.New()
+
 	return &User{
 		ID:        id,
 		Name:      name,
 		Email:     email,
 		Username:  username,
 		Contact:   contact,
-		Password:  hashPassword,
+		Password:  passwordHash,
+		Status:    status,
 		CreatedAt: time.Now(),
 		UpdatedAt: time.Now(),
+		Version:   1,
 	}
 }
 
+// MatchVersion reports whether the user is still at the version the caller
+// read, 0 matches any version.
+func (u *User) MatchVersion(version int) bool {
+	return version == 0 || u.Version == version
+}
+
 func (u *User) Update(name, email, username, contact, password string) {
 	hashPassword, err := utils.HashPassword(password)
 	if err != nil {
@@ -53,6 +83,46 @@ func (u *User) Update(name, email, username, contact, password string) {
 	u.UpdatedAt = time.Now()
 }
 
+// Patch applies the provided fields and returns the columns to write
+func (u *User) Patch(input InputPatch) []string {
+	columns := make([]string, 0)
+	if input.Name != nil {
+		u.Name = *input.Name
+		columns = append(columns, "name")
+	}
+
+	if input.Email != nil {
+		u.Email = *input.Email
+		columns = append(columns, "email")
+	}
+
+	if input.Username != nil {
+		u.Username = *input.Username
+		columns = append(columns, "username")
+	}
+
+	if input.Contact != nil {
+		u.Contact = *input.Contact
+		columns = append(columns, "contact")
+	}
+
+	if input.Password != nil {
+		hashPassword, err := utils.HashPassword(*input.Password)
+		if err != nil {
+			hashPassword = "-"
+		}
+
+		u.Password = hashPassword
+		columns = append(columns, "password")
+	}
+
+	if len(columns) != 0 {
+		u.UpdatedAt = time.Now()
+	}
+
+	return columns
+}
+
 func (u *User) UpdateProfile(name, username, contact string) {
 	u.Name = name
 	u.Username = username
@@ -60,7 +130,91 @@ func (u *User) UpdateProfile(name, username, contact string) {
 	u.UpdatedAt = time.Now()
 }
 
+func (u *User) ChangePassword(password string) {
+	hashPassword, err := utils.HashPassword(password)
+	if err != nil {
+		hashPassword = "-"
+	}
+
+	u.Password = hashPassword
+	u.MustChangePassword = false
+	u.UpdatedAt = time.Now()
+}
+
+func (u *User) SetPasswordHash(passwordHash string) {
+	u.Password = passwordHash
+	u.MustChangePassword = false
+	u.UpdatedAt = time.Now()
+}
+
+// ForcePasswordChange replaces the password with temporaryPassword when it is
+// given, otherwise the current password stays valid until the user changes it.
+func (u *User) ForcePasswordChange(temporaryPassword string) {
+	if temporaryPassword != "" {
+		u.ChangePassword(temporaryPassword)
+	}
+
+	u.MustChangePassword = true
+	u.UpdatedAt = time.Now()
+}
+
+func (u *User) ChangeStatus(status, reason string, until *time.Time) {
+	u.Status = status
+	u.StatusReason = reason
+	u.StatusUntil = until
+	u.UpdatedAt = time.Now()
+}
+
+func (u *User) Verify() {
+	now := time.Now()
+	u.EmailVerifiedAt = &now
+	if u.Status == StatusPendingVerification {
+		u.Status = StatusActive
+	}
+
+	u.UpdatedAt = now
+}
+
+// VerifyIdentity marks the identity of the user as verified, it is set once
+// an identity verification request is approved.
+func (u *User) VerifyIdentity() {
+	now := time.Now()
+	u.IdentityVerifiedAt = &now
+	u.UpdatedAt = now
+}
+
+// CurrentStatus treats a suspension whose until timestamp has passed as active.
+func (u *User) CurrentStatus(now time.Time) string {
+	if u.Status == StatusSuspended && u.StatusUntil != nil && now.After(*u.StatusUntil) {
+		return StatusActive
+	}
+
+	return u.Status
+}
+
+func (u *User) Delete() {
+	now := time.Now()
+	u.Status = StatusDeleted
+	u.DeletedAt = &now
+	u.UpdatedAt = now
+}
+
+// Batch holds the users of a batch read keyed by ID and the IDs without a
+// user
+type Batch struct {
+	Items   map[string]ClientView `json:"items"`
+	Missing []string              `json:"missing"`
+}
+
 type Page struct {
 	Items []*User `json:"items"`
 	Total int     `json:"total"`
 }
+
+// CursorPage is a keyset page, Total is only set when it was asked for
+type CursorPage struct {
+	Items      []*User `json:"items"`
+	NextCursor string  `json:"next_cursor"`
+	PrevCursor string  `json:"prev_cursor"`
+	Total      *int    `json:"total,omitempty"`
+}
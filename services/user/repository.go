@@ -1,12 +1,34 @@
 package user
 
-import "github.com/google/uuid"
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+
+	"stark/database"
+)
 
 type Repository interface {
+	// WithTx returns the repository writing and reading in tx, the owner of
+	// tx commits or rolls back
+	WithTx(tx *sqlx.Tx) Repository
 	Store(data *User) error
+	Patch(data *User, columns []string) error
 	StoreProfile(data *User) error
+	StoreStatus(data *User) error
+	StorePassword(data *User) error
+	SoftDelete(data *User) error
+	Delete(id uuid.UUID) error
 	FindByID(id uuid.UUID) (*User, error)
+	// FindByIDForUpdate locks the row until the transaction ends, it is only
+	// meaningful on a repository joined to one
+	FindByIDForUpdate(id uuid.UUID) (*User, error)
+	FindByIDs(ids []string) ([]*User, error)
 	FindByFilter(filter Filter) ([]*User, error)
 	FindPage(offset, limit int) ([]*User, error)
+	FindCursorPage(cursor *database.Cursor, limit int) ([]*User, error)
 	FindTotalByFilter(filter Filter) (int, error)
+	FindApproximateTotal() (int, error)
+	FindDeletedBefore(deletedAt time.Time) ([]*User, error)
 }
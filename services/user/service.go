@@ -2,29 +2,105 @@ package user
 
 import (
 	"database/sql"
+	"time"
 
 	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
 	"github.com/palantir/stacktrace"
 
+	"stark/database"
 	"stark/failure"
+	"stark/services/profile_trail"
+	"stark/services/user_detail"
+	"stark/services/user_location"
+	"stark/services/webhook"
+	"stark/utils"
+	"stark/utils/activity"
+	"stark/utils/log"
 )
 
+var errVersionConflict = failure.WithMessage(
+	failure.CodeVersionConflict,
+	"user was changed by another request, fetch it again and retry with the new ETag",
+)
+
+// Notifier emails the user about changes to their account. The email only
+// changes through Update and Patch, which the user handlers and the import
+// call, auth and profile never touch it, so the change is announced here.
+// notification imports this package, so its Service comes in as a Notifier.
+type Notifier interface {
+	NotifyEmailChanged(item *User, oldEmail string)
+}
+
 type Service struct {
-	repo Repository
+	repo                Repository
+	webhookService      *webhook.Service
+	userDetailService   *user_detail.Service
+	userLocationService *user_location.Service
+	trailRecorder       profile_trail.Recorder
+	notifier            Notifier
+}
+
+func NewService(
+	repo Repository,
+	webhookService *webhook.Service,
+	userDetailService *user_detail.Service,
+	userLocationService *user_location.Service,
+	profileTrailService *profile_trail.Service,
+	notifier Notifier,
+) *Service {
+	return &Service{
+		repo:                repo,
+		webhookService:      webhookService,
+		userDetailService:   userDetailService,
+		userLocationService: userLocationService,
+		trailRecorder:       profileTrailService,
+		notifier:            notifier,
+	}
+}
+
+// WithTx returns the service with its repository joined to tx, for writes
+// that commit together with those of other services
+func (s *Service) WithTx(tx *sqlx.Tx) *Service {
+	service := *s
+	service.repo = s.repo.WithTx(tx)
+	service.webhookService = s.webhookService.WithTx(tx)
+	return &service
+}
+
+// WithTrail returns the service recording its profile trails to recorder, a
+// unit of work passes a batch it stores once it commits
+func (s *Service) WithTrail(recorder profile_trail.Recorder) *Service {
+	service := *s
+	service.trailRecorder = recorder
+	return &service
+}
+
+// WithNotifier returns the service emailing through notifier, a unit of work
+// passes a batch it sends once it commits
+func (s *Service) WithNotifier(notifier Notifier) *Service {
+	service := *s
+	service.notifier = notifier
+	return &service
+}
+
+func (s *Service) Create(name, email, username, contact, password, status string) (*User, error) {
+	return s.create(New(name, email, username, contact, password, status))
 }
 
-func NewService(repo Repository) *Service {
-	return &Service{repo: repo}
+// CreateWithPasswordHash creates a user whose password is already a bcrypt
+// hash, e.g. one imported from another system.
+func (s *Service) CreateWithPasswordHash(name, email, username, contact, passwordHash, status string) (*User, error) {
+	return s.create(NewWithPasswordHash(name, email, username, contact, passwordHash, status))
 }
 
-func (s *Service) Create(name, email, username, contact, password string) (*User, error) {
-	item := New(name, email, username, contact, password)
-	totalByEmail, err := s.repo.FindTotalByFilter(Filter{Emails: []string{email}})
+func (s *Service) create(item *User) (*User, error) {
+	totalByEmail, err := s.repo.FindTotalByFilter(Filter{Emails: []string{item.Email}, WithDeleted: true})
 	if err != nil {
 		return nil, err
 	}
 
-	totalByUsername, err := s.repo.FindTotalByFilter(Filter{Usernames: []string{username}})
+	totalByUsername, err := s.repo.FindTotalByFilter(Filter{Usernames: []string{item.Username}, WithDeleted: true})
 	if err != nil {
 		return nil, err
 	}
@@ -41,10 +117,12 @@ func (s *Service) Create(name, email, username, contact, password string) (*User
 		return nil, err
 	}
 
+	s.dispatch(webhook.EventUserCreated, item)
 	return s.FindByID(item.ID)
 }
 
-func (s *Service) Update(id uuid.UUID, name, email, username, contact, password string) (*User, error) {
+// Update replaces the user when it is still at version, 0 skips the check
+func (s *Service) Update(origin profile_trail.Origin, id uuid.UUID, version int, name, email, username, contact, password string) (*User, error) {
 	item, err := s.repo.FindByID(id)
 	if err != nil {
 		if stacktrace.RootCause(err) == sql.ErrNoRows {
@@ -57,16 +135,74 @@ func (s *Service) Update(id uuid.UUID, name, email, username, contact, password
 		return nil, err
 	}
 
+	if !item.MatchVersion(version) {
+		return nil, errVersionConflict
+	}
+
+	before := *item
 	item.Update(name, email, username, contact, password)
 	err = s.repo.Store(item)
+	if err != nil {
+		return nil, conflict(err)
+	}
+
+	s.trail(origin, &before, item)
+	s.dispatch(webhook.EventUserUpdated, item)
+	s.notifyEmailChanged(&before, item)
+	return s.repo.FindByID(id)
+}
+
+func (s *Service) Patch(origin profile_trail.Origin, id uuid.UUID, version int, input InputPatch) (*User, error) {
+	item, err := s.FindByID(id)
 	if err != nil {
 		return nil, err
 	}
 
+	if !item.MatchVersion(version) {
+		return nil, errVersionConflict
+	}
+
+	filters := make([]Filter, 0)
+	if input.Email != nil && *input.Email != item.Email {
+		filters = append(filters, Filter{Emails: []string{*input.Email}, WithDeleted: true})
+	}
+
+	if input.Username != nil && *input.Username != item.Username {
+		filters = append(filters, Filter{Usernames: []string{*input.Username}, WithDeleted: true})
+	}
+
+	for _, filter := range filters {
+		total, err := s.repo.FindTotalByFilter(filter)
+		if err != nil {
+			return nil, err
+		}
+
+		if total > 0 {
+			return nil, failure.WithMessage(
+				failure.CodeUserAlreadyExist,
+				"username or email exists, duplicate username or email is not allowed",
+			)
+		}
+	}
+
+	before := *item
+	columns := item.Patch(input)
+	if len(columns) == 0 {
+		return item, nil
+	}
+
+	err = s.repo.Patch(item, columns)
+	if err != nil {
+		return nil, conflict(err)
+	}
+
+	s.trail(origin, &before, item)
+	s.dispatch(webhook.EventUserUpdated, item)
+	s.notifyEmailChanged(&before, item)
 	return s.repo.FindByID(id)
 }
 
-func (s *Service) UpdateProfile(id uuid.UUID, name, username, contact string) (*User, error) {
+func (s *Service) UpdateProfile(origin profile_trail.Origin, id uuid.UUID, name, username, contact string) (*User, error) {
 	item, err := s.repo.FindByID(id)
 	if err != nil {
 		if stacktrace.RootCause(err) == sql.ErrNoRows {
@@ -79,15 +215,187 @@ func (s *Service) UpdateProfile(id uuid.UUID, name, username, contact string) (*
 		return nil, err
 	}
 
+	before := *item
 	item.UpdateProfile(name, username, contact)
 	err = s.repo.StoreProfile(item)
+	if err != nil {
+		return nil, conflict(err)
+	}
+
+	s.trail(origin, &before, item)
+
+	return s.repo.FindByID(id)
+}
+
+func (s *Service) ChangePassword(origin profile_trail.Origin, id uuid.UUID, password string) (*User, error) {
+	item, err := s.FindByID(id)
+	if err != nil {
+		return nil, err
+	}
+
+	before := *item
+	item.ChangePassword(password)
+	err = s.repo.StorePassword(item)
+	if err != nil {
+		return nil, conflict(err)
+	}
+
+	s.trail(origin, &before, item)
+
+	return s.repo.FindByID(id)
+}
+
+// SetPasswordHash replaces the password with a bcrypt hash as is
+func (s *Service) SetPasswordHash(origin profile_trail.Origin, id uuid.UUID, passwordHash string) (*User, error) {
+	item, err := s.FindByID(id)
+	if err != nil {
+		return nil, err
+	}
+
+	before := *item
+	item.SetPasswordHash(passwordHash)
+	err = s.repo.StorePassword(item)
+	if err != nil {
+		return nil, conflict(err)
+	}
+
+	s.trail(origin, &before, item)
+
+	return s.repo.FindByID(id)
+}
+
+// ForcePasswordReset flags the user to change password on next login and,
+// when requested, returns a newly issued temporary password.
+func (s *Service) ForcePasswordReset(origin profile_trail.Origin, id uuid.UUID, temporary bool) (string, error) {
+	item, err := s.FindByID(id)
+	if err != nil {
+		return "", err
+	}
+
+	temporaryPassword := ""
+	if temporary {
+		temporaryPassword = utils.GenerateSecureToken(8)
+	}
+
+	before := *item
+	item.ForcePasswordChange(temporaryPassword)
+	err = s.repo.StorePassword(item)
+	if err != nil {
+		return "", conflict(err)
+	}
+
+	s.trail(origin, &before, item)
+
+	return temporaryPassword, nil
+}
+
+func (s *Service) ChangeStatus(id uuid.UUID, version int, status, reason string, until *time.Time) (*User, error) {
+	item, err := s.FindByID(id)
+	if err != nil {
+		return nil, err
+	}
+
+	if !item.MatchVersion(version) {
+		return nil, errVersionConflict
+	}
+
+	item.ChangeStatus(status, reason, until)
+	err = s.repo.StoreStatus(item)
+	if err != nil {
+		return nil, conflict(err)
+	}
+
+	s.dispatch(webhook.EventUserUpdated, item)
+	return s.repo.FindByID(id)
+}
+
+func (s *Service) Verify(id uuid.UUID) (*User, error) {
+	item, err := s.FindByID(id)
+	if err != nil {
+		return nil, err
+	}
+
+	item.Verify()
+	err = s.repo.StoreStatus(item)
+	if err != nil {
+		return nil, err
+	}
+
+	s.dispatch(webhook.EventUserVerified, item)
+	return s.repo.FindByID(id)
+}
+
+// VerifyIdentity marks the identity of the user as verified. It runs in the
+// transaction of the approval, so the webhook is left to the caller to
+// dispatch once it commits.
+func (s *Service) VerifyIdentity(origin profile_trail.Origin, id uuid.UUID) (*User, error) {
+	item, err := s.FindByID(id)
 	if err != nil {
 		return nil, err
 	}
 
+	before := *item
+	item.VerifyIdentity()
+	err = s.repo.StoreStatus(item)
+	if err != nil {
+		return nil, conflict(err)
+	}
+
+	s.trail(origin, &before, item)
 	return s.repo.FindByID(id)
 }
 
+func (s *Service) CheckStatus(item *User) error {
+	switch item.CurrentStatus(time.Now()) {
+	case StatusActive:
+		return nil
+	case StatusPendingVerification:
+		return failure.WithMessage(
+			failure.CodeAccountPendingVerification,
+			"account is pending verification, verify your email first",
+		)
+	case StatusSuspended:
+		return failure.WithMessage(
+			failure.CodeAccountSuspended,
+			"account is suspended, "+item.StatusReason,
+		)
+	case StatusBanned:
+		return failure.WithMessage(
+			failure.CodeAccountBanned,
+			"account is banned, "+item.StatusReason,
+		)
+	}
+
+	return failure.WithMessage(
+		failure.CodeAccountDeleted,
+		"account is deleted",
+	)
+}
+
+func (s *Service) Delete(id uuid.UUID) (*User, error) {
+	item, err := s.FindByID(id)
+	if err != nil {
+		return nil, err
+	}
+
+	item.Delete()
+	err = s.repo.SoftDelete(item)
+	if err != nil {
+		return nil, err
+	}
+
+	s.dispatch(webhook.EventUserDeleted, item)
+	return item, nil
+}
+
+func (s *Service) Purge(id uuid.UUID) error {
+	return s.repo.Delete(id)
+}
+
+func (s *Service) FindDeletedBefore(deletedAt time.Time) ([]*User, error) {
+	return s.repo.FindDeletedBefore(deletedAt)
+}
+
 func (s *Service) FindByID(id uuid.UUID) (*User, error) {
 	item, err := s.repo.FindByID(id)
 	if err != nil {
@@ -104,6 +412,46 @@ func (s *Service) FindByID(id uuid.UUID) (*User, error) {
 	return item, nil
 }
 
+// FindByIDForUpdate reads the user and locks its row until the transaction
+// of the service ends, other transactions locking it wait until then
+func (s *Service) FindByIDForUpdate(id uuid.UUID) (*User, error) {
+	item, err := s.repo.FindByIDForUpdate(id)
+	if err != nil {
+		if stacktrace.RootCause(err) == sql.ErrNoRows {
+			return nil, failure.WithMessage(
+				failure.CodeUserNotFound,
+				"user not found, id isn't in database",
+			)
+		}
+
+		return nil, err
+	}
+
+	return item, nil
+}
+
+// FindByIDs reads many users at once and returns the ids that matched none
+func (s *Service) FindByIDs(ids []string) ([]*User, []string, error) {
+	items, err := s.repo.FindByIDs(ids)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	found := make(map[string]bool, len(items))
+	for _, item := range items {
+		found[item.ID.String()] = true
+	}
+
+	missing := make([]string, 0)
+	for _, id := range ids {
+		if !found[id] && !utils.IsInList(missing, id) {
+			missing = append(missing, id)
+		}
+	}
+
+	return items, missing, nil
+}
+
 func (s *Service) FindAllByFilter(filter Filter) ([]*User, error) {
 	return s.repo.FindByFilter(filter)
 }
@@ -125,3 +473,117 @@ func (s *Service) FindPage(page, limit int) (Page, error) {
 		Total: total,
 	}, nil
 }
+
+// FindCursorPage reads a keyset page, total is one of the database total
+// modes and the table is only counted when asked to.
+func (s *Service) FindCursorPage(cursor string, limit int, total string) (CursorPage, error) {
+	page, err := database.ReadCursorPage(
+		cursor,
+		limit,
+		total,
+		s.repo.FindCursorPage,
+		func(item *User) (time.Time, string) {
+			return item.CreatedAt, item.ID.String()
+		},
+		func() (int, error) {
+			return s.repo.FindTotalByFilter(Filter{})
+		},
+		s.repo.FindApproximateTotal,
+	)
+
+	if err != nil {
+		return CursorPage{}, err
+	}
+
+	return CursorPage(page), nil
+}
+
+// Represent turns users into client views shaped by the options, included
+// relations are read with one query per relation whatever the number of users.
+func (s *Service) Represent(items []*User, options ViewOptions) ([]ClientView, error) {
+	views := ClientViews(items)
+	if options.IsEmpty() || len(items) == 0 {
+		return views, nil
+	}
+
+	ids := make([]string, 0, len(items))
+	for _, item := range items {
+		ids = append(ids, item.ID.String())
+	}
+
+	details := make(map[uuid.UUID]*user_detail.ClientView)
+	if options.Includes(IncludeDetail) {
+		items, err := s.userDetailService.FindAllByFilter(user_detail.Filter{IDs: ids})
+		if err != nil {
+			return nil, err
+		}
+
+		for _, item := range items {
+			view := item.ClientView()
+			details[item.ID] = &view
+		}
+	}
+
+	locations := make(map[uuid.UUID]*user_location.ClientView)
+	if options.Includes(IncludeLocation) {
+		items, err := s.userLocationService.FindAllByFilter(user_location.Filter{IDs: ids})
+		if err != nil {
+			return nil, err
+		}
+
+		for _, item := range items {
+			view := item.ClientView()
+			locations[item.ID] = &view
+		}
+	}
+
+	for i := range views {
+		views[i].fields = options.Fields
+		views[i].include = options.Include
+		views[i].detail = details[views[i].ID]
+		views[i].location = locations[views[i].ID]
+	}
+
+	return views, nil
+}
+
+// dispatch queues a webhook event for the user without the password hash.
+// The change is already stored, so a failure is logged instead of returned.
+func (s *Service) dispatch(event string, item *User) {
+	payload := item.ClientView()
+	err := s.webhookService.Dispatch(event, &payload)
+	if err != nil {
+		ctx := activity.NewContext("user_webhook_dispatch")
+		ctx = activity.WithUserID(ctx, item.ID.String())
+		log.WithContext(ctx).Error(stacktrace.Propagate(err, "dispatch %s webhook error", event))
+	}
+}
+
+// trail records the change in the profile trail with the password hash
+// redacted, a failure is logged like one of dispatch.
+func (s *Service) trail(origin profile_trail.Origin, before, after *User) {
+	err := s.trailRecorder.Record(origin, after.ID.String(), profile_trail.SectionProfile, before, after, "password")
+	if err != nil {
+		ctx := activity.NewContext("user_profile_trail")
+		ctx = activity.WithUserID(ctx, after.ID.String())
+		log.WithContext(ctx).Error(stacktrace.Propagate(err, "record profile trail error"))
+	}
+}
+
+// notifyEmailChanged warns the previous address when the change moved the
+// user to another email
+func (s *Service) notifyEmailChanged(before, after *User) {
+	if before.Email != after.Email {
+		s.notifier.NotifyEmailChanged(after, before.Email)
+	}
+}
+
+// conflict turns a write that lost the race on the row version into the same
+// failure as a stale If-Match.
+func conflict(err error) error {
+	if stacktrace.RootCause(err) == database.ErrVersionConflict {
+		return errVersionConflict
+	}
+
+	return err
+}
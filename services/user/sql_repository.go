@@ -2,14 +2,17 @@ package user
 
 import (
 	"errors"
+	"time"
 
 	"github.com/doug-martin/goqu/v9"
 	_ "github.com/doug-martin/goqu/v9/dialect/mysql"
+	"github.com/doug-martin/goqu/v9/exp"
 	"github.com/google/uuid"
 	"github.com/jmoiron/sqlx"
 	"github.com/palantir/stacktrace"
 
 	"stark/database"
+	"stark/services/outbox"
 )
 
 type sqlRepository struct {
@@ -17,10 +20,11 @@ type sqlRepository struct {
 }
 
 const (
-	selectCountUserQuery = "SELECT COUNT(*) FROM users"
-	insertUserQuery      = `
-		INSERT INTO users (id, name, email, username, contact, password, created_at, updated_at) 
-		VALUES (?, ?, ?, ?, ?, ?, ? ,?)
+	selectCountUserQuery  = "SELECT COUNT(*) FROM users"
+	selectUsersByIDsQuery = "SELECT * FROM users WHERE id IN (:ids) AND deleted_at IS NULL"
+	insertUserQuery       = `
+		INSERT INTO users (id, name, email, username, contact, password, status, created_at, updated_at) 
+		VALUES (?, ?, ?, ?, ?, ?, ?, ? ,?)
 	`
 	updateUserQuery = `
 		UPDATE users SET
@@ -29,23 +33,57 @@ const (
 			username = ?,
 			contact = ?,
 			password = ?,
-			updated_at = ?
-		WHERE id = ?
+			updated_at = ?,
+			version = version + 1
+		WHERE id = ? AND version = ?
 	`
 	updateProfileQuery = `
 		UPDATE users SET
 			name = ?,
 			username = ?,
 			contact = ?,
-			updated_at = ?
-		WHERE id = ?
+			updated_at = ?,
+			version = version + 1
+		WHERE id = ? AND version = ?
 	`
+	updateStatusQuery = `
+		UPDATE users SET
+			status = ?,
+			status_reason = ?,
+			status_until = ?,
+			email_verified_at = ?,
+			identity_verified_at = ?,
+			updated_at = ?,
+			version = version + 1
+		WHERE id = ? AND version = ?
+	`
+	updatePasswordQuery = `
+		UPDATE users SET
+			password = ?,
+			must_change_password = ?,
+			updated_at = ?,
+			version = version + 1
+		WHERE id = ? AND version = ?
+	`
+	softDeleteUserQuery = `
+		UPDATE users SET
+			status = ?,
+			deleted_at = ?,
+			updated_at = ?,
+			version = version + 1
+		WHERE id = ? AND version = ?
+	`
+	deleteUserQuery = "DELETE FROM users WHERE id = ?"
 )
 
 func NewSQLRepository(mysqlDB *database.MySQL) Repository {
 	return &sqlRepository{mysqlDB}
 }
 
+func (repo *sqlRepository) WithTx(tx *sqlx.Tx) Repository {
+	return &sqlRepository{mysqlDB: repo.mysqlDB.Join(tx)}
+}
+
 func (repo *sqlRepository) Store(data *User) error {
 	exist, err := repo.existByID(data.ID)
 	if err != nil {
@@ -72,12 +110,192 @@ func (repo *sqlRepository) StoreProfile(data *User) error {
 	}
 }
 
+func (repo *sqlRepository) StoreStatus(data *User) error {
+	_, err := repo.mysqlDB.WithTransaction(func(tx *sqlx.Tx) (interface{}, error) {
+		res, err := tx.Exec(updateStatusQuery,
+			data.Status,
+			data.StatusReason,
+			data.StatusUntil,
+			data.EmailVerifiedAt,
+			data.IdentityVerifiedAt,
+			data.UpdatedAt,
+			data.ID,
+			data.Version,
+		)
+
+		if err != nil {
+			return nil, err
+		}
+
+		rowsAffected, err := res.RowsAffected()
+		if err != nil {
+			return nil, err
+		}
+
+		if rowsAffected <= 0 {
+			return nil, stacktrace.Propagate(database.ErrVersionConflict, "update user status fails")
+		}
+
+		data.Version++
+
+		err = outbox.Write(tx, aggregateType, data.ID.String(), EventStatusChanged, data.eventPayload())
+		if err != nil {
+			return nil, err
+		}
+
+		return nil, nil
+	})
+
+	return err
+}
+
+func (repo *sqlRepository) StorePassword(data *User) error {
+	_, err := repo.mysqlDB.WithTransaction(func(tx *sqlx.Tx) (interface{}, error) {
+		res, err := tx.Exec(updatePasswordQuery,
+			data.Password,
+			data.MustChangePassword,
+			data.UpdatedAt,
+			data.ID,
+			data.Version,
+		)
+
+		if err != nil {
+			return nil, err
+		}
+
+		rowsAffected, err := res.RowsAffected()
+		if err != nil {
+			return nil, err
+		}
+
+		if rowsAffected <= 0 {
+			return nil, stacktrace.Propagate(database.ErrVersionConflict, "update user password fails")
+		}
+
+		data.Version++
+
+		err = outbox.Write(tx, aggregateType, data.ID.String(), EventPasswordChanged, data.eventPayload())
+		if err != nil {
+			return nil, err
+		}
+
+		return nil, nil
+	})
+
+	return err
+}
+
+func (repo *sqlRepository) SoftDelete(data *User) error {
+	_, err := repo.mysqlDB.WithTransaction(func(tx *sqlx.Tx) (interface{}, error) {
+		res, err := tx.Exec(softDeleteUserQuery,
+			data.Status,
+			data.DeletedAt,
+			data.UpdatedAt,
+			data.ID,
+			data.Version,
+		)
+
+		if err != nil {
+			return nil, err
+		}
+
+		rowsAffected, err := res.RowsAffected()
+		if err != nil {
+			return nil, err
+		}
+
+		if rowsAffected <= 0 {
+			return nil, stacktrace.Propagate(database.ErrVersionConflict, "soft delete user fails")
+		}
+
+		data.Version++
+
+		err = outbox.Write(tx, aggregateType, data.ID.String(), EventDeleted, data.eventPayload())
+		if err != nil {
+			return nil, err
+		}
+
+		return nil, nil
+	})
+
+	return err
+}
+
+func (repo *sqlRepository) Delete(id uuid.UUID) error {
+	_, err := repo.mysqlDB.WithTransaction(func(tx *sqlx.Tx) (interface{}, error) {
+		_, err := tx.Exec(deleteUserQuery, id)
+		if err != nil {
+			return nil, err
+		}
+
+		return nil, outbox.Write(tx, aggregateType, id.String(), EventPurged, map[string]string{"id": id.String()})
+	})
+
+	return err
+}
+
+// Patch writes only the given columns, updated_at and the bumped version
+func (repo *sqlRepository) Patch(data *User, columns []string) error {
+	values := map[string]interface{}{
+		"name":     data.Name,
+		"email":    data.Email,
+		"username": data.Username,
+		"contact":  data.Contact,
+		"password": data.Password,
+	}
+
+	record := goqu.Record{
+		"updated_at": data.UpdatedAt,
+		"version":    goqu.L("version + 1"),
+	}
+
+	for _, column := range columns {
+		record[column] = values[column]
+	}
+
+	dialect := goqu.Dialect("mysql")
+	dataset := dialect.Update("users").Prepared(true).Set(record)
+	dataset = dataset.Where(goqu.Ex{
+		"id":         data.ID.String(),
+		"version":    data.Version,
+		"deleted_at": nil,
+	})
+
+	sql, args, err := dataset.ToSQL()
+	if err != nil {
+		return stacktrace.Propagate(err, "sql error")
+	}
+
+	_, err = repo.mysqlDB.WithTransaction(func(tx *sqlx.Tx) (interface{}, error) {
+		res, err := tx.Exec(sql, args...)
+		if err != nil {
+			return nil, err
+		}
+
+		rowsAffected, err := res.RowsAffected()
+		if err != nil {
+			return nil, err
+		}
+
+		if rowsAffected <= 0 {
+			return nil, stacktrace.Propagate(database.ErrVersionConflict, "patch user fails")
+		}
+
+		data.Version++
+
+		return nil, outbox.Write(tx, aggregateType, data.ID.String(), EventUpdated, data.eventPayload())
+	})
+
+	return err
+}
+
 func (repo *sqlRepository) FindByID(id uuid.UUID) (result *User, err error) {
 	var data User
 	dialect := goqu.Dialect("mysql")
 	dataset := dialect.From("users")
 	dataset = dataset.Where(goqu.Ex{
-		"id": id.String(),
+		"id":         id.String(),
+		"deleted_at": nil,
 	})
 
 	sql, _, err := dataset.ToSQL()
@@ -93,6 +311,48 @@ func (repo *sqlRepository) FindByID(id uuid.UUID) (result *User, err error) {
 	return &data, nil
 }
 
+func (repo *sqlRepository) FindByIDForUpdate(id uuid.UUID) (result *User, err error) {
+	var data User
+	dialect := goqu.Dialect("mysql")
+	dataset := dialect.From("users")
+	dataset = dataset.Where(goqu.Ex{
+		"id":         id.String(),
+		"deleted_at": nil,
+	})
+
+	dataset = dataset.ForUpdate(exp.Wait)
+	sql, _, err := dataset.ToSQL()
+	if err != nil {
+		return nil, stacktrace.Propagate(err, "sql error")
+	}
+
+	err = repo.mysqlDB.Get(&data, sql)
+	if err != nil {
+		return nil, stacktrace.Propagate(err, "can't lock user by id")
+	}
+
+	return &data, nil
+}
+
+// FindByIDs reads the users with the given ids in a single query, ids
+// without a user are left out
+func (repo *sqlRepository) FindByIDs(ids []string) (result []*User, err error) {
+	query, args, err := repo.mysqlDB.In(selectUsersByIDsQuery, map[string]interface{}{
+		"ids": ids,
+	})
+
+	if err != nil {
+		return nil, stacktrace.Propagate(err, "sql error")
+	}
+
+	err = repo.mysqlDB.Select(&result, repo.mysqlDB.Rebind(query), args...)
+	if err != nil {
+		return nil, stacktrace.Propagate(err, "select rows fails")
+	}
+
+	return result, nil
+}
+
 func (repo *sqlRepository) FindByFilter(filter Filter) (result []*User, err error) {
 	if filter.IsEmpty() {
 		return
@@ -100,16 +360,15 @@ func (repo *sqlRepository) FindByFilter(filter Filter) (result []*User, err erro
 
 	dialect := goqu.Dialect("mysql")
 	dataset := dialect.From("users")
-	if len(filter.Emails) != 0 {
+	if !filter.WithDeleted {
 		dataset = dataset.Where(goqu.Ex{
-			"email": filter.Emails,
+			"deleted_at": nil,
 		})
 	}
 
-	if len(filter.Usernames) != 0 {
-		dataset = dataset.Where(goqu.Ex{
-			"username": filter.Usernames,
-		})
+	dataset = dataset.Where(filterExpression(filter))
+	for _, sort := range filter.Sort {
+		dataset = dataset.OrderAppend(database.Order(sort.Field, sort.Direction))
 	}
 
 	sql, _, err := dataset.ToSQL()
@@ -128,6 +387,11 @@ func (repo *sqlRepository) FindByFilter(filter Filter) (result []*User, err erro
 func (repo *sqlRepository) FindPage(offset int, limit int) (result []*User, err error) {
 	dialect := goqu.Dialect("mysql")
 	dataset := dialect.From("users")
+	dataset = dataset.Where(goqu.Ex{
+		"deleted_at": nil,
+	})
+	dataset = dataset.Order(goqu.C("created_at").Asc(), goqu.C("id").Asc())
+
 	sql, _, err := dataset.ToSQL()
 	if err != nil {
 		return nil, stacktrace.Propagate(err, "sql error")
@@ -141,21 +405,40 @@ func (repo *sqlRepository) FindPage(offset int, limit int) (result []*User, err
 	return
 }
 
+// FindCursorPage reads up to limit rows from the cursor, a backward cursor
+// returns them newest first
+func (repo *sqlRepository) FindCursorPage(cursor *database.Cursor, limit int) (result []*User, err error) {
+	dialect := goqu.Dialect("mysql")
+	dataset := dialect.From("users")
+	dataset = dataset.Where(goqu.Ex{
+		"deleted_at": nil,
+	})
+	dataset = cursor.Paginate(dataset, limit)
+
+	sql, _, err := dataset.ToSQL()
+	if err != nil {
+		return nil, stacktrace.Propagate(err, "sql error")
+	}
+
+	err = repo.mysqlDB.Select(&result, sql)
+	if err != nil {
+		return nil, stacktrace.Propagate(err, "select rows fails")
+	}
+
+	return result, nil
+}
+
 func (repo *sqlRepository) FindTotalByFilter(filter Filter) (total int, err error) {
 	dialect := goqu.Dialect("mysql")
 	dataset := dialect.From("users")
 	dataset = dataset.Select(goqu.COUNT("*"))
-	if len(filter.Emails) != 0 {
-		dataset = dataset.Where(goqu.ExOr{
-			"email": filter.Emails,
+	if !filter.WithDeleted {
+		dataset = dataset.Where(goqu.Ex{
+			"deleted_at": nil,
 		})
 	}
 
-	if len(filter.Usernames) != 0 {
-		dataset = dataset.Where(goqu.ExOr{
-			"username": filter.Usernames,
-		})
-	}
+	dataset = dataset.Where(filterExpression(filter))
 
 	sql, _, err := dataset.ToSQL()
 	if err != nil {
@@ -170,6 +453,79 @@ func (repo *sqlRepository) FindTotalByFilter(filter Filter) (total int, err erro
 	return total, nil
 }
 
+func (repo *sqlRepository) FindApproximateTotal() (int, error) {
+	return repo.mysqlDB.ApproximateCount("users")
+}
+
+func (repo *sqlRepository) FindDeletedBefore(deletedAt time.Time) (result []*User, err error) {
+	dialect := goqu.Dialect("mysql")
+	dataset := dialect.From("users")
+	dataset = dataset.Where(goqu.C("deleted_at").Lte(deletedAt))
+	sql, _, err := dataset.ToSQL()
+	if err != nil {
+		return nil, stacktrace.Propagate(err, "sql error")
+	}
+
+	err = repo.mysqlDB.Select(&result, sql)
+	if err != nil {
+		return nil, stacktrace.Propagate(err, "select rows fails")
+	}
+
+	return result, nil
+}
+
+// filterExpression translates the filter criteria into a WHERE expression,
+// nested and/or/not filters become grouped sub expressions.
+func filterExpression(filter Filter) exp.ExpressionList {
+	expressions := []exp.Expression{
+		filter.Name.Expression("name"),
+		filter.Email.Expression("email"),
+		filter.Username.Expression("username"),
+		filter.CreatedAt.Expression("created_at"),
+		filter.UpdatedAt.Expression("updated_at"),
+		filter.EmailVerifiedAt.Expression("email_verified_at"),
+	}
+
+	if len(filter.Emails) != 0 {
+		expressions = append(expressions, goqu.Ex{"email": filter.Emails})
+	}
+
+	if len(filter.Usernames) != 0 {
+		expressions = append(expressions, goqu.Ex{"username": filter.Usernames})
+	}
+
+	if len(filter.Statuses) != 0 {
+		expressions = append(expressions, goqu.Ex{"status": filter.Statuses})
+	}
+
+	if filter.Verified != nil {
+		if *filter.Verified {
+			expressions = append(expressions, goqu.C("email_verified_at").IsNotNull())
+		} else {
+			expressions = append(expressions, goqu.C("email_verified_at").IsNull())
+		}
+	}
+
+	for _, item := range filter.And {
+		expressions = append(expressions, filterExpression(item))
+	}
+
+	if len(filter.Or) != 0 {
+		ors := make([]exp.Expression, 0)
+		for _, item := range filter.Or {
+			ors = append(ors, filterExpression(item))
+		}
+
+		expressions = append(expressions, database.Combine(exp.OrType, ors...))
+	}
+
+	if filter.Not != nil {
+		expressions = append(expressions, database.Not(filterExpression(*filter.Not)))
+	}
+
+	return database.Combine(exp.AndType, expressions...)
+}
+
 func (repo *sqlRepository) existByID(id uuid.UUID) (bool, error) {
 	var total int
 	err := repo.mysqlDB.Get(&total, selectCountUserQuery+" WHERE id = ?", id)
@@ -189,6 +545,7 @@ func (repo *sqlRepository) insert(data *User) error {
 			data.Username,
 			data.Contact,
 			data.Password,
+			data.Status,
 			data.CreatedAt,
 			data.UpdatedAt,
 		)
@@ -206,6 +563,11 @@ func (repo *sqlRepository) insert(data *User) error {
 			return nil, errors.New("insert user fails")
 		}
 
+		err = outbox.Write(tx, aggregateType, data.ID.String(), EventCreated, data.eventPayload())
+		if err != nil {
+			return nil, err
+		}
+
 		return nil, nil
 	})
 
@@ -222,6 +584,7 @@ func (repo *sqlRepository) update(data *User) error {
 			data.Password,
 			data.UpdatedAt,
 			data.ID,
+			data.Version,
 		)
 
 		if err != nil {
@@ -234,7 +597,14 @@ func (repo *sqlRepository) update(data *User) error {
 		}
 
 		if rowsAffected <= 0 {
-			return nil, errors.New("update user fails")
+			return nil, stacktrace.Propagate(database.ErrVersionConflict, "update user fails")
+		}
+
+		data.Version++
+
+		err = outbox.Write(tx, aggregateType, data.ID.String(), EventUpdated, data.eventPayload())
+		if err != nil {
+			return nil, err
 		}
 
 		return nil, nil
@@ -251,6 +621,7 @@ func (repo *sqlRepository) updateProfile(data *User) error {
 			data.Contact,
 			data.UpdatedAt,
 			data.ID,
+			data.Version,
 		)
 
 		if err != nil {
@@ -263,7 +634,14 @@ func (repo *sqlRepository) updateProfile(data *User) error {
 		}
 
 		if rowsAffected <= 0 {
-			return nil, errors.New("update profile fails")
+			return nil, stacktrace.Propagate(database.ErrVersionConflict, "update profile fails")
+		}
+
+		data.Version++
+
+		err = outbox.Write(tx, aggregateType, data.ID.String(), EventUpdated, data.eventPayload())
+		if err != nil {
+			return nil, err
 		}
 
 		return nil, nil
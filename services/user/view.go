@@ -0,0 +1,261 @@
+package user
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"stark/services/user_detail"
+	"stark/services/user_location"
+	"stark/utils"
+)
+
+// The views are what each audience gets to see of a user, responses and
+// payloads go through them instead of User so the password hash stays in the
+// database.
+
+const (
+	IncludeDetail   = "detail"
+	IncludeLocation = "location"
+)
+
+// clientFields are the attributes a client can pick with fields=
+var clientFields = func() []string {
+	fields := make([]string, 0)
+	viewType := reflect.TypeOf(ClientView{})
+	for i := 0; i < viewType.NumField(); i++ {
+		if tag := viewType.Field(i).Tag.Get("json"); tag != "" {
+			fields = append(fields, tag)
+		}
+	}
+
+	return fields
+}()
+
+// InternalView is a user as seen by internal services and operators
+type InternalView struct {
+	ID                 uuid.UUID  `json:"id"`
+	Name               string     `json:"name"`
+	Email              string     `json:"email"`
+	Username           string     `json:"username"`
+	Contact            string     `json:"contact"`
+	MustChangePassword bool       `json:"must_change_password"`
+	Status             string     `json:"status"`
+	StatusReason       string     `json:"status_reason"`
+	StatusUntil        *time.Time `json:"status_until"`
+	EmailVerifiedAt    *time.Time `json:"email_verified_at"`
+	IdentityVerifiedAt *time.Time `json:"identity_verified_at"`
+	DeletedAt          *time.Time `json:"deleted_at"`
+	CreatedAt          time.Time  `json:"created_at"`
+	UpdatedAt          time.Time  `json:"updated_at"`
+	Version            int        `json:"version"`
+}
+
+// ClientView is a user as seen by client apps, the moderation notes of a
+// status stay internal
+type ClientView struct {
+	ID                 uuid.UUID  `json:"id"`
+	Name               string     `json:"name"`
+	Email              string     `json:"email"`
+	Username           string     `json:"username"`
+	Contact            string     `json:"contact"`
+	MustChangePassword bool       `json:"must_change_password"`
+	Status             string     `json:"status"`
+	StatusUntil        *time.Time `json:"status_until"`
+	EmailVerifiedAt    *time.Time `json:"email_verified_at"`
+	IdentityVerifiedAt *time.Time `json:"identity_verified_at"`
+	CreatedAt          time.Time  `json:"created_at"`
+	UpdatedAt          time.Time  `json:"updated_at"`
+	Version            int        `json:"version"`
+
+	// Set by Service.Represent, see MarshalJSON
+	fields   []string
+	include  []string
+	detail   *user_detail.ClientView
+	location *user_location.ClientView
+}
+
+// ViewOptions shape a client response, Fields keeps only the listed
+// attributes besides the id and Include embeds related records.
+type ViewOptions struct {
+	Fields  []string
+	Include []string
+}
+
+// ParseViewOptions reads the comma separated fields and include query values
+func ParseViewOptions(fields, include string) (ViewOptions, error) {
+	options := ViewOptions{
+		Fields:  splitList(fields),
+		Include: splitList(include),
+	}
+
+	for _, field := range options.Fields {
+		if !utils.IsInList(clientFields, field) {
+			return options, errors.New("invalid fields, " + field + " isn't a user field")
+		}
+	}
+
+	for _, relation := range options.Include {
+		if relation != IncludeDetail && relation != IncludeLocation {
+			return options, errors.New("invalid include, use detail or location")
+		}
+	}
+
+	return options, nil
+}
+
+func (o ViewOptions) IsEmpty() bool {
+	return len(o.Fields) == 0 && len(o.Include) == 0
+}
+
+func (o ViewOptions) Includes(relation string) bool {
+	return utils.IsInList(o.Include, relation)
+}
+
+// MarshalJSON drops the attributes left out by fields= and adds the included
+// relations, null when the user has none.
+func (v ClientView) MarshalJSON() ([]byte, error) {
+	type clientView ClientView
+	data, err := json.Marshal(clientView(v))
+	if err != nil || (len(v.fields) == 0 && len(v.include) == 0) {
+		return data, err
+	}
+
+	var out map[string]json.RawMessage
+	err = json.Unmarshal(data, &out)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(v.fields) != 0 {
+		for key := range out {
+			if key != "id" && !utils.IsInList(v.fields, key) {
+				delete(out, key)
+			}
+		}
+	}
+
+	if utils.IsInList(v.include, IncludeDetail) {
+		out[IncludeDetail], err = json.Marshal(v.detail)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if utils.IsInList(v.include, IncludeLocation) {
+		out[IncludeLocation], err = json.Marshal(v.location)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return json.Marshal(out)
+}
+
+// SelfView is a user as seen by themselves
+type SelfView struct {
+	ID                 uuid.UUID  `json:"id"`
+	Name               string     `json:"name"`
+	Email              string     `json:"email"`
+	Username           string     `json:"username"`
+	Contact            string     `json:"contact"`
+	MustChangePassword bool       `json:"must_change_password"`
+	Status             string     `json:"status"`
+	StatusUntil        *time.Time `json:"status_until"`
+	EmailVerifiedAt    *time.Time `json:"email_verified_at"`
+	IdentityVerifiedAt *time.Time `json:"identity_verified_at"`
+	CreatedAt          time.Time  `json:"created_at"`
+	UpdatedAt          time.Time  `json:"updated_at"`
+}
+
+type ClientPage struct {
+	Items []ClientView `json:"items"`
+	Total int          `json:"total"`
+}
+
+type ClientCursorPage struct {
+	Items      []ClientView `json:"items"`
+	NextCursor string       `json:"next_cursor"`
+	PrevCursor string       `json:"prev_cursor"`
+	Total      *int         `json:"total,omitempty"`
+}
+
+func (u *User) InternalView() InternalView {
+	return InternalView{
+		ID:                 u.ID,
+		Name:               u.Name,
+		Email:              u.Email,
+		Username:           u.Username,
+		Contact:            u.Contact,
+		MustChangePassword: u.MustChangePassword,
+		Status:             u.Status,
+		StatusReason:       u.StatusReason,
+		StatusUntil:        u.StatusUntil,
+		EmailVerifiedAt:    u.EmailVerifiedAt,
+		IdentityVerifiedAt: u.IdentityVerifiedAt,
+		DeletedAt:          u.DeletedAt,
+		CreatedAt:          u.CreatedAt,
+		UpdatedAt:          u.UpdatedAt,
+		Version:            u.Version,
+	}
+}
+
+func (u *User) ClientView() ClientView {
+	return ClientView{
+		ID:                 u.ID,
+		Name:               u.Name,
+		Email:              u.Email,
+		Username:           u.Username,
+		Contact:            u.Contact,
+		MustChangePassword: u.MustChangePassword,
+		Status:             u.Status,
+		StatusUntil:        u.StatusUntil,
+		EmailVerifiedAt:    u.EmailVerifiedAt,
+		IdentityVerifiedAt: u.IdentityVerifiedAt,
+		CreatedAt:          u.CreatedAt,
+		UpdatedAt:          u.UpdatedAt,
+		Version:            u.Version,
+	}
+}
+
+func (u *User) SelfView() SelfView {
+	return SelfView{
+		ID:                 u.ID,
+		Name:               u.Name,
+		Email:              u.Email,
+		Username:           u.Username,
+		Contact:            u.Contact,
+		MustChangePassword: u.MustChangePassword,
+		Status:             u.Status,
+		StatusUntil:        u.StatusUntil,
+		EmailVerifiedAt:    u.EmailVerifiedAt,
+		IdentityVerifiedAt: u.IdentityVerifiedAt,
+		CreatedAt:          u.CreatedAt,
+		UpdatedAt:          u.UpdatedAt,
+	}
+}
+
+func ClientViews(items []*User) []ClientView {
+	views := make([]ClientView, 0, len(items))
+	for _, item := range items {
+		views = append(views, item.ClientView())
+	}
+
+	return views
+}
+
+func splitList(value string) []string {
+	items := make([]string, 0)
+	for _, item := range strings.Split(value, ",") {
+		item = strings.TrimSpace(item)
+		if item != "" && !utils.IsInList(items, item) {
+			items = append(items, item)
+		}
+	}
+
+	return items
+}
@@ -0,0 +1,192 @@
+package user
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"stark/services/user_detail"
+	"stark/services/user_location"
+	"stark/services/webhook"
+)
+
+// secretFields must never reach a response or payload built from a user, the
+// included detail and location among them
+var secretFields = []string{
+	`"password"`,
+	`"bearer_key"`,
+	`"signing_secret"`,
+	`"device_token"`,
+	`"oauth_id"`,
+	`"avatar_path"`,
+	`"id_card_path"`,
+}
+
+type detailRepository struct {
+	user_detail.Repository
+	items []*user_detail.UserDetail
+}
+
+func (r detailRepository) FindByFilter(filter user_detail.Filter) ([]*user_detail.UserDetail, error) {
+	return r.items, nil
+}
+
+type locationRepository struct {
+	user_location.Repository
+	items []*user_location.UserLocation
+}
+
+func (r locationRepository) FindByFilter(filter user_location.Filter) ([]*user_location.UserLocation, error) {
+	return r.items, nil
+}
+
+type webhookRepository struct {
+	webhook.Repository
+	deliveries []*webhook.Delivery
+}
+
+func (r *webhookRepository) FindByEvent(event string) ([]*webhook.Webhook, error) {
+	return []*webhook.Webhook{webhook.New("client", "https://example.com/hook", []string{event})}, nil
+}
+
+func (r *webhookRepository) StoreDelivery(item *webhook.Delivery) error {
+	r.deliveries = append(r.deliveries, item)
+	return nil
+}
+
+func newTestUser() *User {
+	now := time.Now()
+	item := NewWithPasswordHash("Tony", "tony@stark.com", "tony", "0800", "$2a$14$secret-hash", StatusActive)
+	item.EmailVerifiedAt = &now
+	return item
+}
+
+func newTestService(item *User) *Service {
+	detail := user_detail.New(item.ID, "device-token", "ios", "web", "google-oauth-id")
+	detail.AvatarPath = "avatars/" + item.ID.String() + "/avatar.png"
+	// Not a clean key, reads leave it unsigned so no storage is needed
+	detail.IDCardPath = "id-cards/" + item.ID.String() + "/../id-card.png"
+	detailService := user_detail.NewService(detailRepository{
+		items: []*user_detail.UserDetail{detail},
+	}, nil, nil)
+
+	locationService := user_location.NewService(locationRepository{
+		items: []*user_location.UserLocation{user_location.New(item.ID, "31", "3171", "317101", "3171011001")},
+	}, nil)
+
+	return NewService(nil, nil, detailService, locationService, nil, nil)
+}
+
+func assertNoSecrets(t *testing.T, data []byte) {
+	t.Helper()
+	for _, field := range secretFields {
+		if strings.Contains(string(data), field) {
+			t.Errorf("%s leaked in %s", field, data)
+		}
+	}
+}
+
+func TestViewsHideSecrets(t *testing.T) {
+	item := newTestUser()
+	service := newTestService(item)
+	total := 1
+
+	represent := func(fields, include string) interface{} {
+		options, err := ParseViewOptions(fields, include)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		views, err := service.Represent([]*User{item}, options)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return views
+	}
+
+	tests := []struct {
+		name string
+		view interface{}
+	}{
+		{"InternalView", item.InternalView()},
+		{"ClientView", item.ClientView()},
+		{"ClientView with fields", represent("name,email,status", "")},
+		{"ClientView with include", represent("", "detail,location")},
+		{"ClientView with fields and include", represent("name", "detail,location")},
+		{"SelfView", item.SelfView()},
+		{"ClientPage", ClientPage{Items: ClientViews([]*User{item}), Total: 1}},
+		{"ClientCursorPage", ClientCursorPage{Items: ClientViews([]*User{item}), Total: &total}},
+		{"Batch", Batch{Items: map[string]ClientView{item.ID.String(): item.ClientView()}, Missing: []string{uuid.NewString()}}},
+		{"event payload", item.eventPayload()},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			data, err := json.Marshal(test.view)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			assertNoSecrets(t, data)
+		})
+	}
+}
+
+func TestViewsKeepSelectedFields(t *testing.T) {
+	item := newTestUser()
+	options, err := ParseViewOptions("name", "detail")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	views, err := newTestService(item).Represent([]*User{item}, options)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := json.Marshal(views[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var out map[string]json.RawMessage
+	err = json.Unmarshal(data, &out)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, key := range []string{"id", "name", "detail"} {
+		if _, ok := out[key]; !ok {
+			t.Errorf("%s is missing from %s", key, data)
+		}
+	}
+
+	if len(out) != 3 {
+		t.Errorf("expected only id, name and detail in %s", data)
+	}
+}
+
+func TestParseViewOptionsRejectsSecrets(t *testing.T) {
+	for _, field := range []string{"password", "bearer_key", "signing_secret"} {
+		_, err := ParseViewOptions(field, "")
+		if err == nil {
+			t.Errorf("fields=%s was accepted", field)
+		}
+	}
+}
+
+func TestDispatchPayloadHidesSecrets(t *testing.T) {
+	repo := &webhookRepository{}
+	service := &Service{webhookService: webhook.NewService(repo, nil, nil)}
+	service.dispatch(webhook.EventUserUpdated, newTestUser())
+
+	if len(repo.deliveries) != 1 {
+		t.Fatalf("expected one delivery, got %d", len(repo.deliveries))
+	}
+
+	assertNoSecrets(t, repo.deliveries[0].Payload)
+}
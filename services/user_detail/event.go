@@ -0,0 +1,9 @@
+package user_detail
+
+const (
+	aggregateType = "user_detail"
+
+	EventCreated = "user_detail.created"
+	EventUpdated = "user_detail.updated"
+	EventDeleted = "user_detail.deleted"
+)
@@ -1,12 +1,44 @@
 package user_detail
 
+import "stark/database"
+
 type Filter struct {
 	IDs          []string `json:"ids"`
 	OAuthIDs     []string `json:"oauth_ids"`
 	DeviceTokens []string `json:"device_tokens"`
+	DeviceOSes   []string `json:"device_oses"`
 	Sources      []string `json:"sources"`
+
+	CreatedAt *database.TimeRange `json:"created_at"`
+	UpdatedAt *database.TimeRange `json:"updated_at"`
+
+	// And, Or and Not combine nested filters with the criteria above
+	And []Filter `json:"and" binding:"omitempty,dive"`
+	Or  []Filter `json:"or" binding:"omitempty,dive"`
+	Not *Filter  `json:"not"`
+
+	Sort []Sort `json:"sort" binding:"omitempty,max=5,dive"`
+
+	// WithDeleted includes soft-deleted records, e.g. for uniqueness checks.
+	WithDeleted bool `json:"-"`
+}
+
+type Sort struct {
+	Field     string `json:"field" binding:"required,oneof=device_os source created_at updated_at"`
+	Direction string `json:"direction" binding:"omitempty,oneof=asc desc"`
 }
 
+// IsEmpty reports whether the filter has no criteria, sorting alone does not
+// count.
 func (f Filter) IsEmpty() bool {
-	return len(f.IDs) == 0 && len(f.OAuthIDs) == 0 && len(f.DeviceTokens) == 0 && len(f.Sources) == 0
+	return len(f.IDs) == 0 &&
+		len(f.OAuthIDs) == 0 &&
+		len(f.DeviceTokens) == 0 &&
+		len(f.DeviceOSes) == 0 &&
+		len(f.Sources) == 0 &&
+		f.CreatedAt == nil &&
+		f.UpdatedAt == nil &&
+		len(f.And) == 0 &&
+		len(f.Or) == 0 &&
+		f.Not == nil
 }
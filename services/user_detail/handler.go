@@ -1,22 +1,36 @@
 package user_detail
 
 import (
+	"context"
+	"encoding/json"
 	"errors"
+	"io"
 	"net/http"
 	"strconv"
 
 	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
 	"github.com/go-playground/validator/v10"
 	"github.com/google/uuid"
 	"github.com/palantir/stacktrace"
 
+	"stark/database"
 	"stark/failure"
 	"stark/respond"
+	"stark/services/profile_trail"
 	"stark/utils"
 	"stark/utils/activity"
 	"stark/utils/log"
 )
 
+// Room for the multipart boundaries and headers around the uploaded file
+const multipartOverhead = 64 << 10
+
+var errUploadTooLarge = failure.WithMessage(
+	failure.CodeUploadTooLarge,
+	"file is too large, upload a smaller image",
+)
+
 type Handler struct {
 	service *Service
 }
@@ -53,16 +67,14 @@ func (h *Handler) HandleCreate(c *gin.Context) {
 		return
 	}
 
+	origin := profile_trail.NewOrigin(ctx, c.ClientIP(), c.Request.UserAgent())
 	user, err := h.service.Create(
+		origin,
 		userID,
 		input.DeviceToken,
 		input.DeviceOS,
-		input.AvatarUrl,
-		input.AvatarPath,
 		input.Source,
 		input.OAuthId,
-		input.IDCardUrl,
-		input.IDCardPath,
 	)
 
 	if err != nil {
@@ -79,7 +91,7 @@ func (h *Handler) HandleCreate(c *gin.Context) {
 		return
 	}
 
-	respond.Success(c, trx, http.StatusCreated, user)
+	respond.Success(c, trx, http.StatusCreated, user.ClientView())
 }
 
 func (h *Handler) HandleDetail(c *gin.Context) {
@@ -107,7 +119,8 @@ func (h *Handler) HandleDetail(c *gin.Context) {
 		return
 	}
 
-	respond.Success(c, trx, http.StatusOK, user)
+	c.Header("ETag", utils.FormatETag(user.Version))
+	respond.Success(c, trx, http.StatusOK, user.ClientView())
 }
 
 func (h *Handler) HandleUpdate(c *gin.Context) {
@@ -138,16 +151,15 @@ func (h *Handler) HandleUpdate(c *gin.Context) {
 		return
 	}
 
+	origin := profile_trail.NewOrigin(ctx, c.ClientIP(), c.Request.UserAgent())
 	user, err := h.service.Update(
+		origin,
 		userDetailID,
+		c.GetInt("version"),
 		input.DeviceToken,
 		input.DeviceOS,
-		input.AvatarUrl,
-		input.AvatarPath,
 		input.Source,
 		input.OAuthId,
-		input.IDCardUrl,
-		input.IDCardPath,
 	)
 
 	if err != nil {
@@ -156,6 +168,9 @@ func (h *Handler) HandleUpdate(c *gin.Context) {
 			case failure.CodeUserNotFound:
 				respond.Error(c, trx, http.StatusBadRequest, f.Code, f.Desc)
 				return
+			case failure.CodeVersionConflict:
+				respond.Error(c, trx, http.StatusPreconditionFailed, f.Code, f.Desc)
+				return
 			}
 		}
 
@@ -164,7 +179,75 @@ func (h *Handler) HandleUpdate(c *gin.Context) {
 		return
 	}
 
-	respond.Success(c, trx, http.StatusCreated, user)
+	c.Header("ETag", utils.FormatETag(user.Version))
+	respond.Success(c, trx, http.StatusCreated, user.ClientView())
+}
+
+// HandlePatch applies a JSON Merge Patch (RFC 7396), only the fields present
+// in the body are validated and written.
+func (h *Handler) HandlePatch(c *gin.Context) {
+	ctx := activity.NewContext("user_detail_patch")
+	ctx = activity.WithClientID(ctx, c.Value("client_id").(string))
+	trx, _ := activity.GetTransactionID(ctx)
+	userDetailID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		respond.Error(c, trx, http.StatusBadRequest, respond.ErrBadRequest, "invalid user detail id")
+		return
+	}
+
+	var input InputPatch
+
+	if err := c.ShouldBindBodyWith(&input, binding.JSON); err != nil {
+		var validationErrors validator.ValidationErrors
+		if errors.As(err, &validationErrors) {
+			out := make([]utils.ErrorMessage, 0)
+			for _, validationError := range validationErrors {
+				out = append(out, utils.ErrorMessage{
+					Field:   utils.ToSnakeCase(validationError.Field()),
+					Message: utils.GetErrorMessage(validationError),
+				})
+			}
+
+			respond.Invalid(c, trx, http.StatusBadRequest, out)
+			return
+		}
+
+		respond.Error(c, trx, http.StatusBadRequest, respond.ErrBadRequest, "invalid merge patch document")
+		return
+	}
+
+	var fields map[string]json.RawMessage
+	if err := c.ShouldBindBodyWith(&fields, binding.JSON); err != nil {
+		respond.Error(c, trx, http.StatusBadRequest, respond.ErrBadRequest, "invalid merge patch document")
+		return
+	}
+
+	if out := input.ApplyNulls(utils.NullFields(fields)); len(out) != 0 {
+		respond.Invalid(c, trx, http.StatusBadRequest, out)
+		return
+	}
+
+	origin := profile_trail.NewOrigin(ctx, c.ClientIP(), c.Request.UserAgent())
+	item, err := h.service.Patch(origin, userDetailID, c.GetInt("version"), input)
+	if err != nil {
+		if f, ok := stacktrace.RootCause(err).(failure.Failure); ok {
+			switch f.Code {
+			case failure.CodeUserNotFound:
+				respond.Error(c, trx, http.StatusBadRequest, f.Code, f.Desc)
+				return
+			case failure.CodeVersionConflict:
+				respond.Error(c, trx, http.StatusPreconditionFailed, f.Code, f.Desc)
+				return
+			}
+		}
+
+		log.WithContext(ctx).Error(stacktrace.Propagate(err, "patch user detail error"))
+		respond.Error(c, trx, http.StatusInternalServerError, respond.ErrInternal, "unknown error")
+		return
+	}
+
+	c.Header("ETag", utils.FormatETag(item.Version))
+	respond.Success(c, trx, http.StatusOK, item.ClientView())
 }
 
 func (h *Handler) HandleAllByFilter(c *gin.Context) {
@@ -195,7 +278,7 @@ func (h *Handler) HandleAllByFilter(c *gin.Context) {
 		return
 	}
 
-	respond.Success(c, trx, http.StatusCreated, tenant)
+	respond.Success(c, trx, http.StatusCreated, ClientViews(tenant))
 }
 
 func (h *Handler) HandlePage(c *gin.Context) {
@@ -223,11 +306,145 @@ func (h *Handler) HandlePage(c *gin.Context) {
 		}
 	}
 
+	// A cursor query, empty for the first page, switches to keyset pagination
+	if cursor, ok := c.GetQuery("cursor"); ok {
+		total := c.DefaultQuery("total", database.TotalNone)
+		if !utils.IsInList([]string{database.TotalNone, database.TotalExact, database.TotalApproximate}, total) {
+			respond.Error(c, trx, http.StatusBadRequest, respond.ErrBadRequest, "invalid total, should be one of none exact approximate")
+			return
+		}
+
+		if limit <= 0 {
+			respond.Error(c, trx, http.StatusBadRequest, respond.ErrBadRequest, "invalid limit")
+			return
+		}
+
+		cursorPage, err := h.service.FindCursorPage(cursor, limit, total)
+		if err != nil {
+			if f, ok := stacktrace.RootCause(err).(failure.Failure); ok {
+				switch f.Code {
+				case failure.CodeInvalidCursor:
+					respond.Error(c, trx, http.StatusBadRequest, f.Code, f.Desc)
+					return
+				}
+			}
+
+			log.WithContext(ctx).Error(stacktrace.Propagate(err, "get user detail cursor page error"))
+			respond.Error(c, trx, http.StatusInternalServerError, respond.ErrInternal, "unknown error")
+			return
+		}
+
+		respond.Success(c, trx, http.StatusOK, cursorPage.ClientView())
+		return
+	}
+
 	tenantPage, err := h.service.FindPage(page, limit)
 	if err != nil {
 		respond.Error(c, trx, http.StatusBadRequest, respond.ErrInternal, err.Error())
 		return
 	}
 
-	respond.Success(c, trx, http.StatusOK, tenantPage)
+	respond.Success(c, trx, http.StatusOK, tenantPage.ClientView())
+}
+
+// HandleUploadAvatar takes the avatar as the file field of a multipart form
+func (h *Handler) HandleUploadAvatar(c *gin.Context) {
+	h.handleUpload(c, "user_detail_upload_avatar", h.service.UploadAvatar)
+}
+
+// HandleUploadIDCard takes the ID card as the file field of a multipart form
+func (h *Handler) HandleUploadIDCard(c *gin.Context) {
+	h.handleUpload(c, "user_detail_upload_id_card", h.service.UploadIDCard)
+}
+
+func (h *Handler) handleUpload(c *gin.Context, action string, upload func(profile_trail.Origin, uuid.UUID, []byte) (*Upload, error)) {
+	ctx := activity.NewContext(action)
+	ctx = activity.WithClientID(ctx, c.Value("client_id").(string))
+	trx, _ := activity.GetTransactionID(ctx)
+	userDetailID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		respond.Error(c, trx, http.StatusBadRequest, respond.ErrBadRequest, "invalid user detail id")
+		return
+	}
+
+	data, err := ReadUpload(c)
+	if err != nil {
+		respondUploadError(c, ctx, trx, err)
+		return
+	}
+
+	origin := profile_trail.NewOrigin(ctx, c.ClientIP(), c.Request.UserAgent())
+	item, err := upload(origin, userDetailID, data)
+	if err != nil {
+		respondUploadError(c, ctx, trx, err)
+		return
+	}
+
+	respond.Success(c, trx, http.StatusCreated, item.ClientView())
+}
+
+func respondUploadError(c *gin.Context, ctx context.Context, trx string, err error) {
+	if f, ok := stacktrace.RootCause(err).(failure.Failure); ok {
+		switch f.Code {
+		case failure.CodeUserNotFound, failure.CodeInvalidImage:
+			respond.Error(c, trx, http.StatusBadRequest, f.Code, f.Desc)
+			return
+		case failure.CodeUploadTooLarge:
+			respond.Error(c, trx, http.StatusRequestEntityTooLarge, f.Code, f.Desc)
+			return
+		}
+	}
+
+	log.WithContext(ctx).Error(stacktrace.Propagate(err, "upload user detail image error"))
+	respond.Error(c, trx, http.StatusInternalServerError, respond.ErrInternal, "unknown error")
+}
+
+// ReadUpload reads the file field of a multipart upload, a larger file than
+// MaxUploadSize fails with CodeUploadTooLarge.
+func ReadUpload(c *gin.Context) ([]byte, error) {
+	files, err := ReadUploads(c, "file")
+	if err != nil {
+		return nil, err
+	}
+
+	return files[0], nil
+}
+
+// ReadUploads reads the files of the given fields of a multipart upload in
+// order, every one of them is required and limited to MaxUploadSize.
+func ReadUploads(c *gin.Context, fields ...string) ([][]byte, error) {
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, int64(len(fields))*MaxUploadSize()+multipartOverhead)
+	files := make([][]byte, 0, len(fields))
+	for _, field := range fields {
+		data, err := readUploadField(c, field)
+		if err != nil {
+			return nil, err
+		}
+
+		files = append(files, data)
+	}
+
+	return files, nil
+}
+
+func readUploadField(c *gin.Context, field string) ([]byte, error) {
+	file, header, err := c.Request.FormFile(field)
+	if err != nil {
+		var maxBytesError *http.MaxBytesError
+		if errors.As(err, &maxBytesError) {
+			return nil, errUploadTooLarge
+		}
+
+		return nil, failure.WithMessage(
+			failure.CodeInvalidImage,
+			field+" is required, send the image as the "+field+" field of a multipart form",
+		)
+	}
+	defer file.Close()
+
+	if header.Size > MaxUploadSize() {
+		return nil, errUploadTooLarge
+	}
+
+	return io.ReadAll(file)
 }
@@ -0,0 +1,254 @@
+package user_detail
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/draw"
+	"image/jpeg"
+	"image/png"
+	"net/http"
+
+	"stark/failure"
+)
+
+const (
+	ContentTypeJPEG = "image/jpeg"
+	ContentTypePNG  = "image/png"
+
+	// Larger images are refused before decoding, a small file can still
+	// decode into a huge bitmap
+	maxImagePixels = 25000000
+
+	thumbnailSize = 256
+	jpegQuality   = 90
+
+	exifOrientationTag = 0x0112
+)
+
+// decodeImage reads an uploaded JPEG or PNG, the type is sniffed from the
+// content instead of trusting the request. A JPEG is turned upright by its
+// EXIF orientation as the EXIF data is dropped on encoding.
+func decodeImage(data []byte) (*image.RGBA, string, error) {
+	contentType := http.DetectContentType(data)
+	if contentType != ContentTypeJPEG && contentType != ContentTypePNG {
+		return nil, "", failure.WithMessage(
+			failure.CodeInvalidImage,
+			"unsupported image type, upload a jpeg or png",
+		)
+	}
+
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, "", failure.WithMessage(failure.CodeInvalidImage, "invalid image, "+err.Error())
+	}
+
+	if config.Width*config.Height > maxImagePixels {
+		return nil, "", failure.WithMessage(
+			failure.CodeInvalidImage,
+			"image is too large, it should have at most 25 megapixels",
+		)
+	}
+
+	decoded, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, "", failure.WithMessage(failure.CodeInvalidImage, "invalid image, "+err.Error())
+	}
+
+	img := toRGBA(decoded)
+	if contentType == ContentTypeJPEG {
+		img = orient(img, jpegOrientation(data))
+	}
+
+	return img, contentType, nil
+}
+
+// encodeImage writes the pixels alone, metadata of the upload such as EXIF
+// never makes it into the stored file
+func encodeImage(img image.Image, contentType string) ([]byte, error) {
+	var buffer bytes.Buffer
+	var err error
+	if contentType == ContentTypePNG {
+		err = png.Encode(&buffer, img)
+	} else {
+		err = jpeg.Encode(&buffer, img, &jpeg.Options{Quality: jpegQuality})
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return buffer.Bytes(), nil
+}
+
+func imageExtension(contentType string) string {
+	if contentType == ContentTypePNG {
+		return ".png"
+	}
+
+	return ".jpg"
+}
+
+// thumbnail scales the image down to fit a size by size square, each pixel is
+// the average of the source pixels it covers
+func thumbnail(img *image.RGBA, size int) *image.RGBA {
+	width, height := img.Rect.Dx(), img.Rect.Dy()
+	if width <= size && height <= size {
+		return img
+	}
+
+	thumbWidth, thumbHeight := size, height*size/width
+	if height > width {
+		thumbWidth, thumbHeight = width*size/height, size
+	}
+
+	if thumbWidth < 1 {
+		thumbWidth = 1
+	}
+
+	if thumbHeight < 1 {
+		thumbHeight = 1
+	}
+
+	thumb := image.NewRGBA(image.Rect(0, 0, thumbWidth, thumbHeight))
+	for y := 0; y < thumbHeight; y++ {
+		top, bottom := y*height/thumbHeight, (y+1)*height/thumbHeight
+		for x := 0; x < thumbWidth; x++ {
+			left, right := x*width/thumbWidth, (x+1)*width/thumbWidth
+			var sum [4]int
+			count := 0
+			for sy := top; sy < bottom; sy++ {
+				offset := sy*img.Stride + left*4
+				for sx := left; sx < right; sx++ {
+					for i := 0; i < 4; i++ {
+						sum[i] += int(img.Pix[offset+i])
+					}
+
+					offset += 4
+					count++
+				}
+			}
+
+			offset := y*thumb.Stride + x*4
+			for i := 0; i < 4; i++ {
+				thumb.Pix[offset+i] = uint8(sum[i] / count)
+			}
+		}
+	}
+
+	return thumb
+}
+
+func toRGBA(img image.Image) *image.RGBA {
+	bounds := img.Bounds()
+	rgba := image.NewRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(rgba, rgba.Rect, img, bounds.Min, draw.Src)
+	return rgba
+}
+
+// orient applies an EXIF orientation, 1 is upright and 2 to 8 are the mirror
+// and rotation combinations of the TIFF specification
+func orient(img *image.RGBA, orientation int) *image.RGBA {
+	if orientation < 2 || orientation > 8 {
+		return img
+	}
+
+	width, height := img.Rect.Dx(), img.Rect.Dy()
+	dstWidth, dstHeight := width, height
+	if orientation >= 5 {
+		dstWidth, dstHeight = height, width
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, dstWidth, dstHeight))
+	for y := 0; y < dstHeight; y++ {
+		for x := 0; x < dstWidth; x++ {
+			var sx, sy int
+			switch orientation {
+			case 2:
+				sx, sy = width-1-x, y
+			case 3:
+				sx, sy = width-1-x, height-1-y
+			case 4:
+				sx, sy = x, height-1-y
+			case 5:
+				sx, sy = y, x
+			case 6:
+				sx, sy = y, height-1-x
+			case 7:
+				sx, sy = width-1-y, height-1-x
+			case 8:
+				sx, sy = width-1-y, x
+			}
+
+			copy(dst.Pix[y*dst.Stride+x*4:y*dst.Stride+x*4+4], img.Pix[sy*img.Stride+sx*4:sy*img.Stride+sx*4+4])
+		}
+	}
+
+	return dst
+}
+
+// jpegOrientation reads the orientation tag from the EXIF segment of a JPEG,
+// 1 when there is none or it can't be read
+func jpegOrientation(data []byte) int {
+	if len(data) < 4 || data[0] != 0xFF || data[1] != 0xD8 {
+		return 1
+	}
+
+	offset := 2
+	for offset+4 <= len(data) {
+		if data[offset] != 0xFF {
+			return 1
+		}
+
+		marker := data[offset+1]
+		length := int(binary.BigEndian.Uint16(data[offset+2:]))
+		// Start of scan, the metadata segments are all before it
+		if marker == 0xDA || length < 2 || offset+2+length > len(data) {
+			return 1
+		}
+
+		segment := data[offset+4 : offset+2+length]
+		if marker == 0xE1 && bytes.HasPrefix(segment, []byte("Exif\x00\x00")) {
+			return tiffOrientation(segment[6:])
+		}
+
+		offset += 2 + length
+	}
+
+	return 1
+}
+
+func tiffOrientation(tiff []byte) int {
+	if len(tiff) < 8 {
+		return 1
+	}
+
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return 1
+	}
+
+	ifd := int(order.Uint32(tiff[4:]))
+	if ifd+2 > len(tiff) {
+		return 1
+	}
+
+	entries := int(order.Uint16(tiff[ifd:]))
+	for i := 0; i < entries; i++ {
+		entry := ifd + 2 + i*12
+		if entry+12 > len(tiff) {
+			return 1
+		}
+
+		if order.Uint16(tiff[entry:]) == exifOrientationTag {
+			return int(order.Uint16(tiff[entry+8:]))
+		}
+	}
+
+	return 1
+}
@@ -1,13 +1,45 @@
 package user_detail
 
+import "stark/utils"
+
+// Input is a user detail as written by a client, the avatar and ID card are
+// set through their upload endpoints
 type Input struct {
 	ID          string `json:"id" binding:"required"`
 	DeviceToken string `json:"device_token"`
 	DeviceOS    string `json:"device_os"`
-	AvatarUrl   string `json:"avatar_url"`
-	AvatarPath  string `json:"avatar_path"`
 	Source      string `json:"source" binding:"required"`
 	OAuthId     string `json:"oauth_id"`
-	IDCardUrl   string `json:"id_card_url"`
-	IDCardPath  string `json:"id_card_path"`
+}
+
+// InputPatch is a JSON Merge Patch, nil fields are left untouched
+type InputPatch struct {
+	DeviceToken *string `json:"device_token"`
+	DeviceOS    *string `json:"device_os"`
+	Source      *string `json:"source" binding:"omitempty,min=1"`
+	OAuthId     *string `json:"oauth_id"`
+}
+
+// ApplyNulls clears the fields removed by the patch, source is mandatory and
+// can't be removed.
+func (p *InputPatch) ApplyNulls(nulls []string) []utils.ErrorMessage {
+	out := make([]utils.ErrorMessage, 0)
+	empty := ""
+	for _, field := range nulls {
+		switch field {
+		case "device_token":
+			p.DeviceToken = &empty
+		case "device_os":
+			p.DeviceOS = &empty
+		case "oauth_id":
+			p.OAuthId = &empty
+		case "source":
+			out = append(out, utils.ErrorMessage{
+				Field:   field,
+				Message: "this field cannot be null",
+			})
+		}
+	}
+
+	return out
 }
@@ -7,65 +7,129 @@ import (
 )
 
 type UserDetail struct {
-	ID          uuid.UUID `json:"id" db:"id"`
-	DeviceToken string    `json:"device_token" db:"device_token"`
-	DeviceOS    string    `json:"device_os" db:"device_os"`
-	AvatarUrl   string    `json:"avatar_url" db:"avatar_url"`
-	AvatarPath  string    `json:"avatar_path" db:"avatar_path"`
-	Source      string    `json:"source" db:"source"`
-	OAuthId     string    `json:"oauth_id" db:"oauth_id"`
-	IDCardUrl   string    `json:"id_card_url" db:"id_card_url"`
-	IDCardPath  string    `json:"id_card_path" db:"id_card_path"`
-	CreatedAt   time.Time `json:"created_at" db:"created_at"`
-	UpdatedAt   time.Time `json:"updated_at" db:"updated_at"`
+	ID          uuid.UUID  `json:"id" db:"id"`
+	DeviceToken string     `json:"device_token" db:"device_token"`
+	DeviceOS    string     `json:"device_os" db:"device_os"`
+	AvatarUrl   string     `json:"avatar_url" db:"avatar_url"`
+	AvatarPath  string     `json:"avatar_path" db:"avatar_path"`
+	Source      string     `json:"source" db:"source"`
+	OAuthId     string     `json:"oauth_id" db:"oauth_id"`
+	IDCardUrl   string     `json:"id_card_url" db:"id_card_url"`
+	IDCardPath  string     `json:"id_card_path" db:"id_card_path"`
+	DeletedAt   *time.Time `json:"deleted_at" db:"deleted_at"`
+	CreatedAt   time.Time  `json:"created_at" db:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at" db:"updated_at"`
+	Version     int        `json:"version" db:"version"`
 }
 
 func New(
 	id uuid.UUID,
 	device_token,
 	device_os,
-	avatar_url,
-	avatar_path,
 	source,
-	oauth_id,
-	id_card_url,
-	id_card_path string) *UserDetail {
+	oauth_id string) *UserDetail {
 	return &UserDetail{
 		ID:          id,
 		DeviceToken: device_token,
 		DeviceOS:    device_os,
-		AvatarUrl:   avatar_url,
-		AvatarPath:  avatar_path,
 		Source:      source,
 		OAuthId:     oauth_id,
-		IDCardUrl:   id_card_url,
-		IDCardPath:  id_card_path,
 		CreatedAt:   time.Now(),
 		UpdatedAt:   time.Now(),
+		Version:     1,
 	}
 }
 
+// MatchVersion reports whether the user detail is still at the version the caller
+// read, 0 matches any version.
+func (u *UserDetail) MatchVersion(version int) bool {
+	return version == 0 || u.Version == version
+}
+
+// Update replaces the fields a caller can write, the avatar and ID card are
+// only changed by their uploads
 func (u *UserDetail) Update(
 	device_token,
 	device_os,
-	avatar_url,
-	avatar_path,
 	source,
-	oauth_id,
-	id_card_url,
-	id_card_path string) {
+	oauth_id string) {
 	u.DeviceToken = device_token
 	u.DeviceOS = device_os
-	u.AvatarUrl = avatar_url
-	u.AvatarPath = avatar_path
 	u.Source = source
 	u.OAuthId = oauth_id
-	u.IDCardUrl = id_card_url
-	u.IDCardPath = id_card_path
 	u.UpdatedAt = time.Now()
 }
 
+// Patch applies the provided fields and returns the columns to write
+func (u *UserDetail) Patch(input InputPatch) []string {
+	columns := make([]string, 0)
+	if input.DeviceToken != nil {
+		u.DeviceToken = *input.DeviceToken
+		columns = append(columns, "device_token")
+	}
+
+	if input.DeviceOS != nil {
+		u.DeviceOS = *input.DeviceOS
+		columns = append(columns, "device_os")
+	}
+
+	if input.Source != nil {
+		u.Source = *input.Source
+		columns = append(columns, "source")
+	}
+
+	if input.OAuthId != nil {
+		u.OAuthId = *input.OAuthId
+		columns = append(columns, "oauth_id")
+	}
+
+	if len(columns) != 0 {
+		u.UpdatedAt = time.Now()
+	}
+
+	return columns
+}
+
+// SetAvatar points the avatar to an upload and returns the columns to write
+func (u *UserDetail) SetAvatar(url, path string) []string {
+	u.AvatarUrl = url
+	u.AvatarPath = path
+	u.UpdatedAt = time.Now()
+	return []string{"avatar_url", "avatar_path"}
+}
+
+// SetIDCard points the ID card to an upload and returns the columns to write
+func (u *UserDetail) SetIDCard(url, path string) []string {
+	u.IDCardUrl = url
+	u.IDCardPath = path
+	u.UpdatedAt = time.Now()
+	return []string{"id_card_url", "id_card_path"}
+}
+
+func (u *UserDetail) Delete() {
+	now := time.Now()
+	u.DeletedAt = &now
+	u.UpdatedAt = now
+}
+
+// Upload is an image stored for the user detail, a private image has a
+// signed url that stops working at ExpiresAt
+type Upload struct {
+	Detail       *UserDetail `json:"detail"`
+	Url          string      `json:"url"`
+	ThumbnailUrl string      `json:"thumbnail_url,omitempty"`
+	ExpiresAt    *time.Time  `json:"expires_at,omitempty"`
+}
+
 type Page struct {
 	Items []*UserDetail `json:"items"`
 	Total int           `json:"total"`
 }
+
+// CursorPage is a keyset page, Total is only set when it was asked for
+type CursorPage struct {
+	Items      []*UserDetail `json:"items"`
+	NextCursor string        `json:"next_cursor"`
+	PrevCursor string        `json:"prev_cursor"`
+	Total      *int          `json:"total,omitempty"`
+}
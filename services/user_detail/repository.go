@@ -1,11 +1,23 @@
 package user_detail
 
-import "github.com/google/uuid"
+import (
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+
+	"stark/database"
+)
 
 type Repository interface {
+	// WithTx returns the repository writing and reading in tx, the owner of
+	// tx commits or rolls back
+	WithTx(tx *sqlx.Tx) Repository
 	Store(item *UserDetail) error
+	Patch(item *UserDetail, columns []string) error
+	SoftDelete(item *UserDetail) error
 	FindByID(id uuid.UUID) (*UserDetail, error)
 	FindByFilter(filter Filter) ([]*UserDetail, error)
 	FindPage(offset, limit int) ([]*UserDetail, error)
+	FindCursorPage(cursor *database.Cursor, limit int) ([]*UserDetail, error)
 	FindTotalByFilter(filter Filter) (int, error)
+	FindApproximateTotal() (int, error)
 }
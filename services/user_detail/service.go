@@ -1,54 +1,95 @@
 package user_detail
 
 import (
+	"bytes"
 	"database/sql"
+	"image"
+	"path"
+	"strings"
+	"time"
 
 	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
 	"github.com/palantir/stacktrace"
 
+	"stark/database"
 	"stark/failure"
+	"stark/services/profile_trail"
+	"stark/utils"
+	"stark/utils/activity"
+	"stark/utils/log"
+	"stark/utils/storage"
+)
+
+const (
+	// Uploads are stored under a prefix per kind and user detail, only keys
+	// under them are treated as stored by Stark
+	avatarPrefix = "avatars/"
+	idCardPrefix = "id-cards/"
+
+	thumbnailSuffix = "_thumb"
+)
+
+var errVersionConflict = failure.WithMessage(
+	failure.CodeVersionConflict,
+	"user detail was changed by another request, fetch it again and retry with the new ETag",
 )
 
 type Service struct {
-	repo Repository
+	repo          Repository
+	trailRecorder profile_trail.Recorder
+	fileStorage   storage.Storage
+}
+
+func NewService(repo Repository, profileTrailService *profile_trail.Service, fileStorage storage.Storage) *Service {
+	return &Service{
+		repo:          repo,
+		trailRecorder: profileTrailService,
+		fileStorage:   fileStorage,
+	}
+}
+
+// WithTx returns the service with its repository joined to tx, for writes
+// that commit together with those of other services
+func (s *Service) WithTx(tx *sqlx.Tx) *Service {
+	service := *s
+	service.repo = s.repo.WithTx(tx)
+	return &service
 }
 
-func NewService(repo Repository) *Service {
-	return &Service{repo: repo}
+// WithTrail returns the service recording its profile trails to recorder, a
+// unit of work passes a batch it stores once it commits
+func (s *Service) WithTrail(recorder profile_trail.Recorder) *Service {
+	service := *s
+	service.trailRecorder = recorder
+	return &service
 }
 
 func (s *Service) Create(
+	origin profile_trail.Origin,
 	id uuid.UUID,
 	device_token,
 	device_os,
-	avatar_url,
-	avatar_path,
 	source,
-	oauth_id,
-	id_card_url,
-	id_card_path string) (*UserDetail, error) {
+	oauth_id string) (*UserDetail, error) {
 	item := New(
 		id,
 		device_token,
 		device_os,
-		avatar_url,
-		avatar_path,
 		source,
 		oauth_id,
-		id_card_url,
-		id_card_path,
 	)
 
 	var err error
 	totalOauthID := 0
 	if oauth_id != "" {
-		totalOauthID, err = s.repo.FindTotalByFilter(Filter{OAuthIDs: []string{oauth_id}})
+		totalOauthID, err = s.repo.FindTotalByFilter(Filter{OAuthIDs: []string{oauth_id}, WithDeleted: true})
 		if err != nil {
 			return nil, err
 		}
 	}
 
-	totalID, err := s.repo.FindTotalByFilter(Filter{IDs: []string{id.String()}})
+	totalID, err := s.repo.FindTotalByFilter(Filter{IDs: []string{id.String()}, WithDeleted: true})
 	if err != nil {
 		return nil, err
 	}
@@ -65,51 +106,277 @@ func (s *Service) Create(
 		return nil, err
 	}
 
+	s.trail(origin, nil, item)
 	return s.FindByID(item.ID)
 }
 
+// Update replaces the user detail when it is still at version, 0 skips the
+// check. A missing user detail is created.
 func (s *Service) Update(
+	origin profile_trail.Origin,
 	id uuid.UUID,
+	version int,
 	device_token,
 	device_os,
-	avatar_url,
-	avatar_path,
 	source,
-	oauth_id,
-	id_card_url,
-	id_card_path string) (*UserDetail, error) {
-	item := &UserDetail{
-		ID:          id,
-		DeviceToken: device_token,
-		DeviceOS:    device_os,
-		AvatarUrl:   avatar_url,
-		AvatarPath:  avatar_path,
-		Source:      source,
-		OAuthId:     oauth_id,
-		IDCardUrl:   id_card_url,
-		IDCardPath:  id_card_path,
+	oauth_id string) (*UserDetail, error) {
+	var before *UserDetail
+	item, err := s.repo.FindByID(id)
+	if err != nil {
+		if stacktrace.RootCause(err) != sql.ErrNoRows {
+			return nil, err
+		}
+
+		item = &UserDetail{ID: id}
+	} else {
+		previous := *item
+		before = &previous
+	}
+
+	if !item.MatchVersion(version) {
+		return nil, errVersionConflict
 	}
 
 	item.Update(
 		device_token,
 		device_os,
-		avatar_url,
-		avatar_path,
 		source,
 		oauth_id,
-		id_card_url,
-		id_card_path,
 	)
 
-	err := s.repo.Store(item)
+	err = s.repo.Store(item)
+	if err != nil {
+		return nil, conflict(err)
+	}
+
+	s.trail(origin, before, item)
+	return s.FindByID(id)
+}
+
+func (s *Service) Patch(origin profile_trail.Origin, id uuid.UUID, version int, input InputPatch) (*UserDetail, error) {
+	return s.patch(origin, id, version, func(item *UserDetail) []string {
+		return item.Patch(input)
+	})
+}
+
+// patch writes the columns apply changed when the user detail is still at
+// version, 0 skips the check
+func (s *Service) patch(origin profile_trail.Origin, id uuid.UUID, version int, apply func(item *UserDetail) []string) (*UserDetail, error) {
+	item, err := s.find(id)
+	if err != nil {
+		return nil, err
+	}
+
+	if !item.MatchVersion(version) {
+		return nil, errVersionConflict
+	}
+
+	before := *item
+	columns := apply(item)
+	if len(columns) == 0 {
+		return item, s.sign(item)
+	}
+
+	err = s.repo.Patch(item, columns)
+	if err != nil {
+		return nil, conflict(err)
+	}
+
+	s.trail(origin, &before, item)
+	return s.FindByID(id)
+}
+
+// UploadAvatar stores the image and a thumbnail of it as public files and
+// points the avatar of the user detail to them, replacing the stored ones.
+func (s *Service) UploadAvatar(origin profile_trail.Origin, id uuid.UUID, data []byte) (*Upload, error) {
+	item, err := s.find(id)
+	if err != nil {
+		return nil, err
+	}
+
+	img, contentType, err := decodeImage(data)
+	if err != nil {
+		return nil, err
+	}
+
+	key := avatarPrefix + id.String() + "/" + uuid.New().String() + imageExtension(contentType)
+	err = s.storeImage(key, img, contentType, true)
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.storeImage(thumbnailKey(key), thumbnail(img, thumbnailSize), contentType, true)
+	if err != nil {
+		s.removeUpload(key)
+		return nil, err
+	}
+
+	previous := item.AvatarPath
+	avatarUrl := s.fileStorage.URL(key)
+	detail, err := s.patch(origin, id, 0, func(item *UserDetail) []string {
+		return item.SetAvatar(avatarUrl, key)
+	})
+
+	if err != nil {
+		s.removeUpload(key, thumbnailKey(key))
+		return nil, err
+	}
+
+	if isUpload(avatarPrefix, id, previous) {
+		s.removeUpload(previous, thumbnailKey(previous))
+	}
+
+	return &Upload{
+		Detail:       detail,
+		Url:          avatarUrl,
+		ThumbnailUrl: s.fileStorage.URL(thumbnailKey(key)),
+	}, nil
+}
+
+// UploadIDCard stores the image as a private file, it is only handed out as
+// a signed url. The stored url of the ID card is cleared, reads fill it in.
+func (s *Service) UploadIDCard(origin profile_trail.Origin, id uuid.UUID, data []byte) (*Upload, error) {
+	item, err := s.find(id)
+	if err != nil {
+		return nil, err
+	}
+
+	img, contentType, err := decodeImage(data)
+	if err != nil {
+		return nil, err
+	}
+
+	key := idCardPrefix + id.String() + "/" + uuid.New().String() + imageExtension(contentType)
+	err = s.storeImage(key, img, contentType, false)
+	if err != nil {
+		return nil, err
+	}
+
+	previous := item.IDCardPath
+	detail, err := s.patch(origin, id, 0, func(item *UserDetail) []string {
+		return item.SetIDCard("", key)
+	})
+
+	if err != nil {
+		s.removeUpload(key)
+		return nil, err
+	}
+
+	if isUpload(idCardPrefix, id, previous) {
+		s.removeUpload(previous)
+	}
+
+	expiresAt := time.Now().Add(SignedURLTTL())
+	return &Upload{
+		Detail:    detail,
+		Url:       detail.IDCardUrl,
+		ExpiresAt: &expiresAt,
+	}, nil
+}
+
+// StorePrivateImage cleans an uploaded image the same way as the ID card and
+// stores it as a private file, the extension of its type is appended to key.
+// It returns the key the image was stored under.
+func (s *Service) StorePrivateImage(key string, data []byte) (string, error) {
+	img, contentType, err := decodeImage(data)
+	if err != nil {
+		return "", err
+	}
+
+	key += imageExtension(contentType)
+	err = s.storeImage(key, img, contentType, false)
+	if err != nil {
+		return "", err
+	}
+
+	return key, nil
+}
+
+// sign sets the ID card url of the items whose ID card was uploaded to Stark
+// to a signed url, any other ID card path is left alone rather than failing
+// the read. Reads for callers are signed, reads for a write are not so a
+// signed url never gets stored.
+func (s *Service) sign(items ...*UserDetail) error {
+	for _, item := range items {
+		if item == nil || !isUpload(idCardPrefix, item.ID, item.IDCardPath) {
+			continue
+		}
+
+		signedUrl, err := s.fileStorage.SignedURL(item.IDCardPath, SignedURLTTL())
+		if err != nil {
+			return err
+		}
+
+		item.IDCardUrl = signedUrl
+	}
+
+	return nil
+}
+
+// RemoveUploads deletes the avatar, its thumbnail and the ID card stored for
+// the user detail, deleted or not. It runs before the user is purged, once
+// the row is gone nothing would point to the files.
+func (s *Service) RemoveUploads(id uuid.UUID) error {
+	items, err := s.repo.FindByFilter(Filter{IDs: []string{id.String()}, WithDeleted: true})
+	if err != nil {
+		return err
+	}
+
+	for _, item := range items {
+		keys := make([]string, 0)
+		if isUpload(avatarPrefix, id, item.AvatarPath) {
+			keys = append(keys, item.AvatarPath, thumbnailKey(item.AvatarPath))
+		}
+
+		if isUpload(idCardPrefix, id, item.IDCardPath) {
+			keys = append(keys, item.IDCardPath)
+		}
+
+		for _, key := range keys {
+			err := s.fileStorage.Delete(key)
+			if err != nil {
+				return stacktrace.Propagate(err, "remove upload %s error", key)
+			}
+		}
+	}
+
+	return nil
+}
+
+func (s *Service) Delete(id uuid.UUID) (*UserDetail, error) {
+	item, err := s.find(id)
 	if err != nil {
 		return nil, err
 	}
 
-	return s.repo.FindByID(id)
+	item.Delete()
+	err = s.repo.SoftDelete(item)
+	if err != nil {
+		return nil, err
+	}
+
+	return item, nil
 }
 
 func (s *Service) FindByID(id uuid.UUID) (*UserDetail, error) {
+	item, err := s.find(id)
+	if err != nil {
+		return nil, err
+	}
+
+	return item, s.sign(item)
+}
+
+func (s *Service) FindAllByFilter(filter Filter) ([]*UserDetail, error) {
+	items, err := s.repo.FindByFilter(filter)
+	if err != nil {
+		return nil, err
+	}
+
+	return items, s.sign(items...)
+}
+
+func (s *Service) find(id uuid.UUID) (*UserDetail, error) {
 	item, err := s.repo.FindByID(id)
 	if err != nil {
 		if stacktrace.RootCause(err) == sql.ErrNoRows {
@@ -125,10 +392,6 @@ func (s *Service) FindByID(id uuid.UUID) (*UserDetail, error) {
 	return item, nil
 }
 
-func (s *Service) FindAllByFilter(filter Filter) ([]*UserDetail, error) {
-	return s.repo.FindByFilter(filter)
-}
-
 func (s *Service) FindPage(page, limit int) (Page, error) {
 	offset := (page - 1) * limit
 	items, err := s.repo.FindPage(offset, limit)
@@ -141,8 +404,110 @@ func (s *Service) FindPage(page, limit int) (Page, error) {
 		return Page{}, err
 	}
 
+	err = s.sign(items...)
+	if err != nil {
+		return Page{}, err
+	}
+
 	return Page{
 		Items: items,
 		Total: total,
 	}, nil
 }
+
+// FindCursorPage reads a keyset page, total is one of the database total
+// modes and the table is only counted when asked to.
+func (s *Service) FindCursorPage(cursor string, limit int, total string) (CursorPage, error) {
+	page, err := database.ReadCursorPage(
+		cursor,
+		limit,
+		total,
+		s.repo.FindCursorPage,
+		func(item *UserDetail) (time.Time, string) {
+			return item.CreatedAt, item.ID.String()
+		},
+		func() (int, error) {
+			return s.repo.FindTotalByFilter(Filter{})
+		},
+		s.repo.FindApproximateTotal,
+	)
+
+	if err != nil {
+		return CursorPage{}, err
+	}
+
+	err = s.sign(page.Items...)
+	if err != nil {
+		return CursorPage{}, err
+	}
+
+	return CursorPage(page), nil
+}
+
+// trail records the change in the profile trail, the change is already
+// stored so a failure is logged instead of returned.
+func (s *Service) trail(origin profile_trail.Origin, before, after *UserDetail) {
+	err := s.trailRecorder.Record(origin, after.ID.String(), profile_trail.SectionDetail, before, after)
+	if err != nil {
+		ctx := activity.NewContext("user_detail_profile_trail")
+		ctx = activity.WithUserID(ctx, after.ID.String())
+		log.WithContext(ctx).Error(stacktrace.Propagate(err, "record profile trail error"))
+	}
+}
+
+func (s *Service) storeImage(key string, img image.Image, contentType string, public bool) error {
+	data, err := encodeImage(img, contentType)
+	if err != nil {
+		return err
+	}
+
+	return s.fileStorage.Put(key, bytes.NewReader(data), int64(len(data)), contentType, public)
+}
+
+// removeUpload deletes stored files that are no longer referenced, a failure
+// only leaves an orphan behind so it is logged.
+func (s *Service) removeUpload(keys ...string) {
+	for _, key := range keys {
+		err := s.fileStorage.Delete(key)
+		if err != nil {
+			ctx := activity.NewContext("user_detail_remove_upload")
+			log.WithContext(ctx).Error(stacktrace.Propagate(err, "remove upload %s error", key))
+		}
+	}
+}
+
+// conflict turns a write that lost the race on the row version into the same
+// failure as a stale If-Match.
+func conflict(err error) error {
+	if stacktrace.RootCause(err) == database.ErrVersionConflict {
+		return errVersionConflict
+	}
+
+	return err
+}
+
+// isUpload reports whether path is a file Stark stored for the user detail.
+// Rows written before the upload endpoints owned the paths may hold any
+// value, so a key that isn't clean is never treated as an upload.
+func isUpload(prefix string, id uuid.UUID, key string) bool {
+	if _, err := storage.CleanKey(key); err != nil {
+		return false
+	}
+
+	return strings.HasPrefix(key, prefix+id.String()+"/")
+}
+
+func thumbnailKey(key string) string {
+	extension := path.Ext(key)
+	return strings.TrimSuffix(key, extension) + thumbnailSuffix + extension
+}
+
+// MaxUploadSize is the largest image upload in bytes
+func MaxUploadSize() int64 {
+	return int64(utils.GetIntEnv("UPLOAD_MAX_SIZE", 5<<20))
+}
+
+// SignedURLTTL is how long a signed url of a private image works
+func SignedURLTTL() time.Duration {
+	return utils.GetDurationEnv("UPLOAD_SIGNED_URL_TTL", 15*time.Minute)
+}
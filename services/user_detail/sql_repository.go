@@ -5,11 +5,13 @@ import (
 
 	"github.com/doug-martin/goqu/v9"
 	_ "github.com/doug-martin/goqu/v9/dialect/mysql"
+	"github.com/doug-martin/goqu/v9/exp"
 	"github.com/google/uuid"
 	"github.com/jmoiron/sqlx"
 	"github.com/palantir/stacktrace"
 
 	"stark/database"
+	"stark/services/outbox"
 )
 
 type sqlRepository struct {
@@ -32,8 +34,16 @@ const (
 			oauth_id = ?,
 			id_card_url = ?,
 			id_card_path = ?,
-			updated_at = ?
-		WHERE id = ?
+			updated_at = ?,
+			version = version + 1
+		WHERE id = ? AND version = ?
+	`
+	softDeleteUserQuery = `
+		UPDATE user_details SET
+			deleted_at = ?,
+			updated_at = ?,
+			version = version + 1
+		WHERE id = ? AND version = ?
 	`
 )
 
@@ -41,6 +51,10 @@ func NewSQLRepository(mysqlDB *database.MySQL) Repository {
 	return &sqlRepository{mysqlDB}
 }
 
+func (repo *sqlRepository) WithTx(tx *sqlx.Tx) Repository {
+	return &sqlRepository{mysqlDB: repo.mysqlDB.Join(tx)}
+}
+
 func (repo *sqlRepository) Store(data *UserDetail) error {
 	exist, err := repo.existByID(data.ID)
 	if err != nil {
@@ -55,23 +69,113 @@ func (repo *sqlRepository) Store(data *UserDetail) error {
 		data.ID,
 		data.DeviceToken,
 		data.DeviceOS,
-		data.AvatarUrl,
-		data.AvatarPath,
 		data.Source,
 		data.OAuthId,
-		data.IDCardUrl,
-		data.IDCardPath,
 	)
 
 	return repo.insert(data)
 }
 
+func (repo *sqlRepository) SoftDelete(data *UserDetail) error {
+	_, err := repo.mysqlDB.WithTransaction(func(tx *sqlx.Tx) (interface{}, error) {
+		res, err := tx.Exec(softDeleteUserQuery,
+			data.DeletedAt,
+			data.UpdatedAt,
+			data.ID,
+			data.Version,
+		)
+
+		if err != nil {
+			return nil, err
+		}
+
+		rowsAffected, err := res.RowsAffected()
+		if err != nil {
+			return nil, err
+		}
+
+		if rowsAffected <= 0 {
+			return nil, stacktrace.Propagate(database.ErrVersionConflict, "soft delete user detail fails")
+		}
+
+		data.Version++
+
+		err = outbox.Write(tx, aggregateType, data.ID.String(), EventDeleted, data)
+		if err != nil {
+			return nil, err
+		}
+
+		return nil, nil
+	})
+
+	return err
+}
+
+// Patch writes only the given columns, updated_at and the bumped version
+func (repo *sqlRepository) Patch(data *UserDetail, columns []string) error {
+	values := map[string]interface{}{
+		"device_token": data.DeviceToken,
+		"device_os":    data.DeviceOS,
+		"avatar_url":   data.AvatarUrl,
+		"avatar_path":  data.AvatarPath,
+		"source":       data.Source,
+		"oauth_id":     data.OAuthId,
+		"id_card_url":  data.IDCardUrl,
+		"id_card_path": data.IDCardPath,
+	}
+
+	record := goqu.Record{
+		"updated_at": data.UpdatedAt,
+		"version":    goqu.L("version + 1"),
+	}
+
+	for _, column := range columns {
+		record[column] = values[column]
+	}
+
+	dialect := goqu.Dialect("mysql")
+	dataset := dialect.Update("user_details").Prepared(true).Set(record)
+	dataset = dataset.Where(goqu.Ex{
+		"id":         data.ID.String(),
+		"version":    data.Version,
+		"deleted_at": nil,
+	})
+
+	sql, args, err := dataset.ToSQL()
+	if err != nil {
+		return stacktrace.Propagate(err, "sql error")
+	}
+
+	_, err = repo.mysqlDB.WithTransaction(func(tx *sqlx.Tx) (interface{}, error) {
+		res, err := tx.Exec(sql, args...)
+		if err != nil {
+			return nil, err
+		}
+
+		rowsAffected, err := res.RowsAffected()
+		if err != nil {
+			return nil, err
+		}
+
+		if rowsAffected <= 0 {
+			return nil, stacktrace.Propagate(database.ErrVersionConflict, "patch user detail fails")
+		}
+
+		data.Version++
+
+		return nil, outbox.Write(tx, aggregateType, data.ID.String(), EventUpdated, data)
+	})
+
+	return err
+}
+
 func (repo *sqlRepository) FindByID(id uuid.UUID) (result *UserDetail, err error) {
 	var data UserDetail
 	dialect := goqu.Dialect("mysql")
 	dataset := dialect.From("user_details")
 	dataset = dataset.Where(goqu.Ex{
-		"id": id.String(),
+		"id":         id.String(),
+		"deleted_at": nil,
 	})
 
 	sql, _, err := dataset.ToSQL()
@@ -94,28 +198,15 @@ func (repo *sqlRepository) FindByFilter(filter Filter) (result []*UserDetail, er
 
 	dialect := goqu.Dialect("mysql")
 	dataset := dialect.From("user_details")
-	if len(filter.IDs) != 0 {
-		dataset = dataset.Where(goqu.Ex{
-			"id": filter.IDs,
-		})
-	}
-
-	if len(filter.OAuthIDs) != 0 {
-		dataset = dataset.Where(goqu.Ex{
-			"oauth_id": filter.OAuthIDs,
-		})
-	}
-
-	if len(filter.DeviceTokens) != 0 {
+	if !filter.WithDeleted {
 		dataset = dataset.Where(goqu.Ex{
-			"device_token": filter.DeviceTokens,
+			"deleted_at": nil,
 		})
 	}
 
-	if len(filter.Sources) != 0 {
-		dataset = dataset.Where(goqu.Ex{
-			"source": filter.Sources,
-		})
+	dataset = dataset.Where(filterExpression(filter))
+	for _, sort := range filter.Sort {
+		dataset = dataset.OrderAppend(database.Order(sort.Field, sort.Direction))
 	}
 
 	sql, _, err := dataset.ToSQL()
@@ -134,6 +225,11 @@ func (repo *sqlRepository) FindByFilter(filter Filter) (result []*UserDetail, er
 func (repo *sqlRepository) FindPage(offset int, limit int) (result []*UserDetail, err error) {
 	dialect := goqu.Dialect("mysql")
 	dataset := dialect.From("user_details")
+	dataset = dataset.Where(goqu.Ex{
+		"deleted_at": nil,
+	})
+	dataset = dataset.Order(goqu.C("created_at").Asc(), goqu.C("id").Asc())
+
 	sql, _, err := dataset.ToSQL()
 	if err != nil {
 		return nil, stacktrace.Propagate(err, "sql error")
@@ -147,34 +243,41 @@ func (repo *sqlRepository) FindPage(offset int, limit int) (result []*UserDetail
 	return
 }
 
-func (repo *sqlRepository) FindTotalByFilter(filter Filter) (total int, err error) {
+// FindCursorPage reads up to limit rows from the cursor, a backward cursor
+// returns them newest first
+func (repo *sqlRepository) FindCursorPage(cursor *database.Cursor, limit int) (result []*UserDetail, err error) {
 	dialect := goqu.Dialect("mysql")
 	dataset := dialect.From("user_details")
-	dataset = dataset.Select(goqu.COUNT("*"))
-	if len(filter.IDs) != 0 {
-		dataset = dataset.Where(goqu.Ex{
-			"id": filter.IDs,
-		})
-	}
+	dataset = dataset.Where(goqu.Ex{
+		"deleted_at": nil,
+	})
+	dataset = cursor.Paginate(dataset, limit)
 
-	if len(filter.OAuthIDs) != 0 {
-		dataset = dataset.Where(goqu.Ex{
-			"oauth_id": filter.OAuthIDs,
-		})
+	sql, _, err := dataset.ToSQL()
+	if err != nil {
+		return nil, stacktrace.Propagate(err, "sql error")
 	}
 
-	if len(filter.DeviceTokens) != 0 {
-		dataset = dataset.Where(goqu.Ex{
-			"device_token": filter.DeviceTokens,
-		})
+	err = repo.mysqlDB.Select(&result, sql)
+	if err != nil {
+		return nil, stacktrace.Propagate(err, "select rows fails")
 	}
 
-	if len(filter.Sources) != 0 {
+	return result, nil
+}
+
+func (repo *sqlRepository) FindTotalByFilter(filter Filter) (total int, err error) {
+	dialect := goqu.Dialect("mysql")
+	dataset := dialect.From("user_details")
+	dataset = dataset.Select(goqu.COUNT("*"))
+	if !filter.WithDeleted {
 		dataset = dataset.Where(goqu.Ex{
-			"source": filter.Sources,
+			"deleted_at": nil,
 		})
 	}
 
+	dataset = dataset.Where(filterExpression(filter))
+
 	sql, _, err := dataset.ToSQL()
 	if err != nil {
 		return 0, stacktrace.Propagate(err, "sql error")
@@ -188,6 +291,58 @@ func (repo *sqlRepository) FindTotalByFilter(filter Filter) (total int, err erro
 	return total, nil
 }
 
+func (repo *sqlRepository) FindApproximateTotal() (int, error) {
+	return repo.mysqlDB.ApproximateCount("user_details")
+}
+
+// filterExpression translates the filter criteria into a WHERE expression,
+// nested and/or/not filters become grouped sub expressions.
+func filterExpression(filter Filter) exp.ExpressionList {
+	expressions := []exp.Expression{
+		filter.CreatedAt.Expression("created_at"),
+		filter.UpdatedAt.Expression("updated_at"),
+	}
+
+	if len(filter.IDs) != 0 {
+		expressions = append(expressions, goqu.Ex{"id": filter.IDs})
+	}
+
+	if len(filter.OAuthIDs) != 0 {
+		expressions = append(expressions, goqu.Ex{"oauth_id": filter.OAuthIDs})
+	}
+
+	if len(filter.DeviceTokens) != 0 {
+		expressions = append(expressions, goqu.Ex{"device_token": filter.DeviceTokens})
+	}
+
+	if len(filter.DeviceOSes) != 0 {
+		expressions = append(expressions, goqu.Ex{"device_os": filter.DeviceOSes})
+	}
+
+	if len(filter.Sources) != 0 {
+		expressions = append(expressions, goqu.Ex{"source": filter.Sources})
+	}
+
+	for _, item := range filter.And {
+		expressions = append(expressions, filterExpression(item))
+	}
+
+	if len(filter.Or) != 0 {
+		ors := make([]exp.Expression, 0)
+		for _, item := range filter.Or {
+			ors = append(ors, filterExpression(item))
+		}
+
+		expressions = append(expressions, database.Combine(exp.OrType, ors...))
+	}
+
+	if filter.Not != nil {
+		expressions = append(expressions, database.Not(filterExpression(*filter.Not)))
+	}
+
+	return database.Combine(exp.AndType, expressions...)
+}
+
 func (repo *sqlRepository) existByID(id uuid.UUID) (bool, error) {
 	var total int
 	err := repo.mysqlDB.Get(&total, selectCountUserQuery+" WHERE id = ?", id)
@@ -227,6 +382,11 @@ func (repo *sqlRepository) insert(data *UserDetail) error {
 			return nil, errors.New("insert user detail fails")
 		}
 
+		err = outbox.Write(tx, aggregateType, data.ID.String(), EventCreated, data)
+		if err != nil {
+			return nil, err
+		}
+
 		return nil, nil
 	})
 
@@ -246,6 +406,7 @@ func (repo *sqlRepository) update(data *UserDetail) error {
 			data.IDCardPath,
 			data.UpdatedAt,
 			data.ID,
+			data.Version,
 		)
 
 		if err != nil {
@@ -258,7 +419,14 @@ func (repo *sqlRepository) update(data *UserDetail) error {
 		}
 
 		if rowsAffected <= 0 {
-			return nil, errors.New("update user detail fails")
+			return nil, stacktrace.Propagate(database.ErrVersionConflict, "update user detail fails")
+		}
+
+		data.Version++
+
+		err = outbox.Write(tx, aggregateType, data.ID.String(), EventUpdated, data)
+		if err != nil {
+			return nil, err
 		}
 
 		return nil, nil
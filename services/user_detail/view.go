@@ -0,0 +1,156 @@
+package user_detail
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// The views are what each audience gets to see of a user detail. The device
+// token and OAuth id are credentials of the user and the storage paths are
+// internal, responses go through the views instead of UserDetail.
+
+// InternalView is a user detail as seen by internal services and operators
+type InternalView struct {
+	ID        uuid.UUID  `json:"id"`
+	DeviceOS  string     `json:"device_os"`
+	AvatarUrl string     `json:"avatar_url"`
+	Source    string     `json:"source"`
+	OAuthId   string     `json:"oauth_id"`
+	IDCardUrl string     `json:"id_card_url"`
+	DeletedAt *time.Time `json:"deleted_at"`
+	CreatedAt time.Time  `json:"created_at"`
+	UpdatedAt time.Time  `json:"updated_at"`
+	Version   int        `json:"version"`
+}
+
+// ClientView is a user detail as seen by client apps, the ID card is only
+// shown to its owner and to operators
+type ClientView struct {
+	ID        uuid.UUID `json:"id"`
+	DeviceOS  string    `json:"device_os"`
+	AvatarUrl string    `json:"avatar_url"`
+	Source    string    `json:"source"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	Version   int       `json:"version"`
+}
+
+// SelfView is a user detail as seen by the user it belongs to
+type SelfView struct {
+	ID        uuid.UUID `json:"id"`
+	DeviceOS  string    `json:"device_os"`
+	AvatarUrl string    `json:"avatar_url"`
+	Source    string    `json:"source"`
+	IDCardUrl string    `json:"id_card_url"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+type ClientUpload struct {
+	Detail       ClientView `json:"detail"`
+	Url          string     `json:"url"`
+	ThumbnailUrl string     `json:"thumbnail_url,omitempty"`
+	ExpiresAt    *time.Time `json:"expires_at,omitempty"`
+}
+
+type SelfUpload struct {
+	Detail       SelfView   `json:"detail"`
+	Url          string     `json:"url"`
+	ThumbnailUrl string     `json:"thumbnail_url,omitempty"`
+	ExpiresAt    *time.Time `json:"expires_at,omitempty"`
+}
+
+type ClientPage struct {
+	Items []ClientView `json:"items"`
+	Total int          `json:"total"`
+}
+
+type ClientCursorPage struct {
+	Items      []ClientView `json:"items"`
+	NextCursor string       `json:"next_cursor"`
+	PrevCursor string       `json:"prev_cursor"`
+	Total      *int         `json:"total,omitempty"`
+}
+
+func (u *UserDetail) InternalView() InternalView {
+	return InternalView{
+		ID:        u.ID,
+		DeviceOS:  u.DeviceOS,
+		AvatarUrl: u.AvatarUrl,
+		Source:    u.Source,
+		OAuthId:   u.OAuthId,
+		IDCardUrl: u.IDCardUrl,
+		DeletedAt: u.DeletedAt,
+		CreatedAt: u.CreatedAt,
+		UpdatedAt: u.UpdatedAt,
+		Version:   u.Version,
+	}
+}
+
+func (u *UserDetail) ClientView() ClientView {
+	return ClientView{
+		ID:        u.ID,
+		DeviceOS:  u.DeviceOS,
+		AvatarUrl: u.AvatarUrl,
+		Source:    u.Source,
+		CreatedAt: u.CreatedAt,
+		UpdatedAt: u.UpdatedAt,
+		Version:   u.Version,
+	}
+}
+
+func (u *UserDetail) SelfView() SelfView {
+	return SelfView{
+		ID:        u.ID,
+		DeviceOS:  u.DeviceOS,
+		AvatarUrl: u.AvatarUrl,
+		Source:    u.Source,
+		IDCardUrl: u.IDCardUrl,
+		CreatedAt: u.CreatedAt,
+		UpdatedAt: u.UpdatedAt,
+	}
+}
+
+func ClientViews(items []*UserDetail) []ClientView {
+	views := make([]ClientView, 0, len(items))
+	for _, item := range items {
+		views = append(views, item.ClientView())
+	}
+
+	return views
+}
+
+func (u *Upload) ClientView() ClientUpload {
+	return ClientUpload{
+		Detail:       u.Detail.ClientView(),
+		Url:          u.Url,
+		ThumbnailUrl: u.ThumbnailUrl,
+		ExpiresAt:    u.ExpiresAt,
+	}
+}
+
+func (u *Upload) SelfView() SelfUpload {
+	return SelfUpload{
+		Detail:       u.Detail.SelfView(),
+		Url:          u.Url,
+		ThumbnailUrl: u.ThumbnailUrl,
+		ExpiresAt:    u.ExpiresAt,
+	}
+}
+
+func (p Page) ClientView() ClientPage {
+	return ClientPage{
+		Items: ClientViews(p.Items),
+		Total: p.Total,
+	}
+}
+
+func (p CursorPage) ClientView() ClientCursorPage {
+	return ClientCursorPage{
+		Items:      ClientViews(p.Items),
+		NextCursor: p.NextCursor,
+		PrevCursor: p.PrevCursor,
+		Total:      p.Total,
+	}
+}
@@ -0,0 +1,56 @@
+package user_detail
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+// secretFields are credentials of the user or internal storage paths, no view
+// shows them
+var secretFields = []string{`"device_token"`, `"avatar_path"`, `"id_card_path"`}
+
+func TestViewsHideSecrets(t *testing.T) {
+	id := uuid.New()
+	item := New(id, "device-token", "ios", "web", "google-oauth-id")
+	item.SetAvatar("https://cdn.example.com/avatar.png", avatarPrefix+id.String()+"/avatar.png")
+	item.SetIDCard("https://cdn.example.com/id-card.png?signature=x", idCardPrefix+id.String()+"/id-card.png")
+	upload := &Upload{Detail: item, Url: item.AvatarUrl}
+	total := 1
+
+	tests := []struct {
+		name      string
+		view      interface{}
+		withOAuth bool
+	}{
+		{"InternalView", item.InternalView(), true},
+		{"ClientView", item.ClientView(), false},
+		{"ClientViews", ClientViews([]*UserDetail{item}), false},
+		{"ClientPage", Page{Items: []*UserDetail{item}, Total: 1}.ClientView(), false},
+		{"ClientCursorPage", CursorPage{Items: []*UserDetail{item}, Total: &total}.ClientView(), false},
+		{"ClientUpload", upload.ClientView(), false},
+		{"SelfView", item.SelfView(), false},
+		{"SelfUpload", upload.SelfView(), false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			data, err := json.Marshal(test.view)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			for _, field := range secretFields {
+				if strings.Contains(string(data), field) {
+					t.Errorf("%s leaked in %s", field, data)
+				}
+			}
+
+			if strings.Contains(string(data), `"oauth_id"`) != test.withOAuth {
+				t.Errorf(`"oauth_id" presence should be %v in %s`, test.withOAuth, data)
+			}
+		})
+	}
+}
@@ -0,0 +1,93 @@
+package user_export
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+)
+
+type encoder interface {
+	encode(row *Row) error
+	// flush pushes the buffered rows through to the client
+	flush() error
+}
+
+func newEncoder(w io.Writer, format string, includePasswordHash bool) (encoder, error) {
+	if format == FormatCSV {
+		writer := csv.NewWriter(w)
+		err := writer.Write(Columns(includePasswordHash))
+		if err != nil {
+			return nil, err
+		}
+
+		return &csvEncoder{w: w, writer: writer, includePasswordHash: includePasswordHash}, nil
+	}
+
+	buffer := bufio.NewWriter(w)
+	return &ndjsonEncoder{w: w, buffer: buffer, encoder: json.NewEncoder(buffer)}, nil
+}
+
+type csvEncoder struct {
+	w                   io.Writer
+	writer              *csv.Writer
+	includePasswordHash bool
+}
+
+func (e *csvEncoder) encode(row *Row) error {
+	record := row.Record(e.includePasswordHash)
+	for i, cell := range record {
+		record[i] = escapeFormula(cell)
+	}
+
+	return e.writer.Write(record)
+}
+
+func (e *csvEncoder) flush() error {
+	e.writer.Flush()
+	err := e.writer.Error()
+	if err != nil {
+		return err
+	}
+
+	flushHTTP(e.w)
+	return nil
+}
+
+type ndjsonEncoder struct {
+	w       io.Writer
+	buffer  *bufio.Writer
+	encoder *json.Encoder
+}
+
+func (e *ndjsonEncoder) encode(row *Row) error {
+	return e.encoder.Encode(row)
+}
+
+func (e *ndjsonEncoder) flush() error {
+	err := e.buffer.Flush()
+	if err != nil {
+		return err
+	}
+
+	flushHTTP(e.w)
+	return nil
+}
+
+// escapeFormula prefixes a cell a spreadsheet would run as a formula with a
+// quote, so user input like =HYPERLINK(...) is shown as text
+func escapeFormula(cell string) string {
+	if cell != "" && strings.ContainsRune("=+-@\t\r", rune(cell[0])) {
+		return "'" + cell
+	}
+
+	return cell
+}
+
+func flushHTTP(w io.Writer) {
+	if flusher, ok := w.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
@@ -0,0 +1,84 @@
+package user_export
+
+import (
+	"errors"
+	"io"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+	"github.com/palantir/stacktrace"
+
+	"stark/respond"
+	"stark/services/user"
+	"stark/utils"
+	"stark/utils/activity"
+	"stark/utils/log"
+)
+
+type Handler struct {
+	service *Service
+}
+
+func NewHandler(service *Service) *Handler {
+	return &Handler{service: service}
+}
+
+// HandleExport streams every user matching the filter in the body, an empty
+// body exports all users.
+func (h *Handler) HandleExport(c *gin.Context) {
+	ctx := activity.NewContext("user_export")
+	ctx = activity.WithInternalID(ctx, c.Value("internal_id").(string))
+	trx, _ := activity.GetTransactionID(ctx)
+	format := c.DefaultQuery("format", FormatNDJSON)
+	if !IsFormat(format) {
+		respond.Error(c, trx, http.StatusBadRequest, respond.ErrBadRequest, "invalid format, use ndjson or csv")
+		return
+	}
+
+	includePasswordHash := c.Query("include_password_hash") == "true"
+	var input user.Filter
+
+	if err := c.ShouldBindJSON(&input); err != nil && !errors.Is(err, io.EOF) {
+		var validationErrors validator.ValidationErrors
+		if errors.As(err, &validationErrors) {
+			out := make([]utils.ErrorMessage, 0)
+			for _, validationError := range validationErrors {
+				out = append(out, utils.ErrorMessage{
+					Field:   utils.ToSnakeCase(validationError.Field()),
+					Message: utils.GetErrorMessage(validationError),
+				})
+			}
+
+			respond.Invalid(c, trx, http.StatusBadRequest, out)
+			return
+		}
+
+		respond.Error(c, trx, http.StatusBadRequest, respond.ErrBadRequest, "invalid filter")
+		return
+	}
+
+	contentType := "application/x-ndjson"
+	if format == FormatCSV {
+		contentType = "text/csv; charset=utf-8"
+	}
+
+	c.Header("Content-Type", contentType)
+	c.Header("Content-Disposition", `attachment; filename="users.`+format+`"`)
+	c.Status(http.StatusOK)
+
+	total, err := h.service.Export(c.Writer, input, format, includePasswordHash)
+	if err != nil {
+		// Once rows are sent the status can't change anymore, the client sees
+		// a truncated export
+		if c.Writer.Written() {
+			log.WithContext(ctx).Error(stacktrace.Propagate(err, "export users error after %d rows", total))
+			return
+		}
+
+		log.WithContext(ctx).Error(stacktrace.Propagate(err, "export users error"))
+		c.Header("Content-Type", "application/json")
+		c.Header("Content-Disposition", "")
+		respond.Error(c, trx, http.StatusInternalServerError, respond.ErrInternal, "unknown error")
+	}
+}
@@ -0,0 +1,111 @@
+package user_export
+
+import "time"
+
+const (
+	FormatNDJSON = "ndjson"
+	FormatCSV    = "csv"
+)
+
+// Row is a user joined with its detail and location. The columns carry the
+// names of the user import, so an export can be imported again.
+type Row struct {
+	ID              string     `json:"id" db:"id"`
+	Name            string     `json:"name" db:"name"`
+	Email           string     `json:"email" db:"email"`
+	Username        string     `json:"username" db:"username"`
+	Contact         string     `json:"contact" db:"contact"`
+	PasswordHash    string     `json:"password_hash,omitempty" db:"password"`
+	Status          string     `json:"status" db:"status"`
+	EmailVerifiedAt *time.Time `json:"email_verified_at" db:"email_verified_at"`
+	CreatedAt       time.Time  `json:"created_at" db:"created_at"`
+	UpdatedAt       time.Time  `json:"updated_at" db:"updated_at"`
+
+	DeviceToken *string `json:"device_token" db:"device_token"`
+	DeviceOS    *string `json:"device_os" db:"device_os"`
+	AvatarUrl   *string `json:"avatar_url" db:"avatar_url"`
+	AvatarPath  *string `json:"avatar_path" db:"avatar_path"`
+	Source      *string `json:"source" db:"source"`
+	OAuthId     *string `json:"oauth_id" db:"oauth_id"`
+	IDCardUrl   *string `json:"id_card_url" db:"id_card_url"`
+	IDCardPath  *string `json:"id_card_path" db:"id_card_path"`
+
+	ProvinceID *string `json:"province_id" db:"province_id"`
+	RegencyID  *string `json:"regency_id" db:"regency_id"`
+	DistrictID *string `json:"district_id" db:"district_id"`
+	VillageID  *string `json:"village_id" db:"village_id"`
+}
+
+// Columns are the CSV headers of the export
+func Columns(includePasswordHash bool) []string {
+	columns := []string{"id", "name", "email", "username", "contact"}
+	if includePasswordHash {
+		columns = append(columns, "password_hash")
+	}
+
+	return append(columns,
+		"status",
+		"email_verified_at",
+		"created_at",
+		"updated_at",
+		"device_token",
+		"device_os",
+		"avatar_url",
+		"avatar_path",
+		"source",
+		"oauth_id",
+		"id_card_url",
+		"id_card_path",
+		"province_id",
+		"regency_id",
+		"district_id",
+		"village_id",
+	)
+}
+
+// Record is the row as CSV values in the order of Columns
+func (r *Row) Record(includePasswordHash bool) []string {
+	record := []string{r.ID, r.Name, r.Email, r.Username, r.Contact}
+	if includePasswordHash {
+		record = append(record, r.PasswordHash)
+	}
+
+	return append(record,
+		r.Status,
+		formatTime(r.EmailVerifiedAt),
+		formatTime(&r.CreatedAt),
+		formatTime(&r.UpdatedAt),
+		value(r.DeviceToken),
+		value(r.DeviceOS),
+		value(r.AvatarUrl),
+		value(r.AvatarPath),
+		value(r.Source),
+		value(r.OAuthId),
+		value(r.IDCardUrl),
+		value(r.IDCardPath),
+		value(r.ProvinceID),
+		value(r.RegencyID),
+		value(r.DistrictID),
+		value(r.VillageID),
+	)
+}
+
+func IsFormat(format string) bool {
+	return format == FormatNDJSON || format == FormatCSV
+}
+
+func value(s *string) string {
+	if s == nil {
+		return ""
+	}
+
+	return *s
+}
+
+func formatTime(t *time.Time) string {
+	if t == nil {
+		return ""
+	}
+
+	return t.Format(time.RFC3339)
+}
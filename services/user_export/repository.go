@@ -0,0 +1,9 @@
+package user_export
+
+import "stark/services/user"
+
+type Repository interface {
+	// Stream calls fn with each user matching the filter, one row in memory
+	// at a time. An error from fn stops the stream.
+	Stream(filter user.Filter, fn func(row *Row) error) error
+}
@@ -0,0 +1,52 @@
+package user_export
+
+import (
+	"io"
+
+	"stark/services/user"
+)
+
+// Rows are flushed to the client every flushInterval rows
+const flushInterval = 500
+
+type Service struct {
+	repo Repository
+}
+
+func NewService(repo Repository) *Service {
+	return &Service{repo: repo}
+}
+
+// Export streams the users matching the filter to w and returns how many were
+// written. Password hashes are left out unless includePasswordHash is set.
+func (s *Service) Export(w io.Writer, filter user.Filter, format string, includePasswordHash bool) (int, error) {
+	encoder, err := newEncoder(w, format, includePasswordHash)
+	if err != nil {
+		return 0, err
+	}
+
+	total := 0
+	err = s.repo.Stream(filter, func(row *Row) error {
+		if !includePasswordHash {
+			row.PasswordHash = ""
+		}
+
+		err := encoder.encode(row)
+		if err != nil {
+			return err
+		}
+
+		total++
+		if total%flushInterval == 0 {
+			return encoder.flush()
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return total, err
+	}
+
+	return total, encoder.flush()
+}
@@ -0,0 +1,118 @@
+package user_export
+
+import (
+	"github.com/doug-martin/goqu/v9"
+	_ "github.com/doug-martin/goqu/v9/dialect/mysql"
+	"github.com/doug-martin/goqu/v9/exp"
+	"github.com/palantir/stacktrace"
+
+	"stark/database"
+	"stark/services/user"
+)
+
+type sqlRepository struct {
+	mysqlDB *database.MySQL
+}
+
+func NewSQLRepository(mysqlDB *database.MySQL) Repository {
+	return &sqlRepository{mysqlDB: mysqlDB}
+}
+
+func (repo *sqlRepository) Stream(filter user.Filter, fn func(row *Row) error) error {
+	sql, err := streamQuery(filter)
+	if err != nil {
+		return err
+	}
+
+	rows, err := repo.mysqlDB.Queryx(sql)
+	if err != nil {
+		return stacktrace.Propagate(err, "select rows fails")
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var row Row
+		err = rows.StructScan(&row)
+		if err != nil {
+			return stacktrace.Propagate(err, "can't read user export row")
+		}
+
+		err = fn(&row)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return stacktrace.Propagate(err, "select rows fails")
+	}
+
+	return nil
+}
+
+func streamQuery(filter user.Filter) (string, error) {
+	dialect := goqu.Dialect("mysql")
+
+	// The filter columns aren't qualified, so it is applied to users alone
+	// before the detail and location are joined
+	users := dialect.From("users").Where(
+		goqu.Ex{"deleted_at": nil},
+		filter.Expression(),
+	)
+
+	dataset := dialect.From(users.As("u")).
+		Select(
+			goqu.I("u.id"),
+			goqu.I("u.name"),
+			goqu.I("u.email"),
+			goqu.I("u.username"),
+			goqu.I("u.contact"),
+			goqu.I("u.password"),
+			goqu.I("u.status"),
+			goqu.I("u.email_verified_at"),
+			goqu.I("u.created_at"),
+			goqu.I("u.updated_at"),
+			goqu.I("d.device_token"),
+			goqu.I("d.device_os"),
+			goqu.I("d.avatar_url"),
+			goqu.I("d.avatar_path"),
+			goqu.I("d.source"),
+			goqu.I("d.oauth_id"),
+			goqu.I("d.id_card_url"),
+			goqu.I("d.id_card_path"),
+			goqu.I("l.province_id"),
+			goqu.I("l.regency_id"),
+			goqu.I("l.district_id"),
+			goqu.I("l.village_id"),
+		).
+		LeftJoin(
+			goqu.T("user_details").As("d"),
+			goqu.On(goqu.Ex{"d.id": goqu.I("u.id"), "d.deleted_at": nil}),
+		).
+		LeftJoin(
+			goqu.T("user_locations").As("l"),
+			goqu.On(goqu.Ex{"l.id": goqu.I("u.id"), "l.deleted_at": nil}),
+		)
+
+	for _, sort := range filter.Sort {
+		dataset = dataset.OrderAppend(order(sort.Field, sort.Direction))
+	}
+
+	dataset = dataset.OrderAppend(goqu.I("u.created_at").Asc(), goqu.I("u.id").Asc())
+
+	sql, _, err := dataset.ToSQL()
+	if err != nil {
+		return "", stacktrace.Propagate(err, "sql error")
+	}
+
+	return sql, nil
+}
+
+func order(column, direction string) exp.OrderedExpression {
+	if direction == database.SortDesc {
+		return goqu.T("u").Col(column).Desc()
+	}
+
+	return goqu.T("u").Col(column).Asc()
+}
@@ -0,0 +1,84 @@
+package user_import
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/palantir/stacktrace"
+
+	"stark/failure"
+	"stark/respond"
+	"stark/services/profile_trail"
+	"stark/utils/activity"
+	"stark/utils/log"
+)
+
+type Handler struct {
+	service *Service
+}
+
+func NewHandler(service *Service) *Handler {
+	return &Handler{service: service}
+}
+
+// HandleCreate takes the import file as the raw request body and answers
+// with the job to poll, the rows are imported in the background.
+func (h *Handler) HandleCreate(c *gin.Context) {
+	ctx := activity.NewContext("user_import_create")
+	ctx = activity.WithClientID(ctx, c.Value("client_id").(string))
+	trx, _ := activity.GetTransactionID(ctx)
+	clientID, _ := activity.GetClientID(ctx)
+	format := c.DefaultQuery("format", FormatCSV)
+	if !IsFormat(format) {
+		respond.Error(c, trx, http.StatusBadRequest, respond.ErrBadRequest, "invalid format, use csv or ndjson")
+		return
+	}
+
+	onDuplicate := c.DefaultQuery("on_duplicate", DuplicateFail)
+	if !IsDuplicatePolicy(onDuplicate) {
+		respond.Error(c, trx, http.StatusBadRequest, respond.ErrBadRequest, "invalid on_duplicate, use skip, update or fail")
+		return
+	}
+
+	dryRun := c.Query("dry_run") == "true"
+	body := http.MaxBytesReader(c.Writer, c.Request.Body, MaxSize())
+	origin := profile_trail.NewOrigin(ctx, c.ClientIP(), c.Request.UserAgent())
+	job, err := h.service.CreateJob(origin, clientID, format, onDuplicate, dryRun, body)
+	if err != nil {
+		var maxBytesError *http.MaxBytesError
+		if errors.As(err, &maxBytesError) {
+			respond.Error(c, trx, http.StatusRequestEntityTooLarge, respond.ErrBadRequest, "import file is too large")
+			return
+		}
+
+		log.WithContext(ctx).Error(stacktrace.Propagate(err, "create import job error"))
+		respond.Error(c, trx, http.StatusInternalServerError, respond.ErrInternal, "unknown error")
+		return
+	}
+
+	respond.Success(c, trx, http.StatusAccepted, job)
+}
+
+func (h *Handler) HandleDetail(c *gin.Context) {
+	ctx := activity.NewContext("user_import_detail")
+	ctx = activity.WithClientID(ctx, c.Value("client_id").(string))
+	trx, _ := activity.GetTransactionID(ctx)
+	clientID, _ := activity.GetClientID(ctx)
+	job, err := h.service.FindJob(clientID, c.Param("id"))
+	if err != nil {
+		if f, ok := stacktrace.RootCause(err).(failure.Failure); ok {
+			switch f.Code {
+			case failure.CodeImportNotFound:
+				respond.Error(c, trx, http.StatusNotFound, f.Code, f.Desc)
+				return
+			}
+		}
+
+		log.WithContext(ctx).Error(stacktrace.Propagate(err, "get import job error"))
+		respond.Error(c, trx, http.StatusInternalServerError, respond.ErrInternal, "unknown error")
+		return
+	}
+
+	respond.Success(c, trx, http.StatusOK, job)
+}
@@ -0,0 +1,33 @@
+package user_import
+
+// Row is one user of an import file, CSV headers use the JSON names. Either
+// password or password_hash, a bcrypt hash from another system, is required.
+type Row struct {
+	Name         string `json:"name" binding:"required"`
+	Email        string `json:"email" binding:"required,email"`
+	Username     string `json:"username" binding:"required"`
+	Contact      string `json:"contact" binding:"required"`
+	Password     string `json:"password" binding:"required_without=PasswordHash,excluded_with=PasswordHash"`
+	PasswordHash string `json:"password_hash"`
+
+	DeviceToken string `json:"device_token"`
+	DeviceOS    string `json:"device_os"`
+	Source      string `json:"source"`
+	OAuthId     string `json:"oauth_id"`
+
+	ProvinceID string `json:"province_id"`
+	RegencyID  string `json:"regency_id"`
+	DistrictID string `json:"district_id"`
+	VillageID  string `json:"village_id"`
+}
+
+func (r *Row) HasDetail() bool {
+	return r.DeviceToken != "" ||
+		r.DeviceOS != "" ||
+		r.Source != "" ||
+		r.OAuthId != ""
+}
+
+func (r *Row) HasLocation() bool {
+	return r.ProvinceID != "" || r.RegencyID != "" || r.DistrictID != "" || r.VillageID != ""
+}
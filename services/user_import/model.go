@@ -0,0 +1,113 @@
+package user_import
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+
+	"stark/services/profile_trail"
+)
+
+const (
+	FormatCSV    = "csv"
+	FormatNDJSON = "ndjson"
+
+	// OnDuplicate policies for rows whose email or username already exists
+	DuplicateSkip   = "skip"
+	DuplicateUpdate = "update"
+	DuplicateFail   = "fail"
+
+	StatusPending   = "pending"
+	StatusRunning   = "running"
+	StatusCompleted = "completed"
+	StatusFailed    = "failed"
+
+	// maxReportedErrors caps the row errors kept in the job report, the
+	// counters still include every row.
+	maxReportedErrors = 1000
+)
+
+type RowError struct {
+	Line    int    `json:"line"`
+	Field   string `json:"field,omitempty"`
+	Message string `json:"message"`
+}
+
+// Job is an asynchronous import, in a dry run the counters tell what the
+// import would do without writing anything.
+type Job struct {
+	ID          string     `json:"id"`
+	ClientID    string     `json:"client_id"`
+	Format      string     `json:"format"`
+	OnDuplicate string     `json:"on_duplicate"`
+	DryRun      bool       `json:"dry_run"`
+	Status      string     `json:"status"`
+	Total       int        `json:"total"`
+	Created     int        `json:"created"`
+	Updated     int        `json:"updated"`
+	Skipped     int        `json:"skipped"`
+	Failed      int        `json:"failed"`
+	Errors      []RowError `json:"errors"`
+	Error       string     `json:"error,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+	CompletedAt *time.Time `json:"completed_at"`
+	ExpiresAt   time.Time  `json:"expires_at"`
+
+	// origin is the request that created the job, the profile trails of the
+	// imported rows point to it
+	origin profile_trail.Origin
+}
+
+func NewJob(origin profile_trail.Origin, clientID, format, onDuplicate string, dryRun bool, ttl time.Duration) *Job {
+	now := time.Now()
+
+	return &Job{
+		ID:          uuid.New().String(),
+		ClientID:    clientID,
+		Format:      format,
+		OnDuplicate: onDuplicate,
+		DryRun:      dryRun,
+		Status:      StatusPending,
+		Errors:      make([]RowError, 0),
+		CreatedAt:   now,
+		ExpiresAt:   now.Add(ttl),
+		origin:      origin,
+	}
+}
+
+func (j *Job) Start() {
+	j.Status = StatusRunning
+}
+
+func (j *Job) Complete() {
+	now := time.Now()
+	j.Status = StatusCompleted
+	j.CompletedAt = &now
+}
+
+func (j *Job) Fail(err error) {
+	now := time.Now()
+	j.Status = StatusFailed
+	j.Error = err.Error()
+	j.CompletedAt = &now
+}
+
+// RejectRow counts a failed row and keeps its errors for the report
+func (j *Job) RejectRow(errs ...RowError) {
+	j.Failed++
+	for _, item := range errs {
+		if len(j.Errors) >= maxReportedErrors {
+			return
+		}
+
+		j.Errors = append(j.Errors, item)
+	}
+}
+
+func IsFormat(format string) bool {
+	return format == FormatCSV || format == FormatNDJSON
+}
+
+func IsDuplicatePolicy(policy string) bool {
+	return policy == DuplicateSkip || policy == DuplicateUpdate || policy == DuplicateFail
+}
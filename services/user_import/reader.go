@@ -0,0 +1,156 @@
+package user_import
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"io"
+	"reflect"
+	"strings"
+
+	"stark/utils"
+)
+
+const maxNDJSONLine = 1 << 20
+
+// rowColumns are the CSV headers an import accepts, the JSON names of Row
+var rowColumns = func() map[string]bool {
+	columns := make(map[string]bool)
+	rowType := reflect.TypeOf(Row{})
+	for i := 0; i < rowType.NumField(); i++ {
+		columns[rowType.Field(i).Tag.Get("json")] = true
+	}
+
+	return columns
+}()
+
+// rowError is a problem with a single row, the import goes on with the next
+// one. Any other error from a reader stops the import.
+type rowError struct {
+	field   string
+	message string
+}
+
+func (e rowError) Error() string {
+	return e.message
+}
+
+type rowReader interface {
+	// next returns the line of the row and io.EOF after the last row
+	next() (int, *Row, error)
+}
+
+func newRowReader(format string, r io.Reader) (rowReader, error) {
+	if format == FormatNDJSON {
+		scanner := bufio.NewScanner(r)
+		scanner.Buffer(make([]byte, 64*1024), maxNDJSONLine)
+		return &ndjsonReader{scanner: scanner}, nil
+	}
+
+	return newCSVReader(r)
+}
+
+type csvReader struct {
+	reader  *csv.Reader
+	columns []string
+}
+
+func newCSVReader(r io.Reader) (*csvReader, error) {
+	reader := csv.NewReader(r)
+	reader.TrimLeadingSpace = true
+	header, err := reader.Read()
+	if err == io.EOF {
+		return nil, errors.New("csv file is empty, a header row is required")
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	columns := make([]string, len(header))
+	for i, column := range header {
+		column = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(column, "\ufeff")))
+		if !rowColumns[column] {
+			return nil, errors.New("unknown csv column " + column)
+		}
+
+		columns[i] = column
+	}
+
+	for _, column := range []string{"name", "email", "username", "contact"} {
+		if !utils.IsInList(columns, column) {
+			return nil, errors.New("csv column " + column + " is required")
+		}
+	}
+
+	return &csvReader{reader: reader, columns: columns}, nil
+}
+
+func (c *csvReader) next() (int, *Row, error) {
+	record, err := c.reader.Read()
+	if err == io.EOF {
+		return 0, nil, io.EOF
+	}
+
+	if err != nil {
+		var parseError *csv.ParseError
+		if errors.As(err, &parseError) {
+			return parseError.StartLine, nil, rowError{message: parseError.Err.Error()}
+		}
+
+		return 0, nil, err
+	}
+
+	line, _ := c.reader.FieldPos(0)
+	values := make(map[string]string, len(c.columns))
+	for i, column := range c.columns {
+		values[column] = strings.TrimSpace(record[i])
+	}
+
+	data, err := json.Marshal(values)
+	if err != nil {
+		return line, nil, err
+	}
+
+	var row Row
+	err = json.Unmarshal(data, &row)
+	if err != nil {
+		return line, nil, err
+	}
+
+	return line, &row, nil
+}
+
+type ndjsonReader struct {
+	scanner *bufio.Scanner
+	line    int
+}
+
+func (n *ndjsonReader) next() (int, *Row, error) {
+	for n.scanner.Scan() {
+		n.line++
+		text := bytes.TrimSpace(n.scanner.Bytes())
+		if len(text) == 0 {
+			continue
+		}
+
+		decoder := json.NewDecoder(bytes.NewReader(text))
+		decoder.DisallowUnknownFields()
+		var row Row
+		err := decoder.Decode(&row)
+		if err != nil {
+			return n.line, nil, rowError{message: "invalid json, " + err.Error()}
+		}
+
+		return n.line, &row, nil
+	}
+
+	err := n.scanner.Err()
+	if err != nil {
+		return n.line, nil, err
+	}
+
+	return 0, nil, io.EOF
+}
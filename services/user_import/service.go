@@ -0,0 +1,500 @@
+package user_import
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
+	"github.com/go-redis/redis"
+	"github.com/jmoiron/sqlx"
+	"github.com/palantir/stacktrace"
+
+	"stark/database"
+	"stark/failure"
+	"stark/services/notification"
+	"stark/services/profile_trail"
+	"stark/services/user"
+	"stark/services/user_detail"
+	"stark/services/user_location"
+	"stark/utils"
+	"stark/utils/activity"
+	"stark/utils/log"
+)
+
+const (
+	jobPrefix = "user_import:"
+
+	// The job is stored after every progressInterval rows so its status shows
+	// how far a running import is
+	progressInterval = 100
+
+	// Detail source of imported users that don't have one
+	defaultSource = "import"
+)
+
+type Service struct {
+	mysqlDB             *database.MySQL
+	redisDB             *database.Redis
+	userService         *user.Service
+	userDetailService   *user_detail.Service
+	userLocationService *user_location.Service
+	profileTrailService *profile_trail.Service
+	notificationService *notification.Service
+}
+
+func NewService(
+	mysqlDB *database.MySQL,
+	redisDB *database.Redis,
+	userService *user.Service,
+	userDetailService *user_detail.Service,
+	userLocationService *user_location.Service,
+	profileTrailService *profile_trail.Service,
+	notificationService *notification.Service,
+) *Service {
+	return &Service{
+		mysqlDB:             mysqlDB,
+		redisDB:             redisDB,
+		userService:         userService,
+		userDetailService:   userDetailService,
+		userLocationService: userLocationService,
+		profileTrailService: profileTrailService,
+		notificationService: notificationService,
+	}
+}
+
+// CreateJob spools the file to disk and imports it in the background
+func (s *Service) CreateJob(origin profile_trail.Origin, clientID, format, onDuplicate string, dryRun bool, body io.Reader) (*Job, error) {
+	job := NewJob(origin, clientID, format, onDuplicate, dryRun, jobTTL())
+	err := os.MkdirAll(importDir(), 0700)
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := os.OpenFile(importPath(job), os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = io.Copy(file, body)
+	file.Close()
+	if err != nil {
+		os.Remove(importPath(job))
+		return nil, err
+	}
+
+	err = s.storeJob(job)
+	if err != nil {
+		os.Remove(importPath(job))
+		return nil, err
+	}
+
+	go s.processJob(job)
+
+	return job, nil
+}
+
+func (s *Service) FindJob(clientID, id string) (*Job, error) {
+	job, err := s.findJob(id)
+	if err != nil {
+		return nil, err
+	}
+
+	if job.ClientID != clientID {
+		return nil, failure.WithMessage(
+			failure.CodeImportNotFound,
+			"import not found, id isn't in storage",
+		)
+	}
+
+	return job, nil
+}
+
+func (s *Service) processJob(job *Job) {
+	ctx := activity.NewContext("user_import")
+	ctx = activity.WithClientID(ctx, job.ClientID)
+	defer os.Remove(importPath(job))
+
+	job.Start()
+	err := s.storeJob(job)
+	if err != nil {
+		log.WithContext(ctx).Error(stacktrace.Propagate(err, "store import %s error", job.ID))
+	}
+
+	err = s.importFile(job)
+	if err != nil {
+		log.WithContext(ctx).Error(stacktrace.Propagate(err, "import %s error", job.ID))
+		job.Fail(err)
+	} else {
+		job.Complete()
+	}
+
+	err = s.storeJob(job)
+	if err != nil {
+		log.WithContext(ctx).Error(stacktrace.Propagate(err, "store import %s error", job.ID))
+	}
+}
+
+func (s *Service) importFile(job *Job) error {
+	file, err := os.Open(importPath(job))
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	reader, err := newRowReader(job.Format, file)
+	if err != nil {
+		return err
+	}
+
+	// Emails and usernames seen earlier in the file, keyed to their line
+	emails := make(map[string]int)
+	usernames := make(map[string]int)
+	for {
+		line, row, err := reader.next()
+		if err == io.EOF {
+			return nil
+		}
+
+		var invalid rowError
+		if errors.As(err, &invalid) {
+			job.Total++
+			job.RejectRow(RowError{Line: line, Field: invalid.field, Message: invalid.message})
+			continue
+		}
+
+		if err != nil {
+			return err
+		}
+
+		job.Total++
+		errs := s.importRow(job, line, row, emails, usernames)
+		if len(errs) != 0 {
+			job.RejectRow(errs...)
+		}
+
+		if job.Total%progressInterval == 0 {
+			err = s.storeJob(job)
+			if err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func (s *Service) importRow(job *Job, line int, row *Row, emails, usernames map[string]int) []RowError {
+	errs := validateRow(line, row)
+	if len(errs) != 0 {
+		return errs
+	}
+
+	email := strings.ToLower(row.Email)
+	if first, ok := emails[email]; ok {
+		return []RowError{{Line: line, Field: "email", Message: fmt.Sprintf("duplicate email, already on line %d", first)}}
+	}
+
+	username := strings.ToLower(row.Username)
+	if first, ok := usernames[username]; ok {
+		return []RowError{{Line: line, Field: "username", Message: fmt.Sprintf("duplicate username, already on line %d", first)}}
+	}
+
+	emails[email] = line
+	usernames[username] = line
+
+	existing, err := s.findExisting(row)
+	if err != nil {
+		return []RowError{rowFailure(job, line, err)}
+	}
+
+	if existing == nil {
+		if !job.DryRun {
+			err = s.writeRow(job, func(s *Service) error {
+				return s.createUser(job.origin, row)
+			})
+
+			if err != nil {
+				return []RowError{rowFailure(job, line, err)}
+			}
+		}
+
+		job.Created++
+		return nil
+	}
+
+	switch job.OnDuplicate {
+	case DuplicateSkip:
+		job.Skipped++
+		return nil
+	case DuplicateFail:
+		return []RowError{{Line: line, Message: "username or email exists, duplicate username or email is not allowed"}}
+	}
+
+	if existing.DeletedAt != nil {
+		return []RowError{{Line: line, Message: "user is deleted, a deleted user can't be updated"}}
+	}
+
+	if !job.DryRun {
+		err = s.writeRow(job, func(s *Service) error {
+			return s.updateUser(job.origin, existing, row)
+		})
+
+		if err != nil {
+			return []RowError{rowFailure(job, line, err)}
+		}
+	}
+
+	job.Updated++
+	return nil
+}
+
+// findExisting returns the user with the email or username of the row, or an
+// error when they belong to two different users
+func (s *Service) findExisting(row *Row) (*user.User, error) {
+	var existing *user.User
+	for _, filter := range []user.Filter{
+		{Emails: []string{row.Email}, WithDeleted: true},
+		{Usernames: []string{row.Username}, WithDeleted: true},
+	} {
+		items, err := s.userService.FindAllByFilter(filter)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, item := range items {
+			if existing != nil && existing.ID != item.ID {
+				return nil, failure.WithMessage(
+					failure.CodeUserAlreadyExist,
+					"email and username belong to different users",
+				)
+			}
+
+			existing = item
+		}
+	}
+
+	return existing, nil
+}
+
+// writeRow runs write in one transaction so the user, detail and location of
+// a row are stored together or not at all. The trails and notifications of
+// the row are held in batches until the commit.
+func (s *Service) writeRow(job *Job, write func(s *Service) error) error {
+	trails := s.profileTrailService.NewBatch()
+	notifications := s.notificationService.NewBatch()
+	_, err := s.mysqlDB.WithTransaction(func(tx *sqlx.Tx) (interface{}, error) {
+		service := *s
+		service.userService = s.userService.WithTx(tx).WithTrail(trails).WithNotifier(notifications)
+		service.userDetailService = s.userDetailService.WithTx(tx).WithTrail(trails)
+		service.userLocationService = s.userLocationService.WithTx(tx).WithTrail(trails)
+		return nil, write(&service)
+	})
+
+	if err != nil {
+		return err
+	}
+
+	err = trails.Flush()
+	if err != nil {
+		ctx := activity.NewContext("user_import_profile_trail")
+		ctx = activity.WithClientID(ctx, job.ClientID)
+		log.WithContext(ctx).Error(stacktrace.Propagate(err, "record profile trails error"))
+	}
+
+	notifications.Flush()
+	return nil
+}
+
+func (s *Service) createUser(origin profile_trail.Origin, row *Row) error {
+	var item *user.User
+	var err error
+	if row.PasswordHash != "" {
+		item, err = s.userService.CreateWithPasswordHash(
+			row.Name,
+			row.Email,
+			row.Username,
+			row.Contact,
+			row.PasswordHash,
+			user.StatusActive,
+		)
+	} else {
+		item, err = s.userService.Create(
+			row.Name,
+			row.Email,
+			row.Username,
+			row.Contact,
+			row.Password,
+			user.StatusActive,
+		)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	return s.storeRelated(origin, item, row)
+}
+
+func (s *Service) updateUser(origin profile_trail.Origin, item *user.User, row *Row) error {
+	input := user.InputPatch{
+		Name:     &row.Name,
+		Email:    &row.Email,
+		Username: &row.Username,
+		Contact:  &row.Contact,
+	}
+
+	if row.Password != "" {
+		input.Password = &row.Password
+	}
+
+	item, err := s.userService.Patch(origin, item.ID, 0, input)
+	if err != nil {
+		return err
+	}
+
+	if row.PasswordHash != "" {
+		item, err = s.userService.SetPasswordHash(origin, item.ID, row.PasswordHash)
+		if err != nil {
+			return err
+		}
+	}
+
+	return s.storeRelated(origin, item, row)
+}
+
+func (s *Service) storeRelated(origin profile_trail.Origin, item *user.User, row *Row) error {
+	if row.HasDetail() {
+		source := row.Source
+		if source == "" {
+			source = defaultSource
+		}
+
+		_, err := s.userDetailService.Update(
+			origin,
+			item.ID,
+			0,
+			row.DeviceToken,
+			row.DeviceOS,
+			source,
+			row.OAuthId,
+		)
+
+		if err != nil {
+			return err
+		}
+	}
+
+	if row.HasLocation() {
+		_, err := s.userLocationService.Update(
+			origin,
+			item.ID,
+			0,
+			row.ProvinceID,
+			row.RegencyID,
+			row.DistrictID,
+			row.VillageID,
+		)
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *Service) storeJob(job *Job) error {
+	data, err := json.Marshal(job)
+	if err != nil {
+		return err
+	}
+
+	return s.redisDB.Set(jobPrefix+job.ID, string(data), time.Until(job.ExpiresAt))
+}
+
+func (s *Service) findJob(id string) (*Job, error) {
+	data, err := s.redisDB.Get(jobPrefix + id)
+	if err != nil {
+		if stacktrace.RootCause(err) == redis.Nil {
+			return nil, failure.WithMessage(
+				failure.CodeImportNotFound,
+				"import not found, id isn't in storage",
+			)
+		}
+
+		return nil, err
+	}
+
+	var job Job
+	err = json.Unmarshal([]byte(data), &job)
+	if err != nil {
+		return nil, err
+	}
+
+	return &job, nil
+}
+
+func validateRow(line int, row *Row) []RowError {
+	errs := make([]RowError, 0)
+	err := binding.Validator.ValidateStruct(row)
+	if err != nil {
+		var validationErrors validator.ValidationErrors
+		if !errors.As(err, &validationErrors) {
+			return []RowError{{Line: line, Message: err.Error()}}
+		}
+
+		for _, validationError := range validationErrors {
+			errs = append(errs, RowError{
+				Line:    line,
+				Field:   utils.ToSnakeCase(validationError.Field()),
+				Message: utils.GetErrorMessage(validationError),
+			})
+		}
+	}
+
+	if row.PasswordHash != "" && !utils.IsPasswordHash(row.PasswordHash) {
+		errs = append(errs, RowError{Line: line, Field: "password_hash", Message: "should be a bcrypt hash"})
+	}
+
+	return errs
+}
+
+// rowFailure reports a failure as is, anything else is logged and reported
+// without details
+func rowFailure(job *Job, line int, err error) RowError {
+	if f, ok := stacktrace.RootCause(err).(failure.Failure); ok {
+		return RowError{Line: line, Message: f.Desc}
+	}
+
+	ctx := activity.NewContext("user_import")
+	ctx = activity.WithClientID(ctx, job.ClientID)
+	log.WithContext(ctx).Error(stacktrace.Propagate(err, "import %s line %d error", job.ID, line))
+	return RowError{Line: line, Message: "unknown error"}
+}
+
+func importDir() string {
+	dir := os.Getenv("IMPORT_DIR")
+	if dir == "" {
+		dir = filepath.Join(os.TempDir(), "stark-imports")
+	}
+
+	return dir
+}
+
+func importPath(job *Job) string {
+	return filepath.Join(importDir(), job.ID+"."+job.Format)
+}
+
+func jobTTL() time.Duration {
+	return utils.GetDurationEnv("IMPORT_JOB_TTL", 24*time.Hour)
+}
+
+// MaxSize is the largest import file in bytes
+func MaxSize() int64 {
+	return int64(utils.GetIntEnv("IMPORT_MAX_SIZE", 32<<20))
+}
@@ -0,0 +1,9 @@
+package user_location
+
+const (
+	aggregateType = "user_location"
+
+	EventCreated = "user_location.created"
+	EventUpdated = "user_location.updated"
+	EventDeleted = "user_location.deleted"
+)
@@ -1,9 +1,44 @@
 package user_location
 
+import "stark/database"
+
 type Filter struct {
-	IDs []string `json:"ids"`
+	IDs         []string `json:"ids"`
+	ProvinceIDs []string `json:"province_ids"`
+	RegencyIDs  []string `json:"regency_ids"`
+	DistrictIDs []string `json:"district_ids"`
+	VillageIDs  []string `json:"village_ids"`
+
+	CreatedAt *database.TimeRange `json:"created_at"`
+	UpdatedAt *database.TimeRange `json:"updated_at"`
+
+	// And, Or and Not combine nested filters with the criteria above
+	And []Filter `json:"and" binding:"omitempty,dive"`
+	Or  []Filter `json:"or" binding:"omitempty,dive"`
+	Not *Filter  `json:"not"`
+
+	Sort []Sort `json:"sort" binding:"omitempty,max=5,dive"`
+
+	// WithDeleted includes soft-deleted records, e.g. for uniqueness checks.
+	WithDeleted bool `json:"-"`
+}
+
+type Sort struct {
+	Field     string `json:"field" binding:"required,oneof=province_id regency_id district_id village_id created_at updated_at"`
+	Direction string `json:"direction" binding:"omitempty,oneof=asc desc"`
 }
 
+// IsEmpty reports whether the filter has no criteria, sorting alone does not
+// count.
 func (f Filter) IsEmpty() bool {
-	return len(f.IDs) == 0
+	return len(f.IDs) == 0 &&
+		len(f.ProvinceIDs) == 0 &&
+		len(f.RegencyIDs) == 0 &&
+		len(f.DistrictIDs) == 0 &&
+		len(f.VillageIDs) == 0 &&
+		f.CreatedAt == nil &&
+		f.UpdatedAt == nil &&
+		len(f.And) == 0 &&
+		len(f.Or) == 0 &&
+		f.Not == nil
 }
@@ -1,17 +1,21 @@
 package user_location
 
 import (
+	"encoding/json"
 	"errors"
 	"net/http"
 	"strconv"
 
 	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
 	"github.com/go-playground/validator/v10"
 	"github.com/google/uuid"
 	"github.com/palantir/stacktrace"
 
+	"stark/database"
 	"stark/failure"
 	"stark/respond"
+	"stark/services/profile_trail"
 	"stark/utils"
 	"stark/utils/activity"
 	"stark/utils/log"
@@ -53,7 +57,9 @@ func (h *Handler) HandleCreate(c *gin.Context) {
 		return
 	}
 
+	origin := profile_trail.NewOrigin(ctx, c.ClientIP(), c.Request.UserAgent())
 	user, err := h.service.Create(
+		origin,
 		userID,
 		input.ProvinceID,
 		input.RegencyID,
@@ -75,7 +81,7 @@ func (h *Handler) HandleCreate(c *gin.Context) {
 		return
 	}
 
-	respond.Success(c, trx, http.StatusCreated, user)
+	respond.Success(c, trx, http.StatusCreated, user.ClientView())
 }
 
 func (h *Handler) HandleDetail(c *gin.Context) {
@@ -103,7 +109,8 @@ func (h *Handler) HandleDetail(c *gin.Context) {
 		return
 	}
 
-	respond.Success(c, trx, http.StatusOK, user)
+	c.Header("ETag", utils.FormatETag(user.Version))
+	respond.Success(c, trx, http.StatusOK, user.ClientView())
 }
 
 func (h *Handler) HandleUpdate(c *gin.Context) {
@@ -134,8 +141,11 @@ func (h *Handler) HandleUpdate(c *gin.Context) {
 		return
 	}
 
+	origin := profile_trail.NewOrigin(ctx, c.ClientIP(), c.Request.UserAgent())
 	user, err := h.service.Update(
+		origin,
 		userDetailID,
+		c.GetInt("version"),
 		input.ProvinceID,
 		input.RegencyID,
 		input.DistrictID,
@@ -148,6 +158,9 @@ func (h *Handler) HandleUpdate(c *gin.Context) {
 			case failure.CodeUserNotFound:
 				respond.Error(c, trx, http.StatusBadRequest, f.Code, f.Desc)
 				return
+			case failure.CodeVersionConflict:
+				respond.Error(c, trx, http.StatusPreconditionFailed, f.Code, f.Desc)
+				return
 			}
 		}
 
@@ -156,7 +169,75 @@ func (h *Handler) HandleUpdate(c *gin.Context) {
 		return
 	}
 
-	respond.Success(c, trx, http.StatusCreated, user)
+	c.Header("ETag", utils.FormatETag(user.Version))
+	respond.Success(c, trx, http.StatusCreated, user.ClientView())
+}
+
+// HandlePatch applies a JSON Merge Patch (RFC 7396), only the fields present
+// in the body are validated and written.
+func (h *Handler) HandlePatch(c *gin.Context) {
+	ctx := activity.NewContext("user_location_patch")
+	ctx = activity.WithClientID(ctx, c.Value("client_id").(string))
+	trx, _ := activity.GetTransactionID(ctx)
+	userLocationID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		respond.Error(c, trx, http.StatusBadRequest, respond.ErrBadRequest, "invalid user location id")
+		return
+	}
+
+	var input InputPatch
+
+	if err := c.ShouldBindBodyWith(&input, binding.JSON); err != nil {
+		var validationErrors validator.ValidationErrors
+		if errors.As(err, &validationErrors) {
+			out := make([]utils.ErrorMessage, 0)
+			for _, validationError := range validationErrors {
+				out = append(out, utils.ErrorMessage{
+					Field:   utils.ToSnakeCase(validationError.Field()),
+					Message: utils.GetErrorMessage(validationError),
+				})
+			}
+
+			respond.Invalid(c, trx, http.StatusBadRequest, out)
+			return
+		}
+
+		respond.Error(c, trx, http.StatusBadRequest, respond.ErrBadRequest, "invalid merge patch document")
+		return
+	}
+
+	var fields map[string]json.RawMessage
+	if err := c.ShouldBindBodyWith(&fields, binding.JSON); err != nil {
+		respond.Error(c, trx, http.StatusBadRequest, respond.ErrBadRequest, "invalid merge patch document")
+		return
+	}
+
+	if out := input.ApplyNulls(utils.NullFields(fields)); len(out) != 0 {
+		respond.Invalid(c, trx, http.StatusBadRequest, out)
+		return
+	}
+
+	origin := profile_trail.NewOrigin(ctx, c.ClientIP(), c.Request.UserAgent())
+	item, err := h.service.Patch(origin, userLocationID, c.GetInt("version"), input)
+	if err != nil {
+		if f, ok := stacktrace.RootCause(err).(failure.Failure); ok {
+			switch f.Code {
+			case failure.CodeUserNotFound:
+				respond.Error(c, trx, http.StatusBadRequest, f.Code, f.Desc)
+				return
+			case failure.CodeVersionConflict:
+				respond.Error(c, trx, http.StatusPreconditionFailed, f.Code, f.Desc)
+				return
+			}
+		}
+
+		log.WithContext(ctx).Error(stacktrace.Propagate(err, "patch user location error"))
+		respond.Error(c, trx, http.StatusInternalServerError, respond.ErrInternal, "unknown error")
+		return
+	}
+
+	c.Header("ETag", utils.FormatETag(item.Version))
+	respond.Success(c, trx, http.StatusOK, item.ClientView())
 }
 
 func (h *Handler) HandleAllByFilter(c *gin.Context) {
@@ -187,7 +268,7 @@ func (h *Handler) HandleAllByFilter(c *gin.Context) {
 		return
 	}
 
-	respond.Success(c, trx, http.StatusCreated, tenant)
+	respond.Success(c, trx, http.StatusCreated, ClientViews(tenant))
 }
 
 func (h *Handler) HandlePage(c *gin.Context) {
@@ -215,11 +296,43 @@ func (h *Handler) HandlePage(c *gin.Context) {
 		}
 	}
 
+	// A cursor query, empty for the first page, switches to keyset pagination
+	if cursor, ok := c.GetQuery("cursor"); ok {
+		total := c.DefaultQuery("total", database.TotalNone)
+		if !utils.IsInList([]string{database.TotalNone, database.TotalExact, database.TotalApproximate}, total) {
+			respond.Error(c, trx, http.StatusBadRequest, respond.ErrBadRequest, "invalid total, should be one of none exact approximate")
+			return
+		}
+
+		if limit <= 0 {
+			respond.Error(c, trx, http.StatusBadRequest, respond.ErrBadRequest, "invalid limit")
+			return
+		}
+
+		cursorPage, err := h.service.FindCursorPage(cursor, limit, total)
+		if err != nil {
+			if f, ok := stacktrace.RootCause(err).(failure.Failure); ok {
+				switch f.Code {
+				case failure.CodeInvalidCursor:
+					respond.Error(c, trx, http.StatusBadRequest, f.Code, f.Desc)
+					return
+				}
+			}
+
+			log.WithContext(ctx).Error(stacktrace.Propagate(err, "get user location cursor page error"))
+			respond.Error(c, trx, http.StatusInternalServerError, respond.ErrInternal, "unknown error")
+			return
+		}
+
+		respond.Success(c, trx, http.StatusOK, cursorPage.ClientView())
+		return
+	}
+
 	tenantPage, err := h.service.FindPage(page, limit)
 	if err != nil {
 		respond.Error(c, trx, http.StatusBadRequest, respond.ErrInternal, err.Error())
 		return
 	}
 
-	respond.Success(c, trx, http.StatusOK, tenantPage)
+	respond.Success(c, trx, http.StatusOK, tenantPage.ClientView())
 }
@@ -1,5 +1,7 @@
 package user_location
 
+import "stark/utils"
+
 type Input struct {
 	ID         string `json:"id" binding:"required"`
 	ProvinceID string `json:"province_id"`
@@ -7,3 +9,30 @@ type Input struct {
 	DistrictID string `json:"district_id"`
 	VillageID  string `json:"village_id"`
 }
+
+// InputPatch is a JSON Merge Patch, nil fields are left untouched
+type InputPatch struct {
+	ProvinceID *string `json:"province_id"`
+	RegencyID  *string `json:"regency_id"`
+	DistrictID *string `json:"district_id"`
+	VillageID  *string `json:"village_id"`
+}
+
+// ApplyNulls clears the fields removed by the patch
+func (p *InputPatch) ApplyNulls(nulls []string) []utils.ErrorMessage {
+	empty := ""
+	for _, field := range nulls {
+		switch field {
+		case "province_id":
+			p.ProvinceID = &empty
+		case "regency_id":
+			p.RegencyID = &empty
+		case "district_id":
+			p.DistrictID = &empty
+		case "village_id":
+			p.VillageID = &empty
+		}
+	}
+
+	return make([]utils.ErrorMessage, 0)
+}
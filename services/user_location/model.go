@@ -7,13 +7,15 @@ import (
 )
 
 type UserLocation struct {
-	ID         uuid.UUID `json:"id" db:"id"`
-	ProvinceID string    `json:"province_id" db:"province_id"`
-	RegencyID  string    `json:"regency_id" db:"regency_id"`
-	DistrictID string    `json:"district_id" db:"district_id"`
-	VillageID  string    `json:"village_id" db:"village_id"`
-	CreatedAt  time.Time `json:"created_at" db:"created_at"`
-	UpdatedAt  time.Time `json:"updated_at" db:"updated_at"`
+	ID         uuid.UUID  `json:"id" db:"id"`
+	ProvinceID string     `json:"province_id" db:"province_id"`
+	RegencyID  string     `json:"regency_id" db:"regency_id"`
+	DistrictID string     `json:"district_id" db:"district_id"`
+	VillageID  string     `json:"village_id" db:"village_id"`
+	DeletedAt  *time.Time `json:"deleted_at" db:"deleted_at"`
+	CreatedAt  time.Time  `json:"created_at" db:"created_at"`
+	UpdatedAt  time.Time  `json:"updated_at" db:"updated_at"`
+	Version    int        `json:"version" db:"version"`
 }
 
 func New(
@@ -30,9 +32,16 @@ func New(
 		VillageID:  village_id,
 		CreatedAt:  time.Now(),
 		UpdatedAt:  time.Now(),
+		Version:    1,
 	}
 }
 
+// MatchVersion reports whether the user location is still at the version the caller
+// read, 0 matches any version.
+func (u *UserLocation) MatchVersion(version int) bool {
+	return version == 0 || u.Version == version
+}
+
 func (u *UserLocation) Update(
 	province_id,
 	regency_id,
@@ -45,7 +54,51 @@ func (u *UserLocation) Update(
 	u.UpdatedAt = time.Now()
 }
 
+// Patch applies the provided fields and returns the columns to write
+func (u *UserLocation) Patch(input InputPatch) []string {
+	columns := make([]string, 0)
+	if input.ProvinceID != nil {
+		u.ProvinceID = *input.ProvinceID
+		columns = append(columns, "province_id")
+	}
+
+	if input.RegencyID != nil {
+		u.RegencyID = *input.RegencyID
+		columns = append(columns, "regency_id")
+	}
+
+	if input.DistrictID != nil {
+		u.DistrictID = *input.DistrictID
+		columns = append(columns, "district_id")
+	}
+
+	if input.VillageID != nil {
+		u.VillageID = *input.VillageID
+		columns = append(columns, "village_id")
+	}
+
+	if len(columns) != 0 {
+		u.UpdatedAt = time.Now()
+	}
+
+	return columns
+}
+
+func (u *UserLocation) Delete() {
+	now := time.Now()
+	u.DeletedAt = &now
+	u.UpdatedAt = now
+}
+
 type Page struct {
 	Items []*UserLocation `json:"items"`
 	Total int             `json:"total"`
 }
+
+// CursorPage is a keyset page, Total is only set when it was asked for
+type CursorPage struct {
+	Items      []*UserLocation `json:"items"`
+	NextCursor string          `json:"next_cursor"`
+	PrevCursor string          `json:"prev_cursor"`
+	Total      *int            `json:"total,omitempty"`
+}
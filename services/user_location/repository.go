@@ -1,11 +1,23 @@
 package user_location
 
-import "github.com/google/uuid"
+import (
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+
+	"stark/database"
+)
 
 type Repository interface {
+	// WithTx returns the repository writing and reading in tx, the owner of
+	// tx commits or rolls back
+	WithTx(tx *sqlx.Tx) Repository
 	Store(item *UserLocation) error
+	Patch(item *UserLocation, columns []string) error
+	SoftDelete(item *UserLocation) error
 	FindByID(id uuid.UUID) (*UserLocation, error)
 	FindByFilter(filter Filter) ([]*UserLocation, error)
 	FindPage(offset, limit int) ([]*UserLocation, error)
+	FindCursorPage(cursor *database.Cursor, limit int) ([]*UserLocation, error)
 	FindTotalByFilter(filter Filter) (int, error)
+	FindApproximateTotal() (int, error)
 }
@@ -2,22 +2,54 @@ package user_location
 
 import (
 	"database/sql"
+	"time"
 
 	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
 	"github.com/palantir/stacktrace"
 
+	"stark/database"
 	"stark/failure"
+	"stark/services/profile_trail"
+	"stark/utils/activity"
+	"stark/utils/log"
+)
+
+var errVersionConflict = failure.WithMessage(
+	failure.CodeVersionConflict,
+	"user location was changed by another request, fetch it again and retry with the new ETag",
 )
 
 type Service struct {
-	repo Repository
+	repo          Repository
+	trailRecorder profile_trail.Recorder
+}
+
+func NewService(repo Repository, profileTrailService *profile_trail.Service) *Service {
+	return &Service{
+		repo:          repo,
+		trailRecorder: profileTrailService,
+	}
+}
+
+// WithTx returns the service with its repository joined to tx, for writes
+// that commit together with those of other services
+func (s *Service) WithTx(tx *sqlx.Tx) *Service {
+	service := *s
+	service.repo = s.repo.WithTx(tx)
+	return &service
 }
 
-func NewService(repo Repository) *Service {
-	return &Service{repo: repo}
+// WithTrail returns the service recording its profile trails to recorder, a
+// unit of work passes a batch it stores once it commits
+func (s *Service) WithTrail(recorder profile_trail.Recorder) *Service {
+	service := *s
+	service.trailRecorder = recorder
+	return &service
 }
 
 func (s *Service) Create(
+	origin profile_trail.Origin,
 	id uuid.UUID,
 	province_id,
 	regency_id,
@@ -31,7 +63,7 @@ func (s *Service) Create(
 		village_id,
 	)
 
-	totalID, err := s.repo.FindTotalByFilter(Filter{IDs: []string{id.String()}})
+	totalID, err := s.repo.FindTotalByFilter(Filter{IDs: []string{id.String()}, WithDeleted: true})
 	if err != nil {
 		return nil, err
 	}
@@ -48,21 +80,35 @@ func (s *Service) Create(
 		return nil, err
 	}
 
+	s.trail(origin, nil, item)
 	return s.FindByID(item.ID)
 }
 
+// Update replaces the user location when it is still at version, 0 skips the
+// check. A missing user location is created.
 func (s *Service) Update(
+	origin profile_trail.Origin,
 	id uuid.UUID,
+	version int,
 	province_id,
 	regency_id,
 	district_id,
 	village_id string) (*UserLocation, error) {
-	item := &UserLocation{
-		ID:         id,
-		ProvinceID: province_id,
-		RegencyID:  regency_id,
-		DistrictID: district_id,
-		VillageID:  village_id,
+	var before *UserLocation
+	item, err := s.repo.FindByID(id)
+	if err != nil {
+		if stacktrace.RootCause(err) != sql.ErrNoRows {
+			return nil, err
+		}
+
+		item = &UserLocation{ID: id}
+	} else {
+		previous := *item
+		before = &previous
+	}
+
+	if !item.MatchVersion(version) {
+		return nil, errVersionConflict
 	}
 
 	item.Update(
@@ -72,14 +118,55 @@ func (s *Service) Update(
 		village_id,
 	)
 
-	err := s.repo.Store(item)
+	err = s.repo.Store(item)
+	if err != nil {
+		return nil, conflict(err)
+	}
+
+	s.trail(origin, before, item)
+	return s.repo.FindByID(id)
+}
+
+func (s *Service) Patch(origin profile_trail.Origin, id uuid.UUID, version int, input InputPatch) (*UserLocation, error) {
+	item, err := s.FindByID(id)
 	if err != nil {
 		return nil, err
 	}
 
+	if !item.MatchVersion(version) {
+		return nil, errVersionConflict
+	}
+
+	before := *item
+	columns := item.Patch(input)
+	if len(columns) == 0 {
+		return item, nil
+	}
+
+	err = s.repo.Patch(item, columns)
+	if err != nil {
+		return nil, conflict(err)
+	}
+
+	s.trail(origin, &before, item)
 	return s.repo.FindByID(id)
 }
 
+func (s *Service) Delete(id uuid.UUID) (*UserLocation, error) {
+	item, err := s.FindByID(id)
+	if err != nil {
+		return nil, err
+	}
+
+	item.Delete()
+	err = s.repo.SoftDelete(item)
+	if err != nil {
+		return nil, err
+	}
+
+	return item, nil
+}
+
 func (s *Service) FindByID(id uuid.UUID) (*UserLocation, error) {
 	item, err := s.repo.FindByID(id)
 	if err != nil {
@@ -117,3 +204,48 @@ func (s *Service) FindPage(page, limit int) (Page, error) {
 		Total: total,
 	}, nil
 }
+
+// FindCursorPage reads a keyset page, total is one of the database total
+// modes and the table is only counted when asked to.
+func (s *Service) FindCursorPage(cursor string, limit int, total string) (CursorPage, error) {
+	page, err := database.ReadCursorPage(
+		cursor,
+		limit,
+		total,
+		s.repo.FindCursorPage,
+		func(item *UserLocation) (time.Time, string) {
+			return item.CreatedAt, item.ID.String()
+		},
+		func() (int, error) {
+			return s.repo.FindTotalByFilter(Filter{})
+		},
+		s.repo.FindApproximateTotal,
+	)
+
+	if err != nil {
+		return CursorPage{}, err
+	}
+
+	return CursorPage(page), nil
+}
+
+// trail records the change in the profile trail, the change is already
+// stored so a failure is logged instead of returned.
+func (s *Service) trail(origin profile_trail.Origin, before, after *UserLocation) {
+	err := s.trailRecorder.Record(origin, after.ID.String(), profile_trail.SectionLocation, before, after)
+	if err != nil {
+		ctx := activity.NewContext("user_location_profile_trail")
+		ctx = activity.WithUserID(ctx, after.ID.String())
+		log.WithContext(ctx).Error(stacktrace.Propagate(err, "record profile trail error"))
+	}
+}
+
+// conflict turns a write that lost the race on the row version into the same
+// failure as a stale If-Match.
+func conflict(err error) error {
+	if stacktrace.RootCause(err) == database.ErrVersionConflict {
+		return errVersionConflict
+	}
+
+	return err
+}
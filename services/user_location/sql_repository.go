@@ -5,11 +5,13 @@ import (
 
 	"github.com/doug-martin/goqu/v9"
 	_ "github.com/doug-martin/goqu/v9/dialect/mysql"
+	"github.com/doug-martin/goqu/v9/exp"
 	"github.com/google/uuid"
 	"github.com/jmoiron/sqlx"
 	"github.com/palantir/stacktrace"
 
 	"stark/database"
+	"stark/services/outbox"
 )
 
 type sqlRepository struct {
@@ -28,8 +30,16 @@ const (
 			regency_id = ?,
 			district_id = ?,
 			village_id = ?,
-			updated_at = ?
-		WHERE id = ?
+			updated_at = ?,
+			version = version + 1
+		WHERE id = ? AND version = ?
+	`
+	softDeleteUserQuery = `
+		UPDATE user_locations SET
+			deleted_at = ?,
+			updated_at = ?,
+			version = version + 1
+		WHERE id = ? AND version = ?
 	`
 )
 
@@ -37,6 +47,10 @@ func NewSQLRepository(mysqlDB *database.MySQL) Repository {
 	return &sqlRepository{mysqlDB}
 }
 
+func (repo *sqlRepository) WithTx(tx *sqlx.Tx) Repository {
+	return &sqlRepository{mysqlDB: repo.mysqlDB.Join(tx)}
+}
+
 func (repo *sqlRepository) Store(data *UserLocation) error {
 	exist, err := repo.existByID(data.ID)
 	if err != nil {
@@ -51,12 +65,102 @@ func (repo *sqlRepository) Store(data *UserLocation) error {
 	return repo.insert(data)
 }
 
+func (repo *sqlRepository) SoftDelete(data *UserLocation) error {
+	_, err := repo.mysqlDB.WithTransaction(func(tx *sqlx.Tx) (interface{}, error) {
+		res, err := tx.Exec(softDeleteUserQuery,
+			data.DeletedAt,
+			data.UpdatedAt,
+			data.ID,
+			data.Version,
+		)
+
+		if err != nil {
+			return nil, err
+		}
+
+		rowsAffected, err := res.RowsAffected()
+		if err != nil {
+			return nil, err
+		}
+
+		if rowsAffected <= 0 {
+			return nil, stacktrace.Propagate(database.ErrVersionConflict, "soft delete user location fails")
+		}
+
+		data.Version++
+
+		err = outbox.Write(tx, aggregateType, data.ID.String(), EventDeleted, data)
+		if err != nil {
+			return nil, err
+		}
+
+		return nil, nil
+	})
+
+	return err
+}
+
+// Patch writes only the given columns, updated_at and the bumped version
+func (repo *sqlRepository) Patch(data *UserLocation, columns []string) error {
+	values := map[string]interface{}{
+		"province_id": data.ProvinceID,
+		"regency_id":  data.RegencyID,
+		"district_id": data.DistrictID,
+		"village_id":  data.VillageID,
+	}
+
+	record := goqu.Record{
+		"updated_at": data.UpdatedAt,
+		"version":    goqu.L("version + 1"),
+	}
+
+	for _, column := range columns {
+		record[column] = values[column]
+	}
+
+	dialect := goqu.Dialect("mysql")
+	dataset := dialect.Update("user_locations").Prepared(true).Set(record)
+	dataset = dataset.Where(goqu.Ex{
+		"id":         data.ID.String(),
+		"version":    data.Version,
+		"deleted_at": nil,
+	})
+
+	sql, args, err := dataset.ToSQL()
+	if err != nil {
+		return stacktrace.Propagate(err, "sql error")
+	}
+
+	_, err = repo.mysqlDB.WithTransaction(func(tx *sqlx.Tx) (interface{}, error) {
+		res, err := tx.Exec(sql, args...)
+		if err != nil {
+			return nil, err
+		}
+
+		rowsAffected, err := res.RowsAffected()
+		if err != nil {
+			return nil, err
+		}
+
+		if rowsAffected <= 0 {
+			return nil, stacktrace.Propagate(database.ErrVersionConflict, "patch user location fails")
+		}
+
+		data.Version++
+
+		return nil, outbox.Write(tx, aggregateType, data.ID.String(), EventUpdated, data)
+	})
+
+	return err
+}
+
 func (repo *sqlRepository) FindByID(id uuid.UUID) (result *UserLocation, err error) {
 	var data UserLocation
 	dialect := goqu.Dialect("mysql")
 	dataset := dialect.From("user_locations")
 	dataset = dataset.Where(goqu.Ex{
-		"id": id.String(),
+		"id":         id.String(),
+		"deleted_at": nil,
 	})
 
 	sql, _, err := dataset.ToSQL()
@@ -79,12 +183,17 @@ func (repo *sqlRepository) FindByFilter(filter Filter) (result []*UserLocation,
 
 	dialect := goqu.Dialect("mysql")
 	dataset := dialect.From("user_locations")
-	if len(filter.IDs) != 0 {
+	if !filter.WithDeleted {
 		dataset = dataset.Where(goqu.Ex{
-			"id": filter.IDs,
+			"deleted_at": nil,
 		})
 	}
 
+	dataset = dataset.Where(filterExpression(filter))
+	for _, sort := range filter.Sort {
+		dataset = dataset.OrderAppend(database.Order(sort.Field, sort.Direction))
+	}
+
 	sql, _, err := dataset.ToSQL()
 	if err != nil {
 		return nil, stacktrace.Propagate(err, "sql error")
@@ -101,6 +210,11 @@ func (repo *sqlRepository) FindByFilter(filter Filter) (result []*UserLocation,
 func (repo *sqlRepository) FindPage(offset int, limit int) (result []*UserLocation, err error) {
 	dialect := goqu.Dialect("mysql")
 	dataset := dialect.From("user_locations")
+	dataset = dataset.Where(goqu.Ex{
+		"deleted_at": nil,
+	})
+	dataset = dataset.Order(goqu.C("created_at").Asc(), goqu.C("id").Asc())
+
 	sql, _, err := dataset.ToSQL()
 	if err != nil {
 		return nil, stacktrace.Propagate(err, "sql error")
@@ -114,16 +228,41 @@ func (repo *sqlRepository) FindPage(offset int, limit int) (result []*UserLocati
 	return
 }
 
+// FindCursorPage reads up to limit rows from the cursor, a backward cursor
+// returns them newest first
+func (repo *sqlRepository) FindCursorPage(cursor *database.Cursor, limit int) (result []*UserLocation, err error) {
+	dialect := goqu.Dialect("mysql")
+	dataset := dialect.From("user_locations")
+	dataset = dataset.Where(goqu.Ex{
+		"deleted_at": nil,
+	})
+	dataset = cursor.Paginate(dataset, limit)
+
+	sql, _, err := dataset.ToSQL()
+	if err != nil {
+		return nil, stacktrace.Propagate(err, "sql error")
+	}
+
+	err = repo.mysqlDB.Select(&result, sql)
+	if err != nil {
+		return nil, stacktrace.Propagate(err, "select rows fails")
+	}
+
+	return result, nil
+}
+
 func (repo *sqlRepository) FindTotalByFilter(filter Filter) (total int, err error) {
 	dialect := goqu.Dialect("mysql")
 	dataset := dialect.From("user_locations")
 	dataset = dataset.Select(goqu.COUNT("*"))
-	if len(filter.IDs) != 0 {
+	if !filter.WithDeleted {
 		dataset = dataset.Where(goqu.Ex{
-			"id": filter.IDs,
+			"deleted_at": nil,
 		})
 	}
 
+	dataset = dataset.Where(filterExpression(filter))
+
 	sql, _, err := dataset.ToSQL()
 	if err != nil {
 		return 0, stacktrace.Propagate(err, "sql error")
@@ -137,6 +276,58 @@ func (repo *sqlRepository) FindTotalByFilter(filter Filter) (total int, err erro
 	return total, nil
 }
 
+func (repo *sqlRepository) FindApproximateTotal() (int, error) {
+	return repo.mysqlDB.ApproximateCount("user_locations")
+}
+
+// filterExpression translates the filter criteria into a WHERE expression,
+// nested and/or/not filters become grouped sub expressions.
+func filterExpression(filter Filter) exp.ExpressionList {
+	expressions := []exp.Expression{
+		filter.CreatedAt.Expression("created_at"),
+		filter.UpdatedAt.Expression("updated_at"),
+	}
+
+	if len(filter.IDs) != 0 {
+		expressions = append(expressions, goqu.Ex{"id": filter.IDs})
+	}
+
+	if len(filter.ProvinceIDs) != 0 {
+		expressions = append(expressions, goqu.Ex{"province_id": filter.ProvinceIDs})
+	}
+
+	if len(filter.RegencyIDs) != 0 {
+		expressions = append(expressions, goqu.Ex{"regency_id": filter.RegencyIDs})
+	}
+
+	if len(filter.DistrictIDs) != 0 {
+		expressions = append(expressions, goqu.Ex{"district_id": filter.DistrictIDs})
+	}
+
+	if len(filter.VillageIDs) != 0 {
+		expressions = append(expressions, goqu.Ex{"village_id": filter.VillageIDs})
+	}
+
+	for _, item := range filter.And {
+		expressions = append(expressions, filterExpression(item))
+	}
+
+	if len(filter.Or) != 0 {
+		ors := make([]exp.Expression, 0)
+		for _, item := range filter.Or {
+			ors = append(ors, filterExpression(item))
+		}
+
+		expressions = append(expressions, database.Combine(exp.OrType, ors...))
+	}
+
+	if filter.Not != nil {
+		expressions = append(expressions, database.Not(filterExpression(*filter.Not)))
+	}
+
+	return database.Combine(exp.AndType, expressions...)
+}
+
 func (repo *sqlRepository) existByID(id uuid.UUID) (bool, error) {
 	var total int
 	err := repo.mysqlDB.Get(&total, selectCountUserQuery+" WHERE id = ?", id)
@@ -172,6 +363,11 @@ func (repo *sqlRepository) insert(data *UserLocation) error {
 			return nil, errors.New("insert user location fails")
 		}
 
+		err = outbox.Write(tx, aggregateType, data.ID.String(), EventCreated, data)
+		if err != nil {
+			return nil, err
+		}
+
 		return nil, nil
 	})
 
@@ -187,6 +383,7 @@ func (repo *sqlRepository) update(data *UserLocation) error {
 			data.VillageID,
 			data.UpdatedAt,
 			data.ID,
+			data.Version,
 		)
 
 		if err != nil {
@@ -199,7 +396,14 @@ func (repo *sqlRepository) update(data *UserLocation) error {
 		}
 
 		if rowsAffected <= 0 {
-			return nil, errors.New("update user location fails")
+			return nil, stacktrace.Propagate(database.ErrVersionConflict, "update user location fails")
+		}
+
+		data.Version++
+
+		err = outbox.Write(tx, aggregateType, data.ID.String(), EventUpdated, data)
+		if err != nil {
+			return nil, err
 		}
 
 		return nil, nil
@@ -0,0 +1,122 @@
+package user_location
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// The views are what each audience gets to see of a user location, responses
+// go through them instead of UserLocation.
+
+// InternalView is a user location as seen by internal services and operators
+type InternalView struct {
+	ID         uuid.UUID  `json:"id"`
+	ProvinceID string     `json:"province_id"`
+	RegencyID  string     `json:"regency_id"`
+	DistrictID string     `json:"district_id"`
+	VillageID  string     `json:"village_id"`
+	DeletedAt  *time.Time `json:"deleted_at"`
+	CreatedAt  time.Time  `json:"created_at"`
+	UpdatedAt  time.Time  `json:"updated_at"`
+	Version    int        `json:"version"`
+}
+
+// ClientView is a user location as seen by client apps
+type ClientView struct {
+	ID         uuid.UUID `json:"id"`
+	ProvinceID string    `json:"province_id"`
+	RegencyID  string    `json:"regency_id"`
+	DistrictID string    `json:"district_id"`
+	VillageID  string    `json:"village_id"`
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+	Version    int       `json:"version"`
+}
+
+// SelfView is a user location as seen by the user it belongs to
+type SelfView struct {
+	ID         uuid.UUID `json:"id"`
+	ProvinceID string    `json:"province_id"`
+	RegencyID  string    `json:"regency_id"`
+	DistrictID string    `json:"district_id"`
+	VillageID  string    `json:"village_id"`
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+type ClientPage struct {
+	Items []ClientView `json:"items"`
+	Total int          `json:"total"`
+}
+
+type ClientCursorPage struct {
+	Items      []ClientView `json:"items"`
+	NextCursor string       `json:"next_cursor"`
+	PrevCursor string       `json:"prev_cursor"`
+	Total      *int         `json:"total,omitempty"`
+}
+
+func (u *UserLocation) InternalView() InternalView {
+	return InternalView{
+		ID:         u.ID,
+		ProvinceID: u.ProvinceID,
+		RegencyID:  u.RegencyID,
+		DistrictID: u.DistrictID,
+		VillageID:  u.VillageID,
+		DeletedAt:  u.DeletedAt,
+		CreatedAt:  u.CreatedAt,
+		UpdatedAt:  u.UpdatedAt,
+		Version:    u.Version,
+	}
+}
+
+func (u *UserLocation) ClientView() ClientView {
+	return ClientView{
+		ID:         u.ID,
+		ProvinceID: u.ProvinceID,
+		RegencyID:  u.RegencyID,
+		DistrictID: u.DistrictID,
+		VillageID:  u.VillageID,
+		CreatedAt:  u.CreatedAt,
+		UpdatedAt:  u.UpdatedAt,
+		Version:    u.Version,
+	}
+}
+
+func (u *UserLocation) SelfView() SelfView {
+	return SelfView{
+		ID:         u.ID,
+		ProvinceID: u.ProvinceID,
+		RegencyID:  u.RegencyID,
+		DistrictID: u.DistrictID,
+		VillageID:  u.VillageID,
+		CreatedAt:  u.CreatedAt,
+		UpdatedAt:  u.UpdatedAt,
+	}
+}
+
+func ClientViews(items []*UserLocation) []ClientView {
+	views := make([]ClientView, 0, len(items))
+	for _, item := range items {
+		views = append(views, item.ClientView())
+	}
+
+	return views
+}
+
+func (p Page) ClientView() ClientPage {
+	return ClientPage{
+		Items: ClientViews(p.Items),
+		Total: p.Total,
+	}
+}
+
+func (p CursorPage) ClientView() ClientCursorPage {
+	return ClientCursorPage{
+		Items:      ClientViews(p.Items),
+		NextCursor: p.NextCursor,
+		PrevCursor: p.PrevCursor,
+		Total:      p.Total,
+	}
+}
@@ -0,0 +1,45 @@
+package user_location
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestOnlyInternalViewShowsDeletion(t *testing.T) {
+	item := New(uuid.New(), "31", "3171", "317101", "3171011001")
+	item.Delete()
+	total := 1
+
+	tests := []struct {
+		name     string
+		view     interface{}
+		internal bool
+	}{
+		{"InternalView", item.InternalView(), true},
+		{"ClientView", item.ClientView(), false},
+		{"ClientViews", ClientViews([]*UserLocation{item}), false},
+		{"ClientPage", Page{Items: []*UserLocation{item}, Total: 1}.ClientView(), false},
+		{"ClientCursorPage", CursorPage{Items: []*UserLocation{item}, Total: &total}.ClientView(), false},
+		{"SelfView", item.SelfView(), false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			data, err := json.Marshal(test.view)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if strings.Contains(string(data), `"deleted_at"`) != test.internal {
+				t.Errorf(`"deleted_at" presence should be %v in %s`, test.internal, data)
+			}
+
+			if !strings.Contains(string(data), `"village_id"`) {
+				t.Errorf(`"village_id" is missing from %s`, data)
+			}
+		})
+	}
+}
@@ -0,0 +1,6 @@
+package webhook
+
+type DeliveryFilter struct {
+	ClientID string
+	Statuses []string
+}
@@ -0,0 +1,175 @@
+package webhook
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+	"github.com/google/uuid"
+	"github.com/palantir/stacktrace"
+
+	"stark/failure"
+	"stark/respond"
+	"stark/utils"
+	"stark/utils/activity"
+	"stark/utils/log"
+)
+
+type Handler struct {
+	service *Service
+}
+
+func NewHandler(service *Service) *Handler {
+	return &Handler{service: service}
+}
+
+func (h *Handler) HandleCreate(c *gin.Context) {
+	ctx := activity.NewContext("webhook_create")
+	ctx = activity.WithClientID(ctx, c.Value("client_id").(string))
+	trx, _ := activity.GetTransactionID(ctx)
+	clientID, _ := activity.GetClientID(ctx)
+	var input Input
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		var validationErrors validator.ValidationErrors
+		if errors.As(err, &validationErrors) {
+			out := make([]utils.ErrorMessage, 0)
+			for _, validationError := range validationErrors {
+				out = append(out, utils.ErrorMessage{
+					Field:   utils.ToSnakeCase(validationError.Field()),
+					Message: utils.GetErrorMessage(validationError),
+				})
+			}
+
+			respond.Invalid(c, trx, http.StatusBadRequest, out)
+		}
+		return
+	}
+
+	webhook, err := h.service.Create(clientID, input.URL, input.Events)
+	if err != nil {
+		log.WithContext(ctx).Error(stacktrace.Propagate(err, "create webhook error"))
+		respond.Error(c, trx, http.StatusInternalServerError, respond.ErrInternal, "unknown error")
+		return
+	}
+
+	respond.Success(c, trx, http.StatusCreated, webhook.SecretView())
+}
+
+func (h *Handler) HandleList(c *gin.Context) {
+	ctx := activity.NewContext("webhook_list")
+	ctx = activity.WithClientID(ctx, c.Value("client_id").(string))
+	trx, _ := activity.GetTransactionID(ctx)
+	clientID, _ := activity.GetClientID(ctx)
+	webhooks, err := h.service.FindByClientID(clientID)
+	if err != nil {
+		log.WithContext(ctx).Error(stacktrace.Propagate(err, "list webhooks error"))
+		respond.Error(c, trx, http.StatusInternalServerError, respond.ErrInternal, "unknown error")
+		return
+	}
+
+	respond.Success(c, trx, http.StatusOK, ClientViews(webhooks))
+}
+
+func (h *Handler) HandleDelete(c *gin.Context) {
+	ctx := activity.NewContext("webhook_delete")
+	ctx = activity.WithClientID(ctx, c.Value("client_id").(string))
+	trx, _ := activity.GetTransactionID(ctx)
+	clientID, _ := activity.GetClientID(ctx)
+	webhookID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		respond.Error(c, trx, http.StatusBadRequest, respond.ErrBadRequest, "invalid webhook id")
+		return
+	}
+
+	err = h.service.Delete(clientID, webhookID)
+	if err != nil {
+		if f, ok := stacktrace.RootCause(err).(failure.Failure); ok {
+			switch f.Code {
+			case failure.CodeWebhookNotFound:
+				respond.Error(c, trx, http.StatusNotFound, f.Code, f.Desc)
+				return
+			}
+		}
+
+		log.WithContext(ctx).Error(stacktrace.Propagate(err, "delete webhook error"))
+		respond.Error(c, trx, http.StatusInternalServerError, respond.ErrInternal, "unknown error")
+		return
+	}
+
+	respond.Success(c, trx, http.StatusOK, nil)
+}
+
+// HandleDeliveryPage lists the delivery log, ?status=dead gives the
+// dead-letter list.
+func (h *Handler) HandleDeliveryPage(c *gin.Context) {
+	ctx := activity.NewContext("webhook_delivery_page")
+	ctx = activity.WithClientID(ctx, c.Value("client_id").(string))
+	trx, _ := activity.GetTransactionID(ctx)
+	clientID, _ := activity.GetClientID(ctx)
+	pageString := c.Query("page")
+	limitString := c.Query("limit")
+	page := 1
+	limit := 25
+	var err error
+	if pageString != "" {
+		page, err = strconv.Atoi(pageString)
+		if err != nil {
+			respond.Error(c, trx, http.StatusBadRequest, respond.ErrBadRequest, "invalid page")
+			return
+		}
+	}
+
+	if limitString != "" {
+		limit, err = strconv.Atoi(limitString)
+		if err != nil {
+			respond.Error(c, trx, http.StatusBadRequest, respond.ErrBadRequest, "invalid limit")
+			return
+		}
+	}
+
+	var statuses []string
+	if status := c.Query("status"); status != "" {
+		statuses = []string{status}
+	}
+
+	deliveryPage, err := h.service.FindDeliveryPage(clientID, statuses, page, limit)
+	if err != nil {
+		log.WithContext(ctx).Error(stacktrace.Propagate(err, "get webhook delivery page error"))
+		respond.Error(c, trx, http.StatusInternalServerError, respond.ErrInternal, "unknown error")
+		return
+	}
+
+	respond.Success(c, trx, http.StatusOK, deliveryPage)
+}
+
+func (h *Handler) HandleRetryDelivery(c *gin.Context) {
+	ctx := activity.NewContext("webhook_retry_delivery")
+	ctx = activity.WithClientID(ctx, c.Value("client_id").(string))
+	trx, _ := activity.GetTransactionID(ctx)
+	clientID, _ := activity.GetClientID(ctx)
+	deliveryID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		respond.Error(c, trx, http.StatusBadRequest, respond.ErrBadRequest, "invalid delivery id")
+		return
+	}
+
+	delivery, err := h.service.RetryDelivery(clientID, deliveryID)
+	if err != nil {
+		if f, ok := stacktrace.RootCause(err).(failure.Failure); ok {
+			switch f.Code {
+			case failure.CodeWebhookDeliveryNotFound:
+				respond.Error(c, trx, http.StatusNotFound, f.Code, f.Desc)
+				return
+			}
+		}
+
+		log.WithContext(ctx).Error(stacktrace.Propagate(err, "retry webhook delivery error"))
+		respond.Error(c, trx, http.StatusInternalServerError, respond.ErrInternal, "unknown error")
+		return
+	}
+
+	respond.Success(c, trx, http.StatusCreated, delivery)
+}
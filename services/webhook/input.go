@@ -0,0 +1,6 @@
+package webhook
+
+type Input struct {
+	URL    string   `json:"url" binding:"required,url,startswith=https://"`
+	Events []string `json:"events" binding:"required,min=1,dive,oneof=user.created user.updated user.verified user.identity_verified user.deleted profile.updated"`
+}
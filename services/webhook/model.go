@@ -0,0 +1,143 @@
+package webhook
+
+import (
+	"encoding/json"
+	"math"
+	"time"
+
+	"github.com/google/uuid"
+
+	"stark/database"
+	"stark/utils"
+)
+
+const (
+	EventUserCreated          = "user.created"
+	EventUserUpdated          = "user.updated"
+	EventUserVerified         = "user.verified"
+	EventUserIdentityVerified = "user.identity_verified"
+	EventUserDeleted          = "user.deleted"
+	EventProfileUpdated       = "profile.updated"
+
+	DeliveryStatusPending   = "pending"
+	DeliveryStatusSucceeded = "succeeded"
+	DeliveryStatusDead      = "dead"
+)
+
+type Webhook struct {
+	ID        uuid.UUID           `json:"id" db:"id"`
+	ClientID  string              `json:"client_id" db:"client_id"`
+	URL       string              `json:"url" db:"url"`
+	Events    database.StringList `json:"events" db:"events"`
+	Secret    string              `json:"secret" db:"secret"`
+	CreatedAt time.Time           `json:"created_at" db:"created_at"`
+	UpdatedAt time.Time           `json:"updated_at" db:"updated_at"`
+}
+
+func New(clientID, url string, events []string) *Webhook {
+	return &Webhook{
+		ID:        uuid.New(),
+		ClientID:  clientID,
+		URL:       url,
+		Events:    append(database.StringList{}, events...),
+		Secret:    utils.GenerateSecureToken(32),
+		CreatedAt: time.Now(),
+		UpdatedAt: time.Now(),
+	}
+}
+
+type Envelope struct {
+	ID        uuid.UUID   `json:"id"`
+	Event     string      `json:"event"`
+	Data      interface{} `json:"data"`
+	CreatedAt time.Time   `json:"created_at"`
+}
+
+type Delivery struct {
+	ID             uuid.UUID       `json:"id" db:"id"`
+	WebhookID      uuid.UUID       `json:"webhook_id" db:"webhook_id"`
+	ClientID       string          `json:"client_id" db:"client_id"`
+	Event          string          `json:"event" db:"event"`
+	Payload        json.RawMessage `json:"payload" db:"payload"`
+	Status         string          `json:"status" db:"status"`
+	Attempts       int             `json:"attempts" db:"attempts"`
+	NextAttemptAt  time.Time       `json:"next_attempt_at" db:"next_attempt_at"`
+	LastStatusCode int             `json:"last_status_code" db:"last_status_code"`
+	LastError      string          `json:"last_error" db:"last_error"`
+	CreatedAt      time.Time       `json:"created_at" db:"created_at"`
+	UpdatedAt      time.Time       `json:"updated_at" db:"updated_at"`
+}
+
+// NewDelivery wraps the event data in an envelope whose id doubles as the
+// delivery id, receivers can use it to drop duplicates.
+func NewDelivery(item *Webhook, event string, data interface{}) (*Delivery, error) {
+	id := uuid.New()
+	now := time.Now()
+	payload, err := json.Marshal(Envelope{
+		ID:        id,
+		Event:     event,
+		Data:      data,
+		CreatedAt: now,
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &Delivery{
+		ID:            id,
+		WebhookID:     item.ID,
+		ClientID:      item.ClientID,
+		Event:         event,
+		Payload:       payload,
+		Status:        DeliveryStatusPending,
+		NextAttemptAt: now,
+		CreatedAt:     now,
+		UpdatedAt:     now,
+	}, nil
+}
+
+func (d *Delivery) Succeed(statusCode int) {
+	d.Attempts++
+	d.Status = DeliveryStatusSucceeded
+	d.LastStatusCode = statusCode
+	d.LastError = ""
+	d.UpdatedAt = time.Now()
+}
+
+// Fail schedules the next attempt with exponential backoff, capped at
+// maxBackoff, and moves the delivery to the dead-letter list once
+// maxAttempts is reached.
+func (d *Delivery) Fail(statusCode int, reason string, maxAttempts int, baseBackoff, maxBackoff time.Duration) {
+	d.Attempts++
+	d.LastStatusCode = statusCode
+	d.LastError = reason
+	if len(d.LastError) > 255 {
+		d.LastError = d.LastError[:255]
+	}
+
+	d.UpdatedAt = time.Now()
+	if d.Attempts >= maxAttempts {
+		d.Status = DeliveryStatusDead
+		return
+	}
+
+	backoff := time.Duration(float64(baseBackoff) * math.Pow(2, float64(d.Attempts-1)))
+	if backoff > maxBackoff || backoff <= 0 {
+		backoff = maxBackoff
+	}
+
+	d.NextAttemptAt = d.UpdatedAt.Add(backoff)
+}
+
+func (d *Delivery) Retry() {
+	d.Status = DeliveryStatusPending
+	d.Attempts = 0
+	d.NextAttemptAt = time.Now()
+	d.UpdatedAt = time.Now()
+}
+
+type DeliveryPage struct {
+	Items []*Delivery `json:"items"`
+	Total int         `json:"total"`
+}
@@ -0,0 +1,25 @@
+package webhook
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+)
+
+type Repository interface {
+	// WithTx returns the repository writing and reading in tx, the owner of
+	// tx commits or rolls back
+	WithTx(tx *sqlx.Tx) Repository
+	Store(item *Webhook) error
+	Delete(id uuid.UUID) error
+	FindByID(id uuid.UUID) (*Webhook, error)
+	FindByClientID(clientID string) ([]*Webhook, error)
+	FindByEvent(event string) ([]*Webhook, error)
+	StoreDelivery(item *Delivery) error
+	ClaimDelivery(item *Delivery, lease time.Duration) (bool, error)
+	FindDeliveryByID(id uuid.UUID) (*Delivery, error)
+	FindDueDeliveries(now time.Time, limit int) ([]*Delivery, error)
+	FindDeliveryPage(filter DeliveryFilter, offset, limit int) ([]*Delivery, error)
+	FindDeliveryTotal(filter DeliveryFilter) (int, error)
+}
@@ -0,0 +1,288 @@
+package webhook
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/palantir/stacktrace"
+
+	"stark/failure"
+	"stark/utils"
+	"stark/utils/activity"
+	"stark/utils/log"
+)
+
+const (
+	deliveryBatchSize = 100
+	deliveryLease     = time.Minute
+)
+
+type Service struct {
+	repo        Repository
+	httpClient  *http.Client
+	checkURL    func(rawURL string) error
+	maxAttempts int
+	baseBackoff time.Duration
+	maxBackoff  time.Duration
+}
+
+// NewService sends deliveries with httpClient to the urls checkURL accepts,
+// production passes NewHTTPClient and CheckURL
+func NewService(repo Repository, httpClient *http.Client, checkURL func(rawURL string) error) *Service {
+	return &Service{
+		repo:        repo,
+		httpClient:  httpClient,
+		checkURL:    checkURL,
+		maxAttempts: utils.GetIntEnv("WEBHOOK_MAX_ATTEMPTS", 8),
+		baseBackoff: utils.GetDurationEnv("WEBHOOK_BASE_BACKOFF", 30*time.Second),
+		maxBackoff:  utils.GetDurationEnv("WEBHOOK_MAX_BACKOFF", 6*time.Hour),
+	}
+}
+
+// WithTx returns the service queuing deliveries in tx, they are only sent
+// once the change that raised the event commits
+func (s *Service) WithTx(tx *sqlx.Tx) *Service {
+	service := *s
+	service.repo = s.repo.WithTx(tx)
+	return &service
+}
+
+func (s *Service) Create(clientID, url string, events []string) (*Webhook, error) {
+	item := New(clientID, url, events)
+	err := s.repo.Store(item)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.repo.FindByID(item.ID)
+}
+
+func (s *Service) Delete(clientID string, id uuid.UUID) error {
+	_, err := s.FindByID(clientID, id)
+	if err != nil {
+		return err
+	}
+
+	return s.repo.Delete(id)
+}
+
+// FindByID only returns webhooks owned by the client
+func (s *Service) FindByID(clientID string, id uuid.UUID) (*Webhook, error) {
+	item, err := s.repo.FindByID(id)
+	if err != nil {
+		if stacktrace.RootCause(err) == sql.ErrNoRows {
+			return nil, failure.WithMessage(
+				failure.CodeWebhookNotFound,
+				"webhook not found, id isn't in database",
+			)
+		}
+
+		return nil, err
+	}
+
+	if item.ClientID != clientID {
+		return nil, failure.WithMessage(
+			failure.CodeWebhookNotFound,
+			"webhook not found, id isn't in database",
+		)
+	}
+
+	return item, nil
+}
+
+func (s *Service) FindByClientID(clientID string) ([]*Webhook, error) {
+	return s.repo.FindByClientID(clientID)
+}
+
+// Dispatch queues a delivery of the event for every subscribed webhook, the
+// delivery worker sends them.
+func (s *Service) Dispatch(event string, data interface{}) error {
+	items, err := s.repo.FindByEvent(event)
+	if err != nil {
+		return err
+	}
+
+	for _, item := range items {
+		// The LIKE match on the events column is loose, confirm the subscription
+		if !utils.IsInList(item.Events, event) {
+			continue
+		}
+
+		delivery, err := NewDelivery(item, event, data)
+		if err != nil {
+			return stacktrace.Propagate(err, "build webhook delivery error")
+		}
+
+		err = s.repo.StoreDelivery(delivery)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *Service) FindDeliveryPage(clientID string, statuses []string, page, limit int) (DeliveryPage, error) {
+	filter := DeliveryFilter{
+		ClientID: clientID,
+		Statuses: statuses,
+	}
+
+	offset := (page - 1) * limit
+	items, err := s.repo.FindDeliveryPage(filter, offset, limit)
+	if err != nil {
+		return DeliveryPage{}, err
+	}
+
+	total, err := s.repo.FindDeliveryTotal(filter)
+	if err != nil {
+		return DeliveryPage{}, err
+	}
+
+	return DeliveryPage{
+		Items: items,
+		Total: total,
+	}, nil
+}
+
+// RetryDelivery puts a dead-lettered delivery back in the queue
+func (s *Service) RetryDelivery(clientID string, id uuid.UUID) (*Delivery, error) {
+	item, err := s.repo.FindDeliveryByID(id)
+	if err != nil {
+		if stacktrace.RootCause(err) == sql.ErrNoRows {
+			return nil, failure.WithMessage(
+				failure.CodeWebhookDeliveryNotFound,
+				"webhook delivery not found, id isn't in database",
+			)
+		}
+
+		return nil, err
+	}
+
+	if item.ClientID != clientID || item.Status != DeliveryStatusDead {
+		return nil, failure.WithMessage(
+			failure.CodeWebhookDeliveryNotFound,
+			"webhook delivery not found, only dead deliveries can be retried",
+		)
+	}
+
+	item.Retry()
+	err = s.repo.StoreDelivery(item)
+	if err != nil {
+		return nil, err
+	}
+
+	return item, nil
+}
+
+func (s *Service) DeliverDue(now time.Time) error {
+	items, err := s.repo.FindDueDeliveries(now, deliveryBatchSize)
+	if err != nil {
+		return err
+	}
+
+	for _, item := range items {
+		claimed, err := s.repo.ClaimDelivery(item, deliveryLease)
+		if err != nil {
+			return err
+		}
+
+		if !claimed {
+			continue
+		}
+
+		err = s.deliver(item)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *Service) RunDeliveryWorker(interval time.Duration) {
+	ctx := activity.NewContext("webhook_delivery_worker")
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		err := s.DeliverDue(time.Now())
+		if err != nil {
+			log.WithContext(ctx).Error(stacktrace.Propagate(err, "deliver webhooks error"))
+		}
+	}
+}
+
+func (s *Service) deliver(item *Delivery) error {
+	webhook, err := s.repo.FindByID(item.WebhookID)
+	if err != nil {
+		if stacktrace.RootCause(err) != sql.ErrNoRows {
+			return err
+		}
+
+		// The webhook was removed after the event was queued, give up right away
+		item.Fail(0, "webhook deleted", 1, s.baseBackoff, s.maxBackoff)
+		return s.repo.StoreDelivery(item)
+	}
+
+	statusCode, err := s.send(webhook, item)
+	if err != nil {
+		item.Fail(statusCode, err.Error(), s.maxAttempts, s.baseBackoff, s.maxBackoff)
+	} else {
+		item.Succeed(statusCode)
+	}
+
+	return s.repo.StoreDelivery(item)
+}
+
+func (s *Service) send(webhook *Webhook, item *Delivery) (int, error) {
+	err := s.checkURL(webhook.URL)
+	if err != nil {
+		return 0, err
+	}
+
+	request, err := http.NewRequest(http.MethodPost, webhook.URL, bytes.NewReader(item.Payload))
+	if err != nil {
+		return 0, err
+	}
+
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set("User-Agent", "stark-webhook")
+	request.Header.Set("X-Webhook-ID", item.ID.String())
+	request.Header.Set("X-Webhook-Event", item.Event)
+	request.Header.Set("X-Webhook-Timestamp", timestamp)
+	request.Header.Set("X-Webhook-Signature", Sign(webhook.Secret, timestamp, item.Payload))
+
+	response, err := s.httpClient.Do(request)
+	if err != nil {
+		return 0, err
+	}
+
+	defer response.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(response.Body, 64<<10))
+	if response.StatusCode < 200 || response.StatusCode >= 300 {
+		return response.StatusCode, fmt.Errorf("unexpected status %d", response.StatusCode)
+	}
+
+	return response.StatusCode, nil
+}
+
+// Sign returns the hex HMAC-SHA256 of the timestamp and payload joined by a
+// dot, receivers recompute it with the webhook secret.
+func Sign(secret, timestamp string, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(payload)
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,138 @@
+package webhook
+
+import (
+	"database/sql"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// deliveryRepository holds one webhook and its due deliveries in memory
+type deliveryRepository struct {
+	Repository
+	webhook    *Webhook
+	deliveries []*Delivery
+}
+
+func (r *deliveryRepository) FindByID(id uuid.UUID) (*Webhook, error) {
+	if r.webhook == nil || r.webhook.ID != id {
+		return nil, sql.ErrNoRows
+	}
+
+	return r.webhook, nil
+}
+
+func (r *deliveryRepository) FindDueDeliveries(now time.Time, limit int) ([]*Delivery, error) {
+	var items []*Delivery
+	for _, item := range r.deliveries {
+		if item.Status == DeliveryStatusPending && !item.NextAttemptAt.After(now) {
+			items = append(items, item)
+		}
+	}
+
+	return items, nil
+}
+
+func (r *deliveryRepository) ClaimDelivery(item *Delivery, lease time.Duration) (bool, error) {
+	return true, nil
+}
+
+func (r *deliveryRepository) StoreDelivery(item *Delivery) error {
+	return nil
+}
+
+// newTestService points a service at receiver, a local http server the
+// production client and url check would refuse
+func newTestService(t *testing.T, receiver http.HandlerFunc, maxAttempts int) (*Service, *deliveryRepository) {
+	server := httptest.NewServer(receiver)
+	t.Cleanup(server.Close)
+
+	item := New("client", server.URL, []string{EventUserUpdated})
+	delivery, err := NewDelivery(item, EventUserUpdated, map[string]string{"id": "user"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	repo := &deliveryRepository{webhook: item, deliveries: []*Delivery{delivery}}
+	service := NewService(repo, server.Client(), func(string) error { return nil })
+	service.maxAttempts = maxAttempts
+	service.baseBackoff = time.Minute
+	service.maxBackoff = 3 * time.Minute
+	return service, repo
+}
+
+func TestDeliverSignsPayload(t *testing.T) {
+	var secret string
+	var signed bool
+	service, repo := newTestService(t, func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		signature := Sign(secret, r.Header.Get("X-Webhook-Timestamp"), body)
+		signed = r.Header.Get("X-Webhook-Signature") == signature
+		w.WriteHeader(http.StatusNoContent)
+	}, 3)
+	secret = repo.webhook.Secret
+
+	err := service.DeliverDue(time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !signed {
+		t.Error("signature doesn't match the timestamp and payload")
+	}
+
+	delivery := repo.deliveries[0]
+	if delivery.Status != DeliveryStatusSucceeded || delivery.LastStatusCode != http.StatusNoContent {
+		t.Errorf("expected a succeeded delivery with 204, got %s with %d", delivery.Status, delivery.LastStatusCode)
+	}
+}
+
+func TestDeliverBacksOffThenDeadLetters(t *testing.T) {
+	service, repo := newTestService(t, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}, 4)
+	delivery := repo.deliveries[0]
+
+	// Each failure doubles the wait from the base backoff up to the cap
+	for attempt, backoff := range []time.Duration{time.Minute, 2 * time.Minute, 3 * time.Minute} {
+		err := service.DeliverDue(delivery.NextAttemptAt)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if delivery.Status != DeliveryStatusPending || delivery.Attempts != attempt+1 {
+			t.Fatalf("attempt %d: expected pending with %d attempts, got %s with %d", attempt+1, attempt+1, delivery.Status, delivery.Attempts)
+		}
+
+		if wait := delivery.NextAttemptAt.Sub(delivery.UpdatedAt); wait != backoff {
+			t.Errorf("attempt %d: expected a backoff of %s, got %s", attempt+1, backoff, wait)
+		}
+	}
+
+	err := service.DeliverDue(delivery.NextAttemptAt)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if delivery.Status != DeliveryStatusDead || delivery.LastStatusCode != http.StatusInternalServerError {
+		t.Errorf("expected a dead delivery with 500, got %s with %d", delivery.Status, delivery.LastStatusCode)
+	}
+}
+
+func TestProductionTransportRefusesLocalReceiver(t *testing.T) {
+	server := httptest.NewServer(http.NotFoundHandler())
+	defer server.Close()
+
+	if CheckURL(server.URL) == nil {
+		t.Errorf("%s was accepted", server.URL)
+	}
+
+	_, err := NewHTTPClient(time.Second).Get(server.URL)
+	if err == nil {
+		t.Errorf("%s was dialed", server.URL)
+	}
+}
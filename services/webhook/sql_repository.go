@@ -0,0 +1,365 @@
+package webhook
+
+import (
+	"errors"
+	"time"
+
+	"github.com/doug-martin/goqu/v9"
+	_ "github.com/doug-martin/goqu/v9/dialect/mysql"
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/palantir/stacktrace"
+
+	"stark/database"
+)
+
+type sqlRepository struct {
+	mysqlDB *database.MySQL
+}
+
+const (
+	insertWebhookQuery = `
+		INSERT INTO webhooks (id, client_id, url, events, secret, created_at, updated_at) 
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+	`
+	deleteWebhookQuery       = "DELETE FROM webhooks WHERE id = ?"
+	selectCountDeliveryQuery = "SELECT COUNT(*) FROM webhook_deliveries"
+	insertDeliveryQuery      = `
+		INSERT INTO webhook_deliveries (id, webhook_id, client_id, event, payload, status, attempts, next_attempt_at, last_status_code, last_error, created_at, updated_at) 
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`
+	updateDeliveryQuery = `
+		UPDATE webhook_deliveries SET
+			status = ?,
+			attempts = ?,
+			next_attempt_at = ?,
+			last_status_code = ?,
+			last_error = ?,
+			updated_at = ?
+		WHERE id = ?
+	`
+	claimDeliveryQuery = `
+		UPDATE webhook_deliveries SET
+			next_attempt_at = ?
+		WHERE id = ? AND status = ? AND next_attempt_at = ?
+	`
+)
+
+func NewSQLRepository(mysqlDB *database.MySQL) Repository {
+	return &sqlRepository{mysqlDB}
+}
+
+func (repo *sqlRepository) WithTx(tx *sqlx.Tx) Repository {
+	return &sqlRepository{mysqlDB: repo.mysqlDB.Join(tx)}
+}
+
+func (repo *sqlRepository) Store(data *Webhook) error {
+	_, err := repo.mysqlDB.WithTransaction(func(tx *sqlx.Tx) (interface{}, error) {
+		res, err := tx.Exec(insertWebhookQuery,
+			data.ID,
+			data.ClientID,
+			data.URL,
+			data.Events,
+			data.Secret,
+			data.CreatedAt,
+			data.UpdatedAt,
+		)
+
+		if err != nil {
+			return nil, err
+		}
+
+		rowsAffected, err := res.RowsAffected()
+		if err != nil {
+			return nil, err
+		}
+
+		if rowsAffected <= 0 {
+			return nil, errors.New("insert webhook fails")
+		}
+
+		return nil, nil
+	})
+
+	return err
+}
+
+func (repo *sqlRepository) Delete(id uuid.UUID) error {
+	_, err := repo.mysqlDB.WithTransaction(func(tx *sqlx.Tx) (interface{}, error) {
+		_, err := tx.Exec(deleteWebhookQuery, id)
+		return nil, err
+	})
+
+	return err
+}
+
+func (repo *sqlRepository) FindByID(id uuid.UUID) (result *Webhook, err error) {
+	var data Webhook
+	dialect := goqu.Dialect("mysql")
+	dataset := dialect.From("webhooks")
+	dataset = dataset.Where(goqu.Ex{
+		"id": id.String(),
+	})
+
+	sql, _, err := dataset.ToSQL()
+	if err != nil {
+		return nil, stacktrace.Propagate(err, "sql error")
+	}
+
+	err = repo.mysqlDB.Get(&data, sql)
+	if err != nil {
+		return nil, stacktrace.Propagate(err, "can't read webhook by id")
+	}
+
+	return &data, nil
+}
+
+func (repo *sqlRepository) FindByClientID(clientID string) (result []*Webhook, err error) {
+	dialect := goqu.Dialect("mysql")
+	dataset := dialect.From("webhooks")
+	dataset = dataset.Where(goqu.Ex{
+		"client_id": clientID,
+	})
+
+	dataset = dataset.Order(goqu.C("created_at").Asc())
+	sql, _, err := dataset.ToSQL()
+	if err != nil {
+		return nil, stacktrace.Propagate(err, "sql error")
+	}
+
+	result = make([]*Webhook, 0)
+	err = repo.mysqlDB.Select(&result, sql)
+	if err != nil {
+		return nil, stacktrace.Propagate(err, "select rows fails")
+	}
+
+	return result, nil
+}
+
+// FindByEvent matches the quoted event name inside the JSON events column
+func (repo *sqlRepository) FindByEvent(event string) (result []*Webhook, err error) {
+	dialect := goqu.Dialect("mysql")
+	dataset := dialect.From("webhooks")
+	dataset = dataset.Where(goqu.C("events").Like(`%"` + event + `"%`))
+	sql, _, err := dataset.ToSQL()
+	if err != nil {
+		return nil, stacktrace.Propagate(err, "sql error")
+	}
+
+	err = repo.mysqlDB.Select(&result, sql)
+	if err != nil {
+		return nil, stacktrace.Propagate(err, "select rows fails")
+	}
+
+	return result, nil
+}
+
+func (repo *sqlRepository) StoreDelivery(data *Delivery) error {
+	exist, err := repo.existDeliveryByID(data.ID)
+	if err != nil {
+		return err
+	}
+
+	if exist {
+		return repo.updateDelivery(data)
+	}
+
+	return repo.insertDelivery(data)
+}
+
+// ClaimDelivery pushes the next attempt of a due delivery out by lease so
+// other workers skip it while it is being sent. Only one worker can win the
+// claim since the update is conditional on the previous next_attempt_at.
+func (repo *sqlRepository) ClaimDelivery(data *Delivery, lease time.Duration) (bool, error) {
+	result, err := repo.mysqlDB.WithTransaction(func(tx *sqlx.Tx) (interface{}, error) {
+		res, err := tx.Exec(claimDeliveryQuery,
+			time.Now().Add(lease),
+			data.ID,
+			DeliveryStatusPending,
+			data.NextAttemptAt,
+		)
+
+		if err != nil {
+			return nil, err
+		}
+
+		return res.RowsAffected()
+	})
+
+	if err != nil {
+		return false, stacktrace.Propagate(err, "claim webhook delivery fails")
+	}
+
+	return result.(int64) > 0, nil
+}
+
+func (repo *sqlRepository) FindDeliveryByID(id uuid.UUID) (result *Delivery, err error) {
+	var data Delivery
+	dialect := goqu.Dialect("mysql")
+	dataset := dialect.From("webhook_deliveries")
+	dataset = dataset.Where(goqu.Ex{
+		"id": id.String(),
+	})
+
+	sql, _, err := dataset.ToSQL()
+	if err != nil {
+		return nil, stacktrace.Propagate(err, "sql error")
+	}
+
+	err = repo.mysqlDB.Get(&data, sql)
+	if err != nil {
+		return nil, stacktrace.Propagate(err, "can't read webhook delivery by id")
+	}
+
+	return &data, nil
+}
+
+func (repo *sqlRepository) FindDueDeliveries(now time.Time, limit int) (result []*Delivery, err error) {
+	dialect := goqu.Dialect("mysql")
+	dataset := dialect.From("webhook_deliveries")
+	dataset = dataset.Where(
+		goqu.Ex{"status": DeliveryStatusPending},
+		goqu.C("next_attempt_at").Lte(now),
+	)
+
+	dataset = dataset.Order(goqu.C("next_attempt_at").Asc()).Limit(uint(limit))
+	sql, _, err := dataset.ToSQL()
+	if err != nil {
+		return nil, stacktrace.Propagate(err, "sql error")
+	}
+
+	err = repo.mysqlDB.Select(&result, sql)
+	if err != nil {
+		return nil, stacktrace.Propagate(err, "select rows fails")
+	}
+
+	return result, nil
+}
+
+func (repo *sqlRepository) FindDeliveryPage(filter DeliveryFilter, offset, limit int) (result []*Delivery, err error) {
+	dataset := deliveryDataset(filter)
+	dataset = dataset.Order(goqu.C("created_at").Desc())
+	sql, _, err := dataset.ToSQL()
+	if err != nil {
+		return nil, stacktrace.Propagate(err, "sql error")
+	}
+
+	result = make([]*Delivery, 0)
+	err = repo.mysqlDB.Select(&result, sql+" LIMIT ? OFFSET ?", limit, offset)
+	if err != nil {
+		return nil, stacktrace.Propagate(err, "select rows fails")
+	}
+
+	return result, nil
+}
+
+func (repo *sqlRepository) FindDeliveryTotal(filter DeliveryFilter) (total int, err error) {
+	dataset := deliveryDataset(filter)
+	dataset = dataset.Select(goqu.COUNT("*"))
+	sql, _, err := dataset.ToSQL()
+	if err != nil {
+		return 0, stacktrace.Propagate(err, "sql error")
+	}
+
+	err = repo.mysqlDB.Get(&total, sql)
+	if err != nil {
+		return 0, stacktrace.Propagate(err, "select row fails")
+	}
+
+	return total, nil
+}
+
+func deliveryDataset(filter DeliveryFilter) *goqu.SelectDataset {
+	dialect := goqu.Dialect("mysql")
+	dataset := dialect.From("webhook_deliveries")
+	if filter.ClientID != "" {
+		dataset = dataset.Where(goqu.Ex{
+			"client_id": filter.ClientID,
+		})
+	}
+
+	if len(filter.Statuses) != 0 {
+		dataset = dataset.Where(goqu.Ex{
+			"status": filter.Statuses,
+		})
+	}
+
+	return dataset
+}
+
+func (repo *sqlRepository) existDeliveryByID(id uuid.UUID) (bool, error) {
+	var total int
+	err := repo.mysqlDB.Get(&total, selectCountDeliveryQuery+" WHERE id = ?", id)
+	if err != nil {
+		return false, stacktrace.Propagate(err, "select count fails")
+	}
+
+	return total > 0, nil
+}
+
+func (repo *sqlRepository) insertDelivery(data *Delivery) error {
+	_, err := repo.mysqlDB.WithTransaction(func(tx *sqlx.Tx) (interface{}, error) {
+		res, err := tx.Exec(insertDeliveryQuery,
+			data.ID,
+			data.WebhookID,
+			data.ClientID,
+			data.Event,
+			string(data.Payload),
+			data.Status,
+			data.Attempts,
+			data.NextAttemptAt,
+			data.LastStatusCode,
+			data.LastError,
+			data.CreatedAt,
+			data.UpdatedAt,
+		)
+
+		if err != nil {
+			return nil, err
+		}
+
+		rowsAffected, err := res.RowsAffected()
+		if err != nil {
+			return nil, err
+		}
+
+		if rowsAffected <= 0 {
+			return nil, errors.New("insert webhook delivery fails")
+		}
+
+		return nil, nil
+	})
+
+	return err
+}
+
+func (repo *sqlRepository) updateDelivery(data *Delivery) error {
+	_, err := repo.mysqlDB.WithTransaction(func(tx *sqlx.Tx) (interface{}, error) {
+		res, err := tx.Exec(updateDeliveryQuery,
+			data.Status,
+			data.Attempts,
+			data.NextAttemptAt,
+			data.LastStatusCode,
+			data.LastError,
+			data.UpdatedAt,
+			data.ID,
+		)
+
+		if err != nil {
+			return nil, err
+		}
+
+		rowsAffected, err := res.RowsAffected()
+		if err != nil {
+			return nil, err
+		}
+
+		if rowsAffected <= 0 {
+			return nil, errors.New("update webhook delivery fails")
+		}
+
+		return nil, nil
+	})
+
+	return err
+}
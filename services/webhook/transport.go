@@ -0,0 +1,108 @@
+package webhook
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"net/url"
+	"syscall"
+	"time"
+)
+
+var (
+	errInsecureURL      = errors.New("webhook url must use https")
+	errForbiddenAddress = errors.New("webhook host resolves to a forbidden address")
+
+	// forbiddenNetworks are reachable from Stark but not from the clients
+	// owning the webhooks, on top of loopback, private and link-local ones
+	forbiddenNetworks = []*net.IPNet{
+		mustParseCIDR("0.0.0.0/8"),
+		mustParseCIDR("100.64.0.0/10"),
+		mustParseCIDR("192.0.0.0/24"),
+		mustParseCIDR("198.18.0.0/15"),
+		mustParseCIDR("240.0.0.0/4"),
+		mustParseCIDR("64:ff9b::/96"),
+	}
+)
+
+// NewHTTPClient returns a client that only connects to public addresses. The
+// address is checked after the host is resolved for each connection, so a
+// host rebinding to an internal address between requests is refused too.
+// Redirects aren't followed and no proxy is used, both would reach a host
+// other than the one checked.
+func NewHTTPClient(timeout time.Duration) *http.Client {
+	dialer := &net.Dialer{
+		Timeout: timeout,
+		Control: func(network, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+
+			ip := net.ParseIP(host)
+			if ip == nil || isForbiddenIP(ip) {
+				return errForbiddenAddress
+			}
+
+			return nil
+		},
+	}
+
+	return &http.Client{
+		Timeout: timeout,
+		Transport: &http.Transport{
+			DialContext:         dialer.DialContext,
+			TLSHandshakeTimeout: timeout,
+			MaxIdleConns:        100,
+			IdleConnTimeout:     90 * time.Second,
+		},
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+// CheckURL refuses webhooks stored before https was required
+func CheckURL(rawURL string) error {
+	parsed, err := url.Parse(rawURL)
+	if err != nil {
+		return err
+	}
+
+	if parsed.Scheme != "https" || parsed.Host == "" {
+		return errInsecureURL
+	}
+
+	return nil
+}
+
+// isForbiddenIP reports whether ip is loopback, private, link-local, which
+// covers the cloud metadata address, or otherwise not publicly routable
+func isForbiddenIP(ip net.IP) bool {
+	if ip.IsLoopback() ||
+		ip.IsPrivate() ||
+		ip.IsUnspecified() ||
+		ip.IsLinkLocalUnicast() ||
+		ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() ||
+		ip.IsMulticast() {
+		return true
+	}
+
+	for _, network := range forbiddenNetworks {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func mustParseCIDR(cidr string) *net.IPNet {
+	_, network, err := net.ParseCIDR(cidr)
+	if err != nil {
+		panic(err)
+	}
+
+	return network
+}
@@ -0,0 +1,53 @@
+package webhook
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+
+	"stark/database"
+)
+
+// ClientView is a webhook without its signing secret, the secret is only
+// shown once when the webhook is created.
+type ClientView struct {
+	ID        uuid.UUID           `json:"id"`
+	ClientID  string              `json:"client_id"`
+	URL       string              `json:"url"`
+	Events    database.StringList `json:"events"`
+	CreatedAt time.Time           `json:"created_at"`
+	UpdatedAt time.Time           `json:"updated_at"`
+}
+
+// SecretView is a webhook with its signing secret, for the create response
+type SecretView struct {
+	ClientView
+	Secret string `json:"secret"`
+}
+
+func (w *Webhook) ClientView() ClientView {
+	return ClientView{
+		ID:        w.ID,
+		ClientID:  w.ClientID,
+		URL:       w.URL,
+		Events:    w.Events,
+		CreatedAt: w.CreatedAt,
+		UpdatedAt: w.UpdatedAt,
+	}
+}
+
+func (w *Webhook) SecretView() SecretView {
+	return SecretView{
+		ClientView: w.ClientView(),
+		Secret:     w.Secret,
+	}
+}
+
+func ClientViews(items []*Webhook) []ClientView {
+	views := make([]ClientView, 0, len(items))
+	for _, item := range items {
+		views = append(views, item.ClientView())
+	}
+
+	return views
+}
@@ -13,6 +13,7 @@ const (
 	Action
 	ClientID
 	UserID
+	InternalID
 )
 
 func NewContext(action string) context.Context {
@@ -53,6 +54,15 @@ func GetUserID(ctx context.Context) (string, bool) {
 	return userID, ok
 }
 
+func WithInternalID(ctx context.Context, internalID string) context.Context {
+	return context.WithValue(ctx, InternalID, internalID)
+}
+
+func GetInternalID(ctx context.Context) (string, bool) {
+	internalID, ok := ctx.Value(InternalID).(string)
+	return internalID, ok
+}
+
 func GetFields(ctx context.Context) map[string]interface{} {
 	fields := make(map[string]interface{})
 
@@ -72,5 +82,9 @@ func GetFields(ctx context.Context) map[string]interface{} {
 		fields["user_id"] = userID
 	}
 
+	if internalID, ok := GetInternalID(ctx); ok {
+		fields["internal_id"] = internalID
+	}
+
 	return fields
 }
@@ -0,0 +1,25 @@
+package broker
+
+import "time"
+
+type Message struct {
+	ID        string    `json:"id"`
+	Topic     string    `json:"topic"`
+	Type      string    `json:"type"`
+	Key       string    `json:"key"`
+	Payload   []byte    `json:"payload"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Handler processes a message, returning an error leaves the message to be
+// delivered again. Delivery is at least once, so handlers must be idempotent
+// on Message.ID.
+type Handler func(msg Message) error
+
+type Broker interface {
+	Publish(msg Message) error
+	// Subscribe starts consuming the topic in the background, each message is
+	// handled by one subscriber of the group.
+	Subscribe(topic, group string, handler Handler) error
+	Close() error
+}
@@ -0,0 +1,44 @@
+package broker
+
+import "sync"
+
+// MemoryBroker hands messages to subscribers synchronously within the
+// process, meant for a single instance and for local development.
+type MemoryBroker struct {
+	mu       sync.RWMutex
+	handlers map[string]map[string]Handler
+}
+
+func NewMemoryBroker() *MemoryBroker {
+	return &MemoryBroker{handlers: make(map[string]map[string]Handler)}
+}
+
+func (b *MemoryBroker) Publish(msg Message) error {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	for _, handler := range b.handlers[msg.Topic] {
+		err := handler(msg)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (b *MemoryBroker) Subscribe(topic, group string, handler Handler) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.handlers[topic] == nil {
+		b.handlers[topic] = make(map[string]Handler)
+	}
+
+	b.handlers[topic][group] = handler
+	return nil
+}
+
+func (b *MemoryBroker) Close() error {
+	return nil
+}
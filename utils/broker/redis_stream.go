@@ -0,0 +1,129 @@
+package broker
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis"
+	"github.com/palantir/stacktrace"
+
+	"stark/database"
+	"stark/utils/activity"
+	"stark/utils/log"
+)
+
+const (
+	streamPrefix    = "events:"
+	streamMaxLen    = 100000
+	streamReadCount = 10
+	streamBlock     = 5 * time.Second
+)
+
+// RedisStreamBroker publishes every topic to its own Redis stream and uses
+// consumer groups so each group sees every message once.
+type RedisStreamBroker struct {
+	redisDB  *database.Redis
+	consumer string
+	done     chan struct{}
+}
+
+func NewRedisStreamBroker(redisDB *database.Redis) *RedisStreamBroker {
+	hostname, _ := os.Hostname()
+	return &RedisStreamBroker{
+		redisDB:  redisDB,
+		consumer: fmt.Sprintf("%s-%d", hostname, os.Getpid()),
+		done:     make(chan struct{}),
+	}
+}
+
+func (b *RedisStreamBroker) Publish(msg Message) error {
+	_, err := b.redisDB.XAdd(streamPrefix+msg.Topic, streamMaxLen, map[string]interface{}{
+		"id":         msg.ID,
+		"type":       msg.Type,
+		"key":        msg.Key,
+		"payload":    string(msg.Payload),
+		"created_at": msg.CreatedAt.UnixNano(),
+	})
+
+	return err
+}
+
+func (b *RedisStreamBroker) Subscribe(topic, group string, handler Handler) error {
+	stream := streamPrefix + topic
+	err := b.redisDB.XGroupCreate(stream, group)
+	if err != nil {
+		return err
+	}
+
+	go b.consume(topic, stream, group, handler)
+	return nil
+}
+
+func (b *RedisStreamBroker) Close() error {
+	close(b.done)
+	return nil
+}
+
+// consume first works through messages left pending by an earlier run of
+// this consumer, then follows new ones. Failed messages stay pending and are
+// picked up again after a restart.
+func (b *RedisStreamBroker) consume(topic, stream, group string, handler Handler) {
+	ctx := activity.NewContext("broker_consume")
+	history := true
+	start := "0"
+	for {
+		select {
+		case <-b.done:
+			return
+		default:
+		}
+
+		messages, err := b.redisDB.XReadGroup(stream, group, b.consumer, start, streamReadCount, streamBlock)
+		if err != nil {
+			log.WithContext(ctx).Error(stacktrace.Propagate(err, "read %s stream error", topic))
+			time.Sleep(streamBlock)
+			continue
+		}
+
+		if history {
+			if len(messages) == 0 {
+				history = false
+				start = ">"
+				continue
+			}
+
+			start = messages[len(messages)-1].ID
+		}
+
+		for _, item := range messages {
+			err = handler(toMessage(topic, item))
+			if err != nil {
+				log.WithContext(ctx).Error(stacktrace.Propagate(err, "handle %s message error", topic))
+				continue
+			}
+
+			err = b.redisDB.XAck(stream, group, item.ID)
+			if err != nil {
+				log.WithContext(ctx).Error(stacktrace.Propagate(err, "ack %s message error", topic))
+			}
+		}
+	}
+}
+
+func toMessage(topic string, item redis.XMessage) Message {
+	msg := Message{Topic: topic}
+	msg.ID, _ = item.Values["id"].(string)
+	msg.Type, _ = item.Values["type"].(string)
+	msg.Key, _ = item.Values["key"].(string)
+	payload, _ := item.Values["payload"].(string)
+	msg.Payload = []byte(payload)
+	createdAt, _ := item.Values["created_at"].(string)
+	nanos, err := strconv.ParseInt(createdAt, 10, 64)
+	if err == nil {
+		msg.CreatedAt = time.Unix(0, nanos)
+	}
+
+	return msg
+}
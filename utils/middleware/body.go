@@ -0,0 +1,59 @@
+package middleware
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"io"
+	"os"
+)
+
+// spoolMemoryLimit is the largest body kept in memory, a larger one goes to
+// a temporary file like an import file is spooled by its service
+const spoolMemoryLimit = 1 << 20
+
+// spoolBody reads body so it can be read again by the handler, hashing it on
+// the way. The returned body must be closed, which removes the temporary
+// file if one was made.
+func spoolBody(body io.Reader) (io.ReadCloser, []byte, error) {
+	hash := sha256.New()
+	var buffer bytes.Buffer
+	_, err := io.CopyN(io.MultiWriter(&buffer, hash), body, spoolMemoryLimit+1)
+	if err == io.EOF {
+		return io.NopCloser(&buffer), hash.Sum(nil), nil
+	}
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	file, err := os.CreateTemp("", "stark-body-*")
+	if err != nil {
+		return nil, nil, err
+	}
+
+	spooled := &spooledBody{file}
+	_, err = io.Copy(file, &buffer)
+	if err == nil {
+		_, err = io.Copy(io.MultiWriter(file, hash), body)
+	}
+
+	if err == nil {
+		_, err = file.Seek(0, io.SeekStart)
+	}
+
+	if err != nil {
+		spooled.Close()
+		return nil, nil, err
+	}
+
+	return spooled, hash.Sum(nil), nil
+}
+
+type spooledBody struct {
+	*os.File
+}
+
+func (b *spooledBody) Close() error {
+	b.File.Close()
+	return os.Remove(b.Name())
+}
@@ -0,0 +1,41 @@
+package middleware
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"io"
+	"os"
+	"testing"
+)
+
+func TestSpoolBodyKeepsBodyAndHash(t *testing.T) {
+	for _, size := range []int{0, spoolMemoryLimit, spoolMemoryLimit + 1, 3 * spoolMemoryLimit} {
+		data := bytes.Repeat([]byte("x"), size)
+		body, bodyHash, err := spoolBody(bytes.NewReader(data))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		read, err := io.ReadAll(body)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		expected := sha256.Sum256(data)
+		if !bytes.Equal(read, data) || !bytes.Equal(bodyHash, expected[:]) {
+			t.Errorf("size %d: body or hash changed while spooling", size)
+		}
+
+		spooled, ok := body.(*spooledBody)
+		if ok != (size > spoolMemoryLimit) {
+			t.Errorf("size %d: spooled to disk should be %v", size, size > spoolMemoryLimit)
+		}
+
+		body.Close()
+		if ok {
+			if _, err := os.Stat(spooled.Name()); !os.IsNotExist(err) {
+				t.Errorf("size %d: temporary file wasn't removed", size)
+			}
+		}
+	}
+}
@@ -1,14 +1,23 @@
 package middleware
 
 import (
+	"crypto/subtle"
+	"errors"
 	"net/http"
 	"os"
 	"stark/database"
+	"stark/failure"
 	"stark/respond"
 	"stark/services/client"
+	"stark/services/user"
 	"stark/utils"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/palantir/stacktrace"
 )
 
 func JSONMiddleware() gin.HandlerFunc {
@@ -18,12 +27,23 @@ func JSONMiddleware() gin.HandlerFunc {
 	}
 }
 
-func CORSMiddleware() gin.HandlerFunc {
+// CORSMiddleware echoes the request origin back only when some enabled client
+// allows it, ClientMiddleware then narrows it down to the calling client.
+func CORSMiddleware(clientService *client.Service) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		c.Header("Access-Control-Allow-Origin", "*")
-		c.Header("Access-Control-Allow-Credentials", "true")
-		c.Header("Access-Control-Allow-Headers", "Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization, accept, origin, Cache-Control, X-Requested-With")
-		c.Header("Access-Control-Allow-Methods", "POST,HEAD,PATCH, OPTIONS, GET, PUT")
+		c.Header("Vary", "Origin")
+		origin := c.Request.Header.Get("Origin")
+		if origin != "" {
+			allowed, err := clientService.IsAllowedOrigin(origin)
+			if err == nil && allowed {
+				c.Header("Access-Control-Allow-Origin", origin)
+				c.Header("Access-Control-Allow-Credentials", "true")
+			}
+		}
+
+		c.Header("Access-Control-Allow-Headers", "Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization, accept, origin, Cache-Control, X-Requested-With, X-Signature, X-Signature-Timestamp, X-Signature-Nonce, If-Match")
+		c.Header("Access-Control-Expose-Headers", "ETag")
+		c.Header("Access-Control-Allow-Methods", "POST,HEAD,PATCH, OPTIONS, GET, PUT, DELETE")
 
 		if c.Request.Method == "OPTIONS" {
 			c.AbortWithStatus(204)
@@ -37,16 +57,40 @@ func CORSMiddleware() gin.HandlerFunc {
 func InternalMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		internalID := c.Request.Header.Get("X-Internal-ID")
-		if internalID != os.Getenv("INTERNAL_ID") {
+		identity, ok := internalIdentity(internalID)
+		if !ok {
 			c.Abort()
 			respond.Error(c, "", http.StatusBadRequest, "BadRequest", "Internal ID is invalid")
 			return
 		}
 
+		c.Set("internal_id", identity)
 		c.Next()
 	}
 }
 
+// internalIdentity resolves an X-Internal-ID secret to the name of its owner.
+// INTERNAL_IDS holds comma separated name:secret pairs, the legacy INTERNAL_ID
+// secret is still accepted under the name "internal".
+func internalIdentity(internalID string) (string, bool) {
+	if internalID == "" {
+		return "", false
+	}
+
+	for _, pair := range strings.Split(os.Getenv("INTERNAL_IDS"), ",") {
+		name, secret, found := strings.Cut(strings.TrimSpace(pair), ":")
+		if found && secret != "" && subtle.ConstantTimeCompare([]byte(secret), []byte(internalID)) == 1 {
+			return name, true
+		}
+	}
+
+	if subtle.ConstantTimeCompare([]byte(os.Getenv("INTERNAL_ID")), []byte(internalID)) == 1 {
+		return "internal", true
+	}
+
+	return "", false
+}
+
 func ClientMiddleware(clientService *client.Service) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		bearerToken := c.Request.Header.Get("Authorization")
@@ -57,23 +101,147 @@ func ClientMiddleware(clientService *client.Service) gin.HandlerFunc {
 			return
 		}
 
-		filter := client.Filter{
-			BearerKeys: []string{bearerKey},
+		client, err := clientService.FindByBearerKey(bearerKey)
+		if err != nil || client == nil {
+			c.Abort()
+			respond.Error(c, "", http.StatusUnauthorized, "Unauthorized", "Client not found")
+			return
 		}
 
-		client, err := clientService.FindAllByFilter(filter)
-		if err != nil || len(client) == 0 {
+		if !client.IsEnabled() {
 			c.Abort()
-			respond.Error(c, "", http.StatusUnauthorized, "Unauthorized", "Client not found")
+			respond.Error(c, "", http.StatusForbidden, failure.CodeClientDisabled, "Client is disabled")
+			return
+		}
+
+		if !client.AllowsIP(c.ClientIP()) {
+			c.Abort()
+			respond.Error(c, "", http.StatusForbidden, failure.CodeIPNotAllowed, "IP address is not allowed")
 			return
 		}
 
-		c.Set("client_id", client[0].ID.String())
+		origin := c.Request.Header.Get("Origin")
+		if origin != "" && !client.AllowsOrigin(origin) {
+			c.Abort()
+			respond.Error(c, "", http.StatusForbidden, failure.CodeOriginNotAllowed, "Origin is not allowed")
+			return
+		}
+
+		redirectURI := c.Query("redirect_uri")
+		if redirectURI != "" && !client.AllowsRedirectURI(redirectURI) {
+			c.Abort()
+			respond.Error(c, "", http.StatusForbidden, failure.CodeRedirectURINotAllowed, "Redirect URI is not allowed")
+			return
+		}
+
+		c.Set("client_id", client.ID.String())
+		c.Set("client", client)
+		c.Next()
+	}
+}
+
+// IfMatchMiddleware requires the ETag of the resource being written in the
+// If-Match header and keeps the parsed row version as "version".
+func IfMatchMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ifMatch := c.Request.Header.Get("If-Match")
+		if ifMatch == "" {
+			c.Abort()
+			respond.Error(c, "", http.StatusPreconditionRequired, failure.CodeVersionRequired, "If-Match header with the current ETag is required")
+			return
+		}
+
+		version, err := utils.ParseIfMatch(ifMatch)
+		if err != nil {
+			c.Abort()
+			respond.Error(c, "", http.StatusBadRequest, respond.ErrBadRequest, "If-Match header is invalid, "+err.Error())
+			return
+		}
+
+		c.Set("version", version)
 		c.Next()
 	}
 }
 
-func AuthMiddleware(redisDB *database.Redis) gin.HandlerFunc {
+// SignatureMiddleware verifies HMAC signed client requests. Signing is
+// optional unless the client requires it, but a signature that is sent is
+// always checked. Must run after ClientMiddleware.
+func SignatureMiddleware(redisDB *database.Redis) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		item := c.Value("client").(*client.Client)
+		signature := c.Request.Header.Get("X-Signature")
+		if signature == "" {
+			if item.RequireSignature {
+				c.Abort()
+				respond.Error(c, "", http.StatusUnauthorized, failure.CodeSignatureRequired, "Request signature is required")
+				return
+			}
+
+			c.Next()
+			return
+		}
+
+		timestamp := c.Request.Header.Get("X-Signature-Timestamp")
+		nonce := c.Request.Header.Get("X-Signature-Nonce")
+		unix, err := strconv.ParseInt(timestamp, 10, 64)
+		if err != nil || nonce == "" {
+			c.Abort()
+			respond.Error(c, "", http.StatusUnauthorized, failure.CodeInvalidSignature, "Signature timestamp and nonce are required")
+			return
+		}
+
+		skew := utils.GetDurationEnv("SIGNATURE_CLOCK_SKEW", 5*time.Minute)
+		signedAt := time.Unix(unix, 0)
+		if time.Since(signedAt) > skew || time.Until(signedAt) > skew {
+			c.Abort()
+			respond.Error(c, "", http.StatusUnauthorized, failure.CodeSignatureExpired, "Request signature is expired")
+			return
+		}
+
+		// The body is read before the handler sees it, so it's bounded here.
+		// The limit has to fit the largest signed route, the import file.
+		limit := int64(utils.GetIntEnv("SIGNATURE_MAX_BODY_SIZE", 32<<20))
+		body, bodyHash, err := spoolBody(http.MaxBytesReader(c.Writer, c.Request.Body, limit))
+		if err != nil {
+			var maxBytesError *http.MaxBytesError
+			if errors.As(err, &maxBytesError) {
+				c.Abort()
+				respond.Error(c, "", http.StatusRequestEntityTooLarge, respond.ErrBadRequest, "Request body is too large")
+				return
+			}
+
+			c.Abort()
+			respond.Error(c, "", http.StatusBadRequest, respond.ErrBadRequest, "Can't read request body")
+			return
+		}
+
+		defer body.Close()
+		c.Request.Body = body
+		if !item.VerifySignature(c.Request.Method, c.Request.URL.RequestURI(), bodyHash, timestamp, nonce, signature) {
+			c.Abort()
+			respond.Error(c, "", http.StatusUnauthorized, failure.CodeInvalidSignature, "Request signature is invalid")
+			return
+		}
+
+		// A nonce only has to be remembered while its timestamp is inside the window
+		fresh, err := redisDB.SetNX("signature_nonce:"+item.ID.String()+":"+nonce, timestamp, 2*skew)
+		if err != nil {
+			c.Abort()
+			respond.Error(c, "", http.StatusInternalServerError, respond.ErrInternal, "Can't verify request nonce")
+			return
+		}
+
+		if !fresh {
+			c.Abort()
+			respond.Error(c, "", http.StatusUnauthorized, failure.CodeSignatureReplayed, "Request nonce was already used")
+			return
+		}
+
+		c.Next()
+	}
+}
+
+func AuthMiddleware(redisDB *database.Redis, userService *user.Service) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		bearerToken := c.Request.Header.Get("Authorization")
 		bearerKey, err := utils.GetBearerKey(bearerToken)
@@ -97,6 +265,38 @@ func AuthMiddleware(redisDB *database.Redis) gin.HandlerFunc {
 			return
 		}
 
+		id, err := uuid.Parse(userID)
+		if err != nil {
+			c.Abort()
+			respond.Error(c, "", http.StatusUnauthorized, "Unauthorized", "invalid user id")
+			return
+		}
+
+		item, err := userService.FindByID(id)
+		if err != nil {
+			c.Abort()
+			respond.Error(c, "", http.StatusUnauthorized, "Unauthorized", "user not found")
+			return
+		}
+
+		err = userService.CheckStatus(item)
+		if err != nil {
+			c.Abort()
+			if f, ok := stacktrace.RootCause(err).(failure.Failure); ok {
+				respond.Error(c, "", http.StatusForbidden, f.Code, f.Desc)
+				return
+			}
+
+			respond.Error(c, "", http.StatusForbidden, "Forbidden", err.Error())
+			return
+		}
+
+		if (metadata.Restricted || item.MustChangePassword) && c.FullPath() != "/api/change-password" {
+			c.Abort()
+			respond.Error(c, "", http.StatusForbidden, failure.CodePasswordChangeRequired, "password change required, change your password first")
+			return
+		}
+
 		c.Set("access_uuid", metadata.AccessUuid)
 		c.Set("user_id", userID)
 		c.Next()
@@ -0,0 +1,159 @@
+package storage
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"stark/respond"
+)
+
+const (
+	visibilityPublic  = "public"
+	visibilityPrivate = "private"
+)
+
+// LocalStorage keeps objects on the filesystem under a public and a private
+// directory, HandleGet serves them under /storage.
+type LocalStorage struct {
+	dir     string
+	baseURL string
+	secret  []byte
+}
+
+func NewLocalStorage(dir, baseURL, secret string) (*LocalStorage, error) {
+	if dir == "" {
+		dir = filepath.Join(os.TempDir(), "stark-storage")
+	}
+
+	if secret == "" {
+		return nil, errors.New("STORAGE_SIGNING_SECRET is required by the local storage")
+	}
+
+	return &LocalStorage{
+		dir:     dir,
+		baseURL: strings.TrimSuffix(baseURL, "/"),
+		secret:  []byte(secret),
+	}, nil
+}
+
+func (s *LocalStorage) Put(key string, body io.Reader, size int64, contentType string, public bool) error {
+	key, err := CleanKey(key)
+	if err != nil {
+		return err
+	}
+
+	visibility := visibilityPrivate
+	if public {
+		visibility = visibilityPublic
+	}
+
+	target := s.path(visibility, key)
+	err = os.MkdirAll(filepath.Dir(target), 0700)
+	if err != nil {
+		return err
+	}
+
+	// Written next to the target and renamed so readers never see half a file
+	file, err := os.CreateTemp(filepath.Dir(target), ".upload-*")
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(file, body)
+	closeErr := file.Close()
+	if err == nil {
+		err = closeErr
+	}
+
+	if err != nil {
+		os.Remove(file.Name())
+		return err
+	}
+
+	return os.Rename(file.Name(), target)
+}
+
+func (s *LocalStorage) Delete(key string) error {
+	key, err := CleanKey(key)
+	if err != nil {
+		return err
+	}
+
+	for _, visibility := range []string{visibilityPublic, visibilityPrivate} {
+		err := os.Remove(s.path(visibility, key))
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *LocalStorage) URL(key string) string {
+	return s.baseURL + "/storage/" + visibilityPublic + "/" + key
+}
+
+func (s *LocalStorage) SignedURL(key string, ttl time.Duration) (string, error) {
+	key, err := CleanKey(key)
+	if err != nil {
+		return "", err
+	}
+
+	expires := strconv.FormatInt(time.Now().Add(ttl).Unix(), 10)
+	query := url.Values{}
+	query.Set("expires", expires)
+	query.Set("signature", s.sign(key, expires))
+	return s.baseURL + "/storage/" + visibilityPrivate + "/" + key + "?" + query.Encode(), nil
+}
+
+// HandleGet serves an object, a private one only with an unexpired signature
+// from SignedURL.
+func (s *LocalStorage) HandleGet(c *gin.Context) {
+	visibility := c.Param("visibility")
+	key, err := CleanKey(strings.TrimPrefix(c.Param("key"), "/"))
+	if err != nil || (visibility != visibilityPublic && visibility != visibilityPrivate) {
+		respond.Error(c, "", http.StatusNotFound, respond.ErrBadRequest, "file not found")
+		return
+	}
+
+	if visibility == visibilityPrivate {
+		expires := c.Query("expires")
+		unix, err := strconv.ParseInt(expires, 10, 64)
+		if err != nil || time.Now().Unix() > unix || !hmac.Equal([]byte(c.Query("signature")), []byte(s.sign(key, expires))) {
+			respond.Error(c, "", http.StatusForbidden, respond.ErrBadRequest, "invalid or expired signature")
+			return
+		}
+
+		c.Header("Cache-Control", "private, no-store")
+	}
+
+	target := s.path(visibility, key)
+	if _, err := os.Stat(target); err != nil {
+		respond.Error(c, "", http.StatusNotFound, respond.ErrBadRequest, "file not found")
+		return
+	}
+
+	c.File(target)
+}
+
+func (s *LocalStorage) path(visibility, key string) string {
+	return filepath.Join(s.dir, visibility, filepath.FromSlash(key))
+}
+
+func (s *LocalStorage) sign(key, expires string) string {
+	mac := hmac.New(sha256.New, s.secret)
+	mac.Write([]byte(key + "\n" + expires))
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,245 @@
+package storage
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	s3Algorithm       = "AWS4-HMAC-SHA256"
+	s3Service         = "s3"
+	s3UnsignedPayload = "UNSIGNED-PAYLOAD"
+	s3TimeFormat      = "20060102T150405Z"
+	s3DateFormat      = "20060102"
+
+	// Longest expiry S3 accepts for a presigned URL
+	s3MaxExpiry = 7 * 24 * time.Hour
+)
+
+// S3Storage keeps objects in a bucket of an S3-compatible service, addressed
+// path-style so MinIO and the like work without DNS per bucket. Requests are
+// signed with AWS Signature Version 4.
+type S3Storage struct {
+	endpoint  *url.URL
+	region    string
+	bucket    string
+	accessKey string
+	secretKey string
+	publicURL string
+	client    *http.Client
+}
+
+// NewS3Storage builds the backend, publicURL is where public objects are read
+// from and defaults to the bucket on the endpoint.
+func NewS3Storage(endpoint, region, bucket, accessKey, secretKey, publicURL string) (*S3Storage, error) {
+	parsed, err := url.Parse(endpoint)
+	if err != nil || parsed.Scheme == "" || parsed.Host == "" {
+		return nil, errors.New("S3_ENDPOINT should be an absolute url")
+	}
+
+	if bucket == "" || accessKey == "" || secretKey == "" {
+		return nil, errors.New("S3_BUCKET, S3_ACCESS_KEY and S3_SECRET_KEY are required by the s3 storage")
+	}
+
+	if region == "" {
+		region = "us-east-1"
+	}
+
+	if publicURL == "" {
+		publicURL = strings.TrimSuffix(endpoint, "/") + "/" + bucket
+	}
+
+	return &S3Storage{
+		endpoint:  parsed,
+		region:    region,
+		bucket:    bucket,
+		accessKey: accessKey,
+		secretKey: secretKey,
+		publicURL: strings.TrimSuffix(publicURL, "/"),
+		client:    &http.Client{Timeout: time.Minute},
+	}, nil
+}
+
+func (s *S3Storage) Put(key string, body io.Reader, size int64, contentType string, public bool) error {
+	key, err := CleanKey(key)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPut, s.objectURL(key), body)
+	if err != nil {
+		return err
+	}
+
+	req.ContentLength = size
+	req.Header.Set("Content-Type", contentType)
+	if public {
+		req.Header.Set("X-Amz-Acl", "public-read")
+	}
+
+	return s.do(req)
+}
+
+func (s *S3Storage) Delete(key string) error {
+	key, err := CleanKey(key)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodDelete, s.objectURL(key), nil)
+	if err != nil {
+		return err
+	}
+
+	return s.do(req)
+}
+
+func (s *S3Storage) URL(key string) string {
+	return s.publicURL + "/" + escapePath(key)
+}
+
+// SignedURL presigns a GET of the object, ttl is capped at the seven days S3
+// allows.
+func (s *S3Storage) SignedURL(key string, ttl time.Duration) (string, error) {
+	key, err := CleanKey(key)
+	if err != nil {
+		return "", err
+	}
+
+	if ttl > s3MaxExpiry {
+		ttl = s3MaxExpiry
+	}
+
+	now := time.Now().UTC()
+	target, err := url.Parse(s.objectURL(key))
+	if err != nil {
+		return "", err
+	}
+
+	query := url.Values{}
+	query.Set("X-Amz-Algorithm", s3Algorithm)
+	query.Set("X-Amz-Credential", s.accessKey+"/"+s.scope(now))
+	query.Set("X-Amz-Date", now.Format(s3TimeFormat))
+	query.Set("X-Amz-Expires", strconv.Itoa(int(ttl.Seconds())))
+	query.Set("X-Amz-SignedHeaders", "host")
+	target.RawQuery = canonicalQuery(query)
+
+	request := canonicalRequest(http.MethodGet, target, http.Header{}, []string{"host"}, s3UnsignedPayload)
+	query.Set("X-Amz-Signature", s.signature(now, request))
+	target.RawQuery = canonicalQuery(query)
+	return target.String(), nil
+}
+
+// do signs the request with the payload left unsigned, which S3 accepts for
+// the content is checked by the length, and fails on any non 2xx status
+func (s *S3Storage) do(req *http.Request) error {
+	now := time.Now().UTC()
+	req.Header.Set("X-Amz-Date", now.Format(s3TimeFormat))
+	req.Header.Set("X-Amz-Content-Sha256", s3UnsignedPayload)
+
+	signed := []string{"host"}
+	for name := range req.Header {
+		signed = append(signed, strings.ToLower(name))
+	}
+
+	sort.Strings(signed)
+	request := canonicalRequest(req.Method, req.URL, req.Header, signed, s3UnsignedPayload)
+	req.Header.Set("Authorization", fmt.Sprintf(
+		"%s Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s3Algorithm,
+		s.accessKey,
+		s.scope(now),
+		strings.Join(signed, ";"),
+		s.signature(now, request),
+	))
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("s3 %s %s responded %d: %s", req.Method, req.URL.Path, resp.StatusCode, message)
+	}
+
+	return nil
+}
+
+func (s *S3Storage) objectURL(key string) string {
+	return strings.TrimSuffix(s.endpoint.String(), "/") + "/" + s.bucket + "/" + escapePath(key)
+}
+
+func (s *S3Storage) scope(now time.Time) string {
+	return now.Format(s3DateFormat) + "/" + s.region + "/" + s3Service + "/aws4_request"
+}
+
+func (s *S3Storage) signature(now time.Time, request string) string {
+	hash := sha256.Sum256([]byte(request))
+	stringToSign := strings.Join([]string{
+		s3Algorithm,
+		now.Format(s3TimeFormat),
+		s.scope(now),
+		hex.EncodeToString(hash[:]),
+	}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+s.secretKey), now.Format(s3DateFormat))
+	key = hmacSHA256(key, s.region)
+	key = hmacSHA256(key, s3Service)
+	key = hmacSHA256(key, "aws4_request")
+	return hex.EncodeToString(hmacSHA256(key, stringToSign))
+}
+
+func canonicalRequest(method string, target *url.URL, header http.Header, signed []string, payloadHash string) string {
+	headers := make([]string, 0, len(signed))
+	for _, name := range signed {
+		value := header.Get(name)
+		if name == "host" {
+			value = target.Host
+		}
+
+		headers = append(headers, name+":"+strings.TrimSpace(value)+"\n")
+	}
+
+	return strings.Join([]string{
+		method,
+		target.EscapedPath(),
+		target.RawQuery,
+		strings.Join(headers, ""),
+		strings.Join(signed, ";"),
+		payloadHash,
+	}, "\n")
+}
+
+// canonicalQuery encodes the query sorted by name with spaces as %20, which
+// is what Signature Version 4 signs
+func canonicalQuery(query url.Values) string {
+	return strings.ReplaceAll(query.Encode(), "+", "%20")
+}
+
+// escapePath escapes every segment of the key but keeps the slashes
+func escapePath(key string) string {
+	segments := strings.Split(key, "/")
+	for i, segment := range segments {
+		segments[i] = url.PathEscape(segment)
+	}
+
+	return strings.Join(segments, "/")
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
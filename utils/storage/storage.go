@@ -0,0 +1,61 @@
+package storage
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path"
+	"strings"
+	"time"
+)
+
+const (
+	DriverLocal = "local"
+	DriverS3    = "s3"
+)
+
+var ErrInvalidKey = errors.New("invalid storage key")
+
+// Storage keeps uploaded files, a public object is read through URL and a
+// private one only through a SignedURL that expires.
+type Storage interface {
+	Put(key string, body io.Reader, size int64, contentType string, public bool) error
+	Delete(key string) error
+	URL(key string) string
+	SignedURL(key string, ttl time.Duration) (string, error)
+}
+
+// New returns the backend picked by STORAGE_DRIVER, the local filesystem
+// when it isn't set.
+func New() (Storage, error) {
+	switch os.Getenv("STORAGE_DRIVER") {
+	case DriverS3:
+		return NewS3Storage(
+			os.Getenv("S3_ENDPOINT"),
+			os.Getenv("S3_REGION"),
+			os.Getenv("S3_BUCKET"),
+			os.Getenv("S3_ACCESS_KEY"),
+			os.Getenv("S3_SECRET_KEY"),
+			os.Getenv("S3_PUBLIC_URL"),
+		)
+	case DriverLocal, "":
+		return NewLocalStorage(
+			os.Getenv("STORAGE_DIR"),
+			os.Getenv("STORAGE_BASE_URL"),
+			os.Getenv("STORAGE_SIGNING_SECRET"),
+		)
+	}
+
+	return nil, errors.New("unknown storage driver " + os.Getenv("STORAGE_DRIVER"))
+}
+
+// CleanKey rejects keys that are empty, absolute or climb out of the storage
+// root, the same key has to be safe as a file path and an object name.
+func CleanKey(key string) (string, error) {
+	cleaned := path.Clean(key)
+	if key == "" || cleaned != key || path.IsAbs(cleaned) || cleaned == ".." || strings.HasPrefix(cleaned, "../") {
+		return "", ErrInvalidKey
+	}
+
+	return cleaned, nil
+}
@@ -1,15 +1,19 @@
 package utils
 
 import (
+	"bytes"
 	"crypto/rand"
 	"encoding/hex"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"math"
 	"net/mail"
 	"net/smtp"
 	"os"
+	"reflect"
 	"regexp"
+	"sort"
 	"stark/database"
 	"strconv"
 	"strings"
@@ -25,6 +29,7 @@ import (
 type AccessDetails struct {
 	AccessUuid string
 	UserID     string
+	Restricted bool
 }
 
 type TokenDetail struct {
@@ -69,6 +74,24 @@ func GetJSONConfig() string {
   	}`
 }
 
+func GetDurationEnv(key string, fallback time.Duration) time.Duration {
+	duration, err := time.ParseDuration(os.Getenv(key))
+	if err != nil {
+		return fallback
+	}
+
+	return duration
+}
+
+func GetIntEnv(key string, fallback int) int {
+	value, err := strconv.Atoi(os.Getenv(key))
+	if err != nil {
+		return fallback
+	}
+
+	return value
+}
+
 func IsInList(list []string, s string) bool {
 	for _, str := range list {
 		if str == s {
@@ -104,6 +127,13 @@ func CheckPasswordHash(password, hash string) bool {
 	return err == nil
 }
 
+// IsPasswordHash reports whether hash is a bcrypt hash CheckPasswordHash can
+// verify
+func IsPasswordHash(hash string) bool {
+	_, err := bcrypt.Cost([]byte(hash))
+	return err == nil
+}
+
 func GenerateSecureToken(length int) string {
 	b := make([]byte, length)
 	if _, err := rand.Read(b); err != nil {
@@ -121,7 +151,9 @@ func GetBearerKey(bearerToken string) (string, error) {
 	return strArr[1], nil
 }
 
-func CreateToken(user_id string) (*TokenDetail, error) {
+// CreateToken issues an access and refresh token pair, a restricted access
+// token only grants the user to change password.
+func CreateToken(user_id string, restricted bool) (*TokenDetail, error) {
 	tokenDetail := &TokenDetail{}
 	tokenDetail.AccessExpires = time.Now().Add(time.Hour * 24 * 30).Unix()
 	tokenDetail.AccessUuid = uuid.NewV4().String()
@@ -135,6 +167,7 @@ func CreateToken(user_id string) (*TokenDetail, error) {
 	accessClaims["authorized"] = true
 	accessClaims["access_uuid"] = tokenDetail.AccessUuid
 	accessClaims["user_id"] = user_id
+	accessClaims["restricted"] = restricted
 	accessClaims["exp"] = tokenDetail.AccessExpires
 	accessToken := jwt.NewWithClaims(jwt.SigningMethodHS256, accessClaims)
 	tokenDetail.AccessToken, err = accessToken.SignedString([]byte(os.Getenv("ACCESS_SECRET")))
@@ -176,9 +209,12 @@ func ExtractAccessTokenMetadata(bearerToken string) (*AccessDetails, error) {
 			return nil, err
 		}
 
+		restricted, _ := claims["restricted"].(bool)
+
 		return &AccessDetails{
 			AccessUuid: accessUuid,
 			UserID:     fmt.Sprintf("%s", claims["user_id"]),
+			Restricted: restricted,
 		}, nil
 	}
 
@@ -250,11 +286,81 @@ func GetErrorMessage(validationError validator.FieldError) string {
 		return "should be less than " + validationError.Param()
 	case "gte":
 		return "should be greater than " + validationError.Param()
+	case "min":
+		if validationError.Kind() == reflect.Slice {
+			return "should have at least " + validationError.Param() + " items"
+		}
+
+		return "should be at least " + validationError.Param() + " characters"
+	case "max":
+		if validationError.Kind() == reflect.Slice {
+			return "should have at most " + validationError.Param() + " items"
+		}
+
+		return "should be at most " + validationError.Param() + " characters"
+	case "uuid":
+		return "this field must be a uuid"
+	case "oneof":
+		return "should be one of " + validationError.Param()
+	case "required_without":
+		return "this field is required without " + ToSnakeCase(validationError.Param())
+	case "excluded_with":
+		return "cannot be given together with " + ToSnakeCase(validationError.Param())
+	case "required_if":
+		field, value, _ := strings.Cut(validationError.Param(), " ")
+		return "this field is required when " + ToSnakeCase(field) + " is " + value
+	case "numeric":
+		return "this field must be numeric"
+	case "len":
+		return "should be exactly " + validationError.Param() + " characters"
+	case "url":
+		return "this field must be a url"
+	case "startswith":
+		return "should start with " + validationError.Param()
 	}
 
 	return "unknown error"
 }
 
+// NullFields returns the members of a JSON Merge Patch (RFC 7396) document
+// that are null, a merge patch uses null to remove a field.
+func NullFields(fields map[string]json.RawMessage) []string {
+	nulls := make([]string, 0)
+	for field, value := range fields {
+		if string(bytes.TrimSpace(value)) == "null" {
+			nulls = append(nulls, field)
+		}
+	}
+
+	sort.Strings(nulls)
+	return nulls
+}
+
+// FormatETag returns the strong entity tag of a row version
+func FormatETag(version int) string {
+	return strconv.Quote(strconv.Itoa(version))
+}
+
+// ParseIfMatch returns the row version in an If-Match header, "*" matches any
+// version and is returned as 0.
+func ParseIfMatch(value string) (int, error) {
+	value = strings.TrimSpace(value)
+	if value == "*" {
+		return 0, nil
+	}
+
+	if len(value) < 2 || value[0] != '"' || value[len(value)-1] != '"' {
+		return 0, errors.New("if-match should be a quoted entity tag")
+	}
+
+	version, err := strconv.Atoi(value[1 : len(value)-1])
+	if err != nil || version <= 0 {
+		return 0, errors.New("if-match entity tag is not a version")
+	}
+
+	return version, nil
+}
+
 var matchFirstCap = regexp.MustCompile("(.)([A-Z][a-z]+)")
 var matchAllCap = regexp.MustCompile("([a-z0-9])([A-Z])")
 